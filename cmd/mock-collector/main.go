@@ -0,0 +1,38 @@
+// Command mock-collector runs a minimal OTLP/HTTP trace receiver that prints the spans it gets.
+// Point the proxy at it with OTEL_TRACES_EXPORTER=otlp and OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318.
+// Never use it outside development.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"smart-proxy/internal/tracing/collector"
+)
+
+func main() {
+	addr := flag.String("addr", ":4318", "listen address")
+	flag.Parse()
+
+	c := collector.New()
+	c.OnExport = func(spans []collector.Span) {
+		for _, s := range spans {
+			log.Printf("%s %s trace=%s span=%s parent=%s duration=%s status=%d %s",
+				s.Service, s.Name, s.TraceID, s.SpanID, s.ParentSpanID, duration(s), s.Status.Code, s.Status.Message)
+		}
+	}
+
+	log.Printf("Mock OTLP collector listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, c.Handler()); err != nil {
+		log.Fatalf("Mock collector failed: %v", err)
+	}
+}
+
+func duration(s collector.Span) time.Duration {
+	start, _ := strconv.ParseInt(s.StartTimeUnixNano, 10, 64)
+	end, _ := strconv.ParseInt(s.EndTimeUnixNano, 10, 64)
+	return time.Duration(end - start)
+}
@@ -0,0 +1,28 @@
+// Command mock-idp runs a throwaway OpenID Connect provider for trying OIDC
+// authentication of the admin API locally. Never use it outside development.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"smart-proxy/internal/auth/mockidp"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL advertised in tokens")
+	flag.Parse()
+
+	idp, err := mockidp.New(*issuer)
+	if err != nil {
+		log.Fatalf("Failed to create IdP: %v", err)
+	}
+
+	log.Printf("Mock IdP listening on %s (issuer %s)", *addr, *issuer)
+	log.Printf("Get a token with: curl '%s/token?sub=alice&groups=admins&aud=smart-proxy'", *issuer)
+	if err := http.ListenAndServe(*addr, idp.Handler()); err != nil {
+		log.Fatalf("Mock IdP failed: %v", err)
+	}
+}
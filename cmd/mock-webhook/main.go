@@ -0,0 +1,30 @@
+// Command mock-webhook runs a minimal notification receiver that prints the events it gets.
+// Point a notification target at it, e.g. {"url": "http://localhost:9000/hook", "secret": "dev"} in
+// NOTIFY_TARGETS_FILE, and start it with -secret dev. Never use it outside development.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"smart-proxy/internal/notify/receiver"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	secret := flag.String("secret", "", "HMAC secret; if set, unsigned requests are rejected")
+	fail := flag.Int("fail", 0, "fail the first N requests with 503 to exercise retries")
+	flag.Parse()
+
+	rc := receiver.New(*secret)
+	rc.FailNext(*fail, http.StatusServiceUnavailable)
+	rc.OnReceive = func(n receiver.Notification) {
+		log.Printf("%s delivery=%s signed=%t %s", n.Event, n.Delivery, n.Signed, n.Body)
+	}
+
+	log.Printf("Mock webhook receiver listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, rc.Handler()); err != nil {
+		log.Fatalf("Mock webhook receiver failed: %v", err)
+	}
+}
@@ -1,27 +1,54 @@
 package main
 
 import (
-	"log"
 	"net/http"
 	"os"
 
+	"smart-proxy/internal/accesslog"
 	"smart-proxy/internal/admin"
+	"smart-proxy/internal/audit"
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/events"
 	"smart-proxy/internal/k8s"
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/notify"
 	"smart-proxy/internal/proxy"
+	"smart-proxy/internal/savings"
 	"smart-proxy/internal/store"
+	"smart-proxy/internal/stream"
+	"smart-proxy/internal/timeseries"
+	"smart-proxy/internal/tracing"
 	"smart-proxy/internal/watcher"
-	// "smart-proxy/internal/watcher"
+	"smart-proxy/internal/webhook"
+
+	"k8s.io/client-go/kubernetes"
 )
 
+var log = logger.Component("server")
+
 func main() {
-	log.Println("Starting OpenShift Smart Proxy...")
+	log.Info("Starting OpenShift Smart Proxy...")
+
+	// 0. Initialize Tracing (optional, configured with the standard OTEL_* variables)
+	shutdownTracing, err := tracing.InitFromEnv()
+	if err != nil {
+		fatal("Invalid tracing configuration", err)
+	}
+	if shutdownTracing != nil {
+		defer shutdownTracing()
+		log.Info("Tracing enabled", "exporter", os.Getenv("OTEL_TRACES_EXPORTER"))
+	}
 
 	// 1. Initialize K8s Client
 	k8sClient, err := k8s.NewClient()
 	if err != nil {
-		log.Printf("Warning: Failed to initialize Kubernetes client: %v", err)
-		log.Println("Running in offline/demo mode (K8s features disabled)")
+		log.Warn("Failed to initialize Kubernetes client", "error", err)
+		log.Warn("Running in offline/demo mode (K8s features disabled)")
 		// In a real app we might want to exit, but for dev we might want to continue
+	} else {
+		log.Info("Namespace mode", "mode", k8sClient.Scope.Mode)
+		k8sClient.StartInformers()
+		defer k8sClient.Close()
 	}
 
 	// 2. Initialize Config Store
@@ -32,26 +59,131 @@ func main() {
 	}
 	configStore := store.NewStore(configPath)
 
+	// Live route events for /api/events
+	eventStream := stream.NewHub()
+	configStore.OnChange(func(change store.Change, route store.RouteConfig) {
+		eventStream.Publish("route."+string(change), route.ID, route.Namespace, route)
+	})
+
+	// Kubernetes Events on Deployments and patched Ingresses/Routes (none in offline mode)
+	eventRecorder := events.NewRecorder(k8sClient)
+	defer eventRecorder.Shutdown()
+
+	// Webhook notifications (global targets from NOTIFY_TARGETS_FILE, per-route targets from the route config)
+	var secrets func(namespace, name string) (map[string][]byte, error)
+	if k8sClient != nil {
+		secrets = k8sClient.GetSecret
+	}
+	notifier, err := notify.FromEnv(secrets)
+	if err != nil {
+		fatal("Invalid notification configuration", err)
+	}
+	defer notifier.Close()
+
+	// Sleep/wake intervals for the savings report
+	savingsTracker, err := savings.FromEnv()
+	if err != nil {
+		fatal("Invalid savings configuration", err)
+	}
+
+	// Per-route traffic history for the dashboard
+	traffic, err := timeseries.FromEnv()
+	if err != nil {
+		fatal("Invalid time series configuration", err)
+	}
+	defer traffic.Close()
+
+	// Audit trail of manual operations (route modes, manual stops)
+	auditLog, err := audit.FromEnv()
+	if err != nil {
+		fatal("Invalid audit log configuration", err)
+	}
+	defer auditLog.Close()
+
 	// 3. Initialize Proxy Handler
 	proxyHandler := proxy.NewHandler(k8sClient, configStore)
+	proxyHandler.Events = eventRecorder
+	proxyHandler.Notifier = notifier
+	proxyHandler.Savings = savingsTracker
+	proxyHandler.Traffic = traffic
+	traffic.Start(proxyHandler.RouteStates)
+	proxyHandler.Stream = eventStream
+	go proxyHandler.WatchStates()
+	accessLog, err := accesslog.FromEnv()
+	if err != nil {
+		fatal("Invalid access log configuration", err)
+	}
+	if accessLog != nil {
+		defer accessLog.Close()
+		proxyHandler.AccessLog = accessLog
+	}
 
 	// 4. Initialize Watcher (Auto-scaler)
 	watcherService := watcher.NewWatcher(k8sClient, configStore)
+	watcherService.Events = eventRecorder
+	watcherService.Notifier = notifier
+	watcherService.Savings = savingsTracker
+	watcherService.Audit = auditLog
 	go watcherService.Start()
 
 	// 5. Start Admin Server (Port 8081)
-	// 5. Start Admin Server (Port 8081)
+	var clientset kubernetes.Interface
+	if k8sClient != nil {
+		clientset = k8sClient.Clientset
+	}
+	authenticator, err := auth.FromEnv(clientset)
+	if err != nil {
+		fatal("Invalid admin authentication configuration", err)
+	}
+	if _, disabled := authenticator.(auth.Anonymous); disabled {
+		log.Warn("Admin API authentication is disabled (set AUTH_MODE to enable it)")
+	}
+
 	go func() {
-		log.Println("Admin Server listening on :8081")
-		adminServer := admin.NewServer(k8sClient, configStore, proxyHandler.Metrics)
+		log.Info("Admin Server listening", "addr", ":8081")
+		adminServer := admin.NewServer(k8sClient, configStore, proxyHandler.Metrics, authenticator)
+		adminServer.Notifier = notifier
+		adminServer.Savings = savingsTracker
+		adminServer.Traffic = traffic
+		adminServer.Stream = eventStream
+		adminServer.Audit = auditLog
+		adminServer.Proxy = proxyHandler
+		adminServer.Watcher = watcherService
 		if err := adminServer.ListenAndServe(":8081"); err != nil {
-			log.Printf("Admin Server failed: %v", err)
+			log.Error("Admin Server failed", "error", err)
 		}
 	}()
 
-	// 6. Start Proxy Server (Port 8080)
-	log.Println("Proxy Server listening on :8080")
+	// 6. Start Admission Webhook (Port 8443, optional)
+	if os.Getenv("WEBHOOK_ENABLED") == "true" {
+		go func() {
+			addr := os.Getenv("WEBHOOK_ADDR")
+			if addr == "" {
+				addr = ":8443"
+			}
+			log.Info("Admission Webhook listening", "addr", addr)
+			namespace := os.Getenv("POD_NAMESPACE")
+			if k8sClient != nil {
+				namespace = k8sClient.Namespace
+			}
+			webhookServer := webhook.NewServer(configStore, namespace)
+			webhookServer.K8sClient = k8sClient
+			webhookServer.Notifier = notifier
+			if err := webhookServer.ListenAndServeTLS(addr); err != nil {
+				log.Error("Admission Webhook failed", "error", err)
+			}
+		}()
+	}
+
+	// 7. Start Proxy Server (Port 8080)
+	log.Info("Proxy Server listening", "addr", ":8080")
 	if err := http.ListenAndServe(":8080", proxyHandler); err != nil {
-		log.Fatalf("Proxy Server failed: %v", err)
+		fatal("Proxy Server failed", err)
 	}
 }
+
+// fatal logs err and exits, like log.Fatalf.
+func fatal(msg string, err error) {
+	log.Error(msg, "error", err)
+	os.Exit(1)
+}
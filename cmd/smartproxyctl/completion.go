@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Route IDs and context names are completed by running smartproxyctl itself, against the current context.
+const bashCompletion = `# bash completion for smartproxyctl
+_smartproxyctl() {
+    local cur prev words cword
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local commands="%[1]s"
+
+    if [[ ${COMP_CWORD} -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "${commands}" -- "${cur}"))
+        return
+    fi
+    case "${prev}" in
+        -o) COMPREPLY=($(compgen -W "table json yaml name" -- "${cur}")); return ;;
+        --context) COMPREPLY=($(compgen -W "$(smartproxyctl config get-contexts -o name 2>/dev/null)" -- "${cur}")); return ;;
+        -f|--file|--config) COMPREPLY=($(compgen -f -- "${cur}")); return ;;
+    esac
+    case "${COMP_WORDS[1]}" in
+        route)
+            if [[ ${COMP_CWORD} -eq 2 ]]; then
+                COMPREPLY=($(compgen -W "list get create edit delete" -- "${cur}"))
+            elif [[ "${COMP_WORDS[2]}" =~ ^(get|edit|delete)$ ]]; then
+                COMPREPLY=($(compgen -W "$(smartproxyctl route list -A -o name 2>/dev/null)" -- "${cur}"))
+            fi ;;
+        wake|sleep|wake-link)
+            COMPREPLY=($(compgen -W "$(smartproxyctl route list -A -o name 2>/dev/null)" -- "${cur}")) ;;
+        patch|unpatch|resources)
+            if [[ ${COMP_CWORD} -eq 2 ]]; then
+                COMPREPLY=($(compgen -W "ingress route" -- "${cur}"))
+            fi ;;
+        config)
+            if [[ ${COMP_CWORD} -eq 2 ]]; then
+                COMPREPLY=($(compgen -W "get-contexts current-context use-context set-context delete-context" -- "${cur}"))
+            else
+                COMPREPLY=($(compgen -W "$(smartproxyctl config get-contexts -o name 2>/dev/null)" -- "${cur}"))
+            fi ;;
+        completion)
+            COMPREPLY=($(compgen -W "bash zsh fish" -- "${cur}")) ;;
+    esac
+}
+complete -F _smartproxyctl smartproxyctl
+`
+
+const fishCompletion = `# fish completion for smartproxyctl
+set -l commands %[1]s
+complete -c smartproxyctl -f
+complete -c smartproxyctl -n "not __fish_seen_subcommand_from $commands" -a "$commands"
+complete -c smartproxyctl -s o -x -a "table json yaml name" -d "Output format"
+complete -c smartproxyctl -l context -x -a "(smartproxyctl config get-contexts -o name 2>/dev/null)" -d "Context"
+complete -c smartproxyctl -n "__fish_seen_subcommand_from route; and not __fish_seen_subcommand_from list get create edit delete" -a "list get create edit delete"
+complete -c smartproxyctl -n "__fish_seen_subcommand_from get edit delete wake sleep wake-link" -a "(smartproxyctl route list -A -o name 2>/dev/null)"
+complete -c smartproxyctl -n "__fish_seen_subcommand_from patch unpatch resources; and not __fish_seen_subcommand_from ingress route" -a "ingress route"
+complete -c smartproxyctl -n "__fish_seen_subcommand_from config; and not __fish_seen_subcommand_from get-contexts current-context use-context set-context delete-context" -a "get-contexts current-context use-context set-context delete-context"
+complete -c smartproxyctl -n "__fish_seen_subcommand_from use-context delete-context set-context" -a "(smartproxyctl config get-contexts -o name 2>/dev/null)"
+complete -c smartproxyctl -n "__fish_seen_subcommand_from completion" -a "bash zsh fish"
+`
+
+// runCompletion prints a completion script: source <(smartproxyctl completion bash)
+func runCompletion(_ context.Context, args []string) error {
+	f := newFlags("completion", "completion bash|zsh|fish")
+	positional, err := f.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	names := strings.Join(commandNames(), " ")
+	switch positional[0] {
+	case "bash":
+		fmt.Printf(bashCompletion, names)
+	case "zsh":
+		// zsh runs the bash script through its compatibility layer
+		fmt.Println("autoload -U +X bashcompinit && bashcompinit")
+		fmt.Printf(bashCompletion, names)
+	case "fish":
+		fmt.Printf(fishCompletion, names)
+	default:
+		return fmt.Errorf("unsupported shell %q, must be bash, zsh or fish", positional[0])
+	}
+	return nil
+}
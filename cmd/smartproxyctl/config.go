@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// config lists the proxy instances smartproxyctl talks to, like a kubeconfig:
+//
+//	current_context: staging
+//	contexts:
+//	  - name: staging
+//	    server: https://proxy-admin.staging.example.com
+//	    token: ...
+//	    namespace: shop
+type config struct {
+	CurrentContext string          `json:"current_context,omitempty"`
+	Contexts       []configContext `json:"contexts"`
+}
+
+// configContext is one proxy instance.
+type configContext struct {
+	Name      string `json:"name"`
+	Server    string `json:"server"`              // Admin API URL
+	Token     string `json:"token,omitempty"`     // Bearer token, if the admin API requires one
+	Namespace string `json:"namespace,omitempty"` // Default namespace of commands that take --namespace
+}
+
+// defaultConfigPath is $SMARTPROXYCTL_CONFIG, or config.yaml in the user configuration directory.
+func defaultConfigPath() string {
+	if path := os.Getenv("SMARTPROXYCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "smartproxyctl.yaml"
+	}
+	return filepath.Join(dir, "smartproxyctl", "config.yaml")
+}
+
+// loadConfig reads the config file; a missing file is an empty config.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// save writes the config file, readable only by its owner since it holds tokens.
+func (c *config) save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func (c *config) find(name string) (configContext, bool) {
+	for _, ctx := range c.Contexts {
+		if ctx.Name == name {
+			return ctx, true
+		}
+	}
+	return configContext{}, false
+}
+
+// runConfig manages the contexts of the config file.
+func runConfig(_ context.Context, args []string) error {
+	sub, args := subcommand(args)
+	switch sub {
+	case "get-contexts":
+		f := newFlags("config get-contexts", "config get-contexts")
+		if _, err := f.parse(args, 0, 0); err != nil {
+			return err
+		}
+		cfg, err := loadConfig(f.configPath())
+		if err != nil {
+			return err
+		}
+		// Tokens stay in the file
+		contexts := make([]configContext, len(cfg.Contexts))
+		for i, ctx := range cfg.Contexts {
+			if ctx.Token != "" {
+				ctx.Token = "REDACTED"
+			}
+			contexts[i] = ctx
+		}
+		return printOutput(f.output, contexts, func() table {
+			t := table{header: []string{"CURRENT", "NAME", "SERVER", "NAMESPACE"}}
+			for _, ctx := range cfg.Contexts {
+				current := ""
+				if ctx.Name == cfg.CurrentContext {
+					current = "*"
+				}
+				t.rows = append(t.rows, []string{current, ctx.Name, ctx.Server, ctx.Namespace})
+			}
+			return t
+		})
+	case "current-context":
+		f := newFlags("config current-context", "config current-context")
+		if _, err := f.parse(args, 0, 0); err != nil {
+			return err
+		}
+		cfg, err := loadConfig(f.configPath())
+		if err != nil {
+			return err
+		}
+		if cfg.CurrentContext == "" {
+			return errors.New("no current context")
+		}
+		fmt.Println(cfg.CurrentContext)
+		return nil
+	case "use-context":
+		f := newFlags("config use-context", "config use-context <name>")
+		positional, err := f.parse(args, 1, 1)
+		if err != nil {
+			return err
+		}
+		return updateConfig(f.configPath(), func(cfg *config) error {
+			if _, ok := cfg.find(positional[0]); !ok {
+				return fmt.Errorf("context %q not found", positional[0])
+			}
+			cfg.CurrentContext = positional[0]
+			fmt.Printf("Switched to context %q.\n", positional[0])
+			return nil
+		})
+	case "set-context":
+		// --server and --token set the context's fields here, rather than overriding them
+		f := newFlags("config set-context", "config set-context <name> [--server URL] [--token TOKEN|-] [--namespace NS]")
+		namespace := f.String("namespace", "", "default namespace of the context")
+		positional, err := f.parse(args, 1, 1)
+		if err != nil {
+			return err
+		}
+		if f.token == "-" {
+			data, err := readInput("-")
+			if err != nil {
+				return err
+			}
+			f.token = strings.TrimSpace(string(data))
+		}
+		return updateConfig(f.configPath(), func(cfg *config) error {
+			ctx, found := cfg.find(positional[0])
+			ctx.Name = positional[0]
+			if f.server != "" {
+				ctx.Server = f.server
+			}
+			if f.token != "" {
+				ctx.Token = f.token
+			}
+			if *namespace != "" {
+				ctx.Namespace = *namespace
+			}
+			if ctx.Server == "" {
+				return errors.New("--server is required for a new context")
+			}
+			if found {
+				for i := range cfg.Contexts {
+					if cfg.Contexts[i].Name == ctx.Name {
+						cfg.Contexts[i] = ctx
+					}
+				}
+				fmt.Printf("Context %q modified.\n", ctx.Name)
+			} else {
+				cfg.Contexts = append(cfg.Contexts, ctx)
+				fmt.Printf("Context %q created.\n", ctx.Name)
+			}
+			if cfg.CurrentContext == "" {
+				cfg.CurrentContext = ctx.Name
+			}
+			return nil
+		})
+	case "delete-context":
+		f := newFlags("config delete-context", "config delete-context <name>")
+		positional, err := f.parse(args, 1, 1)
+		if err != nil {
+			return err
+		}
+		return updateConfig(f.configPath(), func(cfg *config) error {
+			kept := cfg.Contexts[:0]
+			for _, ctx := range cfg.Contexts {
+				if ctx.Name != positional[0] {
+					kept = append(kept, ctx)
+				}
+			}
+			if len(kept) == len(cfg.Contexts) {
+				return fmt.Errorf("context %q not found", positional[0])
+			}
+			cfg.Contexts = kept
+			if cfg.CurrentContext == positional[0] {
+				cfg.CurrentContext = ""
+			}
+			fmt.Printf("Context %q deleted.\n", positional[0])
+			return nil
+		})
+	default:
+		return unknownSubcommand("config", sub, "get-contexts", "current-context", "use-context", "set-context", "delete-context")
+	}
+}
+
+// updateConfig loads the config file, applies update and saves it.
+func updateConfig(path string, update func(*config) error) error {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := update(cfg); err != nil {
+		return err
+	}
+	return cfg.save(path)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContexts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "smartproxyctl", "config.yaml")
+	ctl := func(args ...string) error {
+		return run(context.Background(), append(args, "--config", path))
+	}
+
+	if err := ctl("config", "set-context", "staging"); err == nil {
+		t.Error("new context without a server accepted")
+	}
+	if err := ctl("config", "set-context", "staging", "--server", "https://staging.example.com", "--token", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctl("config", "set-context", "prod", "--server", "https://prod.example.com", "--namespace", "shop"); err != nil {
+		t.Fatal(err)
+	}
+	// Only the fields given change
+	if err := ctl("config", "set-context", "staging", "--namespace", "blog"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CurrentContext != "staging" {
+		t.Errorf("first context not made current: %q", cfg.CurrentContext)
+	}
+	if staging, _ := cfg.find("staging"); staging != (configContext{Name: "staging", Server: "https://staging.example.com", Token: "s3cret", Namespace: "blog"}) {
+		t.Errorf("staging: %+v", staging)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("config file holding tokens: %v, %v", info.Mode(), err)
+	}
+
+	if err := ctl("config", "use-context", "dev"); err == nil {
+		t.Error("switched to an unknown context")
+	}
+	if err := ctl("config", "use-context", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctl("config", "delete-context", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctl("config", "delete-context", "prod"); err == nil {
+		t.Error("deleted a context twice")
+	}
+	if cfg, _ = loadConfig(path); cfg.CurrentContext != "" || len(cfg.Contexts) != 1 {
+		t.Errorf("after deleting the current context: %+v", cfg)
+	}
+	if err := ctl("config", "current-context"); err == nil {
+		t.Error("no current context not reported")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	if cfg, err := loadConfig(filepath.Join(dir, "missing.yaml")); err != nil || len(cfg.Contexts) != 0 {
+		t.Errorf("missing file: %+v, %v", cfg, err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	os.WriteFile(path, []byte("contexts:\n  - name: a\n    sever: https://typo.example.com\n"), 0o600)
+	if _, err := loadConfig(path); err == nil {
+		t.Error("unknown field accepted")
+	}
+}
+
+func TestClientSelection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := &config{CurrentContext: "staging", Contexts: []configContext{
+		{Name: "staging", Server: "https://staging.example.com", Token: "staging-token", Namespace: "blog"},
+		{Name: "prod", Server: "https://prod.example.com/", Token: "prod-token"},
+	}}
+	if err := cfg.save(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SMARTPROXY_SERVER", "")
+	t.Setenv("SMARTPROXY_TOKEN", "")
+
+	tests := []struct {
+		name          string
+		args          []string
+		env           map[string]string
+		server, token string
+	}{
+		{"current context", nil, nil, "https://staging.example.com", "staging-token"},
+		{"other context", []string{"--context", "prod"}, nil, "https://prod.example.com", "prod-token"},
+		{"flags override", []string{"--server", "http://localhost:9000"}, nil, "http://localhost:9000", "staging-token"},
+		{"environment overrides", nil, map[string]string{"SMARTPROXY_TOKEN": "env-token"}, "https://staging.example.com", "env-token"},
+		{"flags before environment", []string{"--token", "flag-token"}, map[string]string{"SMARTPROXY_TOKEN": "env-token"}, "https://staging.example.com", "flag-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			f := newFlags("test", "test")
+			if _, err := f.parse(append(tt.args, "--config", path), 0, 0); err != nil {
+				t.Fatal(err)
+			}
+			c, err := f.client()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Server != tt.server || c.Token != tt.token {
+				t.Errorf("%s with %q, want %s with %q", c.Server, c.Token, tt.server, tt.token)
+			}
+		})
+	}
+
+	f := newFlags("test", "test")
+	f.parse([]string{"--config", path, "--context", "dev"}, 0, 0)
+	if _, err := f.client(); err == nil {
+		t.Error("unknown context accepted")
+	}
+	if ns := f.namespace(""); ns != "" {
+		t.Errorf("namespace of an unknown context: %q", ns)
+	}
+	f = newFlags("test", "test")
+	f.parse([]string{"--config", path}, 0, 0)
+	if f.namespace("") != "blog" || f.namespace("shop") != "shop" {
+		t.Error("the namespace flag does not default to the context's")
+	}
+}
@@ -0,0 +1,226 @@
+// Command smartproxyctl manages smart-proxy instances through their admin API: routes, Ingress and
+// OpenShift Route patching, manual wake-ups, logs, stats, and configuration export and import.
+//
+// Instances are reached through contexts stored in a kubeconfig-like file (see "smartproxyctl config"),
+// or with --server and --token. Run "smartproxyctl help" for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"smart-proxy/internal/client"
+)
+
+// command is a subcommand; run gets the arguments after its name.
+type command struct {
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"route":      {"List, show, create, edit and delete routes", runRoute},
+		"resources":  {"List the Ingresses and OpenShift Routes that can be patched", runResources},
+		"patch":      {"Point an Ingress or OpenShift Route to the proxy", runPatch},
+		"unpatch":    {"Restore an Ingress or OpenShift Route to its Service", runUnpatch},
+		"wake":       {"Wake a route, optionally waiting until it is ready", runWake},
+		"sleep":      {"Put a route to sleep now", runSleep},
+		"wake-link":  {"Create a signed link that wakes a route", runWakeLink},
+		"logs":       {"Print the proxy logs, optionally following them", runLogs},
+		"stats":      {"Show request counters per route", runStats},
+		"export":     {"Export route configurations as YAML or JSON", runExport},
+		"import":     {"Create or update routes from an exported file", runImport},
+		"config":     {"Manage contexts: the proxy instances to talk to", runConfig},
+		"completion": {"Print a shell completion script (bash, zsh or fish)", runCompletion},
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(os.Stdout)
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		usage(os.Stderr)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd.run(ctx, args[1:])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "smartproxyctl manages smart-proxy instances through their admin API.")
+	fmt.Fprintln(w, "\nUsage:\n  smartproxyctl <command> [arguments] [flags]\n\nCommands:")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "  %-11s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w, "\nGlobal flags, accepted by every command:")
+	f := newFlags("", "")
+	f.SetOutput(w)
+	f.PrintDefaults()
+	fmt.Fprintln(w, "\nRun \"smartproxyctl <command> -h\" for the flags of a command.")
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// globals are the flags accepted by every command.
+type globals struct {
+	config  string
+	context string
+	server  string
+	token   string
+	output  string
+}
+
+// flags is the flag set of a command, with the global flags registered.
+type flags struct {
+	*flag.FlagSet
+	globals
+}
+
+// newFlags returns the flag set of a command; usage is the synopsis shown by -h, e.g. "route get <id>".
+func newFlags(name, synopsis string) *flags {
+	f := &flags{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+	f.StringVar(&f.config, "config", "", "config file (default $SMARTPROXYCTL_CONFIG or "+displayPath(defaultConfigPath())+")")
+	f.StringVar(&f.context, "context", "", "context to use instead of the current one")
+	f.StringVar(&f.server, "server", "", "admin API URL, overriding the context (env SMARTPROXY_SERVER)")
+	f.StringVar(&f.token, "token", "", "bearer token, overriding the context (env SMARTPROXY_TOKEN)")
+	f.StringVar(&f.output, "o", "", "output format: table, json, yaml or name")
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "Usage: smartproxyctl %s [flags]\n\nFlags:\n", synopsis)
+		f.PrintDefaults()
+	}
+	return f
+}
+
+// parse parses flags anywhere among the arguments, e.g. "route get shop -o yaml", and returns the positional
+// arguments. It checks there are between min and max of them; max < 0 means no limit.
+func (f *flags) parse(args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := f.Parse(args); err != nil {
+			return nil, err
+		}
+		args = f.Args()
+		if len(args) == 0 {
+			break
+		}
+		if args[0] == "--" {
+			positional = append(positional, args[1:]...)
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		f.Usage()
+		return nil, fmt.Errorf("%s: wrong number of arguments", f.Name())
+	}
+	return positional, nil
+}
+
+// client returns a client for the selected instance: flags and environment override the context.
+func (f *flags) client() (*client.Client, error) {
+	server, token := f.server, f.token
+	if server == "" {
+		server = os.Getenv("SMARTPROXY_SERVER")
+	}
+	if token == "" {
+		token = os.Getenv("SMARTPROXY_TOKEN")
+	}
+
+	cfg, err := loadConfig(f.configPath())
+	if err != nil {
+		return nil, err
+	}
+	name := f.context
+	if name == "" {
+		name = cfg.CurrentContext
+	}
+	if name != "" {
+		c, ok := cfg.find(name)
+		if !ok {
+			if f.context != "" || server == "" {
+				return nil, fmt.Errorf("context %q not found", name)
+			}
+		} else {
+			if server == "" {
+				server = c.Server
+			}
+			if token == "" {
+				token = c.Token
+			}
+		}
+	}
+	if server == "" {
+		server = client.DefaultServer
+	}
+	return client.New(server, token), nil
+}
+
+// namespace returns the namespace flag value, or the context's default namespace if the flag is unset.
+func (f *flags) namespace(value string) string {
+	if value != "" {
+		return value
+	}
+	cfg, err := loadConfig(f.configPath())
+	if err != nil {
+		return ""
+	}
+	name := f.context
+	if name == "" {
+		name = cfg.CurrentContext
+	}
+	if c, ok := cfg.find(name); ok {
+		return c.Namespace
+	}
+	return ""
+}
+
+func (f *flags) configPath() string {
+	if f.config != "" {
+		return f.config
+	}
+	return defaultConfigPath()
+}
+
+// displayPath shortens paths under the home directory for help texts.
+func displayPath(path string) string {
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		if rest, ok := strings.CutPrefix(path, home); ok {
+			return "~" + rest
+		}
+	}
+	return path
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseFlagsAnywhere(t *testing.T) {
+	f := newFlags("route get", "route get <id>")
+	f.SetOutput(io.Discard)
+	positional, err := f.parse([]string{"shop", "-o", "yaml", "--", "-odd-id"}, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(positional, []string{"shop", "-odd-id"}) || f.output != "yaml" {
+		t.Errorf("%q with -o %q", positional, f.output)
+	}
+
+	for _, args := range [][]string{{}, {"a", "b", "c"}, {"a", "--bogus"}} {
+		f := newFlags("route get", "route get <id>")
+		f.SetOutput(io.Discard)
+		if _, err := f.parse(args, 1, 2); err == nil {
+			t.Errorf("%q accepted", args)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	if err := run(context.Background(), []string{"restart"}); err == nil {
+		t.Error("unknown command accepted")
+	}
+	if err := run(context.Background(), []string{"config", "rename-context"}); err == nil {
+		t.Error("unknown subcommand accepted")
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                              "-",
+		30 * time.Minute:               "30m",
+		90 * time.Minute:               "1h30m",
+		2 * time.Hour:                  "2h",
+		45 * time.Second:               "45s",
+		time.Hour + 30*time.Second:     "1h0m30s",
+		10*time.Minute + 5*time.Second: "10m5s",
+	}
+	for d, want := range tests {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%s) = %s, want %s", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// table is the human-readable form of a command output.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// printOutput prints v in format: json and yaml print v itself, table (the default) and name print the
+// table built by tabulate; name prints its first column only, e.g. for scripts and shell completion.
+// Without tabulate, they fall back to yaml.
+func printOutput(format string, v interface{}, tabulate func() table) error {
+	if tabulate == nil && (format == "" || format == "table" || format == "name") {
+		format = "yaml"
+	}
+	switch format {
+	case "", "table":
+		t := tabulate()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, strings.Join(t.header, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		return w.Flush()
+	case "name":
+		for _, row := range tabulate().rows {
+			fmt.Println(row[0])
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unknown output format %q, must be table, json, yaml or name", format)
+	}
+}
+
+// subcommand splits the subcommand name from its arguments; flags before it are not allowed.
+func subcommand(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	return args[0], args[1:]
+}
+
+func unknownSubcommand(command, sub string, valid ...string) error {
+	if sub == "" || sub == "-h" || sub == "--help" || sub == "help" {
+		fmt.Fprintf(os.Stderr, "Usage: smartproxyctl %s <%s> [arguments] [flags]\n", command, strings.Join(valid, "|"))
+		if sub == "" {
+			return fmt.Errorf("%s: missing subcommand", command)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown subcommand %q of %s, must be one of %s", sub, command, strings.Join(valid, ", "))
+}
+
+// readInput reads a file, or stdin for "-".
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// formatDuration prints durations like 30m or 1h30m rather than 30m0s.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// orDash prints empty table cells as "-".
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
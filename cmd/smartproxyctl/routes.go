@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-proxy/internal/client"
+	"smart-proxy/internal/manifest"
+	"smart-proxy/internal/store"
+
+	"sigs.k8s.io/yaml"
+)
+
+// runRoute manages routes: list, get, create, edit and delete.
+func runRoute(ctx context.Context, args []string) error {
+	sub, args := subcommand(args)
+	switch sub {
+	case "list", "ls":
+		return routeList(ctx, args)
+	case "get":
+		return routeGet(ctx, args)
+	case "create", "apply":
+		return routeCreate(ctx, args)
+	case "edit":
+		return routeEdit(ctx, args)
+	case "delete", "rm":
+		return routeDelete(ctx, args)
+	default:
+		return unknownSubcommand("route", sub, "list", "get", "create", "edit", "delete")
+	}
+}
+
+func routeList(ctx context.Context, args []string) error {
+	f := newFlags("route list", "route list [--namespace NS]")
+	namespace := f.String("namespace", "", "only the routes of this namespace (default: the context's, or all)")
+	allNamespaces := f.Bool("A", false, "routes of all namespaces, ignoring the context's default")
+	if _, err := f.parse(args, 0, 0); err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	ns := f.namespace(*namespace)
+	if *allNamespaces {
+		ns = ""
+	}
+	routes, err := c.Routes(ctx, ns)
+	if err != nil {
+		return err
+	}
+	return printOutput(f.output, routes, func() table { return routeTable(routes) })
+}
+
+func routeGet(ctx context.Context, args []string) error {
+	f := newFlags("route get", "route get <id>")
+	positional, err := f.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	route, err := c.Route(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	if f.output == "" {
+		f.output = "yaml"
+	}
+	return printOutput(f.output, route, func() table { return routeTable([]client.Route{route}) })
+}
+
+func routeTable(routes []client.Route) table {
+	t := table{header: []string{"ID", "HOST", "PATH", "NAMESPACE", "DEPLOYMENT", "STATUS", "MODE", "IDLE TIMEOUT"}}
+	for _, r := range routes {
+		t.rows = append(t.rows, []string{r.ID, orDash(r.Host), r.Path, r.Namespace, r.Deployment, r.Status,
+			r.CurrentMode(), formatDuration(r.IdleTimeout)})
+	}
+	return t
+}
+
+// routeCreate creates or replaces a route from a file (-f) or from flags.
+func routeCreate(ctx context.Context, args []string) error {
+	f := newFlags("route create", "route create (-f FILE | --namespace NS --deployment NAME --path PATH [flags])")
+	file := f.String("f", "", "route configuration file, YAML or JSON; \"-\" reads stdin")
+	id := f.String("id", "", "route ID (generated if empty)")
+	host := f.String("host", "", "host to match, empty for any")
+	path := f.String("path", "/", "path prefix to match")
+	namespace := f.String("namespace", "", "namespace of the deployment (default: the context's)")
+	deployment := f.String("deployment", "", "deployment to wake and put to sleep")
+	service := f.String("service", "", "target Service (default: the deployment name)")
+	port := f.Int("port", 80, "target Service port")
+	idle := f.Duration("idle-timeout", 30*time.Minute, "put the route to sleep after this long without requests")
+	var dependencies []string
+	f.Func("dependency", "dependent deployment, \"name\" or \"namespace/name\", with \":stop\" to stop it on idle; repeatable",
+		func(v string) error { dependencies = append(dependencies, v); return nil })
+	if _, err := f.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	var route store.RouteConfig
+	if *file != "" {
+		data, err := readInput(*file)
+		if err != nil {
+			return err
+		}
+		if route, err = manifest.ParseRoute(data); err != nil {
+			return fmt.Errorf("invalid route file: %w", err)
+		}
+	} else {
+		route = store.RouteConfig{
+			ID:            *id,
+			Host:          *host,
+			Path:          *path,
+			Namespace:     f.namespace(*namespace),
+			Deployment:    *deployment,
+			TargetService: *service,
+			TargetPort:    *port,
+			IdleTimeout:   *idle,
+			Dependencies:  []store.DependencyConfig{},
+		}
+		if route.TargetService == "" {
+			route.TargetService = route.Deployment
+		}
+		for _, d := range dependencies {
+			name, stop := strings.CutSuffix(d, ":stop")
+			route.Dependencies = append(route.Dependencies, store.DependencyConfig{Name: name, StopOnIdle: stop})
+		}
+		if route.Namespace == "" || route.Deployment == "" {
+			f.Usage()
+			return errors.New("--namespace and --deployment are required")
+		}
+	}
+
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	saved, err := c.SaveRoute(ctx, route)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Route %s saved.\n", saved.ID)
+	return nil
+}
+
+// routeEdit opens a route in $EDITOR as YAML and saves it if it changed.
+func routeEdit(ctx context.Context, args []string) error {
+	f := newFlags("route edit", "route edit <id>")
+	positional, err := f.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	route, err := c.Route(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	// The mode and the last activity are not edited here; the server keeps them
+	config := route.RouteConfig
+	config.Mode = nil
+	fields, err := manifest.Fields(config)
+	if err != nil {
+		return err
+	}
+	original, err := yaml.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "smartproxyctl-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	header := "# Edit the route and save to apply it; an unchanged file cancels the edit.\n" +
+		"# The mode is changed with the admin API (/api/v1/routes/{id}/mode).\n"
+	if _, err := tmp.WriteString(header + string(original)); err != nil {
+		return err
+	}
+	tmp.Close()
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// The editor may come with arguments, e.g. "code --wait"
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], tmp.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor: %w", err)
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	edited = bytes.TrimPrefix(edited, []byte(header))
+	if bytes.Equal(bytes.TrimSpace(edited), bytes.TrimSpace(original)) {
+		fmt.Println("Edit cancelled, no changes made.")
+		return nil
+	}
+	updated, err := manifest.ParseRoute(edited)
+	if err != nil {
+		return fmt.Errorf("invalid route, not saved: %w", err)
+	}
+	if updated.ID != route.ID {
+		return fmt.Errorf("the route ID cannot change (%s), not saved", route.ID)
+	}
+	// Not saved over changes made by others while editing
+	if _, err := c.UpdateRoute(ctx, updated, route.ETag); err != nil {
+		if errors.Is(err, client.ErrRouteChanged) {
+			return fmt.Errorf("route %s changed while being edited, not saved; edit it again", route.ID)
+		}
+		return err
+	}
+	fmt.Printf("Route %s saved.\n", route.ID)
+	return nil
+}
+
+func routeDelete(ctx context.Context, args []string) error {
+	f := newFlags("route delete", "route delete <id>...")
+	positional, err := f.parse(args, 1, -1)
+	if err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	for _, id := range positional {
+		if err := c.DeleteRoute(ctx, id); err != nil {
+			return fmt.Errorf("route %s: %w", id, err)
+		}
+		fmt.Printf("Route %s deleted.\n", id)
+	}
+	return nil
+}
+
+// runResources lists the patchable Ingresses and OpenShift Routes.
+func runResources(ctx context.Context, args []string) error {
+	f := newFlags("resources", "resources [ingress|route] [--namespace NS]")
+	namespace := f.String("namespace", "", "only this namespace (default: the context's, or all)")
+	positional, err := f.parse(args, 0, 1)
+	if err != nil {
+		return err
+	}
+	kinds := []string{client.KindIngress, client.KindRoute}
+	if len(positional) == 1 {
+		kinds = []string{positional[0]}
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	var resources []client.Resource
+	for _, kind := range kinds {
+		list, err := c.Resources(ctx, kind, f.namespace(*namespace))
+		if err != nil {
+			return err
+		}
+		resources = append(resources, list...)
+	}
+	return printOutput(f.output, resources, func() table {
+		t := table{header: []string{"NAME", "KIND", "NAMESPACE", "HOST", "SERVICE", "PATCHED", "STATUS"}}
+		for _, r := range resources {
+			t.rows = append(t.rows, []string{r.Name, r.Type, r.Namespace, orDash(r.Host), r.Service,
+				strconv.FormatBool(r.Patched), r.Status})
+		}
+		return t
+	})
+}
+
+func runPatch(ctx context.Context, args []string) error {
+	return patchCommand(ctx, "patch", args)
+}
+
+func runUnpatch(ctx context.Context, args []string) error {
+	return patchCommand(ctx, "unpatch", args)
+}
+
+// patchCommand patches or unpatches Ingresses or OpenShift Routes: "patch ingress <name>...".
+func patchCommand(ctx context.Context, name string, args []string) error {
+	f := newFlags(name, name+" ingress|route <name>... [--namespace NS]")
+	namespace := f.String("namespace", "", "namespace of the resources (default: the context's, or the proxy's)")
+	positional, err := f.parse(args, 2, -1)
+	if err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	kind, ns := positional[0], f.namespace(*namespace)
+	for _, resource := range positional[1:] {
+		if name == "patch" {
+			err = c.Patch(ctx, kind, ns, resource)
+		} else {
+			err = c.Unpatch(ctx, kind, ns, resource)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", kind, resource, err)
+		}
+		fmt.Printf("%s %s %sed.\n", capitalize(kind), resource, name)
+	}
+	return nil
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
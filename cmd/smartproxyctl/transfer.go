@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"smart-proxy/internal/client"
+	"smart-proxy/internal/manifest"
+)
+
+// runExport prints the configuration of routes as a declarative document, for import here or elsewhere.
+func runExport(ctx context.Context, args []string) error {
+	f := newFlags("export", "export [--namespace NS] [-o yaml|json] [--file FILE]")
+	namespace := f.String("namespace", "", "only the routes of this namespace (default: all)")
+	file := f.String("file", "", "write to this file instead of stdout")
+	if _, err := f.parse(args, 0, 0); err != nil {
+		return err
+	}
+	switch f.output {
+	case "", manifest.FormatYAML, manifest.FormatJSON:
+	default:
+		return fmt.Errorf("unknown export format %q, must be yaml or json", f.output)
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	data, err := c.ExportConfig(ctx, *namespace, f.output)
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*file, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Exported to %s.\n", *file)
+	return nil
+}
+
+// runImport applies a declarative document: routes are created or updated to match it and, with --prune,
+// those missing from it are deleted. Route modes are kept as they are.
+func runImport(ctx context.Context, args []string) error {
+	f := newFlags("import", "import -f FILE [--dry-run] [--prune] [--namespace NS]")
+	file := f.String("f", "", "document, YAML or JSON; \"-\" reads stdin")
+	dryRun := f.Bool("dry-run", false, "only show the changes")
+	prune := f.Bool("prune", false, "also delete the routes missing from the document, among those you administer")
+	namespace := f.String("namespace", "", "only import into this namespace: the document may not name another, and pruning stays in it")
+	if _, err := f.parse(args, 0, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		f.Usage()
+		return fmt.Errorf("import: -f is required")
+	}
+	data, err := readInput(*file)
+	if err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	result, err := c.ImportConfig(ctx, data, client.ImportOptions{DryRun: *dryRun, Prune: *prune, Namespace: *namespace})
+	if err != nil {
+		return err
+	}
+
+	if f.output != "" && f.output != "table" {
+		if err := printOutput(f.output, result, nil); err != nil {
+			return err
+		}
+	} else {
+		printPlan(result)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%d problem(s) reported", len(result.Errors))
+	}
+	return nil
+}
+
+// printPlan prints the changes of an import like a diff, then the errors.
+func printPlan(result client.ImportResult) {
+	symbols := map[string]string{manifest.ActionCreate: "+", manifest.ActionUpdate: "~", manifest.ActionDelete: "-"}
+	for _, change := range result.Changes {
+		id := change.RouteID
+		if id == "" {
+			id = "(generated ID)"
+		}
+		fmt.Printf("%s %s %s in %s\n", symbols[change.Action], change.Action, id, change.Namespace)
+		for _, field := range change.Fields {
+			fmt.Printf("    %s: %s -> %s\n", field.Path, formatValue(field.Old), formatValue(field.New))
+		}
+	}
+	for _, err := range result.Errors {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+	}
+	if len(result.Errors) > 0 && len(result.Changes) == 0 {
+		return
+	}
+
+	created, updated, deleted := result.Counts()
+	summary := fmt.Sprintf("%d created, %d updated, %d deleted, %d unchanged", created, updated, deleted, result.Unchanged)
+	if result.DryRun {
+		summary = fmt.Sprintf("Dry run, nothing changed: %d to create, %d to update, %d to delete, %d unchanged",
+			created, updated, deleted, result.Unchanged)
+	}
+	fmt.Println(summary + ".")
+}
+
+// formatValue renders a field value of a diff: scalars as is, objects and lists as JSON.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "(none)"
+	case string, bool, json.Number, float64:
+		return fmt.Sprint(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
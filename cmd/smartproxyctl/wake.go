@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"smart-proxy/internal/client"
+	"smart-proxy/internal/logger"
+)
+
+// runWake wakes routes, optionally waiting until they are ready.
+func runWake(ctx context.Context, args []string) error {
+	f := newFlags("wake", "wake <id>... [--wait [--timeout 5m]]")
+	wait := f.Bool("wait", false, "wait until every deployment of the route is ready")
+	timeout := f.Duration("timeout", 5*time.Minute, "how long to wait, at most 15m")
+	positional, err := f.parse(args, 1, -1)
+	if err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	if !*wait {
+		*timeout = 0
+	}
+
+	var results []client.WakeResult
+	notReady := 0
+	for _, id := range positional {
+		result, err := c.Wake(ctx, id, *timeout)
+		if err != nil {
+			return fmt.Errorf("route %s: %w", id, err)
+		}
+		results = append(results, result)
+		if *wait && result.Status != "ready" {
+			notReady++
+		}
+	}
+
+	err = printOutput(f.output, results, func() table {
+		t := table{header: []string{"ROUTE", "WOKE", "STATUS", "ELAPSED"}}
+		for _, r := range results {
+			status, elapsed := "waking", "-"
+			if *wait {
+				status, elapsed = r.Status, strconv.FormatFloat(r.Elapsed, 'f', 1, 64)+"s"
+			}
+			t.rows = append(t.rows, []string{r.RouteID, strconv.FormatBool(r.Woke), status, elapsed})
+		}
+		return t
+	})
+	if err != nil {
+		return err
+	}
+	if f.output == "" || f.output == "table" {
+		for _, r := range results {
+			for _, d := range r.Diagnostics {
+				fmt.Fprintf(os.Stderr, "%s: %s/%s: %s (%s) %s\n", r.RouteID, d.Namespace, d.Deployment, d.Problem, d.Reason, d.Message)
+			}
+		}
+	}
+	if notReady > 0 {
+		return fmt.Errorf("%d route(s) not ready after %s", notReady, *timeout)
+	}
+	return nil
+}
+
+// runSleep puts routes to sleep now.
+func runSleep(ctx context.Context, args []string) error {
+	f := newFlags("sleep", "sleep <id>...")
+	positional, err := f.parse(args, 1, -1)
+	if err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	for _, id := range positional {
+		scaled, err := c.Sleep(ctx, id)
+		if err != nil {
+			return fmt.Errorf("route %s: %w", id, err)
+		}
+		fmt.Printf("Route %s put to sleep, scaled %d deployment(s) to zero.\n", id, len(scaled))
+	}
+	return nil
+}
+
+// runWakeLink signs a wake link for a route.
+func runWakeLink(ctx context.Context, args []string) error {
+	f := newFlags("wake-link", "wake-link <id> [--ttl 24h] [--rate 10]")
+	ttl := f.Duration("ttl", 0, "how long the link works, at most 720h (default 24h)")
+	rate := f.Int("rate", 0, "uses allowed per hour (default 10)")
+	positional, err := f.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	link, err := c.NewWakeLink(ctx, positional[0], *ttl, *rate)
+	if err != nil {
+		return err
+	}
+	if f.output == "" || f.output == "table" {
+		if link.URL != "" {
+			fmt.Println(link.URL)
+		} else {
+			fmt.Println(link.Path)
+		}
+		fmt.Fprintf(os.Stderr, "Expires %s, %d use(s) per hour.\n", link.Expires.Local().Format(time.RFC1123), link.RatePerHour)
+		return nil
+	}
+	return printOutput(f.output, link, nil)
+}
+
+// runLogs prints the proxy logs.
+func runLogs(ctx context.Context, args []string) error {
+	f := newFlags("logs", "logs [-f] [--level LEVEL] [--component NAME] [--route ID]")
+	follow := f.Bool("f", false, "follow new entries until interrupted")
+	level := f.String("level", "", "minimum level: debug, info, warn or error")
+	component := f.String("component", "", "only entries of this component, e.g. proxy or watcher")
+	route := f.String("route", "", "only entries of this route")
+	if _, err := f.parse(args, 0, 0); err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+
+	// Logs are printed as they come: json prints one object per line, the default one line per entry
+	var print func(logger.LogEntry)
+	switch f.output {
+	case "", "table":
+		print = func(e logger.LogEntry) {
+			line := fmt.Sprintf("%s %-5s", e.Timestamp.Local().Format("2006-01-02 15:04:05"), e.Level)
+			if e.Component != "" {
+				line += " [" + e.Component + "]"
+			}
+			line += " " + e.Message
+			if e.RouteID != "" {
+				line += " route_id=" + e.RouteID
+			}
+			keys := make([]string, 0, len(e.Attrs))
+			for k := range e.Attrs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				line += fmt.Sprintf(" %s=%v", k, e.Attrs[k])
+			}
+			fmt.Println(line)
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		print = func(e logger.LogEntry) { enc.Encode(e) }
+	default:
+		return fmt.Errorf("unknown output format %q for logs, must be table or json", f.output)
+	}
+
+	err = c.Logs(ctx, client.LogFilter{Level: *level, Component: *component, RouteID: *route, Follow: *follow}, print)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// runStats shows the request counters per route.
+func runStats(ctx context.Context, args []string) error {
+	f := newFlags("stats", "stats")
+	if _, err := f.parse(args, 0, 0); err != nil {
+		return err
+	}
+	c, err := f.client()
+	if err != nil {
+		return err
+	}
+	stats, err := c.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	return printOutput(f.output, stats, func() table {
+		ids := make([]string, 0, len(stats.RouteStats))
+		for id := range stats.RouteStats {
+			ids = append(ids, id)
+		}
+		// Busiest routes first
+		sort.Slice(ids, func(i, j int) bool {
+			if stats.RouteStats[ids[i]] != stats.RouteStats[ids[j]] {
+				return stats.RouteStats[ids[i]] > stats.RouteStats[ids[j]]
+			}
+			return ids[i] < ids[j]
+		})
+		t := table{header: []string{"ROUTE", "REQUESTS"}}
+		for _, id := range ids {
+			t.rows = append(t.rows, []string{id, strconv.FormatInt(stats.RouteStats[id], 10)})
+		}
+		t.rows = append(t.rows, []string{"TOTAL", strconv.FormatInt(stats.TotalRequests, 10)})
+		return t
+	})
+}
@@ -0,0 +1,203 @@
+// Package accesslog writes one line per proxied request, in Common/Combined, JSON or a custom
+// template format, to stdout, a rotating file and/or a syslog endpoint.
+// Lines are written in the background so that a slow sink never delays requests.
+package accesslog
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"smart-proxy/internal/logger"
+)
+
+var log = logger.Component("accesslog")
+
+// Entry describes a served request.
+type Entry struct {
+	Time      time.Time // When the request was received
+	RequestID string
+	ClientIP  string
+	User      string // Authenticated user of protected routes, or ""
+	Method    string
+	Host      string
+	URI       string
+	Proto     string
+	Status    int
+	Bytes     int64 // Response body bytes
+	Duration  time.Duration
+	RouteID   string // "" if no route matched
+	Upstream  string // host:port of the service, "" if the request was not proxied
+	Woke      bool   // The request woke the route up
+	Referer   string
+	UserAgent string
+}
+
+// Config configures a Logger.
+type Config struct {
+	Format     Formatter
+	Sinks      []Sink
+	SampleRate float64 // Share of requests logged; errors (5xx) and wake-ups are always logged
+}
+
+// Logger formats entries and writes them to its sinks. A nil *Logger discards everything.
+type Logger struct {
+	config  Config
+	queue   chan Entry
+	done    chan struct{}
+	wg      sync.WaitGroup
+	dropped atomic.Int64
+}
+
+const maxQueue = 4096
+
+// New starts a logger; Close flushes it.
+func New(config Config) *Logger {
+	l := &Logger{config: config, queue: make(chan Entry, maxQueue), done: make(chan struct{})}
+	l.wg.Add(1)
+	go l.run()
+	return l
+}
+
+// FromEnv configures the access log from the environment. It returns nil if ACCESS_LOG is unset.
+//
+//	ACCESS_LOG                   Comma-separated sinks: stdout, file:<path>, syslog+udp://host:port, syslog+tcp://host:port
+//	ACCESS_LOG_FORMAT            common, combined (default), json, or a text/template over Entry
+//	ACCESS_LOG_SAMPLE_RATE       Share of requests logged, 0 to 1 (default 1)
+//	ACCESS_LOG_FILE_MAX_SIZE     File size in MB that triggers a rotation (default 100)
+//	ACCESS_LOG_FILE_MAX_BACKUPS  Rotated files kept (default 5)
+func FromEnv() (*Logger, error) {
+	spec := os.Getenv("ACCESS_LOG")
+	if spec == "" {
+		return nil, nil
+	}
+
+	format, err := NewFormatter(os.Getenv("ACCESS_LOG_FORMAT"))
+	if err != nil {
+		return nil, err
+	}
+
+	rate := 1.0
+	if s := os.Getenv("ACCESS_LOG_SAMPLE_RATE"); s != "" {
+		if rate, err = strconv.ParseFloat(s, 64); err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid ACCESS_LOG_SAMPLE_RATE %q", s)
+		}
+	}
+	maxSize, err := envInt("ACCESS_LOG_FILE_MAX_SIZE", 100)
+	if err != nil {
+		return nil, err
+	}
+	maxBackups, err := envInt("ACCESS_LOG_FILE_MAX_BACKUPS", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	var sinks []Sink
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		var sink Sink
+		switch {
+		case s == "stdout":
+			sink = NewWriterSink(os.Stdout)
+		case strings.HasPrefix(s, "file:"):
+			sink, err = NewFileSink(strings.TrimPrefix(s, "file:"), int64(maxSize)<<20, maxBackups)
+		case strings.HasPrefix(s, "syslog+udp://"):
+			sink = NewSyslogSink("udp", strings.TrimPrefix(s, "syslog+udp://"), "smart-proxy")
+		case strings.HasPrefix(s, "syslog+tcp://"):
+			sink = NewSyslogSink("tcp", strings.TrimPrefix(s, "syslog+tcp://"), "smart-proxy")
+		default:
+			err = fmt.Errorf("unknown ACCESS_LOG sink %q", s)
+		}
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return New(Config{Format: format, Sinks: sinks, SampleRate: rate}), nil
+}
+
+func envInt(name string, def int) (int, error) {
+	s := os.Getenv(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, s)
+	}
+	return n, nil
+}
+
+// Log queues an entry. It never blocks; entries are dropped when the queue is full.
+func (l *Logger) Log(e Entry) {
+	if l == nil || !l.sampled(e) {
+		return
+	}
+	select {
+	case l.queue <- e:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+func (l *Logger) sampled(e Entry) bool {
+	if e.Woke || e.Status >= 500 || l.config.SampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < l.config.SampleRate
+}
+
+// Close writes the queued entries and closes the sinks.
+func (l *Logger) Close() {
+	if l == nil {
+		return
+	}
+	close(l.done)
+	l.wg.Wait()
+	for _, sink := range l.config.Sinks {
+		sink.Close()
+	}
+}
+
+func (l *Logger) run() {
+	defer l.wg.Done()
+	var lastError time.Time
+	write := func(e Entry) {
+		line := l.config.Format.Format(e)
+		for _, sink := range l.config.Sinks {
+			// Report failing sinks at most once a minute, not once per request
+			if err := sink.Write(line); err != nil && time.Since(lastError) > time.Minute {
+				lastError = time.Now()
+				log.Error("Error writing access log", "error", err)
+			}
+		}
+		if n := l.dropped.Swap(0); n > 0 {
+			log.Warn("Dropped access log entries, the queue was full", "entries", n)
+		}
+	}
+
+	for {
+		select {
+		case e := <-l.queue:
+			write(e)
+		case <-l.done:
+			for {
+				select {
+				case e := <-l.queue:
+					write(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
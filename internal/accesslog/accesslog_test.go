@@ -0,0 +1,166 @@
+package accesslog
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var entry = Entry{
+	Time:      time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+	RequestID: "req-1",
+	ClientIP:  "127.0.0.1",
+	User:      "alice",
+	Method:    "GET",
+	Host:      "shop.example.com",
+	URI:       "/a?b=1",
+	Proto:     "HTTP/1.1",
+	Status:    200,
+	Bytes:     2326,
+	Duration:  1500 * time.Microsecond,
+	RouteID:   "shop",
+	Upstream:  "web.shop.svc:80",
+	Referer:   "http://ref/",
+	UserAgent: `Mozilla/5.0 "quoted"`,
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"common", `127.0.0.1 - alice [10/Oct/2000:13:55:36 -0700] "GET /a?b=1 HTTP/1.1" 200 2326`},
+		{"", `127.0.0.1 - alice [10/Oct/2000:13:55:36 -0700] "GET /a?b=1 HTTP/1.1" 200 2326 "http://ref/" "Mozilla/5.0 \"quoted\""`},
+		{"json", `{"time":"2000-10-10T13:55:36.000-07:00","request_id":"req-1","client_ip":"127.0.0.1","user":"alice","method":"GET","host":"shop.example.com","uri":"/a?b=1","proto":"HTTP/1.1","status":200,"bytes":2326,"latency_ms":1.5,"route_id":"shop","upstream":"web.shop.svc:80","woke":false,"referer":"http://ref/","user_agent":"Mozilla/5.0 \"quoted\""}`},
+		{"{{.ClientIP}} {{.RouteID}}\n{{.Status}} {{.Duration}}\n", `127.0.0.1 shop 200 1.5ms`},
+	}
+	for _, tt := range tests {
+		f, err := NewFormatter(tt.format)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.format, err)
+		}
+		if got := string(f.Format(entry)); got != tt.want {
+			t.Errorf("%q:\ngot  %s\nwant %s", tt.format, got, tt.want)
+		}
+	}
+
+	anonymous := Entry{Time: entry.Time, Method: "HEAD", URI: "/", Proto: "HTTP/2.0", Status: 503}
+	f, _ := NewFormatter("combined")
+	if got := string(f.Format(anonymous)); got != `- - - [10/Oct/2000:13:55:36 -0700] "HEAD / HTTP/2.0" 503 - "-" "-"` {
+		t.Errorf("empty fields: %s", got)
+	}
+
+	for _, bad := range []string{"apache", "{{.Missing", "{{.Unknown}}"} {
+		f, err := NewFormatter(bad)
+		if err == nil && !strings.HasPrefix(string(f.Format(entry)), "access log template error") {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestSampling(t *testing.T) {
+	var out bytes.Buffer
+	l := New(Config{Format: mustFormat(t, "{{.URI}}"), Sinks: []Sink{NewWriterSink(&out)}, SampleRate: 0})
+	l.Log(Entry{URI: "/sampled-out", Status: 200})
+	l.Log(Entry{URI: "/error", Status: 502})
+	l.Log(Entry{URI: "/wake", Status: 200, Woke: true})
+	l.Close()
+
+	if got := out.String(); got != "/error\n/wake\n" {
+		t.Errorf("logged %q", got)
+	}
+
+	var discard *Logger
+	discard.Log(entry)
+	discard.Close()
+}
+
+func mustFormat(t *testing.T, format string) Formatter {
+	f, err := NewFormatter(format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+	s, err := NewFileSink(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first", "second", "third", "fourth"} {
+		if err := s.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	for file, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		if data, err := os.ReadFile(file); string(data) != want {
+			t.Errorf("%s: %q, %v; want %q", filepath.Base(file), data, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than 2 backups: %v", err)
+	}
+
+	// Reopening appends to the current file
+	s, _ = NewFileSink(path, 0, 0)
+	s.Write([]byte("fifth"))
+	s.Close()
+	if data, _ := os.ReadFile(path); string(data) != "fourth\nfifth\n" {
+		t.Errorf("reopened: %q", data)
+	}
+}
+
+func TestSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := NewSyslogSink("udp", conn.LocalAddr().String(), "smart-proxy")
+	defer s.Close()
+	if err := s.Write([]byte("GET / 200")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<134>1 ") || !strings.Contains(msg, " smart-proxy ") || !strings.HasSuffix(msg, " - - GET / 200") {
+		t.Errorf("message %q", msg)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("ACCESS_LOG", "")
+	if l, err := FromEnv(); l != nil || err != nil {
+		t.Errorf("unset: %v, %v", l, err)
+	}
+
+	for name, env := range map[string][2]string{
+		"sink":        {"ACCESS_LOG", "kafka://broker"},
+		"format":      {"ACCESS_LOG_FORMAT", "apache"},
+		"sample rate": {"ACCESS_LOG_SAMPLE_RATE", "1.5"},
+		"max size":    {"ACCESS_LOG_FILE_MAX_SIZE", "-1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("ACCESS_LOG", "file:"+filepath.Join(t.TempDir(), "access.log"))
+			t.Setenv(env[0], env[1])
+			if _, err := FromEnv(); err == nil {
+				t.Errorf("invalid %s accepted", env[0])
+			}
+		})
+	}
+}
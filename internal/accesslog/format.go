@@ -0,0 +1,133 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Formatter renders an entry as a single line, without the trailing newline.
+type Formatter interface {
+	Format(e Entry) []byte
+}
+
+// NewFormatter returns the formatter for ACCESS_LOG_FORMAT: "common", "combined" (the default), "json",
+// or a text/template over Entry such as `{{.ClientIP}} {{.RouteID}} {{.Status}} {{.Duration}}`.
+func NewFormatter(format string) (Formatter, error) {
+	switch format {
+	case "", "combined":
+		return commonFormat{combined: true}, nil
+	case "common":
+		return commonFormat{}, nil
+	case "json":
+		return jsonFormat{}, nil
+	}
+	if !strings.Contains(format, "{{") {
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+	tmpl, err := template.New("access").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access log template: %w", err)
+	}
+	return templateFormat{tmpl}, nil
+}
+
+// commonFormat is the NCSA Common Log Format, and the Combined format when combined is set:
+//
+//	127.0.0.1 - alice [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.1" 200 2326 "http://ref/" "Mozilla/5.0"
+type commonFormat struct {
+	combined bool
+}
+
+func (f commonFormat) Format(e Entry) []byte {
+	var b bytes.Buffer
+	b.WriteString(dash(e.ClientIP))
+	b.WriteString(" - ")
+	b.WriteString(dash(e.User))
+	b.WriteString(" [")
+	b.WriteString(e.Time.Format("02/Jan/2006:15:04:05 -0700"))
+	b.WriteString("] ")
+	b.WriteString(strconv.Quote(e.Method + " " + e.URI + " " + e.Proto))
+	b.WriteByte(' ')
+	b.WriteString(strconv.Itoa(e.Status))
+	b.WriteByte(' ')
+	if e.Bytes > 0 {
+		b.WriteString(strconv.FormatInt(e.Bytes, 10))
+	} else {
+		b.WriteByte('-')
+	}
+	if f.combined {
+		b.WriteByte(' ')
+		b.WriteString(strconv.Quote(dash(e.Referer)))
+		b.WriteByte(' ')
+		b.WriteString(strconv.Quote(dash(e.UserAgent)))
+	}
+	return b.Bytes()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// jsonFormat writes one JSON object per line.
+type jsonFormat struct{}
+
+type jsonEntry struct {
+	Time      string  `json:"time"`
+	RequestID string  `json:"request_id,omitempty"`
+	ClientIP  string  `json:"client_ip"`
+	User      string  `json:"user,omitempty"`
+	Method    string  `json:"method"`
+	Host      string  `json:"host"`
+	URI       string  `json:"uri"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     int64   `json:"bytes"`
+	LatencyMS float64 `json:"latency_ms"`
+	RouteID   string  `json:"route_id,omitempty"`
+	Upstream  string  `json:"upstream,omitempty"`
+	Woke      bool    `json:"woke"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+}
+
+func (jsonFormat) Format(e Entry) []byte {
+	line, _ := json.Marshal(jsonEntry{
+		Time:      e.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+		RequestID: e.RequestID,
+		ClientIP:  e.ClientIP,
+		User:      e.User,
+		Method:    e.Method,
+		Host:      e.Host,
+		URI:       e.URI,
+		Proto:     e.Proto,
+		Status:    e.Status,
+		Bytes:     e.Bytes,
+		LatencyMS: float64(e.Duration.Microseconds()) / 1000,
+		RouteID:   e.RouteID,
+		Upstream:  e.Upstream,
+		Woke:      e.Woke,
+		Referer:   e.Referer,
+		UserAgent: e.UserAgent,
+	})
+	return line
+}
+
+// templateFormat executes a user template; newlines in the output are replaced by spaces.
+type templateFormat struct {
+	tmpl *template.Template
+}
+
+func (f templateFormat) Format(e Entry) []byte {
+	var b bytes.Buffer
+	if err := f.tmpl.Execute(&b, e); err != nil {
+		return []byte("access log template error: " + err.Error())
+	}
+	return bytes.ReplaceAll(bytes.TrimRight(b.Bytes(), "\n"), []byte("\n"), []byte(" "))
+}
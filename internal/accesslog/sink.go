@@ -0,0 +1,176 @@
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sink receives formatted lines. Sinks are used from a single goroutine.
+type Sink interface {
+	Write(line []byte) error
+	Close() error
+}
+
+// writerSink writes lines to an io.Writer, such as os.Stdout.
+type writerSink struct {
+	w io.Writer
+}
+
+// NewWriterSink returns a sink writing newline-terminated lines to w.
+func NewWriterSink(w io.Writer) Sink {
+	return writerSink{w: w}
+}
+
+func (s writerSink) Write(line []byte) error {
+	_, err := s.w.Write(append(line, '\n'))
+	return err
+}
+
+func (writerSink) Close() error { return nil }
+
+// FileSink appends lines to a file and rotates it once it exceeds maxSize bytes:
+// access.log is renamed access.log.1, access.log.1 becomes access.log.2, and so on up to maxBackups.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileSink opens (or creates) the file at path. A maxSize of 0 disables rotation.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("access log file path is empty")
+	}
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line = append(line, '\n')
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if s.maxBackups == 0 {
+		os.Remove(s.path)
+	} else {
+		os.Remove(s.backup(s.maxBackups))
+		for i := s.maxBackups - 1; i >= 1; i-- {
+			os.Rename(s.backup(i), s.backup(i+1))
+		}
+		if err := os.Rename(s.path, s.backup(1)); err != nil {
+			return err
+		}
+	}
+	return s.open()
+}
+
+func (s *FileSink) backup(n int) string {
+	return s.path + "." + strconv.Itoa(n)
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// SyslogSink sends lines as RFC 5424 messages (facility local0, severity info) over UDP or TCP.
+// TCP messages use octet-counting framing (RFC 6587); the connection is re-established after errors.
+type SyslogSink struct {
+	network  string
+	addr     string
+	appName  string
+	hostname string
+	conn     net.Conn
+}
+
+// syslogPriority is local0 (16) * 8 + info (6).
+const syslogPriority = 134
+
+// NewSyslogSink returns a sink for the syslog server at addr ("host:port"). It connects lazily.
+func NewSyslogSink(network, addr, appName string) *SyslogSink {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &SyslogSink{network: network, addr: addr, appName: appName, hostname: hostname}
+}
+
+func (s *SyslogSink) Write(line []byte) error {
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", syslogPriority,
+		time.Now().UTC().Format(time.RFC3339Nano), s.hostname, s.appName, os.Getpid(), line)
+	if s.network == "tcp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	// Retry once on a fresh connection, e.g. after the server restarted
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if s.conn, err = net.DialTimeout(s.network, s.addr, 5*time.Second); err != nil {
+				s.conn = nil
+				return err
+			}
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err = io.WriteString(s.conn, msg); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// Close closes the connection, if any.
+func (s *SyslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
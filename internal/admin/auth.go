@@ -0,0 +1,115 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/proxy"
+	"smart-proxy/internal/store"
+)
+
+// authorize reports whether the caller holds at least role in namespace, replying 403 otherwise.
+// An empty namespace requires the role cluster-wide.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, role auth.Role, namespace string) bool {
+	identity := auth.FromContext(r.Context())
+	if identity != nil && identity.Can(role, namespace) {
+		return true
+	}
+	target := namespace
+	if target == "" {
+		target = "all namespaces"
+	}
+	http.Error(w, "Forbidden: requires role "+role.String()+" in "+target, http.StatusForbidden)
+	return false
+}
+
+// namespaceOrDefault resolves an empty namespace to the proxy's own one, as the k8s client does.
+func (s *Server) namespaceOrDefault(namespace string) string {
+	if namespace == "" && s.k8sClient != nil {
+		return s.k8sClient.Namespace
+	}
+	return namespace
+}
+
+// visibleRoutes returns the routes the caller may view.
+func (s *Server) visibleRoutes(r *http.Request, routes []store.RouteConfig) []store.RouteConfig {
+	identity := auth.FromContext(r.Context())
+	visible := make([]store.RouteConfig, 0, len(routes))
+	for _, route := range routes {
+		if identity.Can(auth.RoleViewer, route.Namespace) {
+			visible = append(visible, route)
+		}
+	}
+	return visible
+}
+
+// visibleMetrics returns a copy of the metrics restricted to the routes the caller may view.
+func (s *Server) visibleMetrics(r *http.Request) proxy.Stats {
+	stats := s.Metrics.Snapshot()
+	identity := auth.FromContext(r.Context())
+	if identity.Can(auth.RoleViewer, "") {
+		return stats
+	}
+
+	filtered := proxy.Stats{RouteStats: make(map[string]int64)}
+	for _, route := range s.visibleRoutes(r, s.store.GetAllRoutes()) {
+		if count, ok := stats.RouteStats[route.ID]; ok {
+			filtered.RouteStats[route.ID] = count
+			filtered.TotalRequests += count
+		}
+	}
+	return filtered
+}
+
+func (s *Server) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	identity := auth.FromContext(r.Context())
+
+	namespaces := []string{auth.AllNamespaces}
+	if s.k8sClient != nil {
+		if list, err := s.k8sClient.ListNamespaces(); err == nil {
+			namespaces = append(namespaces, list...)
+		}
+	}
+	roles := make(map[string]auth.Role)
+	for _, ns := range namespaces {
+		if role := identity.Roles.RoleIn(ns); role != auth.RoleNone {
+			roles[ns] = role
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"identity": identity,
+		"roles":    roles,
+	})
+}
+
+// handleSession stores the bearer token of an authenticated caller in an HttpOnly cookie (POST)
+// or clears it (DELETE), so browsers can use the dashboard and log stream without custom headers.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	cookie := &http.Cookie{
+		Name:     auth.CookieName,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		cookie.Value = auth.BearerToken(r)
+		if cookie.Value == "" {
+			http.Error(w, "Missing bearer token", http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		cookie.MaxAge = -1
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	http.SetCookie(w, cookie)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/store"
+)
+
+func requestAs(identity *auth.Identity) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/routes", nil)
+	if identity != nil {
+		r = r.WithContext(auth.WithIdentity(r.Context(), identity))
+	}
+	return r
+}
+
+func TestAuthorize(t *testing.T) {
+	s := NewServer(nil, store.NewStore(filepath.Join(t.TempDir(), "routes.json")), nil, nil)
+	operator := &auth.Identity{Name: "bob", Roles: auth.StaticRoles{"shop": auth.RoleOperator, "cart": auth.RoleViewer}}
+	clusterViewer := &auth.Identity{Name: "carol", Roles: auth.StaticRoles{auth.AllNamespaces: auth.RoleViewer}}
+
+	tests := []struct {
+		name      string
+		identity  *auth.Identity
+		role      auth.Role
+		namespace string
+		denial    string // Empty if allowed
+	}{
+		{"role held in the namespace", operator, auth.RoleOperator, "shop", ""},
+		{"lower role in the namespace", operator, auth.RoleViewer, "shop", ""},
+		{"higher role in the namespace", operator, auth.RoleAdmin, "shop", "requires role admin in shop"},
+		{"role held in another namespace", operator, auth.RoleOperator, "cart", "requires role operator in cart"},
+		{"namespace without role", operator, auth.RoleViewer, "billing", "requires role viewer in billing"},
+		{"cluster-wide with namespaced roles", operator, auth.RoleViewer, "", "requires role viewer in all namespaces"},
+		{"cluster-wide role in a namespace", clusterViewer, auth.RoleViewer, "billing", ""},
+		{"cluster-wide role too low", clusterViewer, auth.RoleOperator, "billing", "requires role operator in billing"},
+		{"no identity", nil, auth.RoleViewer, "shop", "requires role viewer in shop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			allowed := s.authorize(w, requestAs(tt.identity), tt.role, tt.namespace)
+			if tt.denial == "" {
+				if !allowed || w.Code != http.StatusOK {
+					t.Errorf("denied: %d %s", w.Code, w.Body)
+				}
+				return
+			}
+			if allowed || w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), tt.denial) {
+				t.Errorf("got %v, %d %q; want 403 %q", allowed, w.Code, w.Body, tt.denial)
+			}
+		})
+	}
+}
+
+func TestCheckRouteRequiresAdminInBothNamespaces(t *testing.T) {
+	s := NewServer(nil, store.NewStore(filepath.Join(t.TempDir(), "routes.json")), nil, nil)
+	s.store.AddRoute(&store.RouteConfig{ID: "shop", Path: "/", Namespace: "shop", Deployment: "web", TargetService: "web", TargetPort: 80})
+	shopAdmin := &auth.Identity{Name: "bob", Roles: auth.StaticRoles{"shop": auth.RoleAdmin, "cart": auth.RoleOperator}}
+
+	route, _ := s.store.GetRoute("shop")
+	route.IdleTimeout = s.MinIdleTimeout
+	w := httptest.NewRecorder()
+	if !s.checkRoute(w, requestAs(shopAdmin), route) {
+		t.Fatalf("update in own namespace denied: %d %s", w.Code, w.Body)
+	}
+
+	// Moving the route to cart needs admin there, and in shop to take it out
+	route.Namespace = "cart"
+	w = httptest.NewRecorder()
+	if s.checkRoute(w, requestAs(shopAdmin), route) || w.Code != http.StatusForbidden {
+		t.Errorf("move to cart: %d %s", w.Code, w.Body)
+	}
+	cartAdmin := &auth.Identity{Name: "carol", Roles: auth.StaticRoles{"cart": auth.RoleAdmin}}
+	w = httptest.NewRecorder()
+	if s.checkRoute(w, requestAs(cartAdmin), route) || !strings.Contains(w.Body.String(), "admin in shop") {
+		t.Errorf("move out of shop: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestVisibleRoutes(t *testing.T) {
+	s := NewServer(nil, store.NewStore(filepath.Join(t.TempDir(), "routes.json")), nil, nil)
+	routes := []store.RouteConfig{{ID: "a", Namespace: "shop"}, {ID: "b", Namespace: "cart"}, {ID: "c", Namespace: "billing"}}
+	viewer := &auth.Identity{Name: "bob", Roles: auth.StaticRoles{"shop": auth.RoleViewer, "cart": auth.RoleAdmin}}
+
+	var ids []string
+	for _, route := range s.visibleRoutes(requestAs(viewer), routes) {
+		ids = append(ids, route.ID)
+	}
+	if strings.Join(ids, ",") != "a,b" {
+		t.Errorf("visible routes %v, want a,b", ids)
+	}
+}
@@ -0,0 +1,246 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-proxy/internal/audit"
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/manifest"
+	"smart-proxy/internal/store"
+)
+
+// maxDocumentBytes bounds the documents accepted by /api/config/import.
+const maxDocumentBytes = 10 << 20
+
+// importResponse is the response of /api/config/import.
+type importResponse struct {
+	DryRun bool `json:"dry_run"`
+	manifest.Plan
+	Errors manifest.Errors `json:"errors,omitempty"` // Validation errors (nothing applied), or routes that failed to apply
+}
+
+// importProblem is the response of an import that was not applied.
+type importProblem struct {
+	problem
+	DryRun  bool              `json:"dry_run"`
+	Changes []manifest.Change `json:"changes"` // Always empty
+}
+
+// handleConfigExport returns the routes the caller may view as a declarative document.
+// Query: ?namespace=<namespace>&format=yaml|json (default yaml)
+func (s *Server) handleConfigExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = manifest.FormatYAML
+	}
+	routes := s.visibleRoutes(r, s.filterRoutes(s.store.GetAllRoutes(), r.URL.Query().Get("namespace")))
+	data, err := manifest.Encode(sortedRoutes(routes), format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format == manifest.FormatJSON {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/yaml")
+	}
+	w.Write(data)
+}
+
+// handleConfigImport creates and updates the routes of a declarative document, YAML or JSON.
+// Query: ?dry_run=true only returns the changes; ?prune=true also deletes the routes missing from the
+// document, among those the caller administers; ?namespace=<namespace> restricts the document and the pruning
+// to one namespace. The document is checked as a whole first: if anything is wrong, nothing is applied.
+func (s *Server) handleConfigImport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	dryRun, prune := query.Get("dry_run") == "true", query.Get("prune") == "true"
+	namespace := query.Get("namespace")
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxDocumentBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	routes, err := manifest.Parse(data)
+	if err != nil {
+		writeImportErrors(w, http.StatusUnprocessableEntity, dryRun, err.(manifest.Errors))
+		return
+	}
+
+	// Each route on its own, its placement and the permissions it needs
+	identity := auth.FromContext(r.Context())
+	var invalid, forbidden manifest.Errors
+	for i, route := range routes {
+		path := fmt.Sprintf("routes[%d]", i)
+		if namespace != "" && route.Namespace != namespace {
+			invalid.Add(path+".namespace", "must be %s, the namespace imported", namespace)
+		}
+		invalid = append(invalid, route.Validate(s.MinIdleTimeout).Prefix(path)...)
+		if !identity.Can(auth.RoleAdmin, route.Namespace) {
+			forbidden.Add(path, "requires role admin in %s", route.Namespace)
+		} else if existing, ok := s.store.GetRoute(route.ID); ok && existing.Namespace != route.Namespace &&
+			!identity.Can(auth.RoleAdmin, existing.Namespace) {
+			forbidden.Add(path+".namespace", "moving the route requires role admin in %s", existing.Namespace)
+		}
+	}
+	if len(forbidden) > 0 {
+		writeImportErrors(w, http.StatusForbidden, dryRun, append(forbidden, invalid...))
+		return
+	}
+	if len(invalid) > 0 {
+		writeImportErrors(w, http.StatusUnprocessableEntity, dryRun, invalid)
+		return
+	}
+
+	var prunable func(store.RouteConfig) bool
+	if prune {
+		prunable = func(route store.RouteConfig) bool {
+			return (namespace == "" || route.Namespace == namespace) && identity.Can(auth.RoleAdmin, route.Namespace) &&
+				!patchedResource(route.ID)
+		}
+	}
+	current := s.store.GetAllRoutes()
+	plan, err := manifest.Diff(current, routes, prunable)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The cluster, then host and path conflicts with the routes as they will be once the document is applied
+	for i, route := range routes {
+		invalid = append(invalid, s.clusterProblems(r.Context(), route).Prefix(fmt.Sprintf("routes[%d]", i))...)
+	}
+	replaced := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		replaced[route.ID] = true
+	}
+	for _, change := range plan.Changes {
+		if change.Action == manifest.ActionDelete {
+			replaced[change.RouteID] = true
+		}
+	}
+	var kept []store.RouteConfig
+	for _, route := range current {
+		if !replaced[route.ID] {
+			kept = append(kept, route)
+		}
+	}
+	for i, route := range routes {
+		others := append(append(kept[:len(kept):len(kept)], routes[:i]...), routes[i+1:]...)
+		invalid = append(invalid, conflictProblems(route, others, identity).Prefix(fmt.Sprintf("routes[%d]", i))...)
+	}
+	if len(invalid) > 0 {
+		writeImportErrors(w, http.StatusUnprocessableEntity, dryRun, invalid)
+		return
+	}
+	response := importResponse{DryRun: dryRun, Plan: plan}
+	if dryRun {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// Apply: deletes, then creates and updates. Conflicts are checked again as routes are saved: a route taking
+	// the host and path of one updated after it is retried once the others are saved.
+	applied := map[string][]string{}
+	done := func(change *manifest.Change, err error) {
+		if err != nil {
+			response.Errors.Add(change.RouteID, "%s failed: %v", change.Action, err)
+			return
+		}
+		applied[change.Action] = append(applied[change.Action], change.RouteID)
+	}
+	var pending []*manifest.Change
+	for i := range response.Changes {
+		change := &response.Changes[i]
+		if change.Action == manifest.ActionDelete {
+			done(change, s.store.RemoveRoute(change.RouteID))
+		} else {
+			pending = append(pending, change)
+		}
+	}
+	for len(pending) > 0 {
+		var conflicting []*manifest.Change
+		errs := map[*manifest.Change]error{}
+		for _, change := range pending {
+			route := *change.Route
+			route.LastActivity = time.Now() // New routes start their idle timeout now
+			if existing, ok := s.store.GetRoute(route.ID); ok {
+				route.LastActivity = existing.LastActivity
+			}
+			err := s.saveRoute(&route, nil)
+			change.RouteID = route.ID
+			var conflict *store.ConflictError
+			if errors.As(err, &conflict) {
+				conflicting = append(conflicting, change)
+				errs[change] = err
+				continue
+			}
+			done(change, err)
+		}
+		if len(conflicting) == len(pending) {
+			for _, change := range conflicting {
+				done(change, errs[change])
+			}
+			break
+		}
+		pending = conflicting
+	}
+
+	actor := identity.Name
+	created, updated, deleted := plan.Counts()
+	log.InfoContext(r.Context(), "Configuration imported", "by", actor, "created", created, "updated", updated,
+		"deleted", deleted, "unchanged", plan.Unchanged, "errors", len(response.Errors))
+	if len(response.Changes) > 0 {
+		details := map[string]string{"prune": strconv.FormatBool(prune)}
+		for action, ids := range applied {
+			details[action] = strings.Join(ids, ",")
+		}
+		s.Audit.Record(audit.Entry{Actor: actor, Action: audit.ActionConfigImport, Namespace: namespace, Details: details})
+	}
+
+	status := http.StatusOK
+	if len(response.Errors) > 0 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeImportErrors answers an import that was not applied with a problem details response, which also
+// holds the fields of import responses.
+func writeImportErrors(w http.ResponseWriter, status int, dryRun bool, errs manifest.Errors) {
+	problemType, title := problemInvalidDocument, "Invalid document"
+	if status == http.StatusForbidden {
+		problemType, title = problemForbidden, "Forbidden"
+	}
+	errs.Err() // Sorts by path
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(importProblem{
+		problem: problem{Type: problemType, Title: title, Status: status, Detail: errs.Error(), Errors: errs},
+		DryRun:  dryRun,
+		Changes: []manifest.Change{},
+	})
+}
+
+// patchedResource reports whether a route belongs to a patched Ingress or OpenShift Route. Pruning leaves
+// those alone: they are removed by unpatching the resource, else it would point to a proxy without route.
+func patchedResource(id string) bool {
+	return strings.HasPrefix(id, "ing-") || strings.HasPrefix(id, "route-")
+}
+
+// sortedRoutes sorts routes by ID, for stable documents.
+func sortedRoutes(routes []store.RouteConfig) []store.RouteConfig {
+	sort.Slice(routes, func(i, j int) bool { return routes[i].ID < routes[j].ID })
+	return routes
+}
@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/store"
+)
+
+const importDocument = `
+routes:
+  - id: shop
+    namespace: shop
+    deployment: web
+    target_service: web
+    target_port: 80
+    path: /
+    idle_timeout: 1h
+  - id: cart
+    namespace: shop
+    deployment: cart
+    target_service: cart
+    target_port: 80
+    path: /cart
+    idle_timeout: 30m
+`
+
+func importAs(s *Server, identity *auth.Identity, query, doc string) (*httptest.ResponseRecorder, importResponse) {
+	r := httptest.NewRequest(http.MethodPost, "/api/config/import?"+query, strings.NewReader(doc))
+	r = r.WithContext(auth.WithIdentity(r.Context(), identity))
+	w := httptest.NewRecorder()
+	s.handleConfigImport(w, r)
+	var response importResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func TestImportDryRun(t *testing.T) {
+	s := NewServer(nil, store.NewStore(filepath.Join(t.TempDir(), "routes.json")), nil, nil)
+	s.store.AddRoute(&store.RouteConfig{ID: "shop", Path: "/", Namespace: "shop", Deployment: "web", TargetService: "web", TargetPort: 80, IdleTimeout: 30 * time.Minute})
+	s.store.AddRoute(&store.RouteConfig{ID: "old", Path: "/old", Namespace: "shop", Deployment: "old", TargetService: "old", TargetPort: 80})
+	admin := &auth.Identity{Name: "alice", Roles: auth.StaticRoles{"shop": auth.RoleAdmin}}
+
+	w, plan := importAs(s, admin, "dry_run=true&prune=true", importDocument)
+	if w.Code != http.StatusOK || !plan.DryRun {
+		t.Fatalf("dry run: %d %s", w.Code, w.Body)
+	}
+	var changes []string
+	for _, c := range plan.Changes {
+		changes = append(changes, c.Action+" "+c.RouteID)
+	}
+	if strings.Join(changes, ", ") != "create cart, update shop, delete old" {
+		t.Errorf("changes: %q", changes)
+	}
+	if len(plan.Changes[1].Fields) != 1 || plan.Changes[1].Fields[0].Path != "idle_timeout" {
+		t.Errorf("update: %+v", plan.Changes[1].Fields)
+	}
+	if len(s.store.GetAllRoutes()) != 2 {
+		t.Error("dry run changed the routes")
+	}
+	if _, ok := s.store.GetRoute("cart"); ok {
+		t.Error("dry run created a route")
+	}
+
+	// Applying does what the dry run announced
+	if w, applied := importAs(s, admin, "prune=true", importDocument); w.Code != http.StatusOK || applied.DryRun || len(applied.Changes) != 3 {
+		t.Fatalf("import: %d %s", w.Code, w.Body)
+	}
+	if _, ok := s.store.GetRoute("old"); ok {
+		t.Error("pruned route kept")
+	}
+	if route, ok := s.store.GetRoute("shop"); !ok || route.IdleTimeout.String() != "1h0m0s" {
+		t.Errorf("updated route: %+v", route)
+	}
+	if w, again := importAs(s, admin, "dry_run=true&prune=true", importDocument); w.Code != http.StatusOK || len(again.Changes) != 0 || again.Unchanged != 2 {
+		t.Errorf("second dry run: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestImportIsAllOrNothing(t *testing.T) {
+	s := NewServer(nil, store.NewStore(filepath.Join(t.TempDir(), "routes.json")), nil, nil)
+	admin := &auth.Identity{Name: "alice", Roles: auth.StaticRoles{"shop": auth.RoleAdmin}}
+
+	invalid := importDocument + "  - id: blog\n    namespace: shop\n    path: /blog\n    idle_timeout: 30m\n"
+	w, response := importAs(s, admin, "", invalid)
+	if w.Code != http.StatusUnprocessableEntity || len(response.Errors) != 1 || response.Errors[0].Path != "routes[2].deployment" {
+		t.Errorf("invalid document: %d %s", w.Code, w.Body)
+	}
+	if len(s.store.GetAllRoutes()) != 0 {
+		t.Error("routes of an invalid document applied")
+	}
+
+	other := importDocument + "  - id: blog\n    namespace: blog\n    deployment: blog\n    target_service: blog\n    target_port: 80\n    path: /blog\n    idle_timeout: 30m\n"
+	w, response = importAs(s, admin, "dry_run=true", other)
+	if w.Code != http.StatusForbidden || !response.DryRun || len(response.Errors) != 1 || response.Errors[0].Path != "routes[2]" {
+		t.Errorf("route in a namespace not administered: %d %s", w.Code, w.Body)
+	}
+	if w, _ = importAs(s, admin, "namespace=blog", importDocument); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("routes outside the namespace imported: %d %s", w.Code, w.Body)
+	}
+	if len(s.store.GetAllRoutes()) != 0 {
+		t.Error("routes of a rejected document applied")
+	}
+}
@@ -0,0 +1,170 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"smart-proxy/internal/audit"
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/store"
+)
+
+// modeRequest is the body of PUT /api/routes/mode. Until and Duration are exclusive; neither means no expiry.
+type modeRequest struct {
+	State       string    `json:"state"`
+	Reason      string    `json:"reason,omitempty"`
+	Until       time.Time `json:"until,omitzero"`
+	Duration    string    `json:"duration,omitempty"` // e.g. "2h"
+	RedirectURL string    `json:"redirect_url,omitempty"`
+}
+
+// modeResponse reports the operational state of a route.
+type modeResponse struct {
+	RouteID string           `json:"route_id"`
+	State   string           `json:"state"`          // In effect: normal once the mode expired
+	Mode    *store.RouteMode `json:"mode,omitempty"` // As set
+}
+
+// handleRouteMode reads (GET), sets (PUT) or clears (DELETE) the operational state of a route:
+// maintenance, pinned awake, disabled or normal. Query: ?route=<route ID>
+func (s *Server) handleRouteMode(w http.ResponseWriter, r *http.Request) {
+	route, found := s.store.GetRoute(r.URL.Query().Get("route"))
+	if !found {
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return
+	}
+
+	var mode *store.RouteMode
+	switch r.Method {
+	case http.MethodGet:
+		if !s.authorize(w, r, auth.RoleViewer, route.Namespace) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(modeResponse{RouteID: route.ID, State: route.CurrentMode(), Mode: route.Mode})
+		return
+	case http.MethodPut:
+		var req modeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var err error
+		if mode, err = req.mode(time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorize(w, r, auth.RoleOperator, route.Namespace) {
+		return
+	}
+
+	actor := auth.FromContext(r.Context()).Name
+	state, reason := store.ModeNormal, ""
+	if mode != nil {
+		mode.SetBy, mode.SetAt = actor, time.Now()
+		state, reason = mode.State, mode.Reason
+	}
+	previous := route.CurrentMode()
+	updated, err := s.store.SetMode(route.ID, mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.InfoContext(r.Context(), "Route mode changed", "route_id", route.ID, "mode", state, "previous", previous, "by", actor)
+
+	details := map[string]string{"state": state, "previous": previous}
+	if mode != nil && !mode.Until.IsZero() {
+		details["until"] = mode.Until.Format(time.RFC3339)
+	}
+	if mode != nil && mode.RedirectURL != "" {
+		details["redirect_url"] = mode.RedirectURL
+	}
+	s.Audit.Record(audit.Entry{
+		Actor:     actor,
+		Action:    audit.ActionRouteMode,
+		RouteID:   route.ID,
+		Namespace: route.Namespace,
+		Reason:    reason,
+		Details:   details,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(modeResponse{RouteID: updated.ID, State: updated.CurrentMode(), Mode: updated.Mode})
+}
+
+// mode validates the request and returns the mode to set, nil for normal.
+func (req modeRequest) mode(now time.Time) (*store.RouteMode, error) {
+	switch req.State {
+	case store.ModeNormal:
+		return nil, nil
+	case store.ModeMaintenance, store.ModePinned, store.ModeDisabled:
+	default:
+		return nil, fmt.Errorf("invalid state %q, must be normal, maintenance, pinned or disabled", req.State)
+	}
+
+	mode := &store.RouteMode{State: req.State, Reason: req.Reason, Until: req.Until}
+	if req.Duration != "" {
+		if !req.Until.IsZero() {
+			return nil, errors.New("set either until or duration, not both")
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration %q", req.Duration)
+		}
+		mode.Until = now.Add(d)
+	}
+	if !mode.Until.IsZero() && !mode.Until.After(now) {
+		return nil, errors.New("the mode must end in the future")
+	}
+
+	if req.RedirectURL != "" {
+		if req.State != store.ModeDisabled {
+			return nil, errors.New("only disabled routes redirect")
+		}
+		u, err := url.Parse(req.RedirectURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.New("invalid redirect URL, must be an absolute http(s) URL")
+		}
+		mode.RedirectURL = req.RedirectURL
+	}
+	return mode, nil
+}
+
+// handleAudit lists recent audit entries for the namespaces the caller may view, newest first.
+// Optional filters: ?route=<route ID>&action=<action>&limit=<n> (default 100)
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	identity := auth.FromContext(r.Context())
+	routeID, action := query.Get("route"), query.Get("action")
+	entries := s.Audit.Recent(func(e audit.Entry) bool {
+		return identity.Can(auth.RoleViewer, e.Namespace) &&
+			(routeID == "" || e.RouteID == routeID) && (action == "" || e.Action == action)
+	}, limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -3,35 +3,58 @@
 package admin
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"smart-proxy/internal/audit"
+	"smart-proxy/internal/auth"
 	"smart-proxy/internal/k8s"
 	"smart-proxy/internal/logger"
+	"smart-proxy/internal/metrics"
+	"smart-proxy/internal/notify"
+	"smart-proxy/internal/openapi"
 	"smart-proxy/internal/proxy"
+	"smart-proxy/internal/savings"
 	"smart-proxy/internal/store"
-
-	routev1 "github.com/openshift/api/route/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"smart-proxy/internal/stream"
+	"smart-proxy/internal/timeseries"
+	"smart-proxy/internal/watcher"
 )
 
+var log = logger.Component("admin")
+
 // Server represents the admin HTTP server.
 type Server struct {
 	k8sClient *k8s.Client
 	store     *store.Store
 	Metrics   *proxy.Metrics
+	Notifier  *notify.Notifier // Optional
+	Savings   *savings.Tracker // Optional
+	Traffic   *timeseries.DB   // Optional
+	Stream    *stream.Hub      // Optional
+	Audit     *audit.Log       // Optional
+	Proxy     *proxy.Handler   // Optional: manual wake-ups and wake links
+	Watcher   *watcher.Watcher // Optional: manual sleep
 	ProxyPort int
+	// MinIdleTimeout is the shortest idle timeout routes may be saved with (MIN_IDLE_TIMEOUT)
+	MinIdleTimeout time.Duration
+	auth           auth.Authenticator
 }
 
 // NewServer creates a new instance of the admin Server.
-// It initializes the server with the provided Kubernetes client, configuration store, and metrics collector.
-// It also reads the SMART_PROXY_PORT environment variable to configure the proxy port (default: 80).
-func NewServer(k8sClient *k8s.Client, store *store.Store, metrics *proxy.Metrics) *Server {
+// It initializes the server with the provided Kubernetes client, configuration store, metrics collector
+// and authenticator (nil disables authentication).
+// It also reads the SMART_PROXY_PORT environment variable to configure the proxy port (default: 80), and
+// MIN_IDLE_TIMEOUT for the shortest idle timeout of routes (default: 1m).
+func NewServer(k8sClient *k8s.Client, store *store.Store, metrics *proxy.Metrics, authn auth.Authenticator) *Server {
 	portStr := os.Getenv("SMART_PROXY_PORT")
 	port := 80
 	if portStr != "" {
@@ -41,10 +64,12 @@ func NewServer(k8sClient *k8s.Client, store *store.Store, metrics *proxy.Metrics
 	}
 
 	return &Server{
-		k8sClient: k8sClient,
-		store:     store,
-		Metrics:   metrics,
-		ProxyPort: port,
+		k8sClient:      k8sClient,
+		store:          store,
+		Metrics:        metrics,
+		ProxyPort:      port,
+		MinIdleTimeout: minIdleTimeoutFromEnv(),
+		auth:           authn,
 	}
 }
 
@@ -57,45 +82,108 @@ func (s *Server) ListenAndServe(addr string) error {
 	}
 
 	mux := http.NewServeMux()
+	api := http.NewServeMux()
 
 	// Static Files (Admin UI)
 	fs := http.FileServer(http.Dir("web/static"))
 	mux.Handle("/", fs)
 
-	// API Endpoints
-	mux.HandleFunc("/api/routes", s.handleRoutes)
-	mux.HandleFunc("/api/k8s/namespaces", s.handleNamespaces)
-	mux.HandleFunc("/api/k8s/deployments", s.handleDeployments)
-	mux.HandleFunc("/api/k8s/ingresses", s.handleIngresses)
-	mux.HandleFunc("/api/k8s/routes", s.handleOpenshiftRoutes) // New
-	mux.HandleFunc("/api/patch-ingress", s.handlePatchIngress)
-	mux.HandleFunc("/api/unpatch-ingress", s.handleUnpatchIngress)
-	mux.HandleFunc("/api/patch-route", s.handlePatchRoute)     // New
-	mux.HandleFunc("/api/unpatch-route", s.handleUnpatchRoute) // New
-	mux.HandleFunc("/api/stats", s.handleStats)
-	// New Endpoints
-	mux.HandleFunc("/api/logs", s.handleLogs)
-	mux.HandleFunc("/api/k8s/stop-deployment", s.handleStopDeployment)
+	// Prometheus metrics (unauthenticated, like most scrape targets)
+	mux.Handle("/metrics", metrics.Default.Handler())
+
+	// API Endpoints (authenticated, authorized per handler)
+	authn := s.auth
+	if authn == nil {
+		authn = auth.Anonymous{}
+	}
+	mux.Handle("/api/", auth.Middleware(authn, api))
+	api.HandleFunc("/api/auth/whoami", s.handleWhoAmI)
+	api.HandleFunc("/api/auth/session", s.handleSession)
+	api.HandleFunc("/api/k8s/namespaces", s.handleNamespaces)
+	api.HandleFunc("/api/k8s/deployments", s.handleDeployments)
+	api.HandleFunc("/api/logs", s.handleLogs)
+	api.HandleFunc("/api/events", s.handleEvents)
+	api.HandleFunc("/api/k8s/stop-deployment", s.handleStopDeployment)
+	api.HandleFunc("/api/notifications/deliveries", s.handleNotificationDeliveries)
+	api.HandleFunc("/api/reports/savings", s.handleSavingsReport)
+
+	// Unversioned endpoints superseded by /api/v1
+	api.HandleFunc("/api/routes", deprecated("/api/v1/routes", s.handleRoutes))
+	api.HandleFunc("/api/routes/diagnostics", deprecated("/api/v1/routes/{id}/diagnostics", s.handleRouteDiagnostics))
+	api.HandleFunc("/api/routes/mode", deprecated("/api/v1/routes/{id}/mode", s.handleRouteMode))
+	api.HandleFunc("POST /api/routes/{id}/wake", deprecated("/api/v1/routes/{id}/wake", s.handleWakeRoute))
+	api.HandleFunc("POST /api/routes/{id}/sleep", deprecated("/api/v1/routes/{id}/sleep", s.handleSleepRoute))
+	api.HandleFunc("POST /api/routes/{id}/wake-links", deprecated("/api/v1/routes/{id}/wake-links", s.handleWakeLinks))
+	api.HandleFunc("/api/k8s/ingresses", deprecated("/api/v1/resources/ingresses", s.handleIngresses))
+	api.HandleFunc("/api/k8s/routes", deprecated("/api/v1/resources/routes", s.handleOpenshiftRoutes))
+	api.HandleFunc("/api/patch-ingress", deprecated("/api/v1/resources/ingresses/{name}:patch", s.handlePatchIngress))
+	api.HandleFunc("/api/unpatch-ingress", deprecated("/api/v1/resources/ingresses/{name}:unpatch", s.handleUnpatchIngress))
+	api.HandleFunc("/api/patch-route", deprecated("/api/v1/resources/routes/{name}:patch", s.handlePatchRoute))
+	api.HandleFunc("/api/unpatch-route", deprecated("/api/v1/resources/routes/{name}:unpatch", s.handleUnpatchRoute))
+	api.HandleFunc("/api/stats", deprecated("/api/v1/stats", s.handleStats))
+	api.HandleFunc("/api/stats/timeseries", deprecated("/api/v1/stats/timeseries", s.handleTimeseries))
+	api.HandleFunc("/api/audit", deprecated("/api/v1/audit", s.handleAudit))
+	api.HandleFunc("GET /api/config/export", deprecated("/api/v1/config/export", s.handleConfigExport))
+	api.HandleFunc("POST /api/config/import", deprecated("/api/v1/config/import", s.handleConfigImport))
+
+	// Versioned API, described by its OpenAPI document (unauthenticated, like /metrics)
+	ops := s.v1Operations()
+	doc := v1Document(ops)
+	spec, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("openapi document: %w", err)
+	}
+	v1 := v1Handler(ops, authn)
+	if os.Getenv("OPENAPI_VALIDATE") == "true" {
+		log.Info("Checking /api/v1 responses against the OpenAPI document")
+		v1 = openapi.Middleware(doc, v1)
+	}
+	mux.Handle(v1Prefix+"/", v1)
+	mux.HandleFunc("GET "+v1Prefix+"/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
 
 	return http.ListenAndServe(addr, mux)
 }
 
 func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	// Logs span every namespace, so they need a cluster-wide role
+	if !s.authorize(w, r, auth.RoleViewer, "") {
+		return
+	}
+
+	// Optional server-side filters: ?level=warn&component=proxy&route=<route ID>
+	// With ?follow=false only the history is sent.
+	query := r.URL.Query()
+	minLevel, err := logger.ParseLevel(query.Get("level"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Get("level") == "" {
+		minLevel = slog.LevelDebug
+	}
+	filter := logger.Filter{MinLevel: minLevel, Component: query.Get("component"), RouteID: query.Get("route")}
+
 	// SSE Handler
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	clientChan := logger.Get().Subscribe()
+	clientChan := logger.Get().SubscribeFiltered(filter)
 	defer logger.Get().Unsubscribe(clientChan)
 
 	// Send history first
-	history := logger.Get().GetHistory()
+	history := logger.Get().GetFilteredHistory(filter)
 	for _, entry := range history {
 		data, _ := json.Marshal(entry)
 		fmt.Fprintf(w, "data: %s\n\n", data)
 	}
 	w.(http.Flusher).Flush()
+	if query.Get("follow") == "false" {
+		return
+	}
 
 	// Stream new logs
 	for {
@@ -110,6 +198,91 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// metricsInterval is how often /api/events sends a metrics snapshot.
+const metricsInterval = 5 * time.Second
+
+// handleEvents streams route events as server-sent events, with the event type as SSE event name.
+// Optional filters: ?types=route.state,wake.progress&route=<route ID>. Clients resume with the Last-Event-ID
+// header (or ?last_event_id=); if events were missed meanwhile, a "reset" event tells them to reload their state.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" || query.Get("last_event_id") != "" {
+		if v == "" {
+			v = query.Get("last_event_id")
+		}
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid last event ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+	types := make(map[string]bool)
+	for _, t := range strings.Split(query.Get("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[t] = true
+		}
+	}
+	routeID := query.Get("route")
+	identity := auth.FromContext(r.Context())
+	wanted := func(e stream.Event) bool {
+		return (len(types) == 0 || types[e.Type]) && (routeID == "" || e.RouteID == routeID) &&
+			identity.Can(auth.RoleViewer, e.Namespace)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	missed, complete, events := s.Stream.Subscribe(lastID)
+	defer s.Stream.Unsubscribe(events)
+
+	send := func(e stream.Event) {
+		data, _ := json.Marshal(e)
+		if e.ID != 0 {
+			fmt.Fprintf(w, "id: %d\n", e.ID)
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	}
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range missed {
+		if wanted(e) {
+			send(e)
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-events:
+			if wanted(e) {
+				send(e)
+				flusher.Flush()
+			}
+		case <-ticker.C:
+			if s.Metrics != nil && (len(types) == 0 || types[stream.Metrics]) {
+				send(stream.Event{Type: stream.Metrics, Time: time.Now().UTC(), Data: s.visibleMetrics(r)})
+			} else {
+				fmt.Fprint(w, ": keepalive\n\n")
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
 func (s *Server) handleStopDeployment(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -122,26 +295,37 @@ func (s *Server) handleStopDeployment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing namespace or deployment", http.StatusBadRequest)
 		return
 	}
+	if !s.authorize(w, r, auth.RoleOperator, namespace) {
+		return
+	}
 
 	if s.k8sClient != nil {
-		err := s.k8sClient.ScaleDeployment(namespace, deployment, 0)
+		err := s.k8sClient.ScaleDeployment(r.Context(), namespace, deployment, 0)
 		if err != nil {
-			logger.Printf("Error scaling down %s: %v", deployment, err)
+			log.ErrorContext(r.Context(), "Error scaling down deployment", "namespace", namespace, "deployment", deployment, "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		logger.Printf("Manual shutdown triggered for %s/%s", namespace, deployment)
+		log.InfoContext(r.Context(), "Manual shutdown triggered", "namespace", namespace, "deployment", deployment)
+		s.Audit.Record(audit.Entry{
+			Actor:     auth.FromContext(r.Context()).Name,
+			Action:    audit.ActionDeploymentStop,
+			Namespace: namespace,
+			Target:    deployment,
+		})
 
 		// Stop dependencies if configured
+		ctx := r.Context()
 		routes := s.store.GetAllRoutes()
 		for _, r := range routes {
 			if r.Namespace == namespace && r.Deployment == deployment {
 				for _, dep := range r.Dependencies {
 					if dep.StopOnIdle {
-						logger.Printf("Stopping dependency %s for manual stop of %s", dep.Name, deployment)
+						log.InfoContext(ctx, "Stopping dependency for manual stop", "dependency", dep.Name, "deployment", deployment)
+						depNs, depName := dep.Target(namespace)
 						// We ignore error here to ensure we try others
-						if err := s.k8sClient.ScaleDeployment(namespace, dep.Name, 0); err != nil {
-							logger.Printf("Error stopping dependency %s: %v", dep.Name, err)
+						if err := s.k8sClient.ScaleDeployment(ctx, depNs, depName, 0); err != nil {
+							log.ErrorContext(ctx, "Error stopping dependency", "dependency", dep.Name, "error", err)
 						}
 					}
 				}
@@ -155,74 +339,94 @@ func (s *Server) handleStopDeployment(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if s.Metrics != nil {
-		json.NewEncoder(w).Encode(s.Metrics)
+		json.NewEncoder(w).Encode(s.visibleMetrics(r))
 	} else {
 		json.NewEncoder(w).Encode(map[string]interface{}{})
 	}
 }
 
-func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// handleTimeseries returns the traffic of a route, or of every route the caller may view, over time.
+// Query: ?route=<route ID>&from=&to=&step=1m. from and to are RFC 3339 times, Unix seconds or durations
+// relative to now such as -6h; they default to the last hour.
+func (s *Server) handleTimeseries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	now := time.Now()
 
-	switch r.Method {
-	case http.MethodGet:
-		routes := s.store.GetAllRoutes()
+	from, err := parseTime(query.Get("from"), now.Add(-time.Hour), now)
+	if err != nil {
+		http.Error(w, "Invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTime(query.Get("to"), now, now)
+	if err != nil {
+		http.Error(w, "Invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	step := time.Minute
+	if v := query.Get("step"); v != "" {
+		if step, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "Invalid step: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-		// Enrich with Status
-		type RouteStatus struct {
-			store.RouteConfig
-			Status           string            `json:"status"`            // "Ready", "Scaling", "Sleep", "Error"
-			DependencyStatus map[string]string `json:"dependency_status"` // DepName -> Status
+	var routeIDs []string
+	if id := query.Get("route"); id != "" {
+		route, found := s.store.GetRoute(id)
+		if !found {
+			http.Error(w, "Route not found", http.StatusNotFound)
+			return
 		}
+		if !s.authorize(w, r, auth.RoleViewer, route.Namespace) {
+			return
+		}
+		routeIDs = []string{id}
+	} else {
+		for _, route := range s.visibleRoutes(r, s.store.GetAllRoutes()) {
+			routeIDs = append(routeIDs, route.ID)
+		}
+	}
 
-		enrichedRoutes := make([]RouteStatus, 0, len(routes))
+	points, err := s.Traffic.Query(routeIDs, from, to, step)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(points)
+}
 
-		for _, r := range routes {
-			// Get Main Status
-			status := "Unknown"
-			if s.k8sClient == nil {
-				status = "K8s Client Unavailable"
-			} else {
-				replicas, ready, err := s.k8sClient.GetDeploymentStatus(r.Namespace, r.Deployment)
-				if err != nil {
-					status = "Error"
-				} else if replicas == 0 {
-					status = "Sleep"
-				} else if ready < replicas {
-					status = "Scaling"
-				} else {
-					status = "Ready"
-				}
-			}
+// parseTime parses an RFC 3339 time, Unix seconds, or a duration relative to now; empty returns def.
+func parseTime(v string, def, now time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time, Unix seconds or a duration", v)
+}
 
-			// Get Dependency Status
-			depStatus := make(map[string]string)
-			if s.k8sClient == nil {
-				for _, dep := range r.Dependencies {
-					depStatus[dep.Name] = "K8s Client Unavailable"
-				}
-			} else {
-				for _, dep := range r.Dependencies {
-					dReplicas, dReady, err := s.k8sClient.GetDeploymentStatus(r.Namespace, dep.Name)
-					if err != nil {
-						depStatus[dep.Name] = "Error"
-					} else if dReplicas == 0 {
-						depStatus[dep.Name] = "Sleep"
-					} else if dReady < dReplicas {
-						depStatus[dep.Name] = "Scaling"
-					} else {
-						depStatus[dep.Name] = "Ready"
-					}
-				}
-			}
+func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-			enrichedRoutes = append(enrichedRoutes, RouteStatus{
-				RouteConfig:      r,
-				Status:           status,
-				DependencyStatus: depStatus,
-			})
+	switch r.Method {
+	case http.MethodGet:
+		routes := s.visibleRoutes(r, s.filterRoutes(s.store.GetAllRoutes(), r.URL.Query().Get("namespace")))
+		enrichedRoutes := make([]routeStatus, 0, len(routes))
+		for _, route := range routes {
+			enrichedRoutes = append(enrichedRoutes, s.routeStatus(r.Context(), route))
 		}
-
 		json.NewEncoder(w).Encode(enrichedRoutes)
 	case http.MethodPost:
 		var route store.RouteConfig
@@ -230,39 +434,14 @@ func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if route.Path == "" || route.Namespace == "" || route.Deployment == "" {
-			http.Error(w, "Missing required fields", http.StatusBadRequest)
-			return
-		}
-		// V2: ID generation handled by Store if missing
-		if err := s.store.AddRoute(&route); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if !s.checkRoute(w, r, route) {
 			return
 		}
-
-		// Update Ingress Annotation for persistence if this is a patched route
-		// Convention: ID = "ing-" + IngressName
-		if len(route.ID) > 4 && route.ID[:4] == "ing-" && s.k8sClient != nil {
-			ingressName := route.ID[4:]
-			// Fetch Ingress
-			ing, err := s.k8sClient.GetIngress(ingressName)
-			if err != nil {
-				logger.Printf("Warning: Failed to fetch ingress %s for persistence update: %v", ingressName, err)
-			} else {
-				// Serialize Config
-				configBytes, _ := json.Marshal(route)
-				if ing.Annotations == nil {
-					ing.Annotations = make(map[string]string)
-				}
-				ing.Annotations["smart-proxy/config"] = string(configBytes)
-
-				// Update Ingress
-				if err := s.k8sClient.UpdateIngress(ing); err != nil {
-					logger.Printf("Warning: Failed to persist config to ingress %s: %v", ingressName, err)
-				} else {
-					logger.Printf("Persisted config update to ingress %s", ingressName)
-				}
+		if err := s.saveRoute(&route, nil); err != nil {
+			if !writeConflict(w, r, err) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
 			}
+			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
@@ -272,6 +451,13 @@ func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Missing id", http.StatusBadRequest)
 			return
 		}
+		namespace := "" // Unknown routes need a cluster-wide role
+		if existing, ok := s.store.GetRoute(id); ok {
+			namespace = existing.Namespace
+		}
+		if !s.authorize(w, r, auth.RoleAdmin, namespace) {
+			return
+		}
 		if err := s.store.RemoveRoute(id); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -282,22 +468,95 @@ func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// routeStatus is a route with the status of its deployments, as listed by the admin API.
+type routeStatus struct {
+	store.RouteConfig
+	Status           string            `json:"status"`            // "Ready", "Scaling", "Sleep", "Error"
+	DependencyStatus map[string]string `json:"dependency_status"` // DepName -> Status
+}
+
+// routeStatus looks up the status of the deployment and dependencies of a route.
+func (s *Server) routeStatus(ctx context.Context, r store.RouteConfig) routeStatus {
+	// Get Main Status
+	status := "Unknown"
+	if s.k8sClient == nil {
+		status = "K8s Client Unavailable"
+	} else {
+		replicas, ready, err := s.k8sClient.GetDeploymentStatus(ctx, r.Namespace, r.Deployment)
+		if err != nil {
+			status = "Error"
+		} else if replicas == 0 {
+			status = "Sleep"
+		} else if ready < replicas {
+			status = "Scaling"
+		} else {
+			status = "Ready"
+		}
+	}
+
+	// Get Dependency Status
+	depStatus := make(map[string]string)
+	if s.k8sClient == nil {
+		for _, dep := range r.Dependencies {
+			depStatus[dep.Name] = "K8s Client Unavailable"
+		}
+	} else {
+		for _, dep := range r.Dependencies {
+			depNs, depName := dep.Target(r.Namespace)
+			dReplicas, dReady, err := s.k8sClient.GetDeploymentStatus(ctx, depNs, depName)
+			if err != nil {
+				depStatus[dep.Name] = "Error"
+			} else if dReplicas == 0 {
+				depStatus[dep.Name] = "Sleep"
+			} else if dReady < dReplicas {
+				depStatus[dep.Name] = "Scaling"
+			} else {
+				depStatus[dep.Name] = "Ready"
+			}
+		}
+	}
+
+	return routeStatus{RouteConfig: r, Status: status, DependencyStatus: depStatus}
+}
+
+// filterRoutes returns the routes in namespace, or all routes if namespace is empty.
+func (s *Server) filterRoutes(routes []store.RouteConfig, namespace string) []store.RouteConfig {
+	if namespace == "" {
+		return routes
+	}
+	filtered := make([]store.RouteConfig, 0, len(routes))
+	for _, r := range routes {
+		if r.Namespace == namespace {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
 func (s *Server) handleNamespaces(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if s.k8sClient == nil {
-		logger.Println("K8s Client is nil, returning mock namespaces")
+		log.Debug("K8s Client is nil, returning mock namespaces")
 		json.NewEncoder(w).Encode([]string{"default", "kube-system", "my-app-ns"})
 		return
 	}
 
 	namespaces, err := s.k8sClient.ListNamespaces()
 	if err != nil {
-		logger.Printf("Error listing namespaces: %v. Returning mock data.", err)
+		log.Error("Error listing namespaces. Returning mock data.", "error", err)
 		json.NewEncoder(w).Encode([]string{"default", "kube-system", "my-app-ns"})
 		return
 	}
-	json.NewEncoder(w).Encode(namespaces)
+
+	identity := auth.FromContext(r.Context())
+	visible := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if identity.Can(auth.RoleViewer, ns) {
+			visible = append(visible, ns)
+		}
+	}
+	json.NewEncoder(w).Encode(visible)
 }
 
 func (s *Server) handleDeployments(w http.ResponseWriter, r *http.Request) {
@@ -307,16 +566,19 @@ func (s *Server) handleDeployments(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing namespace", http.StatusBadRequest)
 		return
 	}
+	if !s.authorize(w, r, auth.RoleViewer, namespace) {
+		return
+	}
 
 	if s.k8sClient == nil {
-		log.Println("K8s Client is nil, returning mock deployments")
+		log.Debug("K8s Client is nil, returning mock deployments")
 		json.NewEncoder(w).Encode([]string{"nginx", "frontend", "backend"})
 		return
 	}
 
-	deployments, err := s.k8sClient.ListDeployments("") // Env var in client handles the NS
+	deployments, err := s.k8sClient.ListDeployments(namespace)
 	if err != nil {
-		logger.Printf("Error listing deployments: %v. Returning mock data.", err)
+		log.Error("Error listing deployments. Returning mock data.", "namespace", namespace, "error", err)
 		json.NewEncoder(w).Encode([]string{"nginx", "frontend", "backend"})
 		return
 	}
@@ -325,70 +587,16 @@ func (s *Server) handleDeployments(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleIngresses(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if s.k8sClient == nil {
-		json.NewEncoder(w).Encode([]string{})
+	res, err := s.ingressResources(r.Context(), auth.FromContext(r.Context()), r.URL.Query().Get("namespace"))
+	if errors.Is(err, errNoCluster) {
+		json.NewEncoder(w).Encode([]PatchableResource{})
 		return
 	}
-	ings, err := s.k8sClient.ListIngresses()
 	if err != nil {
-		logger.Printf("Error listing ingresses: %v", err)
+		log.Error("Error listing ingresses", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// Use PatchableResource (simulated here as anonymous struct or reuse if defined globally,
-	// but since PatchableResource is defined further down, we might need to move definition up or duplicate.
-	// Go allows type mismatch if JSON structure matches? No.
-	// We'll define a local struct compatible or reuse if I moved it up?
-	// I defined PatchableResource in replace_file_content step above, below this function (around line 491).
-	// Structs can be used before definition in Go if in same package.
-
-	var res []PatchableResource
-	for _, ing := range ings {
-		host := ""
-		if len(ing.Spec.Rules) > 0 {
-			host = ing.Spec.Rules[0].Host
-		}
-		patched := ing.Annotations["smart-proxy/patched"] == "true"
-
-		targetSvc := ""
-		targetPort := 80
-		if patched {
-			targetSvc = ing.Annotations["smart-proxy/original-service"]
-		} else {
-			if len(ing.Spec.Rules) > 0 && len(ing.Spec.Rules[0].HTTP.Paths) > 0 {
-				targetSvc = ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name
-				targetPort = int(ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port.Number)
-			}
-		}
-
-		statusStr := "Unknown"
-		if targetSvc != "" {
-			replicas, ready, err := s.k8sClient.GetDeploymentStatus(ing.Namespace, targetSvc)
-			if err != nil {
-				statusStr = "Error"
-			} else {
-				statusStr = fmt.Sprintf("%d/%d", ready, replicas)
-				if replicas == 0 {
-					statusStr += " (Sleep)"
-				} else if ready == replicas {
-					statusStr += " (Ready)"
-				} else {
-					statusStr += " (Not Ready)"
-				}
-			}
-		}
-
-		res = append(res, PatchableResource{
-			Name:      ing.Name,
-			Namespace: ing.Namespace,
-			Host:      host,
-			Service:   targetSvc,
-			Port:      targetPort,
-			Patched:   patched,
-			Status:    statusStr,
-			Type:      "Ingress",
-		})
-	}
 	json.NewEncoder(w).Encode(res)
 }
 
@@ -398,75 +606,16 @@ func (s *Server) handlePatchIngress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	name := r.URL.Query().Get("name")
+	namespace := r.URL.Query().Get("namespace") // Defaults to the proxy namespace
 	if name == "" {
 		http.Error(w, "Missing name", http.StatusBadRequest)
 		return
 	}
-
-	ing, err := s.k8sClient.GetIngress(name)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if ing.Annotations == nil {
-		ing.Annotations = make(map[string]string)
-	}
-	if ing.Annotations["smart-proxy/patched"] == "true" {
-		http.Error(w, "Already patched", http.StatusBadRequest)
+	if !s.authorize(w, r, auth.RoleAdmin, s.namespaceOrDefault(namespace)) {
 		return
 	}
-
-	// Assume first rule, first path for simplicity V2.5
-	if len(ing.Spec.Rules) == 0 || len(ing.Spec.Rules[0].HTTP.Paths) == 0 {
-		http.Error(w, "Ingress has no rules", http.StatusBadRequest)
-		return
-	}
-	rule := ing.Spec.Rules[0]
-	path := rule.HTTP.Paths[0]
-
-	originalSvc := path.Backend.Service.Name
-	originalPort := int(path.Backend.Service.Port.Number)
-
-	// Save original info
-	ing.Annotations["smart-proxy/patched"] = "true"
-	ing.Annotations["smart-proxy/original-service"] = originalSvc
-
-	// Update Ingress to point to Us
-	path.Backend.Service.Name = "smart-proxy"
-	path.Backend.Service.Port.Number = int32(s.ProxyPort)
-	ing.Spec.Rules[0].HTTP.Paths[0] = path
-
-	routeConfig := &store.RouteConfig{
-		ID:            "ing-" + name,
-		Host:          rule.Host,
-		Path:          path.Path,
-		TargetService: originalSvc,
-		TargetPort:    originalPort,
-		Namespace:     ing.Namespace,
-		Deployment:    originalSvc,
-		Dependencies:  []store.DependencyConfig{},
-		IdleTimeout:   30 * 60 * 1000 * 1000 * 1000,
-		LastActivity:  time.Now(),
-	}
-
-	// Persist Config to Annotation
-	configBytes, _ := json.Marshal(routeConfig)
-	ing.Annotations["smart-proxy/config"] = string(configBytes)
-
-	// Update Ingress with both patch and config
-	if err := s.k8sClient.UpdateIngress(ing); err != nil {
-		http.Error(w, "Failed to update ingress: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Add Route to Store
-	err = s.store.AddRoute(routeConfig)
-	if err != nil {
-		logger.Printf("Warning: Failed to add route to store: %v", err)
-	}
-
-	w.WriteHeader(http.StatusOK)
+	_, err := s.patchIngress(namespace, name)
+	writePatchResult(w, err)
 }
 
 func (s *Server) handleUnpatchIngress(w http.ResponseWriter, r *http.Request) {
@@ -475,103 +624,25 @@ func (s *Server) handleUnpatchIngress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	name := r.URL.Query().Get("name")
-
-	ing, err := s.k8sClient.GetIngress(name)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if ing.Annotations["smart-proxy/patched"] != "true" {
-		http.Error(w, "Not patched", http.StatusBadRequest)
-		return
-	}
-
-	originalSvc := ing.Annotations["smart-proxy/original-service"]
-
-	// Restore
-	if len(ing.Spec.Rules) > 0 && len(ing.Spec.Rules[0].HTTP.Paths) > 0 {
-		ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name = originalSvc
-		ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port.Number = 80 // Hardcoded for demo
-	}
-
-	delete(ing.Annotations, "smart-proxy/patched")
-	delete(ing.Annotations, "smart-proxy/original-service")
-
-	if err := s.k8sClient.UpdateIngress(ing); err != nil {
-		http.Error(w, "Failed to update ingress: "+err.Error(), http.StatusInternalServerError)
+	namespace := r.URL.Query().Get("namespace")
+	if !s.authorize(w, r, auth.RoleAdmin, s.namespaceOrDefault(namespace)) {
 		return
 	}
-
-	s.store.RemoveRoute("ing-" + name)
-	w.WriteHeader(http.StatusOK)
-}
-
-type PatchableResource struct {
-	Name      string `json:"name"`
-	Namespace string `json:"namespace"`
-	Host      string `json:"host"`
-	Service   string `json:"service"`
-	Port      int    `json:"port"`
-	Patched   bool   `json:"patched"`
-	Status    string `json:"status"`
-	Type      string `json:"type"` // "Ingress" or "Route"
+	writePatchResult(w, s.unpatchIngress(namespace, name))
 }
 
 // OpenShift Route Handlers
 
 func (s *Server) handleOpenshiftRoutes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if s.k8sClient == nil {
-		json.NewEncoder(w).Encode([]PatchableResource{})
-		return
-	}
-	routes, err := s.k8sClient.ListRoutes()
+	res, err := s.openshiftResources(r.Context(), auth.FromContext(r.Context()), r.URL.Query().Get("namespace"))
 	if err != nil {
-		logger.Printf("Debug: Failed to list OpenShift routes: %v", err)
+		if !errors.Is(err, errNoCluster) {
+			log.Debug("Failed to list OpenShift routes", "error", err)
+		}
 		json.NewEncoder(w).Encode([]PatchableResource{})
 		return
 	}
-
-	var res []PatchableResource
-	for _, route := range routes {
-		host := route.Spec.Host
-		patched := route.Annotations["smart-proxy/patched"] == "true"
-		targetSvc := ""
-		if patched {
-			targetSvc = route.Annotations["smart-proxy/original-service"]
-		} else {
-			targetSvc = route.Spec.To.Name
-		}
-
-		statusStr := "Unknown"
-		if targetSvc != "" {
-			replicas, ready, err := s.k8sClient.GetDeploymentStatus(route.Namespace, targetSvc)
-			if err != nil {
-				statusStr = "Error"
-			} else {
-				statusStr = fmt.Sprintf("%d/%d", ready, replicas)
-				if replicas == 0 {
-					statusStr += " (Sleep)"
-				} else if ready == replicas {
-					statusStr += " (Ready)"
-				} else {
-					statusStr += " (Not Ready)"
-				}
-			}
-		}
-
-		res = append(res, PatchableResource{
-			Name:      route.Name,
-			Namespace: route.Namespace,
-			Host:      host,
-			Service:   targetSvc,
-			Port:      80, // Assumption
-			Patched:   patched,
-			Status:    statusStr,
-			Type:      "Route",
-		})
-	}
 	json.NewEncoder(w).Encode(res)
 }
 
@@ -581,68 +652,12 @@ func (s *Server) handlePatchRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	name := r.URL.Query().Get("name")
-
-	route, err := s.k8sClient.GetRoute(name)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if route.Annotations == nil {
-		route.Annotations = make(map[string]string)
-	}
-	if route.Annotations["smart-proxy/patched"] == "true" {
-		http.Error(w, "Already patched", http.StatusBadRequest)
-		return
-	}
-
-	// Route Target Port check
-	originalSvc := route.Spec.To.Name
-	// Route port might be in Port structure or implicit.
-	// We'll trust TargetPort resolution or assume it points to the Service's port.
-
-	// Save original info
-	route.Annotations["smart-proxy/patched"] = "true"
-	route.Annotations["smart-proxy/original-service"] = originalSvc
-
-	// Update Route to point to Us
-	route.Spec.To.Name = "smart-proxy"
-	// Set target port to ProxyPort (admin/proxy port)
-	if route.Spec.Port == nil {
-		route.Spec.Port = &routev1.RoutePort{}
-	}
-	route.Spec.Port.TargetPort = intstr.FromInt(s.ProxyPort)
-
-	routeConfig := &store.RouteConfig{
-		ID:            "route-" + name, // Convention for Routes
-		Host:          route.Spec.Host,
-		Path:          route.Spec.Path,
-		TargetService: originalSvc,
-		TargetPort:    80, // Assumption: Original service uses port 80? Usually Routes point to Service port.
-		// If we don't know the original port, we might guess 80 or try to lookup Service.
-		// For demo, we assume the backend service listens on 80.
-		Namespace:    route.Namespace,
-		Deployment:   originalSvc, // Assumption: Deployment Name == Service Name
-		Dependencies: []store.DependencyConfig{},
-		IdleTimeout:  30 * 60 * 1000 * 1000 * 1000,
-		LastActivity: time.Now(),
-	}
-
-	// Persist Config
-	configBytes, _ := json.Marshal(routeConfig)
-	route.Annotations["smart-proxy/config"] = string(configBytes)
-
-	if err := s.k8sClient.UpdateRoute(route); err != nil {
-		http.Error(w, "Failed to update route: "+err.Error(), http.StatusInternalServerError)
+	namespace := r.URL.Query().Get("namespace")
+	if !s.authorize(w, r, auth.RoleAdmin, s.namespaceOrDefault(namespace)) {
 		return
 	}
-
-	err = s.store.AddRoute(routeConfig)
-	if err != nil {
-		logger.Printf("Warning: Failed to add route to store: %v", err)
-	}
-
-	w.WriteHeader(http.StatusOK)
+	_, err := s.patchOpenshiftRoute(namespace, name)
+	writePatchResult(w, err)
 }
 
 func (s *Server) handleUnpatchRoute(w http.ResponseWriter, r *http.Request) {
@@ -651,54 +666,50 @@ func (s *Server) handleUnpatchRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	name := r.URL.Query().Get("name")
-
-	route, err := s.k8sClient.GetRoute(name)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	namespace := r.URL.Query().Get("namespace")
+	if !s.authorize(w, r, auth.RoleAdmin, s.namespaceOrDefault(namespace)) {
 		return
 	}
+	writePatchResult(w, s.unpatchOpenshiftRoute(namespace, name))
+}
 
-	if route.Annotations["smart-proxy/patched"] != "true" {
+// writePatchResult replies to the unversioned patch endpoints: 400 for resources in the wrong state, 500 for
+// other errors.
+func writePatchResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.Is(err, errNoCluster):
+		http.Error(w, "Kubernetes client not initialized", http.StatusServiceUnavailable)
+	case errors.Is(err, errAlreadyPatched):
+		http.Error(w, "Already patched", http.StatusBadRequest)
+	case errors.Is(err, errNotPatched):
 		http.Error(w, "Not patched", http.StatusBadRequest)
-		return
+	case errors.Is(err, errNoRules):
+		http.Error(w, "Ingress has no rules", http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
+}
 
-	originalSvc := route.Annotations["smart-proxy/original-service"]
-
-	// Restore
-	route.Spec.To.Name = originalSvc
-	// Clear the forced port so it falls back to Service defaults or original logic?
-	// If we overwrote TargetPort, we should restore it if we saved it.
-	// For now, we clear the specific TargetPort if we set it, effectively reverting to default behavior.
-	// Actually, if we didn't save original port, we might be safer assuming 80 or nil if it was nil.
-	// Let's assume nil for now to let it Pick up from Service.
-	// Ideally we should persist "original-port" annotation too.
-	route.Spec.Port.TargetPort = intstr.IntOrString{} // Clear it? Or set to 80?
-	// Better approach: If we saved it, use it. Without it, we risk breaking if it was custom.
-	// For V2.5 Demo, we'll clear it.
-
-	delete(route.Annotations, "smart-proxy/patched")
-	delete(route.Annotations, "smart-proxy/original-service")
-	delete(route.Annotations, "smart-proxy/config")
-
-	if err := s.k8sClient.UpdateRoute(route); err != nil {
-		http.Error(w, "Failed to update route: "+err.Error(), http.StatusInternalServerError)
-		return
+// removePatchedRoute removes the route of an unpatched Ingress or Route and notifies its targets.
+func (s *Server) removePatchedRoute(id, message string) {
+	route, found := s.store.GetRoute(id)
+	s.store.RemoveRoute(id)
+	if found {
+		s.Notifier.Notify(route, notify.EventUnpatched, message)
 	}
-
-	s.store.RemoveRoute("route-" + name)
-	w.WriteHeader(http.StatusOK)
 }
 
 func (s *Server) SyncRoutesFromIngresses() {
-	logger.Println("Syncing routes from existing Ingresses and Routes...")
+	log.Info("Syncing routes from existing Ingresses and Routes...")
 	if s.k8sClient == nil {
 		return
 	}
 	// Ingresses
-	ings, err := s.k8sClient.ListIngresses()
+	ings, err := s.k8sClient.ListIngresses("")
 	if err != nil {
-		logger.Printf("Warning: Failed to list ingresses: %v", err)
+		log.Warn("Failed to list ingresses", "error", err)
 	} else {
 		count := 0
 		for _, ing := range ings {
@@ -707,21 +718,22 @@ func (s *Server) SyncRoutesFromIngresses() {
 				var config store.RouteConfig
 				if err := json.Unmarshal([]byte(configJSON), &config); err == nil {
 					if config.ID == "" {
-						config.ID = "ing-" + ing.Name
+						config.ID = store.ResourceID("ing-", s.k8sClient.Namespace, ing.Namespace, ing.Name)
 					}
+					s.keepMode(&config)
 					s.store.AddRoute(&config)
 					count++
 				}
 			}
 		}
-		logger.Printf("Synced %d routes from Ingresses", count)
+		log.Info("Synced routes from Ingresses", "count", count)
 	}
 
 	// Routes
-	routes, err := s.k8sClient.ListRoutes()
+	routes, err := s.k8sClient.ListRoutes("")
 	if err != nil {
 		// Log debug only, failure expected on non-OCP
-		// logger.Printf("Debug: Failed to list routes: %v", err)
+		log.Debug("Failed to list routes", "error", err)
 	} else {
 		count := 0
 		for _, route := range routes {
@@ -730,13 +742,191 @@ func (s *Server) SyncRoutesFromIngresses() {
 				var config store.RouteConfig
 				if err := json.Unmarshal([]byte(configJSON), &config); err == nil {
 					if config.ID == "" {
-						config.ID = "route-" + route.Name
+						config.ID = store.ResourceID("route-", s.k8sClient.Namespace, route.Namespace, route.Name)
 					}
+					s.keepMode(&config)
 					s.store.AddRoute(&config)
 					count++
 				}
 			}
 		}
-		logger.Printf("Synced %d routes from OpenShift Routes", count)
+		log.Info("Synced routes from OpenShift Routes", "count", count)
+	}
+}
+
+// keepMode keeps the operational state of a stored route when it is synced again from its annotation,
+// which doesn't hold it.
+func (s *Server) keepMode(config *store.RouteConfig) {
+	if existing, ok := s.store.GetRoute(config.ID); ok && config.Mode == nil {
+		config.Mode = existing.Mode
+	}
+}
+
+// saveRoute stores a route created or updated through the API, and persists it to the annotation of its
+// Ingress if it is a patched one. The mode only changes through /api/routes/mode, which audits it: the
+// stored one is kept. check, if not nil, is a precondition on the stored route (see store.AddRouteIf).
+// Host and path conflicts are checked again under the store lock: a *store.ConflictError is returned.
+func (s *Server) saveRoute(route *store.RouteConfig, check func(current *store.RouteConfig) error) error {
+	route.Mode = nil
+	s.keepMode(route)
+	// V2: ID generation handled by Store if missing
+	if err := s.store.AddRouteIf(route, s.store.NoConflicts(route, check)); err != nil {
+		return err
+	}
+
+	// Update Ingress Annotation for persistence if this is a patched route
+	// Convention: ID = "ing-" + IngressName (see store.ResourceID)
+	var ingressNs, ingressName string
+	isIngress := false
+	if s.k8sClient != nil {
+		ingressNs, ingressName, isIngress = store.ParseResourceID("ing-", s.k8sClient.Namespace, route.ID)
+	}
+	if isIngress {
+		// Fetch Ingress
+		ing, err := s.k8sClient.GetIngress(ingressNs, ingressName)
+		if err != nil {
+			log.Warn("Failed to fetch ingress for persistence update", "route_id", route.ID, "ingress", ingressName, "error", err)
+		} else {
+			// Serialize Config
+			configBytes, _ := json.Marshal(route)
+			if ing.Annotations == nil {
+				ing.Annotations = make(map[string]string)
+			}
+			ing.Annotations["smart-proxy/config"] = string(configBytes)
+
+			// Update Ingress
+			if err := s.k8sClient.UpdateIngress(ing); err != nil {
+				log.Warn("Failed to persist config to ingress", "route_id", route.ID, "ingress", ingressName, "error", err)
+			} else {
+				log.Info("Persisted config update to ingress", "route_id", route.ID, "ingress", ingressName)
+			}
+		}
 	}
+	return nil
+}
+
+// routeDiagnostics is the response of /api/routes/diagnostics.
+type routeDiagnostics struct {
+	RouteID     string             `json:"route_id"`
+	Failure     *proxy.WakeFailure `json:"failure,omitempty"` // If the latest wake-up passed the wake timeout
+	Diagnostics []k8s.Diagnosis    `json:"diagnostics"`       // Current problems of the deployments that are not ready
+}
+
+// handleRouteDiagnostics reports why the deployments of a route are not becoming ready: unschedulable pods,
+// images that cannot be pulled, crashing containers... Query: ?route=<route ID>
+func (s *Server) handleRouteDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	route, found := s.store.GetRoute(r.URL.Query().Get("route"))
+	if !found {
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return
+	}
+	if !s.authorize(w, r, auth.RoleViewer, route.Namespace) {
+		return
+	}
+	if s.k8sClient == nil {
+		http.Error(w, "Kubernetes client not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	response := routeDiagnostics{RouteID: route.ID, Diagnostics: []k8s.Diagnosis{}}
+	if failure, failed := s.Metrics.Failure(route.ID); failed {
+		response.Failure = &failure
+	}
+	diagnose := func(namespace, name string) {
+		diagnostics, err := s.k8sClient.DiagnoseDeployment(r.Context(), namespace, name)
+		if err != nil {
+			log.WarnContext(r.Context(), "Could not diagnose deployment", "namespace", namespace, "deployment", name, "error", err)
+		}
+		response.Diagnostics = append(response.Diagnostics, diagnostics...)
+	}
+	diagnose(route.Namespace, route.Deployment)
+	for _, d := range route.Dependencies {
+		diagnose(d.Target(route.Namespace))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleNotificationDeliveries lists recent webhook notification deliveries for the routes the caller may view.
+// Optional filter: ?route=<route ID>
+func (s *Server) handleNotificationDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity := auth.FromContext(r.Context())
+	routeID := r.URL.Query().Get("route")
+	deliveries := []notify.Delivery{}
+	for _, d := range s.Notifier.Deliveries() {
+		if !identity.Can(auth.RoleViewer, d.Namespace) || (routeID != "" && d.RouteID != routeID) {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// handleSavingsReport reports the resources saved by sleeping deployments, for the routes the caller may view.
+// Query: ?period=day|week (default day), from and to as YYYY-MM-DD (inclusive, default the last 30 days),
+// optional route and namespace filters, and format=csv for a CSV download.
+func (s *Server) handleSavingsReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+
+	period := query.Get("period")
+	if period == "" {
+		period = savings.Daily
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today.AddDate(0, 0, -29), today
+	for _, p := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if v := query.Get(p.name); v != "" {
+			t, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				http.Error(w, "Invalid "+p.name+" date, expected YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+			*p.value = t
+		}
+	}
+
+	identity := auth.FromContext(r.Context())
+	routeID, namespace := query.Get("route"), query.Get("namespace")
+	report, err := s.Savings.Report(savings.Query{
+		Period: period,
+		From:   from,
+		To:     to.AddDate(0, 0, 1),
+		Include: func(iv savings.Interval) bool {
+			return identity.Can(auth.RoleViewer, iv.Namespace) &&
+				(routeID == "" || iv.RouteID == routeID) && (namespace == "" || iv.Namespace == namespace)
+		},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="savings-%s-%s.csv"`,
+			from.Format("2006-01-02"), to.Format("2006-01-02")))
+		report.WriteCSV(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
 }
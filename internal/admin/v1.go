@@ -0,0 +1,915 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-proxy/internal/audit"
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/openapi"
+	"smart-proxy/internal/proxy"
+	"smart-proxy/internal/store"
+	"smart-proxy/internal/timeseries"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// v1Prefix is the path of the versioned API. Its operations are listed once, in v1Operations: the table both
+// routes requests and generates the OpenAPI document, so that the two cannot drift.
+const v1Prefix = "/api/v1"
+
+// Bounds of the ?limit of paginated lists.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 500
+)
+
+// maxRouteBytes bounds the route bodies of /api/v1/routes.
+const maxRouteBytes = 1 << 20
+
+// deprecationDate is when /api/v1 superseded the unversioned endpoints, in Deprecation headers (RFC 9745).
+const deprecationDate = "@1792281600" // 2026-10-18
+
+var (
+	errPreconditionFailed = errors.New("the route does not match If-Match or If-None-Match")
+	errRouteExists        = errors.New("route already exists")
+	errRouteChanged       = errors.New("the route changed while being patched, retry")
+)
+
+// v1Operation is an operation of /api/v1.
+type v1Operation struct {
+	method  string
+	path    string // Relative to /api/v1, as an OpenAPI path template
+	pattern string // Of the mux, if path is not one, e.g. for /resources/{kind}/{name}:patch
+	id      string
+	summary string
+	tag     string
+	params  []openapi.Parameter
+	// Type of the request body, nil for none, and its content types (default JSON)
+	request      interface{}
+	requestTypes []string
+	responses    []v1Response
+	handler      http.HandlerFunc
+}
+
+// v1Response is a response of an operation. Every operation may also answer problem details (default).
+type v1Response struct {
+	status       int
+	description  string
+	body         interface{} // Type of the body, nil for none
+	contentTypes []string    // Default JSON
+	headers      []string    // Names of the headers, described in v1Headers
+}
+
+var v1Headers = map[string]string{
+	"ETag":     "Version of the route configuration, for If-Match and If-None-Match",
+	"Location": "URL of the route",
+}
+
+// routeList is a page of routes.
+type routeList struct {
+	Items         []routeStatus `json:"items"`
+	NextPageToken string        `json:"next_page_token,omitempty"` // Empty on the last page
+}
+
+// resourceList is a page of Ingresses or OpenShift Routes.
+type resourceList struct {
+	Items         []PatchableResource `json:"items"`
+	NextPageToken string              `json:"next_page_token,omitempty"` // Empty on the last page
+}
+
+// configDocument is the JSON form of the documents of /config/export and /config/import.
+type configDocument struct {
+	Routes []map[string]interface{} `json:"routes"`
+}
+
+func pathParam(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "path", Required: true, Description: description, Schema: &openapi.Schema{Type: "string"}}
+}
+
+func queryParam(name, typ, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: typ}}
+}
+
+func headerParam(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "header", Description: description, Schema: &openapi.Schema{Type: "string"}}
+}
+
+var (
+	idParam          = pathParam("id", "Route ID; IDs with a slash are escaped, e.g. ing-team%2Fweb")
+	namespaceParam   = queryParam("namespace", "string", "Only in this namespace")
+	pageParams       = []openapi.Parameter{queryParam("limit", "integer", "Page size, 1 to 500; default 100"), queryParam("page_token", "string", "next_page_token of the previous page")}
+	ifMatchParam     = headerParam("If-Match", "Only if the route has this ETag")
+	ifNoneMatchParam = headerParam("If-None-Match", "Only if the route does not have this ETag; * only creates")
+)
+
+func problemResponse(status int, description string) v1Response {
+	return v1Response{status: status, description: description, body: problem{}, contentTypes: []string{"application/problem+json"}}
+}
+
+// v1Operations lists the operations of /api/v1.
+func (s *Server) v1Operations() []v1Operation {
+	routeResponse := func(status int, description string, headers ...string) v1Response {
+		return v1Response{status: status, description: description, body: routeStatus{}, headers: headers}
+	}
+	notFound := problemResponse(http.StatusNotFound, "No such route")
+	invalid := problemResponse(http.StatusUnprocessableEntity, "Invalid route")
+	conflict := problemResponse(http.StatusConflict, "Route conflict: the host and path are already served, or the route exists")
+	precondition := problemResponse(http.StatusPreconditionFailed, "If-Match or If-None-Match does not hold")
+	resourceParams := []openapi.Parameter{
+		pathParam("kind", "ingresses or routes (OpenShift)"),
+		pathParam("name", "Name of the resource"),
+		queryParam("namespace", "string", "Namespace of the resource; default the proxy's"),
+	}
+	resourceErrors := []v1Response{
+		problemResponse(http.StatusNotFound, "No such resource"),
+		problemResponse(http.StatusConflict, "Already patched, or not patched"),
+		problemResponse(http.StatusServiceUnavailable, "Kubernetes is not available"),
+	}
+
+	return []v1Operation{
+		{
+			method: http.MethodGet, path: "/routes", id: "listRoutes", tag: "routes",
+			summary: "List the routes the caller may view, by ID, with the status of their deployments",
+			params:  append([]openapi.Parameter{namespaceParam}, pageParams...),
+			responses: []v1Response{
+				{status: http.StatusOK, description: "A page of routes", body: routeList{}},
+			},
+			handler: s.handleV1ListRoutes,
+		},
+		{
+			method: http.MethodPost, path: "/routes", id: "createRoute", tag: "routes",
+			summary: "Create a route; its ID is generated if empty",
+			request: store.RouteConfig{},
+			responses: []v1Response{
+				routeResponse(http.StatusCreated, "Created", "ETag", "Location"),
+				invalid, conflict,
+			},
+			handler: s.handleV1CreateRoute,
+		},
+		{
+			method: http.MethodGet, path: "/routes/{id}", id: "getRoute", tag: "routes",
+			summary: "Get a route",
+			params:  []openapi.Parameter{idParam, ifNoneMatchParam},
+			responses: []v1Response{
+				routeResponse(http.StatusOK, "The route", "ETag"),
+				{status: http.StatusNotModified, description: "The route still has the ETag of If-None-Match", headers: []string{"ETag"}},
+				notFound,
+			},
+			handler: s.handleV1GetRoute,
+		},
+		{
+			method: http.MethodPut, path: "/routes/{id}", id: "replaceRoute", tag: "routes",
+			summary: "Create or replace a route; its mode and last activity are kept",
+			params:  []openapi.Parameter{idParam, ifMatchParam, ifNoneMatchParam},
+			request: store.RouteConfig{},
+			responses: []v1Response{
+				routeResponse(http.StatusOK, "Replaced", "ETag"),
+				routeResponse(http.StatusCreated, "Created", "ETag", "Location"),
+				invalid, conflict, precondition,
+			},
+			handler: s.handleV1PutRoute,
+		},
+		{
+			method: http.MethodPatch, path: "/routes/{id}", id: "patchRoute", tag: "routes",
+			summary: "Update fields of a route with a JSON merge patch (RFC 7396); null removes a field",
+			params:  []openapi.Parameter{idParam, ifMatchParam},
+			request: store.RouteConfig{}, requestTypes: []string{"application/merge-patch+json", "application/json"},
+			responses: []v1Response{
+				routeResponse(http.StatusOK, "Updated", "ETag"),
+				notFound, invalid, conflict, precondition,
+				problemResponse(http.StatusUnsupportedMediaType, "Not a merge patch"),
+			},
+			handler: s.handleV1PatchRoute,
+		},
+		{
+			method: http.MethodDelete, path: "/routes/{id}", id: "deleteRoute", tag: "routes",
+			summary: "Delete a route",
+			params:  []openapi.Parameter{idParam, ifMatchParam},
+			responses: []v1Response{
+				{status: http.StatusNoContent, description: "Deleted"},
+				notFound, precondition,
+			},
+			handler: s.handleV1DeleteRoute,
+		},
+		{
+			method: http.MethodGet, path: "/routes/{id}/mode", id: "getRouteMode", tag: "routes",
+			summary: "Get the operational state of a route",
+			params:  []openapi.Parameter{idParam},
+			responses: []v1Response{
+				{status: http.StatusOK, description: "The mode", body: modeResponse{}},
+				notFound,
+			},
+			handler: routeQuery(s.handleRouteMode),
+		},
+		{
+			method: http.MethodPut, path: "/routes/{id}/mode", id: "setRouteMode", tag: "routes",
+			summary: "Put a route in maintenance, pin it awake, disable it or set it back to normal",
+			params:  []openapi.Parameter{idParam},
+			request: modeRequest{},
+			responses: []v1Response{
+				{status: http.StatusOK, description: "The new mode", body: modeResponse{}},
+				notFound,
+			},
+			handler: routeQuery(s.handleRouteMode),
+		},
+		{
+			method: http.MethodDelete, path: "/routes/{id}/mode", id: "clearRouteMode", tag: "routes",
+			summary: "Set a route back to normal",
+			params:  []openapi.Parameter{idParam},
+			responses: []v1Response{
+				{status: http.StatusOK, description: "The new mode", body: modeResponse{}},
+				notFound,
+			},
+			handler: routeQuery(s.handleRouteMode),
+		},
+		{
+			method: http.MethodGet, path: "/routes/{id}/diagnostics", id: "diagnoseRoute", tag: "routes",
+			summary: "Explain why the deployments of a route are not becoming ready",
+			params:  []openapi.Parameter{idParam},
+			responses: []v1Response{
+				{status: http.StatusOK, description: "The diagnostics", body: routeDiagnostics{}},
+				notFound,
+			},
+			handler: routeQuery(s.handleRouteDiagnostics),
+		},
+		{
+			method: http.MethodPost, path: "/routes/{id}/wake", id: "wakeRoute", tag: "routes",
+			summary: "Wake a route, and with wait=true wait until it is ready",
+			params: []openapi.Parameter{idParam,
+				queryParam("wait", "boolean", "Answer once the route is ready"),
+				queryParam("timeout", "string", "How long to wait, up to 15m; default 5m")},
+			responses: []v1Response{
+				{status: http.StatusAccepted, description: "Waking", body: wakeResponse{}},
+				{status: http.StatusOK, description: "Ready", body: wakeResponse{}},
+				{status: http.StatusGatewayTimeout, description: "Not ready after the timeout", body: wakeResponse{}},
+				notFound,
+				problemResponse(http.StatusConflict, "The mode of the route prevents waking it"),
+			},
+			handler: s.handleWakeRoute,
+		},
+		{
+			method: http.MethodPost, path: "/routes/{id}/sleep", id: "sleepRoute", tag: "routes",
+			summary: "Scale the deployment of a route and its stop-on-idle dependencies to zero",
+			params:  []openapi.Parameter{idParam},
+			responses: []v1Response{
+				{status: http.StatusOK, description: "Scaled down", body: sleepResponse{}},
+				notFound,
+			},
+			handler: s.handleSleepRoute,
+		},
+		{
+			method: http.MethodPost, path: "/routes/{id}/wake-links", id: "createWakeLink", tag: "routes",
+			summary: "Create a signed, expiring link that wakes the route",
+			params:  []openapi.Parameter{idParam},
+			request: wakeLinkRequest{},
+			responses: []v1Response{
+				{status: http.StatusCreated, description: "The link", body: wakeLinkResponse{}},
+				notFound,
+			},
+			handler: s.handleWakeLinks,
+		},
+		{
+			method: http.MethodGet, path: "/resources/{kind}", id: "listResources", tag: "resources",
+			summary: "List the Ingresses or OpenShift Routes the caller may view, by namespace and name",
+			params:  append([]openapi.Parameter{pathParam("kind", "ingresses or routes (OpenShift)"), namespaceParam}, pageParams...),
+			responses: []v1Response{
+				{status: http.StatusOK, description: "A page of resources", body: resourceList{}},
+				problemResponse(http.StatusServiceUnavailable, "Kubernetes is not available"),
+			},
+			handler: s.handleV1ListResources,
+		},
+		{
+			method: http.MethodPost, path: "/resources/{kind}/{name}:patch", pattern: "/resources/{kind}/{action}",
+			id: "patchResource", tag: "resources",
+			summary: "Point an Ingress or OpenShift Route to the proxy and create its route",
+			params:  resourceParams,
+			responses: append([]v1Response{
+				routeResponse(http.StatusCreated, "Patched", "Location"),
+				problemResponse(http.StatusUnprocessableEntity, "The Ingress has no rules"),
+			}, resourceErrors...),
+			handler: s.handleV1ResourceAction,
+		},
+		{
+			method: http.MethodPost, path: "/resources/{kind}/{name}:unpatch", pattern: "/resources/{kind}/{action}",
+			id: "unpatchResource", tag: "resources",
+			summary: "Restore an Ingress or OpenShift Route to its original Service and delete its route",
+			params:  resourceParams,
+			responses: append([]v1Response{
+				{status: http.StatusNoContent, description: "Unpatched"},
+			}, resourceErrors...),
+			handler: s.handleV1ResourceAction,
+		},
+		{
+			method: http.MethodGet, path: "/config/export", id: "exportConfig", tag: "config",
+			summary: "Export the routes the caller may view as a declarative document",
+			params:  []openapi.Parameter{namespaceParam, queryParam("format", "string", "yaml (default) or json")},
+			responses: []v1Response{
+				{status: http.StatusOK, description: "The document", body: configDocument{}, contentTypes: []string{"application/yaml", "application/json"}},
+			},
+			handler: s.handleConfigExport,
+		},
+		{
+			method: http.MethodPost, path: "/config/import", id: "importConfig", tag: "config",
+			summary: "Create, update and optionally prune routes from a declarative document, all or nothing",
+			params: []openapi.Parameter{
+				queryParam("dry_run", "boolean", "Only return the changes"),
+				queryParam("prune", "boolean", "Delete the routes missing from the document"),
+				namespaceParam,
+			},
+			request: configDocument{}, requestTypes: []string{"application/yaml", "application/json"},
+			responses: []v1Response{
+				{status: http.StatusOK, description: "The changes, applied unless dry_run", body: importResponse{}},
+				{status: http.StatusInternalServerError, description: "Routes that failed to apply", body: importResponse{}},
+				{status: http.StatusUnprocessableEntity, description: "Invalid document: nothing applied", body: importProblem{}, contentTypes: []string{"application/problem+json"}},
+				{status: http.StatusForbidden, description: "Routes the caller may not administer: nothing applied", body: importProblem{}, contentTypes: []string{"application/problem+json"}},
+			},
+			handler: s.handleConfigImport,
+		},
+		{
+			method: http.MethodGet, path: "/audit", id: "listAuditEntries", tag: "audit",
+			summary: "List recent audit entries of the namespaces the caller may view, newest first",
+			params: []openapi.Parameter{
+				queryParam("route", "string", "Only of this route"),
+				queryParam("action", "string", "Only this action"),
+				queryParam("limit", "integer", "Default 100"),
+			},
+			responses: []v1Response{{status: http.StatusOK, description: "The entries", body: []audit.Entry{}}},
+			handler:   s.handleAudit,
+		},
+		{
+			method: http.MethodGet, path: "/stats", id: "getStats", tag: "stats",
+			summary:   "Request counters of the routes the caller may view",
+			responses: []v1Response{{status: http.StatusOK, description: "The counters", body: proxy.Stats{}}},
+			handler:   s.handleStats,
+		},
+		{
+			method: http.MethodGet, path: "/stats/timeseries", id: "getTraffic", tag: "stats",
+			summary: "Traffic of a route, or of every route the caller may view, over time",
+			params: []openapi.Parameter{
+				queryParam("route", "string", "Route ID"),
+				queryParam("from", "string", "RFC 3339 time, Unix seconds or duration relative to now; default -1h"),
+				queryParam("to", "string", "Default now"),
+				queryParam("step", "string", "Default 1m"),
+			},
+			responses: []v1Response{{status: http.StatusOK, description: "One point per step", body: []timeseries.Point{}}},
+			handler:   s.handleTimeseries,
+		},
+	}
+}
+
+// v1Handler routes the operations of /api/v1 and answers their errors with problem details.
+func v1Handler(ops []v1Operation, authn auth.Authenticator) http.Handler {
+	mux := http.NewServeMux()
+	registered := make(map[string]bool)
+	for _, op := range ops {
+		pattern := op.pattern
+		if pattern == "" {
+			pattern = op.path
+		}
+		pattern = op.method + " " + v1Prefix + pattern
+		if !registered[pattern] {
+			mux.HandleFunc(pattern, op.handler)
+			registered[pattern] = true
+		}
+	}
+	return problems(auth.Middleware(authn, mux))
+}
+
+// v1Document generates the OpenAPI document of /api/v1.
+func v1Document(ops []v1Operation) *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:       "Smart Proxy admin API",
+		Version:     "1.0.0",
+		Description: "Manages the routes of the proxy and the Kubernetes resources it fronts. Errors are problem details (RFC 9457).",
+	})
+	doc.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		"bearer": {Type: "http", Scheme: "bearer", Description: "Static token, Kubernetes service account token or OIDC ID token, per AUTH_MODE"},
+		"cookie": {Type: "apiKey", In: "cookie", Name: auth.CookieName, Description: "Session set by POST /api/auth/session"},
+	}
+	doc.Security = []map[string][]string{{"bearer": {}}, {"cookie": {}}}
+	doc.Tags = []openapi.Tag{
+		{Name: "routes", Description: "Routes and their operational state"},
+		{Name: "resources", Description: "Ingresses and OpenShift Routes pointed to the proxy"},
+		{Name: "config", Description: "Declarative configuration"},
+		{Name: "audit", Description: "Audit log"},
+		{Name: "stats", Description: "Traffic"},
+	}
+
+	content := func(body interface{}, types []string) map[string]openapi.MediaType {
+		if len(types) == 0 {
+			types = []string{"application/json"}
+		}
+		media := make(map[string]openapi.MediaType, len(types))
+		for _, t := range types {
+			media[t] = openapi.MediaType{Schema: doc.Schema(body)}
+		}
+		return media
+	}
+	for _, op := range ops {
+		operation := &openapi.Operation{
+			OperationID: op.id,
+			Summary:     op.summary,
+			Tags:        []string{op.tag},
+			Parameters:  op.params,
+			Responses: map[string]*openapi.Response{
+				"default": {Description: "Error", Content: content(problem{}, []string{"application/problem+json"})},
+			},
+		}
+		if op.request != nil {
+			operation.RequestBody = &openapi.RequestBody{Required: true, Content: content(op.request, op.requestTypes)}
+		}
+		for _, resp := range op.responses {
+			response := &openapi.Response{Description: resp.description}
+			if resp.body != nil {
+				response.Content = content(resp.body, resp.contentTypes)
+			}
+			for _, name := range resp.headers {
+				if response.Headers == nil {
+					response.Headers = make(map[string]openapi.Header)
+				}
+				response.Headers[name] = openapi.Header{Description: v1Headers[name], Schema: &openapi.Schema{Type: "string"}}
+			}
+			operation.Responses[strconv.Itoa(resp.status)] = response
+		}
+		doc.Add(op.method, v1Prefix+op.path, operation)
+	}
+	return doc
+}
+
+// problems turns the plain text errors of handlers (http.Error) into problem details.
+func problems(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pw := &problemWriter{ResponseWriter: w}
+		next.ServeHTTP(pw, r)
+		pw.finish()
+	})
+}
+
+// problemWriter holds back the body of plain text errors, sent as problem details by finish.
+type problemWriter struct {
+	http.ResponseWriter
+	status int // Of the plain text error, 0 if none
+	detail bytes.Buffer
+}
+
+func (p *problemWriter) WriteHeader(status int) {
+	if status >= 400 && strings.HasPrefix(p.Header().Get("Content-Type"), "text/plain") {
+		p.status = status
+		return
+	}
+	p.ResponseWriter.WriteHeader(status)
+}
+
+func (p *problemWriter) Write(b []byte) (int, error) {
+	if p.status != 0 {
+		return p.detail.Write(b)
+	}
+	return p.ResponseWriter.Write(b)
+}
+
+// Flush lets event streams through.
+func (p *problemWriter) Flush() {
+	if f, ok := p.ResponseWriter.(http.Flusher); ok && p.status == 0 {
+		f.Flush()
+	}
+}
+
+func (p *problemWriter) finish() {
+	if p.status == 0 {
+		return
+	}
+	p.Header().Set("Content-Type", "application/problem+json")
+	p.ResponseWriter.WriteHeader(p.status)
+	json.NewEncoder(p.ResponseWriter).Encode(problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(p.status),
+		Status: p.status,
+		Detail: strings.TrimSpace(p.detail.String()),
+	})
+}
+
+// deprecated marks the responses of an unversioned endpoint as deprecated in favor of successor, a path of
+// /api/v1 in which {id} and {name} are replaced by the route ID and resource name of the request.
+func deprecated(successor string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if id == "" {
+			id = r.URL.Query().Get("route")
+		}
+		link := strings.NewReplacer("{id}", url.PathEscape(id), "{name}", url.PathEscape(r.URL.Query().Get("name"))).Replace(successor)
+		w.Header().Set("Deprecation", deprecationDate)
+		w.Header().Add("Link", "<"+link+`>; rel="successor-version"`)
+		h(w, r)
+	}
+}
+
+// routeQuery serves a route sub-resource with a handler of the unversioned API, which reads the route
+// ID from ?route.
+func routeQuery(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		query.Set("route", r.PathValue("id"))
+		u := *r.URL
+		u.RawQuery = query.Encode()
+		r = r.WithContext(r.Context())
+		r.URL = &u
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// routeETag is the version of a route configuration; its last activity, which changes with traffic, is left out.
+func routeETag(route store.RouteConfig) string {
+	route.LastActivity = time.Time{}
+	data, _ := json.Marshal(route)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag, or is *.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditions checks the If-Match and If-None-Match headers of a request against the stored route (nil if
+// there is none), under the store lock.
+func preconditions(r *http.Request) func(current *store.RouteConfig) error {
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	return func(current *store.RouteConfig) error {
+		if ifMatch != "" && (current == nil || !etagMatches(ifMatch, routeETag(*current))) {
+			return errPreconditionFailed
+		}
+		if ifNoneMatch != "" && current != nil && etagMatches(ifNoneMatch, routeETag(*current)) {
+			return errPreconditionFailed
+		}
+		return nil
+	}
+}
+
+// writeStoreError answers an error of saving or deleting a route.
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errPreconditionFailed):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, errRouteExists), errors.Is(err, errRouteChanged):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, store.ErrRouteNotFound):
+		http.Error(w, "Route not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// pageBounds returns the page a request asks for among n items sorted by key: the items from start to end,
+// those after ?page_token, at most ?limit. next is the token of the following page, empty on the last one.
+func pageBounds(r *http.Request, n int, key func(i int) string) (start, end int, next string, err error) {
+	limit := defaultPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxPageSize {
+			return 0, 0, "", fmt.Errorf("invalid limit, must be 1 to %d", maxPageSize)
+		}
+	}
+	if token := r.URL.Query().Get("page_token"); token != "" {
+		after, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return 0, 0, "", errors.New("invalid page_token")
+		}
+		start = sort.Search(n, func(i int) bool { return key(i) > string(after) })
+	}
+	end = min(start+limit, n)
+	if end < n {
+		next = base64.RawURLEncoding.EncodeToString([]byte(key(end - 1)))
+	}
+	return start, end, next, nil
+}
+
+func (s *Server) handleV1ListRoutes(w http.ResponseWriter, r *http.Request) {
+	routes := sortedRoutes(s.visibleRoutes(r, s.filterRoutes(s.store.GetAllRoutes(), r.URL.Query().Get("namespace"))))
+	start, end, next, err := pageBounds(r, len(routes), func(i int) string { return routes[i].ID })
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list := routeList{Items: make([]routeStatus, 0, end-start), NextPageToken: next}
+	for _, route := range routes[start:end] {
+		list.Items = append(list.Items, s.routeStatus(r.Context(), route))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleV1GetRoute(w http.ResponseWriter, r *http.Request) {
+	route, ok := s.routeFromPath(w, r)
+	if !ok || !s.authorize(w, r, auth.RoleViewer, route.Namespace) {
+		return
+	}
+	etag := routeETag(route)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.routeStatus(r.Context(), route))
+}
+
+// decodeRoute decodes a route body. The fields of responses (status, dependency_status) are accepted, so
+// that a route read can be sent back; unknown fields are not.
+func decodeRoute(data []byte) (store.RouteConfig, error) {
+	var body routeStatus
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		return store.RouteConfig{}, fmt.Errorf("invalid route: %w", err)
+	}
+	return body.RouteConfig, nil
+}
+
+func readRoute(w http.ResponseWriter, r *http.Request) (store.RouteConfig, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRouteBytes))
+	if err == nil {
+		var route store.RouteConfig
+		if route, err = decodeRoute(data); err == nil {
+			return route, true
+		}
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+	return store.RouteConfig{}, false
+}
+
+func (s *Server) handleV1CreateRoute(w http.ResponseWriter, r *http.Request) {
+	route, ok := readRoute(w, r)
+	if !ok || !s.checkRoute(w, r, route) {
+		return
+	}
+	err := s.saveRoute(&route, func(current *store.RouteConfig) error {
+		if current != nil {
+			return fmt.Errorf("%w: %s", errRouteExists, route.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		if !writeConflict(w, r, err) {
+			writeStoreError(w, err)
+		}
+		return
+	}
+	s.writeSavedRoute(w, r, route, true)
+}
+
+func (s *Server) handleV1PutRoute(w http.ResponseWriter, r *http.Request) {
+	route, ok := readRoute(w, r)
+	if !ok {
+		return
+	}
+	s.replaceRoute(w, r, route, preconditions(r))
+}
+
+// replaceRoute saves a route sent to /routes/{id} if check, called with the stored route, returns nil.
+func (s *Server) replaceRoute(w http.ResponseWriter, r *http.Request, route store.RouteConfig, check func(current *store.RouteConfig) error) {
+	id := r.PathValue("id")
+	if route.ID != "" && route.ID != id {
+		var errs store.FieldErrors
+		errs.Add("id", "must be empty or %s, the ID of the path", id)
+		writeProblem(w, http.StatusUnprocessableEntity, problemInvalidRoute, "Invalid route", errs)
+		return
+	}
+	route.ID = id
+	if !s.checkRoute(w, r, route) {
+		return
+	}
+
+	created := false
+	err := s.saveRoute(&route, func(current *store.RouteConfig) error {
+		if err := check(current); err != nil {
+			return err
+		}
+		created = current == nil
+		if current != nil {
+			route.LastActivity = current.LastActivity // Runtime state, not configuration
+		}
+		return nil
+	})
+	if err != nil {
+		if !writeConflict(w, r, err) {
+			writeStoreError(w, err)
+		}
+		return
+	}
+	s.writeSavedRoute(w, r, route, created)
+}
+
+func (s *Server) writeSavedRoute(w http.ResponseWriter, r *http.Request, route store.RouteConfig, created bool) {
+	w.Header().Set("ETag", routeETag(route))
+	status := http.StatusOK
+	if created {
+		w.Header().Set("Location", v1Prefix+"/routes/"+url.PathEscape(route.ID))
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, s.routeStatus(r.Context(), route))
+}
+
+func (s *Server) handleV1PatchRoute(w http.ResponseWriter, r *http.Request) {
+	existing, ok := s.routeFromPath(w, r)
+	if !ok || !s.authorize(w, r, auth.RoleAdmin, existing.Namespace) {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/merge-patch+json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var patch interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRouteBytes)).Decode(&patch); err != nil {
+		http.Error(w, "Invalid patch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, isObject := patch.(map[string]interface{}); !isObject {
+		http.Error(w, "Invalid patch: must be a JSON object", http.StatusBadRequest)
+		return
+	}
+	var target interface{}
+	data, _ := json.Marshal(existing)
+	json.Unmarshal(data, &target)
+	data, _ = json.Marshal(mergePatch(target, patch))
+	route, err := decodeRoute(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The patch applies to the route as read: it is not saved over changes made meanwhile
+	etag, check := routeETag(existing), preconditions(r)
+	s.replaceRoute(w, r, route, func(current *store.RouteConfig) error {
+		if current == nil {
+			return store.ErrRouteNotFound
+		}
+		if err := check(current); err != nil {
+			return err
+		}
+		if routeETag(*current) != etag {
+			return errRouteChanged
+		}
+		return nil
+	})
+}
+
+// mergePatch applies a JSON merge patch (RFC 7396) to a decoded JSON document.
+func mergePatch(target, patch interface{}) interface{} {
+	fields, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = make(map[string]interface{})
+	}
+	for name, value := range fields {
+		if value == nil {
+			delete(object, name)
+		} else {
+			object[name] = mergePatch(object[name], value)
+		}
+	}
+	return object
+}
+
+func (s *Server) handleV1DeleteRoute(w http.ResponseWriter, r *http.Request) {
+	route, ok := s.routeFromPath(w, r)
+	if !ok || !s.authorize(w, r, auth.RoleAdmin, route.Namespace) {
+		return
+	}
+	check := preconditions(r)
+	err := s.store.RemoveRouteIf(route.ID, func(current *store.RouteConfig) error {
+		if current == nil {
+			return store.ErrRouteNotFound
+		}
+		return check(current)
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleV1ListResources(w http.ResponseWriter, r *http.Request) {
+	identity, namespace := auth.FromContext(r.Context()), r.URL.Query().Get("namespace")
+	var resources []PatchableResource
+	var err error
+	switch r.PathValue("kind") {
+	case "ingresses":
+		resources, err = s.ingressResources(r.Context(), identity, namespace)
+	case "routes":
+		resources, err = s.openshiftResources(r.Context(), identity, namespace)
+		if err != nil && !errors.Is(err, errNoCluster) {
+			// Expected on clusters without the OpenShift Route API
+			log.DebugContext(r.Context(), "Failed to list OpenShift routes", "error", err)
+			resources, err = []PatchableResource{}, nil
+		}
+	default:
+		http.Error(w, "Unknown kind, must be ingresses or routes", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeResourceError(w, err)
+		return
+	}
+
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Namespace+"/"+resources[i].Name < resources[j].Namespace+"/"+resources[j].Name
+	})
+	start, end, next, err := pageBounds(r, len(resources), func(i int) string {
+		return resources[i].Namespace + "/" + resources[i].Name
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, resourceList{Items: resources[start:end], NextPageToken: next})
+}
+
+// handleV1ResourceAction serves /resources/{kind}/{name}:patch and :unpatch.
+func (s *Server) handleV1ResourceAction(w http.ResponseWriter, r *http.Request) {
+	kind := r.PathValue("kind")
+	sep := strings.LastIndex(r.PathValue("action"), ":")
+	if sep <= 0 || (kind != "ingresses" && kind != "routes") {
+		http.NotFound(w, r)
+		return
+	}
+	name, action := r.PathValue("action")[:sep], r.PathValue("action")[sep+1:]
+	namespace := r.URL.Query().Get("namespace")
+	if action != "patch" && action != "unpatch" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorize(w, r, auth.RoleAdmin, s.namespaceOrDefault(namespace)) {
+		return
+	}
+
+	if action == "unpatch" {
+		unpatch := s.unpatchIngress
+		if kind == "routes" {
+			unpatch = s.unpatchOpenshiftRoute
+		}
+		if err := unpatch(namespace, name); err != nil {
+			writeResourceError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	patch := s.patchIngress
+	if kind == "routes" {
+		patch = s.patchOpenshiftRoute
+	}
+	route, err := patch(namespace, name)
+	if err != nil {
+		writeResourceError(w, err)
+		return
+	}
+	w.Header().Set("Location", v1Prefix+"/routes/"+url.PathEscape(route.ID))
+	writeJSON(w, http.StatusCreated, s.routeStatus(r.Context(), *route))
+}
+
+// writeResourceError answers an error of listing, patching or unpatching resources.
+func writeResourceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNoCluster):
+		http.Error(w, "Kubernetes client not initialized", http.StatusServiceUnavailable)
+	case errors.Is(err, errAlreadyPatched), errors.Is(err, errNotPatched):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errNoRules):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case apierrors.IsNotFound(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
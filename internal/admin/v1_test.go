@@ -0,0 +1,223 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/openapi"
+	"smart-proxy/internal/store"
+)
+
+// v1Client sends requests to /api/v1 and checks every response against the OpenAPI document.
+type v1Client struct {
+	t       *testing.T
+	handler http.Handler
+	doc     *openapi.Document
+	store   *store.Store
+}
+
+func newV1Client(t *testing.T) *v1Client {
+	tokens, err := auth.NewStaticTokens([]auth.StaticToken{
+		{Token: "admin", User: "alice", Binding: auth.Binding{Role: "admin"}},
+		{Token: "viewer", User: "bob", Binding: auth.Binding{Role: "viewer", Namespaces: []string{"shop"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := store.NewStore(filepath.Join(t.TempDir(), "routes.json"))
+	server := NewServer(nil, s, nil, tokens)
+	ops := server.v1Operations()
+	return &v1Client{t: t, handler: v1Handler(ops, tokens), doc: v1Document(ops), store: s}
+}
+
+// do sends a request as admin, unless an Authorization header is given. headers are name, value pairs.
+func (c *v1Client) do(method, path string, body io.Reader, headers ...string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	r := httptest.NewRequest(method, path, body)
+	r.Header.Set("Authorization", "Bearer admin")
+	r.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, r)
+	if err := c.doc.ValidateResponse(method, r.URL.EscapedPath(), w.Code, w.Header().Get("Content-Type"), w.Body.Bytes()); err != nil {
+		c.t.Errorf("response does not match the document: %v", err)
+	}
+	return w
+}
+
+func (c *v1Client) expect(w *httptest.ResponseRecorder, status int) {
+	c.t.Helper()
+	if w.Code != status {
+		c.t.Fatalf("status %d, want %d: %s", w.Code, status, w.Body)
+	}
+}
+
+func testRoute(id, path string) store.RouteConfig {
+	return store.RouteConfig{
+		ID: id, Host: "shop.example.com", Path: path, Namespace: "shop",
+		Deployment: "web", TargetService: "web", TargetPort: 80, IdleTimeout: time.Hour,
+	}
+}
+
+func routeBody(route store.RouteConfig) io.Reader {
+	data, _ := json.Marshal(route)
+	return strings.NewReader(string(data))
+}
+
+func TestV1RouteETags(t *testing.T) {
+	c := newV1Client(t)
+
+	w := c.do(http.MethodPost, "/api/v1/routes", routeBody(testRoute("shop", "/")))
+	c.expect(w, http.StatusCreated)
+	if w.Header().Get("Location") != "/api/v1/routes/shop" {
+		t.Errorf("Location %q", w.Header().Get("Location"))
+	}
+	c.expect(c.do(http.MethodPost, "/api/v1/routes", routeBody(testRoute("shop", "/other"))), http.StatusConflict)
+
+	w = c.do(http.MethodGet, "/api/v1/routes/shop", nil)
+	c.expect(w, http.StatusOK)
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	c.expect(c.do(http.MethodGet, "/api/v1/routes/shop", nil, "If-None-Match", etag), http.StatusNotModified)
+
+	// Traffic does not change the version
+	c.store.UpdateActivity("shop")
+	c.expect(c.do(http.MethodGet, "/api/v1/routes/shop", nil, "If-None-Match", etag), http.StatusNotModified)
+
+	updated := testRoute("shop", "/")
+	updated.IdleTimeout = 2 * time.Hour
+	c.expect(c.do(http.MethodPut, "/api/v1/routes/shop", routeBody(updated), "If-Match", `"stale"`), http.StatusPreconditionFailed)
+	c.expect(c.do(http.MethodPut, "/api/v1/routes/shop", routeBody(updated), "If-None-Match", "*"), http.StatusPreconditionFailed)
+	w = c.do(http.MethodPut, "/api/v1/routes/shop", routeBody(updated), "If-Match", etag)
+	c.expect(w, http.StatusOK)
+	if w.Header().Get("ETag") == etag {
+		t.Error("ETag unchanged by PUT")
+	}
+	c.expect(c.do(http.MethodGet, "/api/v1/routes/shop", nil, "If-None-Match", etag), http.StatusOK)
+
+	c.expect(c.do(http.MethodDelete, "/api/v1/routes/shop", nil, "If-Match", etag), http.StatusPreconditionFailed)
+	c.expect(c.do(http.MethodDelete, "/api/v1/routes/shop", nil, "If-Match", w.Header().Get("ETag")), http.StatusNoContent)
+	c.expect(c.do(http.MethodGet, "/api/v1/routes/shop", nil), http.StatusNotFound)
+
+	// PUT creates with If-None-Match: *
+	w = c.do(http.MethodPut, "/api/v1/routes/shop", routeBody(updated), "If-None-Match", "*")
+	c.expect(w, http.StatusCreated)
+}
+
+// changingReader runs change before the body is first read: the route changes while the request is served.
+type changingReader struct {
+	io.Reader
+	change func()
+}
+
+func (c *changingReader) Read(p []byte) (int, error) {
+	if c.change != nil {
+		c.change()
+		c.change = nil
+	}
+	return c.Reader.Read(p)
+}
+
+func TestV1PatchRoute(t *testing.T) {
+	c := newV1Client(t)
+	c.expect(c.do(http.MethodPost, "/api/v1/routes", routeBody(testRoute("shop", "/"))), http.StatusCreated)
+	c.expect(c.do(http.MethodPost, "/api/v1/routes", routeBody(testRoute("admin", "/admin"))), http.StatusCreated)
+	patch := func(body string, headers ...string) *httptest.ResponseRecorder {
+		return c.do(http.MethodPatch, "/api/v1/routes/shop", strings.NewReader(body),
+			append([]string{"Content-Type", "application/merge-patch+json"}, headers...)...)
+	}
+
+	w := patch(`{"idle_timeout": 7200000000000, "warmup_path": "/health"}`)
+	c.expect(w, http.StatusOK)
+	route, _ := c.store.GetRoute("shop")
+	if route.IdleTimeout != 2*time.Hour || route.WarmupPath != "/health" || route.Path != "/" {
+		t.Errorf("patched route %+v", route)
+	}
+	c.expect(patch(`{"warmup_path": null}`), http.StatusOK)
+	if route, _ := c.store.GetRoute("shop"); route.WarmupPath != "" {
+		t.Errorf("warmup_path not removed: %q", route.WarmupPath)
+	}
+
+	c.expect(patch(`{"wake_timeout": 60000000000}`, "If-Match", `"stale"`), http.StatusPreconditionFailed)
+	c.expect(c.do(http.MethodPatch, "/api/v1/routes/shop", strings.NewReader(`{}`), "Content-Type", "text/plain"), http.StatusUnsupportedMediaType)
+	c.expect(patch(`{"idle_timeout": 1}`), http.StatusUnprocessableEntity)
+
+	// Host and path served by another route
+	w = patch(`{"path": "/admin"}`)
+	c.expect(w, http.StatusConflict)
+	var p problem
+	if json.Unmarshal(w.Body.Bytes(), &p); p.Type != problemRouteConflict || len(p.Errors) == 0 {
+		t.Errorf("conflict problem %+v", p)
+	}
+
+	// Changed after the PATCH read it
+	body := &changingReader{Reader: strings.NewReader(`{"idle_timeout": 10800000000000}`), change: func() {
+		changed, _ := c.store.GetRoute("shop")
+		changed.WakeTimeout = time.Minute
+		c.store.AddRoute(&changed)
+	}}
+	c.expect(c.do(http.MethodPatch, "/api/v1/routes/shop", body, "Content-Type", "application/merge-patch+json"), http.StatusConflict)
+	if route, _ := c.store.GetRoute("shop"); route.IdleTimeout != 2*time.Hour || route.WakeTimeout != time.Minute {
+		t.Errorf("conflicting PATCH applied: %+v", route)
+	}
+}
+
+func TestV1ListPagination(t *testing.T) {
+	c := newV1Client(t)
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("route-%d", i)
+		c.expect(c.do(http.MethodPost, "/api/v1/routes", routeBody(testRoute(id, "/"+id))), http.StatusCreated)
+	}
+
+	var ids []string
+	pages := 0
+	path := "/api/v1/routes?limit=2"
+	for {
+		w := c.do(http.MethodGet, path, nil)
+		c.expect(w, http.StatusOK)
+		var page routeList
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, item := range page.Items {
+			ids = append(ids, item.ID)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		if len(page.Items) != 2 || pages > 3 {
+			t.Fatalf("page %d: %d items, token %q", pages, len(page.Items), page.NextPageToken)
+		}
+		path = "/api/v1/routes?limit=2&page_token=" + page.NextPageToken
+	}
+	if want := "route-0,route-1,route-2,route-3,route-4"; strings.Join(ids, ",") != want || pages != 3 {
+		t.Errorf("%d pages of %v, want 3 of %s", pages, ids, want)
+	}
+
+	c.expect(c.do(http.MethodGet, "/api/v1/routes?limit=0", nil), http.StatusBadRequest)
+	c.expect(c.do(http.MethodGet, "/api/v1/routes?limit=501", nil), http.StatusBadRequest)
+	c.expect(c.do(http.MethodGet, "/api/v1/routes?page_token=!", nil), http.StatusBadRequest)
+}
+
+func TestV1Authorization(t *testing.T) {
+	c := newV1Client(t)
+	c.expect(c.do(http.MethodPost, "/api/v1/routes", routeBody(testRoute("shop", "/"))), http.StatusCreated)
+
+	c.expect(c.do(http.MethodGet, "/api/v1/routes/shop", nil, "Authorization", ""), http.StatusUnauthorized)
+	c.expect(c.do(http.MethodGet, "/api/v1/routes/shop", nil, "Authorization", "Bearer viewer"), http.StatusOK)
+	c.expect(c.do(http.MethodDelete, "/api/v1/routes/shop", nil, "Authorization", "Bearer viewer"), http.StatusForbidden)
+	c.expect(c.do(http.MethodGet, "/api/v1/routes/unknown", nil), http.StatusNotFound)
+}
@@ -0,0 +1,164 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/store"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Problem types of the admin API, in problem details responses.
+const (
+	problemInvalidRoute    = "urn:smart-proxy:problem:invalid-route"
+	problemRouteConflict   = "urn:smart-proxy:problem:route-conflict"
+	problemInvalidDocument = "urn:smart-proxy:problem:invalid-document" // /api/config/import
+	problemForbidden       = "urn:smart-proxy:problem:forbidden"
+)
+
+// problem is a problem details response (RFC 9457), listing the fields at fault.
+type problem struct {
+	Type   string            `json:"type"`
+	Title  string            `json:"title"`
+	Status int               `json:"status"`
+	Detail string            `json:"detail,omitempty"`
+	Errors store.FieldErrors `json:"errors,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, problemType, title string, errs store.FieldErrors) {
+	errs.Err() // Sorts by path
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{Type: problemType, Title: title, Status: status, Detail: errs.Error(), Errors: errs})
+}
+
+// checkRoute checks a route before it is saved, replying with the problems if it may not be: the route on its
+// own, the admin role of the caller in its namespace (and its former one if it moves), then the cluster and
+// host and path conflicts, only checked for authorized callers as errors tell about them.
+func (s *Server) checkRoute(w http.ResponseWriter, r *http.Request, route store.RouteConfig) bool {
+	if errs := route.Validate(s.MinIdleTimeout); len(errs) > 0 {
+		writeProblem(w, http.StatusUnprocessableEntity, problemInvalidRoute, "Invalid route", errs)
+		return false
+	}
+	if !s.authorize(w, r, auth.RoleAdmin, route.Namespace) {
+		return false
+	}
+	// Moving a route out of a namespace also requires admin there
+	if existing, ok := s.store.GetRoute(route.ID); ok && existing.Namespace != route.Namespace {
+		if !s.authorize(w, r, auth.RoleAdmin, existing.Namespace) {
+			return false
+		}
+	}
+	if errs := s.clusterProblems(r.Context(), route); len(errs) > 0 {
+		writeProblem(w, http.StatusUnprocessableEntity, problemInvalidRoute, "Invalid route", errs)
+		return false
+	}
+	if errs := conflictProblems(route, s.store.GetAllRoutes(), auth.FromContext(r.Context())); len(errs) > 0 {
+		writeProblem(w, http.StatusConflict, problemRouteConflict, "Route conflict", errs)
+		return false
+	}
+	return true
+}
+
+// writeConflict replies with the routes of a *store.ConflictError, which saveRoute returns if another route
+// took the host and path since checkRoute, and reports whether err was one.
+func writeConflict(w http.ResponseWriter, r *http.Request, err error) bool {
+	var conflict *store.ConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	errs := conflictProblems(conflict.Route, conflict.Routes, auth.FromContext(r.Context()))
+	writeProblem(w, http.StatusConflict, problemRouteConflict, "Route conflict", errs)
+	return true
+}
+
+// minIdleTimeoutFromEnv reads MIN_IDLE_TIMEOUT, the shortest idle timeout routes may have.
+func minIdleTimeoutFromEnv() time.Duration {
+	if s := os.Getenv("MIN_IDLE_TIMEOUT"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+			return d
+		}
+		log.Warn("Ignoring invalid MIN_IDLE_TIMEOUT", "value", s)
+	}
+	return store.DefaultMinIdleTimeout
+}
+
+// clusterProblems checks that the namespaces of a route are watched and that its Deployment, Service and port,
+// and dependencies exist. Nothing is checked without a k8s client.
+func (s *Server) clusterProblems(ctx context.Context, route store.RouteConfig) store.FieldErrors {
+	var errs store.FieldErrors
+	if s.k8sClient == nil {
+		return errs
+	}
+	if !s.k8sClient.Watches(route.Namespace) {
+		errs.Add("namespace", "namespace %s is not watched", route.Namespace)
+		return errs
+	}
+
+	if _, err := s.k8sClient.GetDeployment(ctx, route.Namespace, route.Deployment); err != nil {
+		missing(&errs, "deployment", "deployment", route.Namespace, route.Deployment, err)
+	}
+	service, err := s.k8sClient.GetService(ctx, route.Namespace, route.TargetService)
+	if err != nil {
+		missing(&errs, "target_service", "service", route.Namespace, route.TargetService, err)
+	} else if !hasPort(service, route.TargetPort) {
+		errs.Add("target_port", "service %s/%s has no port %d", route.Namespace, route.TargetService, route.TargetPort)
+	}
+	for i, dep := range route.Dependencies {
+		path := fmt.Sprintf("dependencies[%d].name", i)
+		namespace, name := dep.Target(route.Namespace)
+		if !s.k8sClient.Watches(namespace) {
+			errs.Add(path, "namespace %s is not watched", namespace)
+			continue
+		}
+		if _, err := s.k8sClient.GetDeployment(ctx, namespace, name); err != nil {
+			missing(&errs, path, "deployment", namespace, name, err)
+		}
+	}
+	return errs
+}
+
+// missing records an object that does not exist. Other errors, e.g. a missing permission or the API server
+// being unreachable, are logged and do not prevent saving.
+func missing(errs *store.FieldErrors, path, kind, namespace, name string, err error) {
+	if apierrors.IsNotFound(err) {
+		errs.Add(path, "%s %s/%s not found", kind, namespace, name)
+		return
+	}
+	log.Warn("Could not check that the object of a route exists", "kind", kind, "namespace", namespace, "name", name, "error", err)
+}
+
+func hasPort(service *corev1.Service, port int) bool {
+	for _, p := range service.Spec.Ports {
+		if int(p.Port) == port {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictProblems reports the routes among others serving the same host and path as route. Routes in
+// namespaces the caller may not view are not named.
+func conflictProblems(route store.RouteConfig, others []store.RouteConfig, identity *auth.Identity) store.FieldErrors {
+	var errs store.FieldErrors
+	host := route.Host
+	if host == "" {
+		host = "any host"
+	}
+	for _, other := range store.Conflicts(route, others) {
+		if other.ID != "" && identity != nil && identity.Can(auth.RoleViewer, other.Namespace) {
+			errs.Add("path", "%s on %s is already served by route %s", route.Path, host, other.ID)
+		} else {
+			errs.Add("path", "%s on %s is already served by another route", route.Path, host)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,202 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-proxy/internal/audit"
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/proxy"
+	"smart-proxy/internal/store"
+)
+
+// Bounds of the ?timeout of a wake that waits for the route to be ready.
+const (
+	defaultWaitTimeout = 5 * time.Minute
+	maxWaitTimeout     = 15 * time.Minute
+)
+
+// wakeResponse is the response of POST /api/routes/{id}/wake.
+type wakeResponse struct {
+	RouteID string `json:"route_id"`
+	Woke    bool   `json:"woke"` // Whether a deployment was scaled up; false if the route was already awake
+	*proxy.ReadyStatus
+}
+
+// routeFromPath returns the route named by the {id} of the request path, replying 404 if there is none.
+// IDs with a slash, such as "ing-namespace/name", are sent escaped: "ing-namespace%2Fname".
+func (s *Server) routeFromPath(w http.ResponseWriter, r *http.Request) (store.RouteConfig, bool) {
+	route, found := s.store.GetRoute(r.PathValue("id"))
+	if !found {
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return store.RouteConfig{}, false
+	}
+	return route, true
+}
+
+// handleWakeRoute wakes a route, e.g. to warm it before a demo or end-to-end tests.
+// With ?wait=true it answers once the route is ready (200) or after ?timeout (default 5m) with 504.
+// Otherwise it answers 202 at once.
+func (s *Server) handleWakeRoute(w http.ResponseWriter, r *http.Request) {
+	route, ok := s.routeFromPath(w, r)
+	if !ok || !s.authorize(w, r, auth.RoleOperator, route.Namespace) {
+		return
+	}
+	if s.Proxy == nil {
+		http.Error(w, "Proxy not available", http.StatusServiceUnavailable)
+		return
+	}
+	wait := r.URL.Query().Get("wait") == "true"
+	timeout := defaultWaitTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxWaitTimeout {
+			http.Error(w, "Invalid timeout, must be a duration up to 15m", http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
+	ctx := logger.WithRouteID(r.Context(), route.ID)
+	actor := auth.FromContext(r.Context()).Name
+	woke, err := s.Proxy.Wake(ctx, route.ID, "was woken by "+actor)
+	switch {
+	case errors.Is(err, proxy.ErrWakeBlocked):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	log.InfoContext(ctx, "Manual wake-up", "by", actor, "woke", woke)
+	s.Audit.Record(audit.Entry{Actor: actor, Action: audit.ActionRouteWake, RouteID: route.ID, Namespace: route.Namespace})
+
+	response := wakeResponse{RouteID: route.ID, Woke: woke}
+	status := http.StatusAccepted
+	if wait {
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		ready, err := s.Proxy.WaitReady(waitCtx, route.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		response.ReadyStatus = &ready
+		status = http.StatusOK
+		if ready.Status != "ready" {
+			status = http.StatusGatewayTimeout
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// sleepResponse is the response of POST /api/routes/{id}/sleep.
+type sleepResponse struct {
+	RouteID string   `json:"route_id"`
+	Scaled  []string `json:"scaled"` // namespace/name of the deployments scaled to zero
+}
+
+// handleSleepRoute puts a route to sleep now: its deployment and stop-on-idle dependencies are scaled to zero.
+func (s *Server) handleSleepRoute(w http.ResponseWriter, r *http.Request) {
+	route, ok := s.routeFromPath(w, r)
+	if !ok || !s.authorize(w, r, auth.RoleOperator, route.Namespace) {
+		return
+	}
+	if s.Watcher == nil || s.k8sClient == nil {
+		http.Error(w, "Kubernetes client not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := logger.WithRouteID(r.Context(), route.ID)
+	actor := auth.FromContext(r.Context()).Name
+	scaled := s.Watcher.Sleep(ctx, route, "was put to sleep by "+actor)
+	log.InfoContext(ctx, "Manual sleep", "by", actor, "scaled", len(scaled))
+	s.Audit.Record(audit.Entry{Actor: actor, Action: audit.ActionRouteSleep, RouteID: route.ID, Namespace: route.Namespace})
+
+	response := sleepResponse{RouteID: route.ID, Scaled: make([]string, 0, len(scaled))}
+	for _, t := range scaled {
+		response.Scaled = append(response.Scaled, t.Namespace+"/"+t.Name)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// wakeLinkRequest is the body of POST /api/routes/{id}/wake-links; both fields are optional.
+type wakeLinkRequest struct {
+	TTL         string `json:"ttl,omitempty"`           // Default 24h, at most 720h
+	RatePerHour int    `json:"rate_per_hour,omitempty"` // Default 10
+}
+
+// wakeLinkResponse adds the full URL of the link, when the route has a host.
+type wakeLinkResponse struct {
+	proxy.WakeLink
+	URL string `json:"url,omitempty"`
+}
+
+// handleWakeLinks creates a signed, expiring link that wakes the route, to share with people without access
+// to the admin API. The link only wakes the route: its access policy still applies.
+func (s *Server) handleWakeLinks(w http.ResponseWriter, r *http.Request) {
+	route, ok := s.routeFromPath(w, r)
+	if !ok || !s.authorize(w, r, auth.RoleOperator, route.Namespace) {
+		return
+	}
+	if s.Proxy == nil {
+		http.Error(w, "Proxy not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	req := wakeLinkRequest{RatePerHour: proxy.DefaultWakeLinkRate}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	ttl := proxy.DefaultWakeLinkTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	if req.RatePerHour == 0 {
+		req.RatePerHour = proxy.DefaultWakeLinkRate
+	}
+
+	link, err := s.Proxy.NewWakeLink(route.ID, ttl, req.RatePerHour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	actor := auth.FromContext(r.Context()).Name
+	s.Audit.Record(audit.Entry{
+		Actor:     actor,
+		Action:    audit.ActionWakeLinkCreate,
+		RouteID:   route.ID,
+		Namespace: route.Namespace,
+		Target:    link.ID,
+		Details:   map[string]string{"expires": link.Expires.Format(time.RFC3339), "rate_per_hour": strconv.Itoa(link.RatePerHour)},
+	})
+
+	response := wakeLinkResponse{WakeLink: link}
+	if base := os.Getenv("WAKE_LINK_BASE_URL"); base != "" {
+		response.URL = strings.TrimSuffix(base, "/") + link.Path
+	} else if route.Host != "" {
+		response.URL = "https://" + route.Host + link.Path
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,115 @@
+// Package audit records the manual operations done on routes and deployments, such as maintenance windows
+// and manual stops: who did what, when and why. Entries go to the application log, an optional JSON lines
+// file, and a bounded in-memory history served by the admin API.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"smart-proxy/internal/logger"
+)
+
+var log = logger.Component("audit")
+
+// Actions recorded.
+const (
+	ActionRouteMode      = "route.mode"       // The operational state of a route changed
+	ActionDeploymentStop = "deployment.stop"  // A deployment was scaled to zero from the admin API
+	ActionRouteWake      = "route.wake"       // A route was woken from the admin API
+	ActionRouteSleep     = "route.sleep"      // A route was put to sleep from the admin API
+	ActionWakeLinkCreate = "wake_link.create" // A wake link was signed; Target is the link ID
+	ActionConfigImport   = "config.import"    // Routes were created, updated or deleted from a document
+)
+
+// SystemActor is the actor of changes made by the proxy itself, e.g. an expired maintenance window.
+const SystemActor = "system"
+
+// Entry is an audited operation.
+type Entry struct {
+	Time      time.Time         `json:"time"`
+	Actor     string            `json:"actor"` // Identity of the caller, or SystemActor
+	Action    string            `json:"action"`
+	RouteID   string            `json:"route_id,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	Target    string            `json:"target,omitempty"` // e.g. the deployment stopped
+	Reason    string            `json:"reason,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Log records entries. A nil *Log discards everything.
+type Log struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries []Entry // Oldest first, at most max
+	max     int
+}
+
+const defaultHistory = 1000
+
+// FromEnv opens the audit log. Entries are always kept in memory and written to the application log.
+//
+//	AUDIT_LOG_FILE  If set, entries are also appended to this file, one JSON object per line
+func FromEnv() (*Log, error) {
+	l := &Log{max: defaultHistory}
+	if path := os.Getenv("AUDIT_LOG_FILE"); path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("opening audit log file: %w", err)
+		}
+		l.file = file
+	}
+	return l, nil
+}
+
+// Record audits an entry. Time is set if zero.
+func (l *Log) Record(e Entry) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	log.Info("Audit", "actor", e.Actor, "action", e.Action, "route_id", e.RouteID, "namespace", e.Namespace,
+		"target", e.Target, "reason", e.Reason, "details", e.Details)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+	if len(l.entries) > l.max {
+		l.entries = l.entries[len(l.entries)-l.max:]
+	}
+	if l.file != nil {
+		line, _ := json.Marshal(e)
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			log.Error("Failed to write audit log file", "error", err)
+		}
+	}
+}
+
+// Recent returns up to limit entries accepted by include (nil for all), newest first.
+func (l *Log) Recent(include func(Entry) bool, limit int) []Entry {
+	entries := []Entry{}
+	if l == nil {
+		return entries
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if include == nil || include(l.entries[i]) {
+			entries = append(entries, l.entries[i])
+		}
+	}
+	return entries
+}
+
+// Close closes the audit log file, if any.
+func (l *Log) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,240 @@
+// Package auth provides pluggable authentication and role-based authorization for the admin API.
+// Callers are authenticated with static bearer tokens, Kubernetes TokenReview or OIDC ID tokens,
+// and hold one of three roles (viewer, operator, admin), optionally limited to a set of namespaces.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// Role is the level of access held by a caller. Higher roles include the lower ones.
+type Role int
+
+const (
+	RoleNone     Role = iota
+	RoleViewer        // Read-only access to routes, stats and cluster resources
+	RoleOperator      // Viewer plus runtime actions (stop, wake)
+	RoleAdmin         // Operator plus configuration changes (routes, patching)
+)
+
+// String returns the lower-case name of the role.
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// MarshalJSON encodes the role by name.
+func (r Role) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// ParseRole parses a role name.
+func ParseRole(s string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "viewer":
+		return RoleViewer, nil
+	case "operator":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown role %q", s)
+	}
+}
+
+// AllNamespaces is the namespace key granting a role everywhere.
+const AllNamespaces = "*"
+
+// RoleResolver returns the role a caller holds in a namespace.
+// AllNamespaces asks for the cluster-wide role.
+type RoleResolver interface {
+	RoleIn(namespace string) Role
+}
+
+// StaticRoles is a RoleResolver backed by a fixed namespace -> role map.
+type StaticRoles map[string]Role
+
+// RoleIn returns the highest of the cluster-wide role and the role in namespace.
+func (s StaticRoles) RoleIn(namespace string) Role {
+	role := s[AllNamespaces]
+	if r := s[namespace]; r > role {
+		role = r
+	}
+	return role
+}
+
+// Binding grants a role, either cluster-wide (no namespaces) or in the listed namespaces.
+type Binding struct {
+	Role       string   `json:"role"`
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// apply adds the binding to roles, keeping the highest role per namespace.
+func (b Binding) apply(roles StaticRoles) error {
+	role, err := ParseRole(b.Role)
+	if err != nil {
+		return err
+	}
+	namespaces := b.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{AllNamespaces}
+	}
+	for _, ns := range namespaces {
+		if role > roles[ns] {
+			roles[ns] = role
+		}
+	}
+	return nil
+}
+
+// Identity is an authenticated caller.
+type Identity struct {
+	Name   string       `json:"name"`
+	Groups []string     `json:"groups,omitempty"`
+	Method string       `json:"method"` // Authenticator that accepted the caller
+	Roles  RoleResolver `json:"-"`
+}
+
+// Can reports whether the identity holds at least role in namespace.
+func (i *Identity) Can(role Role, namespace string) bool {
+	if namespace == "" {
+		namespace = AllNamespaces
+	}
+	return i.Roles.RoleIn(namespace) >= role
+}
+
+// Errors returned by authenticators.
+var (
+	ErrNoCredentials      = errors.New("no credentials provided")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Authenticator identifies the caller of an HTTP request.
+type Authenticator interface {
+	// Authenticate returns ErrNoCredentials if the request carries no token it understands.
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Chain tries each authenticator in turn until one recognises the credentials.
+// Authenticators return ErrNoCredentials for tokens they do not understand, so that
+// e.g. a ServiceAccount token can fall through the static token list to TokenReview.
+type Chain []Authenticator
+
+// Authenticate implements Authenticator.
+func (c Chain) Authenticate(r *http.Request) (*Identity, error) {
+	for _, a := range c {
+		identity, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return identity, err
+	}
+	if BearerToken(r) != "" {
+		return nil, ErrInvalidCredentials
+	}
+	return nil, ErrNoCredentials
+}
+
+// Anonymous grants admin to every caller. It is used when authentication is disabled.
+type Anonymous struct{}
+
+// Authenticate implements Authenticator.
+func (Anonymous) Authenticate(r *http.Request) (*Identity, error) {
+	return &Identity{Name: "anonymous", Method: "none", Roles: StaticRoles{AllNamespaces: RoleAdmin}}, nil
+}
+
+// CookieName is the cookie the token may be sent in, so the dashboard and EventSource work without headers.
+const CookieName = "smart_proxy_token"
+
+// BearerToken extracts the token from the Authorization header or the session cookie.
+func BearerToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if token, ok := strings.CutPrefix(h, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if c, err := r.Cookie(CookieName); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+type contextKey struct{}
+
+// FromContext returns the identity stored by Middleware.
+func FromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(contextKey{}).(*Identity)
+	return identity
+}
+
+// WithIdentity returns a copy of ctx carrying identity.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// Middleware rejects unauthenticated requests with 401 and stores the identity in the request context.
+// Authorization is left to the handlers, which know the namespace being accessed.
+func Middleware(authn Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := authn.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="smart-proxy"`)
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+// FromEnv builds the authenticator configured by AUTH_MODE, a comma-separated list of
+// "token", "kubernetes" and "oidc". An empty AUTH_MODE (or "none") disables authentication.
+// clientset is only required by the "kubernetes" mode.
+func FromEnv(clientset kubernetes.Interface) (Authenticator, error) {
+	mode := os.Getenv("AUTH_MODE")
+	if mode == "" || mode == "none" {
+		return Anonymous{}, nil
+	}
+
+	var chain Chain
+	for _, m := range strings.Split(mode, ",") {
+		switch strings.TrimSpace(m) {
+		case "token":
+			a, err := LoadStaticTokens(os.Getenv("AUTH_TOKENS_FILE"))
+			if err != nil {
+				return nil, fmt.Errorf("token auth: %w", err)
+			}
+			chain = append(chain, a)
+		case "kubernetes":
+			if clientset == nil {
+				return nil, fmt.Errorf("kubernetes auth requires a Kubernetes client")
+			}
+			chain = append(chain, NewKubernetes(clientset))
+		case "oidc":
+			a, err := NewOIDCFromEnv()
+			if err != nil {
+				return nil, fmt.Errorf("oidc auth: %w", err)
+			}
+			chain = append(chain, a)
+		default:
+			return nil, fmt.Errorf("unknown AUTH_MODE %q", m)
+		}
+	}
+	return chain, nil
+}
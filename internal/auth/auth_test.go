@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func request(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/routes", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestStaticTokens(t *testing.T) {
+	tokens, err := NewStaticTokens([]StaticToken{
+		{Token: "t-admin", User: "alice", Binding: Binding{Role: "admin"}},
+		{Token: "t-shop", User: "bob", Groups: []string{"shop"}, Binding: Binding{Role: "operator", Namespaces: []string{"shop", "cart"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := tokens.Authenticate(request("t-shop"))
+	if err != nil || identity.Name != "bob" || identity.Method != "token" {
+		t.Fatalf("identity %+v, %v", identity, err)
+	}
+	for _, tt := range []struct {
+		role      Role
+		namespace string
+		want      bool
+	}{
+		{RoleOperator, "shop", true},
+		{RoleViewer, "cart", true},
+		{RoleAdmin, "shop", false},
+		{RoleViewer, "billing", false},
+		{RoleViewer, "", false}, // Cluster-wide
+	} {
+		if got := identity.Can(tt.role, tt.namespace); got != tt.want {
+			t.Errorf("Can(%s, %q) = %v, want %v", tt.role, tt.namespace, got, tt.want)
+		}
+	}
+	if identity, _ := tokens.Authenticate(request("t-admin")); !identity.Can(RoleAdmin, "") || !identity.Can(RoleAdmin, "shop") {
+		t.Error("cluster-wide admin denied")
+	}
+
+	if _, err := tokens.Authenticate(request("")); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("no token: %v", err)
+	}
+	if _, err := tokens.Authenticate(request("wrong")); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong token: %v", err)
+	}
+	if _, err := tokens.Authenticate(request("a.b.c")); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("JWT not left to the next authenticator: %v", err)
+	}
+
+	cookie := request("")
+	cookie.AddCookie(&http.Cookie{Name: CookieName, Value: "t-admin"})
+	if identity, err := tokens.Authenticate(cookie); err != nil || identity.Name != "alice" {
+		t.Errorf("cookie token: %+v, %v", identity, err)
+	}
+}
+
+func TestStaticTokensRejectInvalidEntries(t *testing.T) {
+	for _, entries := range [][]StaticToken{
+		{{Token: "", User: "alice", Binding: Binding{Role: "admin"}}},
+		{{Token: "t", User: "", Binding: Binding{Role: "admin"}}},
+		{{Token: "t", User: "alice", Binding: Binding{Role: "root"}}},
+	} {
+		if _, err := NewStaticTokens(entries); err == nil {
+			t.Errorf("accepted %+v", entries)
+		}
+	}
+}
+
+func TestChainAndMiddleware(t *testing.T) {
+	tokens, _ := NewStaticTokens([]StaticToken{{Token: "t-admin", User: "alice", Binding: Binding{Role: "admin"}}})
+	chain := Chain{tokens}
+
+	handler := Middleware(chain, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(FromContext(r.Context()).Name))
+	}))
+	for _, tt := range []struct {
+		token  string
+		status int
+	}{
+		{"t-admin", http.StatusOK},
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{"a.b.c", http.StatusUnauthorized}, // No authenticator understands it
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, request(tt.token))
+		if w.Code != tt.status {
+			t.Errorf("token %q: status %d, want %d", tt.token, w.Code, tt.status)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("token %q: no WWW-Authenticate", tt.token)
+		}
+	}
+	if _, err := chain.Authenticate(request("a.b.c")); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unrecognized token: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SAR attributes used to map Kubernetes RBAC onto Smart Proxy roles.
+// A ClusterRole granting e.g. verbs ["view", "operate"] on "routes.smart-proxy.io"
+// makes the subject an operator; a RoleBinding limits that to one namespace.
+const (
+	APIGroup      = "smart-proxy.io"
+	RolesResource = "routes"
+)
+
+// roleVerbs maps each role to the SubjectAccessReview verb that grants it.
+var roleVerbs = map[Role]string{
+	RoleViewer:   "view",
+	RoleOperator: "operate",
+	RoleAdmin:    "admin",
+}
+
+// cacheTTL is how long TokenReview and SubjectAccessReview results are reused.
+const cacheTTL = time.Minute
+
+// Kubernetes authenticates bearer tokens with TokenReview and resolves roles with SubjectAccessReview.
+type Kubernetes struct {
+	client kubernetes.Interface
+
+	mu     sync.Mutex
+	tokens map[[sha256.Size]byte]cachedReview
+}
+
+type cachedReview struct {
+	identity *Identity
+	expires  time.Time
+}
+
+// NewKubernetes returns a Kubernetes authenticator using client for the reviews.
+func NewKubernetes(client kubernetes.Interface) *Kubernetes {
+	return &Kubernetes{
+		client: client,
+		tokens: make(map[[sha256.Size]byte]cachedReview),
+	}
+}
+
+// Authenticate implements Authenticator.
+func (k *Kubernetes) Authenticate(r *http.Request) (*Identity, error) {
+	token := BearerToken(r)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	key := sha256.Sum256([]byte(token))
+	k.mu.Lock()
+	if cached, ok := k.tokens[key]; ok && time.Now().Before(cached.expires) {
+		k.mu.Unlock()
+		return cached.identity, nil
+	}
+	k.mu.Unlock()
+
+	review, err := k.client.AuthenticationV1().TokenReviews().Create(r.Context(), &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if !review.Status.Authenticated {
+		return nil, ErrNoCredentials // Possibly an OIDC token for the next authenticator
+	}
+
+	user := review.Status.User
+	identity := &Identity{
+		Name:   user.Username,
+		Groups: user.Groups,
+		Method: "kubernetes",
+		Roles:  &sarRoles{client: k.client, user: user, cache: make(map[string]cachedRole)},
+	}
+
+	k.mu.Lock()
+	now := time.Now()
+	for hash, cached := range k.tokens {
+		if now.After(cached.expires) {
+			delete(k.tokens, hash)
+		}
+	}
+	k.tokens[key] = cachedReview{identity: identity, expires: now.Add(cacheTTL)}
+	k.mu.Unlock()
+	return identity, nil
+}
+
+// sarRoles resolves a user's role per namespace with SubjectAccessReviews.
+type sarRoles struct {
+	client kubernetes.Interface
+	user   authenticationv1.UserInfo
+
+	mu    sync.Mutex
+	cache map[string]cachedRole // Key is namespace
+}
+
+type cachedRole struct {
+	role    Role
+	expires time.Time
+}
+
+// RoleIn implements RoleResolver, checking from the highest role down.
+func (s *sarRoles) RoleIn(namespace string) Role {
+	s.mu.Lock()
+	if cached, ok := s.cache[namespace]; ok && time.Now().Before(cached.expires) {
+		s.mu.Unlock()
+		return cached.role
+	}
+	s.mu.Unlock()
+
+	sarNamespace := namespace
+	if namespace == AllNamespaces {
+		sarNamespace = "" // Cluster-wide check
+	}
+
+	role := RoleNone
+	for _, candidate := range []Role{RoleAdmin, RoleOperator, RoleViewer} {
+		if s.allowed(sarNamespace, roleVerbs[candidate]) {
+			role = candidate
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.cache[namespace] = cachedRole{role: role, expires: time.Now().Add(cacheTTL)}
+	s.mu.Unlock()
+	return role
+}
+
+func (s *sarRoles) allowed(namespace, verb string) bool {
+	extra := make(map[string]authorizationv1.ExtraValue, len(s.user.Extra))
+	for k, v := range s.user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	review, err := s.client.AuthorizationV1().SubjectAccessReviews().Create(context.TODO(), &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   s.user.Username,
+			UID:    s.user.UID,
+			Groups: s.user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     APIGroup,
+				Resource:  RolesResource,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false
+	}
+	return review.Status.Allowed
+}
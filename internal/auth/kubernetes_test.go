@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeCluster answers TokenReviews for the tokens of users and SubjectAccessReviews from grants, keyed by
+// user, namespace ("" cluster-wide) and verb. It also returns the number of TokenReviews made.
+func fakeCluster(users map[string]string, grants map[[3]string]bool) (*fake.Clientset, *int) {
+	client := fake.NewSimpleClientset()
+	reviews := new(int)
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if user, ok := users[review.Spec.Token]; ok {
+			review.Status = authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: user, Groups: []string{"system:authenticated"}},
+			}
+		}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attrs := sar.Spec.ResourceAttributes
+		if attrs.Group != APIGroup || attrs.Resource != RolesResource {
+			return true, sar, nil
+		}
+		// Cluster-wide grants apply in every namespace, as with a ClusterRoleBinding
+		sar.Status.Allowed = grants[[3]string{sar.Spec.User, attrs.Namespace, attrs.Verb}] ||
+			grants[[3]string{sar.Spec.User, "", attrs.Verb}]
+		return true, sar, nil
+	})
+	return client, reviews
+}
+
+func TestKubernetesAuthenticator(t *testing.T) {
+	client, reviews := fakeCluster(
+		map[string]string{"sa-token": "system:serviceaccount:ci:deployer", "dev-token": "dev"},
+		map[[3]string]bool{
+			{"system:serviceaccount:ci:deployer", "", "admin"}: true,
+			{"dev", "shop", "operate"}:                         true,
+			{"dev", "cart", "view"}:                            true,
+		},
+	)
+	k := NewKubernetes(client)
+
+	sa, err := k.Authenticate(request("sa-token"))
+	if err != nil || sa.Name != "system:serviceaccount:ci:deployer" || sa.Method != "kubernetes" {
+		t.Fatalf("identity %+v, %v", sa, err)
+	}
+	if !sa.Can(RoleAdmin, "") || !sa.Can(RoleAdmin, "shop") {
+		t.Error("cluster-wide admin denied")
+	}
+
+	dev, err := k.Authenticate(request("dev-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		namespace string
+		want      Role
+	}{
+		{"shop", RoleOperator},
+		{"cart", RoleViewer},
+		{"billing", RoleNone},
+		{AllNamespaces, RoleNone},
+	} {
+		if got := dev.Roles.RoleIn(tt.namespace); got != tt.want {
+			t.Errorf("role in %s = %s, want %s", tt.namespace, got, tt.want)
+		}
+	}
+
+	// Reviews are cached per token
+	k.Authenticate(request("dev-token"))
+	if *reviews != 2 {
+		t.Errorf("%d TokenReviews, want 2", *reviews)
+	}
+
+	// Unknown tokens may belong to the next authenticator
+	if _, err := k.Authenticate(request("other")); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("unknown token: %v", err)
+	}
+	if _, err := k.Authenticate(request("")); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("no token: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package mockidp is a minimal OpenID Connect provider for local development and tests.
+// It serves discovery and JWKS documents and issues RS256-signed ID tokens on demand.
+package mockidp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keyID is the kid of the single signing key.
+const keyID = "mock-idp"
+
+// IdP is an in-memory OpenID Connect provider.
+type IdP struct {
+	Issuer string
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]map[string]interface{} // Authorization code -> ID token claims
+}
+
+// New creates an IdP that will be reachable at issuer.
+func New(issuer string) (*IdP, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &IdP{
+		Issuer: strings.TrimSuffix(issuer, "/"),
+		key:    key,
+		codes:  make(map[string]map[string]interface{}),
+	}, nil
+}
+
+// Handler serves the discovery document, the JWKS, an /authorize endpoint that logs
+// everyone in without a prompt (as login_hint, default "alice", with the given groups)
+// and a /token endpoint. GET /token?sub=alice&groups=devs,ops&aud=smart-proxy issues
+// a token directly; POST /token exchanges an authorization code.
+func (i *IdP) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                i.Issuer,
+			"authorization_endpoint":                i.Issuer + "/authorize",
+			"token_endpoint":                        i.Issuer + "/token",
+			"jwks_uri":                              i.Issuer + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		redirect, err := url.Parse(q.Get("redirect_uri"))
+		if err != nil || redirect.Host == "" {
+			http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+			return
+		}
+		subject := q.Get("login_hint")
+		if subject == "" {
+			subject = "alice"
+		}
+		var groups []string
+		if g := q.Get("groups"); g != "" {
+			groups = strings.Split(g, ",")
+		}
+
+		code := make([]byte, 16)
+		rand.Read(code)
+		codeStr := base64.RawURLEncoding.EncodeToString(code)
+		claims := i.claims(subject, groups, q.Get("client_id"), time.Hour)
+		claims["email"] = subject + "@example.com"
+		if nonce := q.Get("nonce"); nonce != "" {
+			claims["nonce"] = nonce
+		}
+		i.mu.Lock()
+		i.codes[codeStr] = claims
+		i.mu.Unlock()
+
+		params := redirect.Query()
+		params.Set("code", codeStr)
+		params.Set("state", q.Get("state"))
+		redirect.RawQuery = params.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": keyID,
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			i.mu.Lock()
+			claims, ok := i.codes[r.FormValue("code")]
+			delete(i.codes, r.FormValue("code"))
+			i.mu.Unlock()
+			if !ok {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			token, err := i.sign(claims)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"id_token": token, "token_type": "Bearer"})
+			return
+		}
+
+		q := r.URL.Query()
+		var groups []string
+		if g := q.Get("groups"); g != "" {
+			groups = strings.Split(g, ",")
+		}
+		token, err := i.Token(q.Get("sub"), groups, q.Get("aud"), time.Hour)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(token))
+	})
+	return mux
+}
+
+// Token issues an ID token for subject with the given groups and audience.
+func (i *IdP) Token(subject string, groups []string, audience string, ttl time.Duration) (string, error) {
+	return i.sign(i.claims(subject, groups, audience, ttl))
+}
+
+func (i *IdP) claims(subject string, groups []string, audience string, ttl time.Duration) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":    i.Issuer,
+		"sub":    subject,
+		"aud":    audience,
+		"groups": groups,
+		"iat":    now.Unix(),
+		"exp":    now.Add(ttl).Unix(),
+	}
+}
+
+func (i *IdP) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
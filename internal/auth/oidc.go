@@ -0,0 +1,349 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDCConfig configures the OIDC authenticator.
+type OIDCConfig struct {
+	IssuerURL   string
+	ClientID    string             // Expected audience
+	GroupsClaim string             // Claim holding the user's groups (default: "groups")
+	Bindings    map[string]Binding // Group -> role binding
+}
+
+// OIDC authenticates ID tokens issued by an OpenID Connect provider and maps their groups to roles.
+// Keys are discovered from the issuer and refreshed when an unknown key ID is seen.
+type OIDC struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *Discovery
+	keys        map[string]crypto.PublicKey // Key is kid
+	lastRefresh time.Time
+}
+
+// NewOIDC returns an OIDC authenticator. Keys are fetched lazily on first use.
+func NewOIDC(config OIDCConfig) *OIDC {
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	return &OIDC{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// NewOIDCFromEnv reads OIDC_ISSUER_URL, OIDC_CLIENT_ID, OIDC_GROUPS_CLAIM and
+// OIDC_ROLE_BINDINGS (a JSON object of group -> {"role", "namespaces"}).
+func NewOIDCFromEnv() (*OIDC, error) {
+	config := OIDCConfig{
+		IssuerURL:   os.Getenv("OIDC_ISSUER_URL"),
+		ClientID:    os.Getenv("OIDC_CLIENT_ID"),
+		GroupsClaim: os.Getenv("OIDC_GROUPS_CLAIM"),
+	}
+	if config.IssuerURL == "" || config.ClientID == "" {
+		return nil, fmt.Errorf("OIDC_ISSUER_URL and OIDC_CLIENT_ID are required")
+	}
+	if raw := os.Getenv("OIDC_ROLE_BINDINGS"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &config.Bindings); err != nil {
+			return nil, fmt.Errorf("invalid OIDC_ROLE_BINDINGS: %w", err)
+		}
+	}
+	for group, b := range config.Bindings {
+		if _, err := ParseRole(b.Role); err != nil {
+			return nil, fmt.Errorf("group %s: %w", group, err)
+		}
+	}
+	return NewOIDC(config), nil
+}
+
+// Authenticate implements Authenticator.
+func (o *OIDC) Authenticate(r *http.Request) (*Identity, error) {
+	token := BearerToken(r)
+	if !looksLikeJWT(token) {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := o.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	name, _ := claims["email"].(string)
+	if name == "" {
+		name, _ = claims["sub"].(string)
+	}
+	groups := stringList(claims[o.config.GroupsClaim])
+
+	roles := StaticRoles{}
+	for _, g := range groups {
+		if b, ok := o.config.Bindings[g]; ok {
+			b.apply(roles) // Validated in NewOIDCFromEnv
+		}
+	}
+	return &Identity{Name: name, Groups: groups, Method: "oidc", Roles: roles}, nil
+}
+
+// Verify checks the signature, issuer, audience and validity period of a JWT and returns its claims.
+// Tokens from another issuer yield ErrNoCredentials, so other authenticators can try them.
+func (o *OIDC) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCredentials
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if iss, _ := claims["iss"].(string); iss != o.config.IssuerURL {
+		return nil, ErrNoCredentials
+	}
+
+	key, err := o.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	if !audienceContains(claims["aud"], o.config.ClientID) {
+		return nil, fmt.Errorf("%w: wrong audience", ErrInvalidCredentials)
+	}
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); !ok || now > exp {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidCredentials)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, fmt.Errorf("%w: token not yet valid", ErrInvalidCredentials)
+	}
+	return claims, nil
+}
+
+// key returns the signing key for kid, refreshing the JWKS at most every 30 seconds.
+func (o *OIDC) key(kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(o.lastRefresh) < 30*time.Second {
+		return nil, fmt.Errorf("%w: unknown signing key", ErrInvalidCredentials)
+	}
+	o.lastRefresh = time.Now()
+
+	keys, err := o.fetchKeys()
+	if err != nil {
+		return nil, fmt.Errorf("fetching OIDC keys: %w", err)
+	}
+	o.keys = keys
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key", ErrInvalidCredentials)
+}
+
+// Discovery is the subset of the OpenID Provider metadata used by Smart Proxy.
+type Discovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discovery fetches the provider metadata once and caches it.
+func (o *OIDC) Discovery() (Discovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.discover()
+}
+
+// discover must be called with o.mu held.
+func (o *OIDC) discover() (Discovery, error) {
+	if o.discovery != nil {
+		return *o.discovery, nil
+	}
+	var discovery Discovery
+	if err := o.getJSON(strings.TrimSuffix(o.config.IssuerURL, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return Discovery{}, err
+	}
+	o.discovery = &discovery
+	return discovery, nil
+}
+
+// ClientID returns the OAuth client ID (and expected audience) of the provider configuration.
+func (o *OIDC) ClientID() string {
+	return o.config.ClientID
+}
+
+// fetchKeys must be called with o.mu held.
+func (o *OIDC) fetchKeys() (map[string]crypto.PublicKey, error) {
+	discovery, err := o.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := o.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (o *OIDC) getJSON(url string, v interface{}) error {
+	resp, err := o.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// jsonWebKey is the subset of RFC 7517 needed for RSA and EC signature keys.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// verifySignature supports RS256 and ES256, the algorithms required by most OIDC providers.
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match %s", alg)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature)
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return fmt.Errorf("key type does not match %s", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return fmt.Errorf("bad signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// looksLikeJWT reports whether token has the three dot-separated segments of a JWT.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	for _, a := range stringList(aud) {
+		if a == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList converts a claim that may be a string or a list of strings.
+func stringList(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var out []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
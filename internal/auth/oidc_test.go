@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/auth/mockidp"
+)
+
+func newMockIdP(t *testing.T) *mockidp.IdP {
+	srv := httptest.NewServer(nil)
+	t.Cleanup(srv.Close)
+	idp, err := mockidp.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Config.Handler = idp.Handler()
+	return idp
+}
+
+func TestOIDCAgainstMockIdP(t *testing.T) {
+	idp := newMockIdP(t)
+	o := NewOIDC(OIDCConfig{
+		IssuerURL: idp.Issuer,
+		ClientID:  "smart-proxy",
+		Bindings: map[string]Binding{
+			"platform": {Role: "admin"},
+			"shop-dev": {Role: "operator", Namespaces: []string{"shop"}},
+		},
+	})
+
+	token, _ := idp.Token("carol", []string{"shop-dev", "unbound"}, "smart-proxy", time.Hour)
+	identity, err := o.Authenticate(request(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Name != "carol" || identity.Method != "oidc" || len(identity.Groups) != 2 {
+		t.Errorf("identity %+v", identity)
+	}
+	if !identity.Can(RoleOperator, "shop") || identity.Can(RoleAdmin, "shop") || identity.Can(RoleViewer, "cart") {
+		t.Error("group bindings not applied")
+	}
+
+	token, _ = idp.Token("dave", []string{"platform"}, "smart-proxy", time.Hour)
+	if identity, err := o.Authenticate(request(token)); err != nil || !identity.Can(RoleAdmin, "") {
+		t.Errorf("platform admin: %+v, %v", identity, err)
+	}
+
+	expired, _ := idp.Token("carol", nil, "smart-proxy", -time.Minute)
+	otherAudience, _ := idp.Token("carol", nil, "another-app", time.Hour)
+	parts := strings.Split(token, ".")
+	forged, _ := idp.Token("mallory", []string{"platform"}, "smart-proxy", time.Hour)
+	tampered := parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+	for name, token := range map[string]string{"expired": expired, "other audience": otherAudience, "tampered": tampered} {
+		if _, err := o.Authenticate(request(token)); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s token: %v", name, err)
+		}
+	}
+
+	// Tokens of another issuer and opaque tokens are left to the next authenticator
+	other := newMockIdP(t)
+	foreign, _ := other.Token("carol", nil, "smart-proxy", time.Hour)
+	for name, token := range map[string]string{"other issuer": foreign, "opaque": "not-a-jwt"} {
+		if _, err := o.Authenticate(request(token)); !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("%s token: %v", name, err)
+		}
+	}
+}
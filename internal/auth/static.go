@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// StaticToken is one entry of the static tokens file.
+type StaticToken struct {
+	Token  string   `json:"token"`
+	User   string   `json:"user"`
+	Groups []string `json:"groups,omitempty"`
+	Binding
+}
+
+// StaticTokens authenticates callers against a fixed list of bearer tokens.
+type StaticTokens struct {
+	tokens []StaticToken
+	roles  []StaticRoles // Parallel to tokens
+}
+
+// NewStaticTokens validates the entries and returns the authenticator.
+func NewStaticTokens(tokens []StaticToken) (*StaticTokens, error) {
+	s := &StaticTokens{tokens: tokens}
+	for _, t := range tokens {
+		if t.Token == "" || t.User == "" {
+			return nil, fmt.Errorf("token entries require both token and user")
+		}
+		roles := StaticRoles{}
+		if err := t.Binding.apply(roles); err != nil {
+			return nil, fmt.Errorf("user %s: %w", t.User, err)
+		}
+		s.roles = append(s.roles, roles)
+	}
+	return s, nil
+}
+
+// LoadStaticTokens reads a JSON array of StaticToken from path.
+func LoadStaticTokens(path string) (*StaticTokens, error) {
+	if path == "" {
+		return nil, fmt.Errorf("AUTH_TOKENS_FILE is not set")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []StaticToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	return NewStaticTokens(tokens)
+}
+
+// Authenticate implements Authenticator.
+func (s *StaticTokens) Authenticate(r *http.Request) (*Identity, error) {
+	token := BearerToken(r)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	for i, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return &Identity{Name: t.User, Groups: t.Groups, Method: "token", Roles: s.roles[i]}, nil
+		}
+	}
+	// JWTs may still be accepted by another authenticator in the chain.
+	if looksLikeJWT(token) {
+		return nil, ErrNoCredentials
+	}
+	return nil, ErrInvalidCredentials
+}
@@ -0,0 +1,496 @@
+// Package client is a Go client for the admin API, as used by smartproxyctl. It only depends on the
+// lightweight packages shared with the server (store, logger, stream), not on the Kubernetes client.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/manifest"
+	"smart-proxy/internal/store"
+	"smart-proxy/internal/stream"
+)
+
+// DefaultServer is the admin API of a proxy running locally, or port-forwarded.
+const DefaultServer = "http://localhost:8081"
+
+// Client calls the admin API of one proxy instance.
+type Client struct {
+	Server string // Base URL, e.g. https://smart-proxy-admin.example.com
+	Token  string // Bearer token; empty when the admin API has no authentication
+	HTTP   *http.Client
+}
+
+// New returns a client for the admin API at server.
+func New(server, token string) *Client {
+	return &Client{Server: strings.TrimSuffix(server, "/"), Token: token, HTTP: &http.Client{}}
+}
+
+// APIError is an error answer of the admin API.
+type APIError struct {
+	StatusCode int
+	Message    string
+	Errors     store.FieldErrors // The fields at fault, for problem details answers
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// IsNotFound reports whether err is a 404 of the admin API or store.ErrRouteNotFound.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.Is(err, store.ErrRouteNotFound) || (errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound)
+}
+
+// send performs a request and returns the response if its status is 2xx or one of accept, an *APIError otherwise.
+// The body is sent as JSON, except an io.Reader which is sent as is. The caller closes the body.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body interface{}, accept ...int) (*http.Response, error) {
+	return c.sendWithHeader(ctx, method, path, query, nil, body, accept...)
+}
+
+// sendWithHeader is send with additional request headers, e.g. If-Match.
+func (c *Client) sendWithHeader(ctx context.Context, method, path string, query url.Values, header http.Header, body interface{}, accept ...int) (*http.Response, error) {
+	u := c.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	reader, raw := body.(io.Reader)
+	if body != nil && !raw {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil && !raw {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	for _, status := range accept {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/problem+json") {
+		var problem struct {
+			Title  string            `json:"title"`
+			Detail string            `json:"detail"`
+			Errors store.FieldErrors `json:"errors"`
+		}
+		if json.Unmarshal(message, &problem) == nil && problem.Title != "" {
+			apiErr.Message, apiErr.Errors = problem.Title, problem.Errors
+			if len(problem.Errors) > 0 {
+				apiErr.Message += ": " + problem.Errors.Error()
+			} else if problem.Detail != "" {
+				apiErr.Message += ": " + problem.Detail
+			}
+		}
+	}
+	return nil, apiErr
+}
+
+// do performs a request and decodes its JSON answer into out, unless out is nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// routePath returns the path of a route, or of a sub-resource if action is not empty; route IDs may contain
+// a slash, which is escaped.
+func routePath(id, action string) string {
+	path := "/api/v1/routes/" + url.PathEscape(id)
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
+
+// ErrRouteChanged is returned by UpdateRoute when the route changed since it was read.
+var ErrRouteChanged = errors.New("the route changed since it was read")
+
+// Route is a route as listed by the admin API: its configuration and the status of its deployments.
+type Route struct {
+	store.RouteConfig
+	Status           string            `json:"status"`            // Ready, Scaling, Sleep or Error
+	DependencyStatus map[string]string `json:"dependency_status"` // Dependency name -> status
+	ETag             string            `json:"-"`                 // Version of the configuration, set by Route and SaveRoute
+}
+
+// Routes lists the routes the caller may view, in namespace if not empty.
+func (c *Client) Routes(ctx context.Context, namespace string) ([]Route, error) {
+	query := url.Values{}
+	if namespace != "" {
+		query.Set("namespace", namespace)
+	}
+	var routes []Route
+	for {
+		var page struct {
+			Items         []Route `json:"items"`
+			NextPageToken string  `json:"next_page_token"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/api/v1/routes", query, nil, &page); err != nil {
+			return nil, err
+		}
+		routes = append(routes, page.Items...)
+		if page.NextPageToken == "" {
+			return routes, nil
+		}
+		query.Set("page_token", page.NextPageToken)
+	}
+}
+
+// Route returns one route, or store.ErrRouteNotFound.
+func (c *Client) Route(ctx context.Context, id string) (Route, error) {
+	resp, err := c.send(ctx, http.MethodGet, routePath(id, ""), nil, nil)
+	if IsNotFound(err) {
+		return Route{}, fmt.Errorf("%w: %s", store.ErrRouteNotFound, id)
+	}
+	return decodeRoute(resp, err)
+}
+
+// SaveRoute creates a route, with a generated ID if it has none, or replaces it, and returns it as saved.
+// Its mode is kept: it only changes through SetMode.
+func (c *Client) SaveRoute(ctx context.Context, route store.RouteConfig) (Route, error) {
+	if route.ID == "" {
+		return decodeRoute(c.send(ctx, http.MethodPost, "/api/v1/routes", nil, route))
+	}
+	return decodeRoute(c.send(ctx, http.MethodPut, routePath(route.ID, ""), nil, route))
+}
+
+// UpdateRoute replaces a route if it still has etag, the ETag it was read with, and returns ErrRouteChanged
+// otherwise.
+func (c *Client) UpdateRoute(ctx context.Context, route store.RouteConfig, etag string) (Route, error) {
+	resp, err := c.sendWithHeader(ctx, http.MethodPut, routePath(route.ID, ""), nil, http.Header{"If-Match": {etag}}, route)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusPreconditionFailed {
+		return Route{}, ErrRouteChanged
+	}
+	return decodeRoute(resp, err)
+}
+
+func decodeRoute(resp *http.Response, err error) (Route, error) {
+	if err != nil {
+		return Route{}, err
+	}
+	defer resp.Body.Close()
+	var route Route
+	if err := json.NewDecoder(resp.Body).Decode(&route); err != nil {
+		return Route{}, err
+	}
+	route.ETag = resp.Header.Get("ETag")
+	return route, nil
+}
+
+// DeleteRoute removes a route.
+func (c *Client) DeleteRoute(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, routePath(id, ""), nil, nil, nil)
+}
+
+// Kinds of patchable resources.
+const (
+	KindIngress = "ingress"
+	KindRoute   = "route" // OpenShift Route
+)
+
+// Resource is an Ingress or OpenShift Route that can be patched to point to the proxy.
+type Resource struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Host      string `json:"host"`
+	Service   string `json:"service"`
+	Port      int    `json:"port"`
+	Patched   bool   `json:"patched"`
+	Status    string `json:"status"`
+	Type      string `json:"type"` // Ingress or Route
+}
+
+// resourceKinds maps the kinds of patchable resources to their collection in the admin API.
+var resourceKinds = map[string]string{KindIngress: "ingresses", KindRoute: "routes"}
+
+// Resources lists the Ingresses or OpenShift Routes (kind) of namespace, or of all namespaces if empty.
+func (c *Client) Resources(ctx context.Context, kind, namespace string) ([]Resource, error) {
+	collection := resourceKinds[kind]
+	if collection == "" {
+		return nil, fmt.Errorf("unknown kind %q, must be ingress or route", kind)
+	}
+	query := url.Values{}
+	if namespace != "" {
+		query.Set("namespace", namespace)
+	}
+	resources := []Resource{}
+	for {
+		var page struct {
+			Items         []Resource `json:"items"`
+			NextPageToken string     `json:"next_page_token"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/api/v1/resources/"+collection, query, nil, &page); err != nil {
+			return nil, err
+		}
+		resources = append(resources, page.Items...)
+		if page.NextPageToken == "" {
+			return resources, nil
+		}
+		query.Set("page_token", page.NextPageToken)
+	}
+}
+
+// Patch points an Ingress or OpenShift Route (kind) to the proxy and creates its route. An empty namespace
+// is the proxy's own.
+func (c *Client) Patch(ctx context.Context, kind, namespace, name string) error {
+	return c.resourceAction(ctx, kind, namespace, name, "patch")
+}
+
+// Unpatch restores an Ingress or OpenShift Route (kind) to its original Service and removes its route.
+func (c *Client) Unpatch(ctx context.Context, kind, namespace, name string) error {
+	return c.resourceAction(ctx, kind, namespace, name, "unpatch")
+}
+
+func (c *Client) resourceAction(ctx context.Context, kind, namespace, name, action string) error {
+	collection := resourceKinds[kind]
+	if collection == "" {
+		return fmt.Errorf("unknown kind %q, must be ingress or route", kind)
+	}
+	query := url.Values{}
+	if namespace != "" {
+		query.Set("namespace", namespace)
+	}
+	return c.do(ctx, http.MethodPost, "/api/v1/resources/"+collection+"/"+url.PathEscape(name)+":"+action, query, nil, nil)
+}
+
+// Diagnosis explains why a deployment is not ready.
+type Diagnosis struct {
+	Namespace  string `json:"namespace"`
+	Deployment string `json:"deployment"`
+	Pod        string `json:"pod,omitempty"`
+	Container  string `json:"container,omitempty"`
+	Problem    string `json:"problem"`
+	Reason     string `json:"reason"`
+	Message    string `json:"message"`
+}
+
+// WakeResult is the answer to a manual wake-up. Status, Elapsed, Details and Diagnostics are only set when
+// waiting for the route to be ready.
+type WakeResult struct {
+	RouteID     string              `json:"route_id"`
+	Woke        bool                `json:"woke"` // Whether a deployment was scaled up
+	Status      string              `json:"status,omitempty"`
+	Elapsed     float64             `json:"elapsed_seconds,omitempty"`
+	Details     []stream.TargetInfo `json:"details,omitempty"`
+	Diagnostics []Diagnosis         `json:"diagnostics,omitempty"`
+}
+
+// Wake wakes a route. If wait is positive it also waits, at most that long, for the route to be ready;
+// a route still not ready is not an error: the result's Status tells.
+func (c *Client) Wake(ctx context.Context, id string, wait time.Duration) (WakeResult, error) {
+	query := url.Values{}
+	if wait > 0 {
+		query.Set("wait", "true")
+		query.Set("timeout", wait.String())
+	}
+	resp, err := c.send(ctx, http.MethodPost, routePath(id, "wake"), query, nil, http.StatusGatewayTimeout)
+	if err != nil {
+		return WakeResult{}, err
+	}
+	defer resp.Body.Close()
+	var result WakeResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
+
+// Sleep puts a route to sleep now and returns the deployments scaled to zero, as namespace/name.
+func (c *Client) Sleep(ctx context.Context, id string) ([]string, error) {
+	var result struct {
+		Scaled []string `json:"scaled"`
+	}
+	err := c.do(ctx, http.MethodPost, routePath(id, "sleep"), nil, nil, &result)
+	return result.Scaled, err
+}
+
+// WakeLink is a signed link that wakes a route.
+type WakeLink struct {
+	ID          string    `json:"id"`
+	RouteID     string    `json:"route_id"`
+	Path        string    `json:"path"`
+	URL         string    `json:"url,omitempty"`
+	Expires     time.Time `json:"expires"`
+	RatePerHour int       `json:"rate_per_hour"`
+}
+
+// NewWakeLink signs a wake link for a route; zero values take the server defaults.
+func (c *Client) NewWakeLink(ctx context.Context, id string, ttl time.Duration, ratePerHour int) (WakeLink, error) {
+	body := map[string]interface{}{}
+	if ttl > 0 {
+		body["ttl"] = ttl.String()
+	}
+	if ratePerHour > 0 {
+		body["rate_per_hour"] = ratePerHour
+	}
+	var link WakeLink
+	err := c.do(ctx, http.MethodPost, routePath(id, "wake-links"), nil, body, &link)
+	return link, err
+}
+
+// ExportConfig returns the routes the caller may view, in namespace if not empty, as a declarative document
+// in format, yaml or json.
+func (c *Client) ExportConfig(ctx context.Context, namespace, format string) ([]byte, error) {
+	query := url.Values{}
+	if namespace != "" {
+		query.Set("namespace", namespace)
+	}
+	if format != "" {
+		query.Set("format", format)
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/api/v1/config/export", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// ImportOptions tune ImportConfig.
+type ImportOptions struct {
+	DryRun    bool   // Only compute the changes
+	Prune     bool   // Also delete the routes missing from the document
+	Namespace string // Restrict the document and the pruning to this namespace
+}
+
+// ImportResult is the outcome of an import: the changes, made or to make, and the problems found.
+type ImportResult struct {
+	DryRun bool `json:"dry_run"`
+	manifest.Plan
+	Errors manifest.Errors `json:"errors,omitempty"`
+}
+
+// ImportConfig applies a declarative document, YAML or JSON. An invalid or forbidden document is not an
+// error: nothing is applied and the result's Errors tell why.
+func (c *Client) ImportConfig(ctx context.Context, doc []byte, opts ImportOptions) (ImportResult, error) {
+	query := url.Values{}
+	if opts.DryRun {
+		query.Set("dry_run", "true")
+	}
+	if opts.Prune {
+		query.Set("prune", "true")
+	}
+	if opts.Namespace != "" {
+		query.Set("namespace", opts.Namespace)
+	}
+	resp, err := c.send(ctx, http.MethodPost, "/api/v1/config/import", query, bytes.NewReader(doc),
+		http.StatusForbidden, http.StatusUnprocessableEntity, http.StatusInternalServerError)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	var result ImportResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		// Not an import result, e.g. a server error
+		return ImportResult{}, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+	return result, nil
+}
+
+// Stats are the request counters of the routes the caller may view.
+type Stats struct {
+	TotalRequests int64
+	RouteStats    map[string]int64 // Key: route ID
+}
+
+// Stats returns the request counters since the proxy started.
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	err := c.do(ctx, http.MethodGet, "/api/v1/stats", nil, nil, &stats)
+	return stats, err
+}
+
+// LogFilter selects log entries; zero values match everything.
+type LogFilter struct {
+	Level     string // Minimum level: debug, info, warn or error
+	Component string
+	RouteID   string
+	Follow    bool // Keep streaming new entries after the history, until ctx is done
+}
+
+// Logs calls fn with the recent log entries of the proxy, then with new ones if filter.Follow is set.
+func (c *Client) Logs(ctx context.Context, filter LogFilter, fn func(logger.LogEntry)) error {
+	query := url.Values{"follow": {strconv.FormatBool(filter.Follow)}}
+	if filter.Level != "" {
+		query.Set("level", filter.Level)
+	}
+	if filter.Component != "" {
+		query.Set("component", filter.Component)
+	}
+	if filter.RouteID != "" {
+		query.Set("route", filter.RouteID)
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/api/logs", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Server-sent events: one entry per "data:" line
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var entry logger.LogEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return fmt.Errorf("invalid log entry: %w", err)
+		}
+		fn(entry)
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+)
+
+func TestWake(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+		// Route IDs with a slash stay one path segment
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.EscapedPath(), "/team%2Fshop/wake") {
+			http.NotFound(w, r)
+			return
+		}
+		status := http.StatusOK
+		result := WakeResult{RouteID: "team/shop", Woke: true}
+		if r.URL.Query().Get("wait") == "true" {
+			if r.URL.Query().Get("timeout") != "30s" {
+				t.Errorf("timeout %q", r.URL.Query().Get("timeout"))
+			}
+			status, result.Status = http.StatusGatewayTimeout, "Scaling"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL+"/", "secret")
+	result, err := c.Wake(context.Background(), "team/shop", 0)
+	if err != nil || !result.Woke || result.RouteID != "team/shop" {
+		t.Errorf("wake: %+v, %v", result, err)
+	}
+	// A route still not ready when the wait is over is not an error
+	if result, err = c.Wake(context.Background(), "team/shop", 30*time.Second); err != nil || result.Status != "Scaling" {
+		t.Errorf("wake and wait: %+v, %v", result, err)
+	}
+
+	_, err = c.Wake(context.Background(), "blog", 0)
+	if !IsNotFound(err) {
+		t.Errorf("unknown route: %v", err)
+	}
+	_, err = New(srv.URL, "").Wake(context.Background(), "team/shop", 0)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Error() != "missing token (HTTP 401)" {
+		t.Errorf("without a token: %v", err)
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{StatusCode: http.StatusNotFound}, true},
+		{fmt.Errorf("%w: shop", store.ErrRouteNotFound), true},
+		{&APIError{StatusCode: http.StatusForbidden}, false},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsNotFound(tt.err); got != tt.want {
+			t.Errorf("IsNotFound(%v) = %t", tt.err, got)
+		}
+	}
+	if got := (&APIError{StatusCode: http.StatusBadGateway}).Error(); got != "502 Bad Gateway" {
+		t.Errorf("error without a message: %s", got)
+	}
+}
+
+func TestLogs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("level") != "warn" || query.Get("route") != "shop" || query.Get("follow") != "false" || query.Has("component") {
+			t.Errorf("query %s", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "id: 1\ndata: {\"level\":\"WARN\",\"message\":\"slow\",\"route_id\":\"shop\"}\n\n")
+		fmt.Fprint(w, "id: 2\ndata: {\"level\":\"ERROR\",\"message\":\"down\",\"route_id\":\"shop\"}\n\n")
+	}))
+	defer srv.Close()
+
+	var messages []string
+	err := New(srv.URL, "").Logs(context.Background(), LogFilter{Level: "warn", RouteID: "shop"}, func(entry logger.LogEntry) {
+		messages = append(messages, entry.Message)
+	})
+	if err != nil || strings.Join(messages, ",") != "slow,down" {
+		t.Errorf("logs: %v, %v", messages, err)
+	}
+}
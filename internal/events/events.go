@@ -0,0 +1,161 @@
+// Package events records Kubernetes Events when routes go to sleep, wake up or fail, on the affected
+// Deployments and on the patched Ingress or OpenShift Route, so that `kubectl describe` explains why
+// an application keeps scaling to zero.
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"smart-proxy/internal/k8s"
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var log = logger.Component("events")
+
+// Event reasons.
+const (
+	ReasonSleeping    = "RouteSleeping"
+	ReasonWaking      = "RouteWaking"
+	ReasonWakeTimeout = "WakeTimeout"
+	ReasonScaleFailed = "ScaleFailed"
+	ReasonPatchDrift  = "PatchDrift"
+)
+
+// RouteIDAnnotation carries the ID of the route an event is about.
+const RouteIDAnnotation = "smart-proxy/route-id"
+
+// Target is a deployment an event is recorded on.
+type Target struct {
+	Namespace string
+	Name      string
+}
+
+// Recorder records route events. A nil *Recorder records nothing, e.g. when running without a cluster.
+type Recorder struct {
+	client      *k8s.Client
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+}
+
+// NewRecorder returns a recorder sending events through client, or nil if client is nil.
+func NewRecorder(client *k8s.Client) *Recorder {
+	if client == nil || client.Clientset == nil {
+		return nil
+	}
+
+	scheme := runtime.NewScheme()
+	clientgoscheme.AddToScheme(scheme)
+	routev1.AddToScheme(scheme)
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.Clientset.CoreV1().Events("")})
+	return &Recorder{
+		client:      client,
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme, corev1.EventSource{Component: "smart-proxy"}),
+	}
+}
+
+// Shutdown stops sending events.
+func (r *Recorder) Shutdown() {
+	if r != nil {
+		r.broadcaster.Shutdown()
+	}
+}
+
+// Sleeping records that deployments of the route were scaled to zero. Cause completes "Route <id> ...",
+// e.g. "was idle for 30m0s".
+func (r *Recorder) Sleeping(route store.RouteConfig, cause string, scaled []Target) {
+	r.record(route, scaled, corev1.EventTypeNormal, ReasonSleeping,
+		fmt.Sprintf("Route %s %s, scaled %s to 0 replicas", route.ID, cause, names(scaled)))
+}
+
+// Waking records that deployments of the route were woken up. Cause completes "Route <id> ...",
+// e.g. "received a request".
+func (r *Recorder) Waking(route store.RouteConfig, cause string, woken []Target) {
+	r.record(route, woken, corev1.EventTypeNormal, ReasonWaking,
+		fmt.Sprintf("Route %s %s, scaled %s to 1 replica", route.ID, cause, names(woken)))
+}
+
+// WakeTimedOut records that the route was still not ready timeout after it was woken up, with the
+// problems found in its deployments, if any.
+func (r *Recorder) WakeTimedOut(route store.RouteConfig, timeout time.Duration, diagnostics string) {
+	main := []Target{{Namespace: route.Namespace, Name: route.Deployment}}
+	message := fmt.Sprintf("Route %s was not ready %s after waking up", route.ID, timeout)
+	if diagnostics != "" {
+		message += ": " + diagnostics
+	}
+	r.record(route, main, corev1.EventTypeWarning, ReasonWakeTimeout, message)
+}
+
+// ScaleFailed records that a deployment of the route, possibly a dependency, could not be scaled.
+func (r *Recorder) ScaleFailed(route store.RouteConfig, target Target, replicas int32, err error) {
+	r.record(route, []Target{target}, corev1.EventTypeWarning, ReasonScaleFailed,
+		fmt.Sprintf("Route %s: failed to scale %s to %d replicas: %v", route.ID, names([]Target{target}), replicas, err))
+}
+
+// PatchDrift records that the route's Ingress or OpenShift Route no longer points to the proxy.
+func (r *Recorder) PatchDrift(route store.RouteConfig, detail string) {
+	main := []Target{{Namespace: route.Namespace, Name: route.Deployment}}
+	r.record(route, main, corev1.EventTypeWarning, ReasonPatchDrift,
+		fmt.Sprintf("Route %s: %s; requests bypass the proxy and will not wake the application", route.ID, detail))
+}
+
+// record emits the event on each target deployment and on the route's Ingress or Route.
+// Objects that cannot be read are skipped.
+func (r *Recorder) record(route store.RouteConfig, deployments []Target, eventType, reason, message string) {
+	if r == nil {
+		return
+	}
+	annotations := map[string]string{RouteIDAnnotation: route.ID}
+
+	var objects []runtime.Object
+	for _, t := range deployments {
+		deployment, err := r.client.GetDeployment(context.Background(), t.Namespace, t.Name)
+		if err != nil {
+			log.Debug("Not recording event on deployment", "route_id", route.ID, "deployment", t.Name, "error", err)
+			continue
+		}
+		objects = append(objects, deployment)
+	}
+	if object := r.resource(route); object != nil {
+		objects = append(objects, object)
+	}
+
+	for _, object := range objects {
+		r.recorder.AnnotatedEventf(object, annotations, eventType, reason, "%s", message)
+	}
+}
+
+// resource returns the Ingress or OpenShift Route the route was created from, or nil.
+func (r *Recorder) resource(route store.RouteConfig) runtime.Object {
+	if ns, name, ok := store.ParseResourceID("ing-", r.client.Namespace, route.ID); ok {
+		if ing, err := r.client.GetIngress(ns, name); err == nil {
+			return ing
+		}
+	} else if ns, name, ok := store.ParseResourceID("route-", r.client.Namespace, route.ID); ok {
+		if rt, err := r.client.GetRoute(ns, name); err == nil {
+			return rt
+		}
+	}
+	return nil
+}
+
+func names(targets []Target) string {
+	parts := make([]string, len(targets))
+	for i, t := range targets {
+		parts[i] = t.Namespace + "/" + t.Name
+	}
+	return strings.Join(parts, ", ")
+}
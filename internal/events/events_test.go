@@ -0,0 +1,80 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"smart-proxy/internal/k8s"
+	"smart-proxy/internal/store"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+)
+
+// newTestRecorder returns a recorder on a cluster holding the deployment shop/web and the ingress shop/shop.
+func newTestRecorder(t *testing.T) (*Recorder, *record.FakeRecorder) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/apis/apps/v1/namespaces/shop/deployments/web":
+			fmt.Fprint(w, `{"kind": "Deployment", "apiVersion": "apps/v1", "metadata": {"name": "web", "namespace": "shop"}}`)
+		case "/apis/networking.k8s.io/v1/namespaces/shop/ingresses/shop":
+			fmt.Fprint(w, `{"kind": "Ingress", "apiVersion": "networking.k8s.io/v1", "metadata": {"name": "shop", "namespace": "shop"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &k8s.Client{Clientset: clientset, Namespace: "proxy", Scope: k8s.NamespaceScope{Mode: k8s.ModeAll}}
+	fake := record.NewFakeRecorder(10)
+	return &Recorder{client: client, recorder: fake}, fake
+}
+
+func recorded(fake *record.FakeRecorder) []string {
+	var events []string
+	for len(fake.Events) > 0 {
+		events = append(events, <-fake.Events)
+	}
+	return events
+}
+
+func TestEventsOnDeploymentsAndIngress(t *testing.T) {
+	r, fake := newTestRecorder(t)
+	route := store.RouteConfig{ID: store.ResourceID("ing-", "proxy", "shop", "shop"), Namespace: "shop", Deployment: "web"}
+
+	r.ScaleFailed(route, Target{Namespace: "shop", Name: "web"}, 1, errors.New("quota exceeded"))
+	want := "Warning ScaleFailed Route ing-shop/shop: failed to scale shop/web to 1 replicas: quota exceeded map[smart-proxy/route-id:ing-shop/shop]"
+	if events := recorded(fake); len(events) != 2 || events[0] != want || events[1] != want {
+		t.Errorf("events %q, want twice %q", events, want)
+	}
+
+	// Objects that cannot be read are skipped
+	r.ScaleFailed(route, Target{Namespace: "shop", Name: "db"}, 1, errors.New("quota exceeded"))
+	if events := recorded(fake); len(events) != 1 {
+		t.Errorf("events %q, want one on the ingress", events)
+	}
+	route.ID = "manual"
+	r.PatchDrift(route, "the ingress points to web")
+	want = "Warning PatchDrift Route manual: the ingress points to web; requests bypass the proxy and will not wake the application map[smart-proxy/route-id:manual]"
+	if events := recorded(fake); len(events) != 1 || events[0] != want {
+		t.Errorf("events %q, want one on the deployment", events)
+	}
+}
+
+func TestNilRecorder(t *testing.T) {
+	var r *Recorder
+	r.ScaleFailed(store.RouteConfig{ID: "shop"}, Target{Namespace: "shop", Name: "web"}, 0, errors.New("boom"))
+	r.Shutdown()
+	if NewRecorder(nil) != nil {
+		t.Error("recorder without a cluster")
+	}
+}
@@ -1,36 +1,55 @@
 // Package k8s provides a client for interacting with Kubernetes and OpenShift clusters.
-// It abstracts common operations like scaling deployments, listing ingresses, and managing OpenShift routes.
+// It abstracts common operations like scaling deployments, listing ingresses, and managing OpenShift routes
+// across a configurable set of namespaces.
 package k8s
 
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/tracing"
+
 	routev1 "github.com/openshift/api/route/v1"
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
 	routev1client "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
 )
 
+var log = logger.Component("k8s")
+
 // Client wraps the Kubernetes and OpenShift clientsets.
 type Client struct {
 	Clientset      *kubernetes.Clientset
 	RouteClientSet *routeclientset.Clientset
 	RouteClient    routev1client.RouteV1Interface // Interface for interacting with OpenShift Routes
-	Namespace      string                         // The namespace the client is scoped to
+	Namespace      string                         // The namespace the proxy runs in, used when none is given
+	Scope          NamespaceScope                 // The namespaces the client is allowed to operate on
+
+	mu        sync.RWMutex
+	informers map[string]*namespaceInformers // Key is namespace ("" in ModeAll)
+	stop      chan struct{}                  // Closed by Close
 }
 
 // NewClient creates a new instance of the K8s Client.
 // It attempts to load configuration from the cluster environment or a local kubeconfig file.
 // It automatically detects the current namespace if running in a cluster, or falls back to "default".
+// The set of watched namespaces is read from the environment (see ScopeFromEnv).
 func NewClient() (*Client, error) {
 	var config *rest.Config
 	var err error
@@ -52,6 +71,9 @@ func NewClient() (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &errorCountingTransport{next: &tracingTransport{next: rt}}
+	})
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -60,65 +82,125 @@ func NewClient() (*Client, error) {
 
 	// Determine namespace
 	// 1. Env var "WATCH_NAMESPACE"
-	// 2. Fallback to "default" (or read from service account mount in future)
+	// 2. Service account mount if running in cluster
+	// 3. Fallback to "default"
 	ns := os.Getenv("WATCH_NAMESPACE")
 	if ns == "" {
 		// Try to read from service account secret if running in cluster
 		if data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
-			ns = string(data)
+			ns = strings.TrimSpace(string(data))
 		} else {
 			ns = "default"
 		}
 	}
 
+	scope, err := ScopeFromEnv(ns)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize OpenShift Route Client
 	routeClient, err := routeclientset.NewForConfig(config)
 	if err != nil {
 		// Log warning but don't fail, maybe not on OpenShift
-		fmt.Printf("Warning: Failed to create OpenShift Route client: %v\n", err)
+		log.Warn("Failed to create OpenShift Route client", "error", err)
 	}
 
-	if routeClient != nil {
-		_ = routeClient.RouteV1().Routes(ns) // Just to verify we can get the interface
-	}
-
-	return &Client{
-		Clientset:   clientset,
-		RouteClient: routeClient.RouteV1(), // Store the V1 interface to create namespaced clients on fly or just store clientset
-		// Actually better to store the Interface for the namespace if scoped, or Clientset.
-		// Let's store Clientset or typed interface.
-		// To match existing pattern, let's store the clientset wrapper or similar.
-		// Simplified:
+	c := &Client{
+		Clientset:      clientset,
 		RouteClientSet: routeClient,
 		Namespace:      ns,
-	}, nil
+		Scope:          scope,
+		informers:      make(map[string]*namespaceInformers),
+		stop:           make(chan struct{}),
+	}
+	if routeClient != nil {
+		c.RouteClient = routeClient.RouteV1()
+	}
+	return c, nil
 }
 
-// GetDeploymentStatus checks if a deployment is ready (replicas > 0 and available)
 // GetDeploymentStatus returns the number of replicas and ready replicas for a deployment.
-// If the namespace is empty, it uses the client's scoped namespace.
-func (c *Client) GetDeploymentStatus(namespace, deploymentName string) (int32, int32, error) {
-	// If namespace is not provided or different (should not happen in single-ns mode logic), enforce strictness or allow if empty
-	targetNs := namespace
-	if targetNs == "" {
-		targetNs = c.Namespace
+// If the namespace is empty, it uses the client's own namespace.
+func (c *Client) GetDeploymentStatus(ctx context.Context, namespace, deploymentName string) (replicas int32, ready int32, err error) {
+	ctx, span := tracing.Start(ctx, "k8s.GetDeploymentStatus", tracing.WithAttributes(
+		tracing.String("k8s.namespace", namespace), tracing.String("k8s.deployment.name", deploymentName)))
+	defer func() {
+		span.SetAttributes(tracing.Int("k8s.deployment.replicas", int(replicas)), tracing.Int("k8s.deployment.ready_replicas", int(ready)))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	targetNs, err := c.checkNamespace(namespace)
+	if err != nil {
+		return 0, 0, err
 	}
 
-	deployment, err := c.Clientset.AppsV1().Deployments(targetNs).Get(context.TODO(), deploymentName, metav1.GetOptions{})
+	var deployment *appsv1.Deployment
+	if listers := c.listersFor(targetNs); listers != nil {
+		span.SetAttributes(tracing.Bool("k8s.cached", true))
+		deployment, err = listers.deployments.Deployments(targetNs).Get(deploymentName)
+	} else {
+		deployment, err = c.Clientset.AppsV1().Deployments(targetNs).Get(ctx, deploymentName, metav1.GetOptions{})
+	}
 	if err != nil {
 		return 0, 0, err
 	}
-	return *deployment.Spec.Replicas, deployment.Status.ReadyReplicas, nil
+
+	replicas = 1 // API default when unset
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return replicas, deployment.Status.ReadyReplicas, nil
+}
+
+// GetDeployment returns a deployment, from the informer cache when its namespace is watched.
+// The returned object is shared with the cache and must not be modified.
+func (c *Client) GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	targetNs, err := c.checkNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if listers := c.listersFor(targetNs); listers != nil {
+		return listers.deployments.Deployments(targetNs).Get(name)
+	}
+	return c.Clientset.AppsV1().Deployments(targetNs).Get(ctx, name, metav1.GetOptions{})
+}
+
+// ListDeploymentPods lists the pods matching the selector of a deployment, from the API server: pods are
+// not cached, so callers should poll sparingly.
+func (c *Client) ListDeploymentPods(ctx context.Context, namespace, name string) ([]corev1.Pod, error) {
+	deployment, err := c.GetDeployment(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	list, err := c.Clientset.CoreV1().Pods(deployment.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
 }
 
 // ScaleDeployment scales a deployment to a specific number of replicas
-func (c *Client) ScaleDeployment(namespace, deploymentName string, replicas int32) error {
-	targetNs := namespace
-	if targetNs == "" {
-		targetNs = c.Namespace
+func (c *Client) ScaleDeployment(ctx context.Context, namespace, deploymentName string, replicas int32) (err error) {
+	ctx, span := tracing.Start(ctx, "k8s.ScaleDeployment", tracing.WithAttributes(
+		tracing.String("k8s.namespace", namespace), tracing.String("k8s.deployment.name", deploymentName),
+		tracing.Int("k8s.deployment.replicas", int(replicas))))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	targetNs, err := c.checkNamespace(namespace)
+	if err != nil {
+		return err
 	}
 
-	scale, err := c.Clientset.AppsV1().Deployments(targetNs).GetScale(context.TODO(), deploymentName, metav1.GetOptions{})
+	scale, err := c.Clientset.AppsV1().Deployments(targetNs).GetScale(ctx, deploymentName, metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
@@ -126,96 +208,187 @@ func (c *Client) ScaleDeployment(namespace, deploymentName string, replicas int3
 	sc := *scale
 	sc.Spec.Replicas = replicas
 
-	_, err = c.Clientset.AppsV1().Deployments(targetNs).UpdateScale(context.TODO(), deploymentName, &sc, metav1.UpdateOptions{})
+	_, err = c.Clientset.AppsV1().Deployments(targetNs).UpdateScale(ctx, deploymentName, &sc, metav1.UpdateOptions{})
 	return err
 }
 
-// ListNamespaces returns ONLY the current namespace in single-ns mode
-func (c *Client) ListNamespaces() ([]string, error) {
-	return []string{c.Namespace}, nil
-}
-
-// ListDeployments lists deployments in the scoped namespace
+// ListDeployments lists the deployment names in a watched namespace.
+// If the namespace is empty, it uses the client's own namespace.
 func (c *Client) ListDeployments(namespace string) ([]string, error) {
-	// Ignore the passed namespace argument if we want to enforce single-ns,
-	// or use it if we trust the caller. For safety/transparency in single-ns mode, use c.Namespace
-	targetNs := c.Namespace // Enforce scoped namespace
+	targetNs, err := c.checkNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if listers := c.listersFor(targetNs); listers != nil {
+		deployments, err := listers.deployments.Deployments(targetNs).List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deployments {
+			names = append(names, d.Name)
+		}
+		sort.Strings(names)
+		return names, nil
+	}
 
 	deployments, err := c.Clientset.AppsV1().Deployments(targetNs).List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
-	var names []string
 	for _, d := range deployments.Items {
 		names = append(names, d.Name)
 	}
 	return names, nil
 }
 
-// ListIngresses lists all ingresses in the namespace
-func (c *Client) ListIngresses() ([]*networkingv1.Ingress, error) {
+// ListIngresses lists the ingresses in a watched namespace, or in all watched namespaces if empty.
+func (c *Client) ListIngresses(namespace string) ([]*networkingv1.Ingress, error) {
 	if c.Clientset == nil {
 		return nil, fmt.Errorf("k8s client not initialized")
 	}
-	list, err := c.Clientset.NetworkingV1().Ingresses(c.Namespace).List(context.TODO(), metav1.ListOptions{})
+	namespaces, err := c.namespacesFor(namespace)
 	if err != nil {
 		return nil, err
 	}
+
 	var result []*networkingv1.Ingress
-	for i := range list.Items {
-		result = append(result, &list.Items[i])
+	for _, ns := range namespaces {
+		if listers := c.listersFor(ns); listers != nil {
+			list, err := listers.ingresses.Ingresses(ns).List(labels.Everything())
+			if err != nil {
+				return nil, err
+			}
+			// Listers return shared cache objects; callers may modify the result.
+			for _, ing := range list {
+				result = append(result, ing.DeepCopy())
+			}
+			continue
+		}
+
+		list, err := c.Clientset.NetworkingV1().Ingresses(ns).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			result = append(result, &list.Items[i])
+		}
 	}
 	return result, nil
 }
 
 // GetIngress gets a specific ingress
-func (c *Client) GetIngress(name string) (*networkingv1.Ingress, error) {
+func (c *Client) GetIngress(namespace, name string) (*networkingv1.Ingress, error) {
 	if c.Clientset == nil {
 		return nil, fmt.Errorf("k8s client not initialized")
 	}
-	return c.Clientset.NetworkingV1().Ingresses(c.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	targetNs, err := c.checkNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return c.Clientset.NetworkingV1().Ingresses(targetNs).Get(context.TODO(), name, metav1.GetOptions{})
 }
 
-// UpdateIngress updates an existing ingress
+// UpdateIngress updates an existing ingress in its own namespace
 func (c *Client) UpdateIngress(ingress *networkingv1.Ingress) error {
 	if c.Clientset == nil {
 		return fmt.Errorf("k8s client not initialized")
 	}
-	_, err := c.Clientset.NetworkingV1().Ingresses(c.Namespace).Update(context.TODO(), ingress, metav1.UpdateOptions{})
+	targetNs, err := c.checkNamespace(ingress.Namespace)
+	if err != nil {
+		return err
+	}
+	_, err = c.Clientset.NetworkingV1().Ingresses(targetNs).Update(context.TODO(), ingress, metav1.UpdateOptions{})
 	return err
 }
 
+// GetService returns a Service in a watched namespace, from the API server.
+func (c *Client) GetService(ctx context.Context, namespace, name string) (*corev1.Service, error) {
+	if c.Clientset == nil {
+		return nil, fmt.Errorf("k8s client not initialized")
+	}
+	targetNs, err := c.checkNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return c.Clientset.CoreV1().Services(targetNs).Get(ctx, name, metav1.GetOptions{})
+}
+
+// GetSecret returns the data of a Secret in a watched namespace.
+func (c *Client) GetSecret(namespace, name string) (map[string][]byte, error) {
+	if c.Clientset == nil {
+		return nil, fmt.Errorf("k8s client not initialized")
+	}
+	targetNs, err := c.checkNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := c.Clientset.CoreV1().Secrets(targetNs).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data, nil
+}
+
+// GetConfigMap returns a ConfigMap in a watched namespace.
+func (c *Client) GetConfigMap(namespace, name string) (*corev1.ConfigMap, error) {
+	if c.Clientset == nil {
+		return nil, fmt.Errorf("k8s client not initialized")
+	}
+	targetNs, err := c.checkNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return c.Clientset.CoreV1().ConfigMaps(targetNs).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
 // OpenShift Route Support
 
-// ListRoutes lists all routes in the namespace
-func (c *Client) ListRoutes() ([]*routev1.Route, error) {
+// ListRoutes lists the routes in a watched namespace, or in all watched namespaces if empty.
+func (c *Client) ListRoutes(namespace string) ([]*routev1.Route, error) {
 	if c.RouteClient == nil {
 		return nil, fmt.Errorf("route client not initialized")
 	}
-	list, err := c.RouteClient.Routes(c.Namespace).List(context.TODO(), metav1.ListOptions{})
+	namespaces, err := c.namespacesFor(namespace)
 	if err != nil {
 		return nil, err
 	}
+
 	var result []*routev1.Route
-	for i := range list.Items {
-		result = append(result, &list.Items[i])
+	for _, ns := range namespaces {
+		list, err := c.RouteClient.Routes(ns).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			result = append(result, &list.Items[i])
+		}
 	}
 	return result, nil
 }
 
 // GetRoute gets a specific route
-func (c *Client) GetRoute(name string) (*routev1.Route, error) {
+func (c *Client) GetRoute(namespace, name string) (*routev1.Route, error) {
 	if c.RouteClient == nil {
 		return nil, fmt.Errorf("route client not initialized")
 	}
-	return c.RouteClient.Routes(c.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	targetNs, err := c.checkNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return c.RouteClient.Routes(targetNs).Get(context.TODO(), name, metav1.GetOptions{})
 }
 
-// UpdateRoute updates an existing route
+// UpdateRoute updates an existing route in its own namespace
 func (c *Client) UpdateRoute(route *routev1.Route) error {
 	if c.RouteClient == nil {
 		return fmt.Errorf("route client not initialized")
 	}
-	_, err := c.RouteClient.Routes(c.Namespace).Update(context.TODO(), route, metav1.UpdateOptions{})
+	targetNs, err := c.checkNamespace(route.Namespace)
+	if err != nil {
+		return err
+	}
+	_, err = c.RouteClient.Routes(targetNs).Update(context.TODO(), route, metav1.UpdateOptions{})
 	return err
 }
@@ -0,0 +1,135 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// Problems found by DiagnoseDeployment.
+const (
+	ProblemImagePull       = "image_pull"       // The image cannot be pulled (ErrImagePull, ImagePullBackOff, InvalidImageName)
+	ProblemUnschedulable   = "unschedulable"    // No node can run the pod (resources, affinity, taints)
+	ProblemCrashLoop       = "crash_loop"       // A container keeps exiting (CrashLoopBackOff)
+	ProblemContainerConfig = "container_config" // A container cannot be created, e.g. a missing ConfigMap or Secret
+	ProblemReplicaFailure  = "replica_failure"  // The deployment cannot create pods, e.g. a quota is exceeded
+)
+
+// Diagnosis is a reason why a deployment does not become ready.
+type Diagnosis struct {
+	Namespace  string `json:"namespace"`
+	Deployment string `json:"deployment"`
+	Pod        string `json:"pod,omitempty"`
+	Container  string `json:"container,omitempty"`
+	Problem    string `json:"problem"`
+	Reason     string `json:"reason"`  // As reported by Kubernetes, e.g. ImagePullBackOff
+	Message    string `json:"message"` // From the pod status or, failing that, its latest warning event
+}
+
+// DiagnoseDeployment inspects the conditions of a deployment, the status of its pods and their recent
+// warning events, and returns the problems keeping it from becoming ready. It reads the API server.
+func (c *Client) DiagnoseDeployment(ctx context.Context, namespace, name string) ([]Diagnosis, error) {
+	deployment, err := c.GetDeployment(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	diagnoses := deploymentProblems(deployment)
+
+	pods, err := c.ListDeploymentPods(ctx, deployment.Namespace, name)
+	if err != nil {
+		return diagnoses, err
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, d := range podProblems(pod) {
+			d.Namespace, d.Deployment = deployment.Namespace, name
+			if d.Message == "" {
+				d.Message = c.latestWarning(ctx, pod)
+			}
+			diagnoses = append(diagnoses, d)
+		}
+	}
+	return diagnoses, nil
+}
+
+func deploymentProblems(deployment *appsv1.Deployment) []Diagnosis {
+	var diagnoses []Diagnosis
+	for _, cond := range deployment.Status.Conditions {
+		if cond.Type == appsv1.DeploymentReplicaFailure && cond.Status == corev1.ConditionTrue {
+			diagnoses = append(diagnoses, Diagnosis{
+				Namespace: deployment.Namespace, Deployment: deployment.Name,
+				Problem: ProblemReplicaFailure, Reason: cond.Reason, Message: cond.Message,
+			})
+		}
+	}
+	return diagnoses
+}
+
+// podProblems classifies the problems of a pod, at most one per container.
+func podProblems(pod *corev1.Pod) []Diagnosis {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason == corev1.PodReasonUnschedulable {
+			return []Diagnosis{{Pod: pod.Name, Problem: ProblemUnschedulable, Reason: cond.Reason, Message: cond.Message}}
+		}
+	}
+
+	var diagnoses []Diagnosis
+	statuses := append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		waiting := cs.State.Waiting
+		if waiting == nil {
+			continue
+		}
+		d := Diagnosis{Pod: pod.Name, Container: cs.Name, Reason: waiting.Reason, Message: waiting.Message}
+		switch waiting.Reason {
+		case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull":
+			d.Problem = ProblemImagePull
+		case "CrashLoopBackOff":
+			d.Problem = ProblemCrashLoop
+			if last := cs.LastTerminationState.Terminated; last != nil {
+				d.Message = fmt.Sprintf("Restarted %d times, last exit code %d (%s)", cs.RestartCount, last.ExitCode, last.Reason)
+			}
+		case "CreateContainerConfigError", "CreateContainerError", "RunContainerError":
+			d.Problem = ProblemContainerConfig
+		default:
+			continue // ContainerCreating, PodInitializing: still progressing
+		}
+		diagnoses = append(diagnoses, d)
+	}
+	return diagnoses
+}
+
+// latestWarning returns the message of the most recent warning event of a pod, or an empty string.
+func (c *Client) latestWarning(ctx context.Context, pod *corev1.Pod) string {
+	selector := fields.Set{"involvedObject.name": pod.Name, "involvedObject.kind": "Pod", "type": corev1.EventTypeWarning}.AsSelector()
+	list, err := c.Clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{FieldSelector: selector.String()})
+	if err != nil {
+		log.DebugContext(ctx, "Could not list pod events", "pod", pod.Name, "error", err)
+		return ""
+	}
+	if len(list.Items) == 0 {
+		return ""
+	}
+	events := list.Items
+	sort.Slice(events, func(i, j int) bool { return eventTime(&events[i]).Before(eventTime(&events[j])) })
+	return events[len(events)-1].Message
+}
+
+func eventTime(e *corev1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.FirstTimestamp.Time
+}
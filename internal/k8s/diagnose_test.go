@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func waitingContainer(name, reason, message string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: message}}}
+}
+
+func TestPodProblems(t *testing.T) {
+	crashing := waitingContainer("app", "CrashLoopBackOff", "back-off 5m0s")
+	crashing.RestartCount = 7
+	crashing.LastTerminationState.Terminated = &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}
+
+	tests := []struct {
+		name   string
+		status corev1.PodStatus
+		want   []Diagnosis
+	}{
+		{"unschedulable", corev1.PodStatus{
+			Conditions:        []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable, Message: "0/3 nodes are available"}},
+			ContainerStatuses: []corev1.ContainerStatus{waitingContainer("app", "ErrImagePull", "")},
+		}, []Diagnosis{{Pod: "web-1", Problem: ProblemUnschedulable, Reason: "Unschedulable", Message: "0/3 nodes are available"}}},
+		{"one problem per container", corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{waitingContainer("migrate", "CreateContainerConfigError", `configmap "db" not found`)},
+			ContainerStatuses:     []corev1.ContainerStatus{waitingContainer("app", "ImagePullBackOff", "pull access denied"), crashing},
+		}, []Diagnosis{
+			{Pod: "web-1", Container: "migrate", Problem: ProblemContainerConfig, Reason: "CreateContainerConfigError", Message: `configmap "db" not found`},
+			{Pod: "web-1", Container: "app", Problem: ProblemImagePull, Reason: "ImagePullBackOff", Message: "pull access denied"},
+			{Pod: "web-1", Container: "app", Problem: ProblemCrashLoop, Reason: "CrashLoopBackOff", Message: "Restarted 7 times, last exit code 1 (Error)"},
+		}},
+		{"still progressing", corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{waitingContainer("app", "ContainerCreating", ""), {Name: "sidecar"}},
+		}, nil},
+	}
+	for _, tt := range tests {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web-1"}, Status: tt.status}
+		if got := podProblems(pod); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// diagnoseAPIServer serves the deployment shop/web, its pods and their warning events.
+func diagnoseAPIServer(t *testing.T) *kubernetes.Clientset {
+	now := time.Now()
+	objects := map[string]interface{}{
+		"/apis/apps/v1/namespaces/shop/deployments/web": appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+			Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+			Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentReplicaFailure, Status: corev1.ConditionTrue, Reason: "FailedCreate", Message: "exceeded quota"},
+			}},
+		},
+		"/api/v1/namespaces/shop/pods": corev1.PodList{Items: []corev1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop"}, Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{waitingContainer("app", "ErrImagePull", "")}}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "shop", DeletionTimestamp: &metav1.Time{Time: now}}, Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{waitingContainer("app", "CrashLoopBackOff", "")}}},
+		}},
+		"/api/v1/namespaces/shop/events": corev1.EventList{Items: []corev1.Event{
+			{Message: "Failed to pull image: not found", LastTimestamp: metav1.NewTime(now)},
+			{Message: "Pulling image", LastTimestamp: metav1.NewTime(now.Add(-time.Minute))},
+		}},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		object, ok := objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			object = metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonNotFound, Code: http.StatusNotFound}
+		}
+		if r.URL.Path == "/api/v1/namespaces/shop/pods" && r.URL.Query().Get("labelSelector") != "app=web" {
+			t.Errorf("pods listed with selector %q", r.URL.Query().Get("labelSelector"))
+		}
+		json.NewEncoder(w).Encode(object)
+	}))
+	t.Cleanup(ts.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientset
+}
+
+func TestDiagnoseDeployment(t *testing.T) {
+	c := &Client{Clientset: diagnoseAPIServer(t), Namespace: "shop", Scope: NamespaceScope{Mode: ModeAll}}
+	diagnoses, err := c.DiagnoseDeployment(t.Context(), "", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Diagnosis{
+		{Namespace: "shop", Deployment: "web", Problem: ProblemReplicaFailure, Reason: "FailedCreate", Message: "exceeded quota"},
+		{Namespace: "shop", Deployment: "web", Pod: "web-1", Container: "app", Problem: ProblemImagePull, Reason: "ErrImagePull",
+			Message: "Failed to pull image: not found"}, // From the latest warning event
+	}
+	if !reflect.DeepEqual(diagnoses, want) {
+		t.Errorf("diagnoses:\ngot  %+v\nwant %+v", diagnoses, want)
+	}
+
+	if _, err := c.DiagnoseDeployment(t.Context(), "shop", "db"); err == nil {
+		t.Error("diagnosed a missing deployment")
+	}
+}
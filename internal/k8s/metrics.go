@@ -0,0 +1,28 @@
+package k8s
+
+import (
+	"net/http"
+	"strconv"
+
+	"smart-proxy/internal/metrics"
+)
+
+// apiErrors counts failed Kubernetes API calls, including those made by the informers.
+var apiErrors = metrics.Default.NewCounterVec("smart_proxy_kubernetes_api_errors_total",
+	"Kubernetes API requests that failed, by HTTP method and status code (\"error\" for transport failures).",
+	"method", "code")
+
+// errorCountingTransport records failed API requests in apiErrors.
+type errorCountingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *errorCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		apiErrors.Inc(req.Method, "error")
+	} else if resp.StatusCode >= 400 {
+		apiErrors.Inc(req.Method, strconv.Itoa(resp.StatusCode))
+	}
+	return resp, err
+}
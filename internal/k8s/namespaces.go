@@ -0,0 +1,292 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NamespaceMode selects which namespaces the client operates on.
+type NamespaceMode string
+
+const (
+	ModeSingle   NamespaceMode = "single"   // Only the client's own namespace
+	ModeList     NamespaceMode = "list"     // A fixed list of namespaces
+	ModeSelector NamespaceMode = "selector" // All namespaces matching a label selector
+	ModeAll      NamespaceMode = "all"      // Cluster-wide
+)
+
+// informerResync is the periodic resync interval of the shared informers.
+const informerResync = 10 * time.Minute
+
+// NamespaceScope is the configured set of namespaces the client is allowed to see.
+type NamespaceScope struct {
+	Mode       NamespaceMode
+	Namespaces []string        // Used by ModeSingle and ModeList
+	Selector   labels.Selector // Used by ModeSelector
+}
+
+// ScopeFromEnv builds the NamespaceScope from the environment:
+//   - WATCH_NAMESPACE_SELECTOR: a label selector (e.g. "smart-proxy=enabled")
+//   - WATCH_NAMESPACES: a comma-separated list, or "*" for all namespaces
+//   - otherwise only defaultNamespace is watched
+func ScopeFromEnv(defaultNamespace string) (NamespaceScope, error) {
+	if sel := os.Getenv("WATCH_NAMESPACE_SELECTOR"); sel != "" {
+		selector, err := labels.Parse(sel)
+		if err != nil {
+			return NamespaceScope{}, fmt.Errorf("invalid WATCH_NAMESPACE_SELECTOR: %w", err)
+		}
+		return NamespaceScope{Mode: ModeSelector, Selector: selector}, nil
+	}
+
+	if list := os.Getenv("WATCH_NAMESPACES"); list != "" {
+		if strings.TrimSpace(list) == "*" {
+			return NamespaceScope{Mode: ModeAll}, nil
+		}
+		var namespaces []string
+		for _, ns := range strings.Split(list, ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				namespaces = append(namespaces, ns)
+			}
+		}
+		return NamespaceScope{Mode: ModeList, Namespaces: namespaces}, nil
+	}
+
+	return NamespaceScope{Mode: ModeSingle, Namespaces: []string{defaultNamespace}}, nil
+}
+
+// namespaceInformers holds the informers and listers of a single watched namespace
+// (or of the whole cluster, keyed by metav1.NamespaceAll, in ModeAll).
+type namespaceInformers struct {
+	deployments appslisters.DeploymentLister
+	ingresses   networkinglisters.IngressLister
+	synced      []cache.InformerSynced
+	stop        chan struct{}
+}
+
+func (n *namespaceInformers) hasSynced() bool {
+	for _, synced := range n.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// StartInformers starts the per-namespace informers backing the read operations.
+// Until they have synced, reads fall back to direct API calls. The informers run until Close.
+func (c *Client) StartInformers() {
+	switch c.Scope.Mode {
+	case ModeAll:
+		c.addNamespace(metav1.NamespaceAll)
+	case ModeSelector:
+		c.watchNamespaceSelector()
+	default:
+		for _, ns := range c.Scope.Namespaces {
+			c.addNamespace(ns)
+		}
+	}
+}
+
+// Close stops the informers.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop == nil || c.closed() {
+		return
+	}
+	close(c.stop)
+	for namespace, set := range c.informers {
+		close(set.stop)
+		delete(c.informers, namespace)
+	}
+}
+
+// watchNamespaceSelector adds and removes per-namespace informers as namespaces
+// start or stop matching the configured label selector, including when they are relabelled.
+func (c *Client) watchNamespaceSelector() {
+	factory := informers.NewSharedInformerFactoryWithOptions(c.Clientset, informerResync,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = c.Scope.Selector.String()
+		}))
+
+	informer := factory.Core().V1().Namespaces().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				c.namespaceChanged(ns)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				c.namespaceChanged(ns)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				c.removeNamespace(ns.Name)
+			}
+		},
+	})
+
+	factory.Start(c.stop)
+	factory.WaitForCacheSync(c.stop)
+}
+
+// namespaceChanged watches or stops watching a namespace depending on whether its labels match the selector.
+func (c *Client) namespaceChanged(ns *corev1.Namespace) {
+	if c.Scope.Selector.Matches(labels.Set(ns.Labels)) {
+		c.addNamespace(ns.Name)
+	} else {
+		c.removeNamespace(ns.Name)
+	}
+}
+
+func (c *Client) addNamespace(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.informers[namespace]; exists || c.closed() {
+		return
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(c.Clientset, informerResync, informers.WithNamespace(namespace))
+	deployments := factory.Apps().V1().Deployments()
+	ingresses := factory.Networking().V1().Ingresses()
+
+	set := &namespaceInformers{
+		deployments: deployments.Lister(),
+		ingresses:   ingresses.Lister(),
+		synced:      []cache.InformerSynced{deployments.Informer().HasSynced, ingresses.Informer().HasSynced},
+		stop:        make(chan struct{}),
+	}
+	factory.Start(set.stop)
+	c.informers[namespace] = set
+
+	if namespace == metav1.NamespaceAll {
+		log.Info("Watching all namespaces")
+	} else {
+		log.Info("Watching namespace", "namespace", namespace)
+	}
+}
+
+// closed reports whether Close was called.
+func (c *Client) closed() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) removeNamespace(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if set, exists := c.informers[namespace]; exists {
+		close(set.stop)
+		delete(c.informers, namespace)
+		log.Info("Stopped watching namespace", "namespace", namespace)
+	}
+}
+
+// listersFor returns the synced informers covering namespace, or nil if there are none yet.
+func (c *Client) listersFor(namespace string) *namespaceInformers {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	set, exists := c.informers[metav1.NamespaceAll]
+	if !exists {
+		set, exists = c.informers[namespace]
+	}
+	if !exists || !set.hasSynced() {
+		return nil
+	}
+	return set
+}
+
+// Watches reports whether namespace is part of the configured scope.
+func (c *Client) Watches(namespace string) bool {
+	switch c.Scope.Mode {
+	case ModeAll:
+		return true
+	case ModeSelector:
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		_, exists := c.informers[namespace]
+		return exists
+	default:
+		for _, ns := range c.Scope.Namespaces {
+			if ns == namespace {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// checkNamespace resolves an empty namespace to the client's own one and
+// rejects namespaces outside the configured scope.
+func (c *Client) checkNamespace(namespace string) (string, error) {
+	if namespace == "" {
+		namespace = c.Namespace
+	}
+	if !c.Watches(namespace) {
+		return "", fmt.Errorf("namespace %s is not watched", namespace)
+	}
+	return namespace, nil
+}
+
+// namespacesFor expands a namespace filter into the namespaces to query.
+// An empty filter means every watched namespace; in ModeAll that is metav1.NamespaceAll.
+func (c *Client) namespacesFor(namespace string) ([]string, error) {
+	if namespace != "" {
+		if !c.Watches(namespace) {
+			return nil, fmt.Errorf("namespace %s is not watched", namespace)
+		}
+		return []string{namespace}, nil
+	}
+	if c.Scope.Mode == ModeAll {
+		return []string{metav1.NamespaceAll}, nil
+	}
+	return c.ListNamespaces()
+}
+
+// ListNamespaces returns the namespaces currently in scope.
+func (c *Client) ListNamespaces() ([]string, error) {
+	switch c.Scope.Mode {
+	case ModeAll:
+		list, err := c.Clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(list.Items))
+		for _, ns := range list.Items {
+			names = append(names, ns.Name)
+		}
+		return names, nil
+	case ModeSelector:
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		names := make([]string, 0, len(c.informers))
+		for ns := range c.informers {
+			names = append(names, ns)
+		}
+		sort.Strings(names)
+		return names, nil
+	default:
+		return append([]string(nil), c.Scope.Namespaces...), nil
+	}
+}
@@ -0,0 +1,159 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestScopeFromEnv(t *testing.T) {
+	tests := []struct {
+		selector, namespaces string
+		want                 NamespaceScope
+	}{
+		{"", "", NamespaceScope{Mode: ModeSingle, Namespaces: []string{"proxy"}}},
+		{"", "shop, blog,,", NamespaceScope{Mode: ModeList, Namespaces: []string{"shop", "blog"}}},
+		{"", " * ", NamespaceScope{Mode: ModeAll}},
+		{"team=shop", "shop", NamespaceScope{Mode: ModeSelector, Selector: labels.SelectorFromSet(labels.Set{"team": "shop"})}},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCH_NAMESPACE_SELECTOR", tt.selector)
+		t.Setenv("WATCH_NAMESPACES", tt.namespaces)
+		scope, err := ScopeFromEnv("proxy")
+		if err != nil || !reflect.DeepEqual(scope, tt.want) {
+			t.Errorf("%q, %q: got %+v, %v; want %+v", tt.selector, tt.namespaces, scope, err, tt.want)
+		}
+	}
+
+	t.Setenv("WATCH_NAMESPACE_SELECTOR", "team in (")
+	if _, err := ScopeFromEnv("proxy"); err == nil {
+		t.Error("invalid selector accepted")
+	}
+}
+
+func TestNamespaceScope(t *testing.T) {
+	list := &Client{Namespace: "proxy", Scope: NamespaceScope{Mode: ModeList, Namespaces: []string{"proxy", "shop"}}}
+	all := &Client{Namespace: "proxy", Scope: NamespaceScope{Mode: ModeAll}}
+
+	for _, ns := range []string{"proxy", "shop"} {
+		if !list.Watches(ns) {
+			t.Errorf("%s not watched", ns)
+		}
+	}
+	if list.Watches("blog") || !all.Watches("blog") {
+		t.Error("scope of blog")
+	}
+	if ns, err := list.checkNamespace(""); ns != "proxy" || err != nil {
+		t.Errorf("empty namespace resolved to %q, %v", ns, err)
+	}
+	if _, err := list.checkNamespace("blog"); err == nil {
+		t.Error("namespace outside the list accepted")
+	}
+	if namespaces, err := list.namespacesFor(""); !reflect.DeepEqual(namespaces, []string{"proxy", "shop"}) || err != nil {
+		t.Errorf("all namespaces of the list: %v, %v", namespaces, err)
+	}
+	if namespaces, err := all.namespacesFor(""); !reflect.DeepEqual(namespaces, []string{metav1.NamespaceAll}) || err != nil {
+		t.Errorf("all namespaces of the cluster: %v, %v", namespaces, err)
+	}
+	if _, err := list.namespacesFor("blog"); err == nil {
+		t.Error("filter outside the list accepted")
+	}
+}
+
+// fakeAPIServer serves empty lists of everything but namespaces, and the namespace events sent on events.
+func fakeAPIServer(t *testing.T, events <-chan string) *kubernetes.Clientset {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		watch := r.URL.Query().Get("watch") == "true"
+		switch {
+		case !watch:
+			fmt.Fprint(w, `{"metadata": {"resourceVersion": "1"}, "items": []}`)
+		case r.URL.Path == "/api/v1/namespaces":
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case event := <-events:
+					fmt.Fprintln(w, event)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	t.Cleanup(func() {
+		// Watches still open end with the connections
+		ts.CloseClientConnections()
+		ts.Close()
+	})
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientset
+}
+
+func namespaceEvent(eventType, name, resourceVersion string, nsLabels map[string]string) string {
+	ns := corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{Kind: "Namespace", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: resourceVersion, Labels: nsLabels},
+	}
+	data, _ := json.Marshal(map[string]interface{}{"type": eventType, "object": ns})
+	return string(data)
+}
+
+func TestRelabelledNamespacesAreWatched(t *testing.T) {
+	events := make(chan string, 10)
+	c := &Client{
+		Clientset: fakeAPIServer(t, events),
+		Namespace: "proxy",
+		Scope:     NamespaceScope{Mode: ModeSelector, Selector: labels.SelectorFromSet(labels.Set{"team": "shop"})},
+		informers: make(map[string]*namespaceInformers),
+		stop:      make(chan struct{}),
+	}
+	c.StartInformers()
+	defer c.Close()
+
+	eventually := func(what string, condition func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting until %s", what)
+			}
+		}
+	}
+
+	events <- namespaceEvent("ADDED", "shop", "2", map[string]string{"team": "shop"})
+	eventually("shop is watched", func() bool { return c.Watches("shop") })
+
+	events <- namespaceEvent("MODIFIED", "shop", "3", map[string]string{"team": "blog"})
+	eventually("shop is no longer watched", func() bool { return !c.Watches("shop") })
+
+	events <- namespaceEvent("MODIFIED", "shop", "4", map[string]string{"team": "shop"})
+	eventually("shop is watched again", func() bool { return c.Watches("shop") })
+	if namespaces, _ := c.ListNamespaces(); !reflect.DeepEqual(namespaces, []string{"shop"}) {
+		t.Errorf("namespaces %v", namespaces)
+	}
+
+	c.Close()
+	if c.Watches("shop") {
+		t.Error("informers still running after Close")
+	}
+	c.addNamespace("blog")
+	if c.Watches("blog") {
+		t.Error("namespace added after Close")
+	}
+	c.Close()
+}
@@ -0,0 +1,34 @@
+package k8s
+
+import (
+	"net/http"
+
+	"smart-proxy/internal/tracing"
+)
+
+// tracingTransport records a client span for every API request made within a trace and
+// propagates the trace context to the API server. Requests outside a trace (e.g. informer
+// watches) are not traced, to avoid a flood of root spans.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if tracing.SpanFromContext(req.Context()) == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, span := tracing.Start(req.Context(), "k8s.api "+req.Method, tracing.WithKind(tracing.KindClient),
+		tracing.WithAttributes(tracing.String("http.method", req.Method), tracing.String("url.path", req.URL.Path)))
+	defer span.End()
+
+	req = req.Clone(ctx)
+	tracing.Inject(ctx, req.Header)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return resp, err
+	}
+	span.SetHTTPStatus(resp.StatusCode)
+	return resp, nil
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"smart-proxy/internal/tracing"
+	"smart-proxy/internal/tracing/collector"
+)
+
+func TestTracingTransport(t *testing.T) {
+	c := collector.New()
+	otlp := httptest.NewServer(c.Handler())
+	defer otlp.Close()
+	shutdown := tracing.Init(tracing.Config{Exporter: tracing.NewOTLPExporter(otlp.URL+"/v1/traces", nil), SampleRatio: 1})
+
+	var received []string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("traceparent"))
+	}))
+	defer apiServer.Close()
+	client := &http.Client{Transport: &tracingTransport{next: http.DefaultTransport}}
+
+	// Outside a trace, e.g. informer watches: neither traced nor propagated
+	req, _ := http.NewRequest(http.MethodGet, apiServer.URL+"/api/v1/namespaces", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	ctx, parent := tracing.Start(context.Background(), "k8s.ScaleDeployment")
+	req, _ = http.NewRequestWithContext(ctx, http.MethodPatch, apiServer.URL+"/apis/apps/v1/namespaces/shop/deployments/web/scale", nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.End()
+	shutdown()
+
+	if len(received) != 2 || received[0] != "" || received[1] == "" {
+		t.Fatalf("traceparent headers received %q", received)
+	}
+	spans := c.Trace(parent.Context().TraceID.String())
+	var api *collector.Span
+	for i := range spans {
+		if spans[i].Name == "k8s.api PATCH" {
+			api = &spans[i]
+		}
+	}
+	if len(spans) != 2 || api == nil {
+		t.Fatalf("spans of the trace %+v", spans)
+	}
+	if api.ParentSpanID != parent.Context().SpanID.String() || api.Attribute("http.status_code") != "200" {
+		t.Errorf("API span parent %s, attributes %+v", api.ParentSpanID, api.Attributes)
+	}
+	if want := "00-" + api.TraceID + "-" + api.SpanID + "-01"; received[1] != want {
+		t.Errorf("traceparent %q, want the API span %q", received[1], want)
+	}
+}
@@ -1,21 +1,41 @@
-// Package logger provides a centralized logging facility with support for
-// broadcasting logs to listeners (e.g., for the web UI) via Go channels.
+// Package logger provides a centralized, leveled and structured logging facility built on log/slog,
+// with an in-memory buffer of recent entries that can be broadcast to listeners (e.g., for the web UI)
+// via Go channels.
+//
+// Each package logs through a component logger (see Component). Route and request IDs are attached
+// to entries by logging with a context prepared by WithRouteID and WithRequestID.
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log"
+	"log/slog"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
 // LogEntry represents a single log line
 type LogEntry struct {
-	Timestamp time.Time `json:"timestamp"`
-	Message   string    `json:"message"`
+	Timestamp time.Time              `json:"timestamp"`
+	Level     string                 `json:"level"` // DEBUG, INFO, WARN or ERROR
+	Component string                 `json:"component,omitempty"`
+	Message   string                 `json:"message"`
+	RouteID   string                 `json:"route_id,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Attrs     map[string]interface{} `json:"attrs,omitempty"` // Remaining structured fields
 }
 
+// Well-known attribute keys, lifted into LogEntry fields.
+const (
+	ComponentKey = "component"
+	RouteKey     = "route_id"
+	RequestKey   = "request_id"
+)
+
 // bufferSize is the number of logs to keep in memory
 const bufferSize = 1000
 
@@ -28,42 +48,225 @@ var (
 type Logger struct {
 	mu          sync.RWMutex
 	buffer      []LogEntry
-	subscribers map[chan LogEntry]bool
-	out         io.Writer
+	subscribers map[chan LogEntry]Filter
+
+	level  *slog.LevelVar
+	slog   *slog.Logger
+	output slog.Handler // Writes to stdout in the configured format
 }
 
-// Get returns the singleton logger instance
+// Get returns the singleton logger instance. It reads LOG_LEVEL (debug, info, warn, error; default info)
+// and LOG_FORMAT (text or json; default text), and installs itself as the slog and log default,
+// so output of the standard log package is structured too.
 func Get() *Logger {
 	once.Do(func() {
-		instance = &Logger{
-			buffer:      make([]LogEntry, 0, bufferSize),
-			subscribers: make(map[chan LogEntry]bool),
-			out:         os.Stdout,
-		}
+		instance = newLogger(os.Stdout, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+		slog.SetDefault(instance.slog)
 	})
 	return instance
 }
 
-// Printf logs a formatted string
+func newLogger(out io.Writer, level, format string) *Logger {
+	l := &Logger{
+		buffer:      make([]LogEntry, 0, bufferSize),
+		subscribers: make(map[chan LogEntry]Filter),
+		level:       new(slog.LevelVar),
+	}
+
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		fmt.Fprintf(out, "Invalid LOG_LEVEL %q, using info\n", level)
+	}
+	l.level.Set(parsed)
+
+	options := &slog.HandlerOptions{Level: l.level}
+	if strings.EqualFold(format, "json") {
+		l.output = slog.NewJSONHandler(out, options)
+	} else {
+		l.output = slog.NewTextHandler(out, options)
+	}
+	l.slog = slog.New(&handler{logger: l, output: l.output})
+	return l
+}
+
+// ParseLevel parses a level name; the empty string means info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// SetLevel changes the minimum level at runtime.
+func (l *Logger) SetLevel(level slog.Level) {
+	l.level.Set(level)
+}
+
+// Component returns a logger whose entries are tagged with the given component
+// (proxy, watcher, admin, k8s, ...).
+func Component(name string) *slog.Logger {
+	return Get().slog.With(ComponentKey, name)
+}
+
+// Printf logs a formatted string at info level, without a component.
+// Prefer a Component logger in new code.
 func Printf(format string, v ...interface{}) {
-	Get().Log(fmt.Sprintf(format, v...))
+	Get().slog.Info(fmt.Sprintf(format, v...))
 }
 
-// Println logs a line
+// Println logs a line at info level, without a component.
 func Println(v ...interface{}) {
-	Get().Log(fmt.Sprint(v...))
+	Get().slog.Info(fmt.Sprint(v...))
 }
 
-// Log adds a message to the buffer and broadcasts it
+// Log logs a message at info level, without a component.
 func (l *Logger) Log(msg string) {
-	entry := LogEntry{
-		Timestamp: time.Now(),
-		Message:   msg,
+	l.slog.Info(msg)
+}
+
+type contextKey int
+
+const (
+	routeIDKey contextKey = iota
+	requestIDKey
+)
+
+// WithRouteID returns a copy of ctx whose log entries carry the route ID.
+func WithRouteID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, routeIDKey, id)
+}
+
+// WithRequestID returns a copy of ctx whose log entries carry the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID stored in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// handler writes records to the output handler and records them in the buffer.
+type handler struct {
+	logger *Logger
+	output slog.Handler
+	attrs  []slog.Attr // From WithAttrs, with group prefixes applied
+	group  string      // Current group prefix, "a.b."
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.logger.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	entry := LogEntry{Timestamp: r.Time, Level: r.Level.String(), Message: r.Message}
+	for _, a := range h.attrs {
+		entry.set(a.Key, a.Value)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(&entry, h.group, a)
+		return true
+	})
+
+	// IDs from the context are never part of a group, so that entries can be filtered by route
+	r = r.Clone()
+	if ctx != nil {
+		if id, ok := ctx.Value(routeIDKey).(string); ok && id != "" {
+			entry.RouteID = id
+			r.AddAttrs(slog.String(RouteKey, id))
+		}
+		if id, ok := ctx.Value(requestIDKey).(string); ok && id != "" {
+			entry.RequestID = id
+			r.AddAttrs(slog.String(RequestKey, id))
+		}
+	}
+	h.logger.record(entry)
+
+	return h.output.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.output = h.output.WithAttrs(attrs)
+	next.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		next.attrs = append(next.attrs, slog.Attr{Key: h.group + a.Key, Value: a.Value})
+	}
+	return &next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
 	}
+	next := *h
+	next.output = h.output.WithGroup(name)
+	next.group = h.group + name + "."
+	return &next
+}
 
-	// Write to Stdout
-	fmt.Fprintln(l.out, entry.Timestamp.Format("2006/01/02 15:04:05"), msg)
+func addAttr(entry *LogEntry, prefix string, a slog.Attr) {
+	value := a.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		for _, member := range value.Group() {
+			addAttr(entry, prefix+a.Key+".", member)
+		}
+		return
+	}
+	entry.set(prefix+a.Key, value)
+}
 
+func (e *LogEntry) set(key string, value slog.Value) {
+	switch key {
+	case ComponentKey:
+		e.Component = value.String()
+	case RouteKey:
+		e.RouteID = value.String()
+	case RequestKey:
+		e.RequestID = value.String()
+	default:
+		if e.Attrs == nil {
+			e.Attrs = make(map[string]interface{})
+		}
+		v := value.Resolve().Any()
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		e.Attrs[key] = v
+	}
+}
+
+// Filter selects log entries. Empty Component and RouteID match everything; the zero MinLevel is info.
+type Filter struct {
+	MinLevel  slog.Level
+	Component string
+	RouteID   string
+}
+
+// Matches reports whether the entry passes the filter.
+func (f Filter) Matches(entry LogEntry) bool {
+	if level, err := ParseLevel(entry.Level); err == nil && level < f.MinLevel {
+		return false
+	}
+	if f.Component != "" && !strings.EqualFold(entry.Component, f.Component) {
+		return false
+	}
+	if f.RouteID != "" && entry.RouteID != f.RouteID {
+		return false
+	}
+	return true
+}
+
+func (l *Logger) record(entry LogEntry) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -75,7 +278,10 @@ func (l *Logger) Log(msg string) {
 	l.buffer = append(l.buffer, entry)
 
 	// Broadcast
-	for ch := range l.subscribers {
+	for ch, filter := range l.subscribers {
+		if !filter.Matches(entry) {
+			continue
+		}
 		select {
 		case ch <- entry:
 		default:
@@ -86,10 +292,15 @@ func (l *Logger) Log(msg string) {
 
 // Subscribe returns a channel to receive live logs
 func (l *Logger) Subscribe() chan LogEntry {
+	return l.SubscribeFiltered(Filter{MinLevel: slog.LevelDebug})
+}
+
+// SubscribeFiltered returns a channel receiving the live logs that match filter.
+func (l *Logger) SubscribeFiltered(filter Filter) chan LogEntry {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	ch := make(chan LogEntry, 100)
-	l.subscribers[ch] = true
+	l.subscribers[ch] = filter
 	return ch
 }
 
@@ -103,10 +314,25 @@ func (l *Logger) Unsubscribe(ch chan LogEntry) {
 
 // GetHistory returns the current buffer
 func (l *Logger) GetHistory() []LogEntry {
+	return l.GetFilteredHistory(Filter{MinLevel: slog.LevelDebug})
+}
+
+// GetFilteredHistory returns the buffered entries matching filter.
+func (l *Logger) GetFilteredHistory(filter Filter) []LogEntry {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 	// Return copy
-	history := make([]LogEntry, len(l.buffer))
-	copy(history, l.buffer)
+	history := make([]LogEntry, 0, len(l.buffer))
+	for _, entry := range l.buffer {
+		if filter.Matches(entry) {
+			history = append(history, entry)
+		}
+	}
 	return history
 }
+
+// StdLogger returns a standard library logger writing to the component logger at the given level,
+// for APIs such as http.Server.ErrorLog.
+func StdLogger(component string, level slog.Level) *log.Logger {
+	return slog.NewLogLogger(Component(component).Handler(), level)
+}
@@ -0,0 +1,103 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]slog.Level{"": slog.LevelInfo, "DEBUG": slog.LevelDebug, " warning ": slog.LevelWarn, "error": slog.LevelError} {
+		if level, err := ParseLevel(s); level != want || err != nil {
+			t.Errorf("ParseLevel(%q) = %v, %v", s, level, err)
+		}
+	}
+	if level, err := ParseLevel("verbose"); level != slog.LevelInfo || err == nil {
+		t.Errorf("ParseLevel(verbose) = %v, %v", level, err)
+	}
+}
+
+func TestEntriesCarryContextAndAttributes(t *testing.T) {
+	var out bytes.Buffer
+	l := newLogger(&out, "debug", "json")
+	ctx := WithRequestID(WithRouteID(context.Background(), "shop"), "req-1")
+
+	l.slog.With(ComponentKey, "proxy").WithGroup("upstream").InfoContext(ctx, "Proxying", "status", 502, "error", errors.New("refused"))
+
+	history := l.GetHistory()
+	if len(history) != 1 {
+		t.Fatalf("history %+v", history)
+	}
+	e := history[0]
+	if e.Level != "INFO" || e.Component != "proxy" || e.RouteID != "shop" || e.RequestID != "req-1" || e.Message != "Proxying" {
+		t.Errorf("entry %+v", e)
+	}
+	if e.Attrs["upstream.status"] != int64(502) || e.Attrs["upstream.error"] != "refused" {
+		t.Errorf("attrs %v", e.Attrs)
+	}
+	if RequestID(ctx) != "req-1" || RequestID(context.Background()) != "" {
+		t.Error("request ID not read back")
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil || line["msg"] != "Proxying" {
+		t.Errorf("output %s: %v", out.String(), err)
+	}
+}
+
+func TestLevelsAndFilters(t *testing.T) {
+	var out bytes.Buffer
+	l := newLogger(&out, "", "text")
+	ch := l.SubscribeFiltered(Filter{MinLevel: slog.LevelWarn, Component: "K8S"})
+	defer l.Unsubscribe(ch)
+
+	k8s := l.slog.With(ComponentKey, "k8s")
+	k8s.Debug("Hidden below info")
+	k8s.Info("Informers synced")
+	k8s.Warn("Watch expired")
+	l.slog.With(ComponentKey, "proxy").Error("Upstream down")
+
+	if history := l.GetHistory(); len(history) != 3 {
+		t.Errorf("%d entries, want 3 at info and above", len(history))
+	}
+	if strings.Contains(out.String(), "Hidden") {
+		t.Error("debug entry written at info level")
+	}
+	select {
+	case e := <-ch:
+		if e.Message != "Watch expired" {
+			t.Errorf("subscriber got %+v", e)
+		}
+	default:
+		t.Fatal("subscriber got nothing")
+	}
+	if len(ch) != 0 {
+		t.Errorf("%d more entries for the subscriber", len(ch))
+	}
+	if history := l.GetFilteredHistory(Filter{RouteID: "shop"}); len(history) != 0 {
+		t.Errorf("route filter matched %+v", history)
+	}
+
+	l.SetLevel(slog.LevelDebug)
+	k8s.Debug("Shown at debug")
+	if !strings.Contains(out.String(), "Shown at debug") {
+		t.Error("SetLevel not applied")
+	}
+}
+
+func TestBufferKeepsTheLatestEntries(t *testing.T) {
+	var out bytes.Buffer
+	l := newLogger(&out, "info", "text")
+	for i := 0; i < bufferSize+10; i++ {
+		l.Log("entry")
+	}
+	l.Log("last")
+	history := l.GetHistory()
+	if len(history) != bufferSize || history[len(history)-1].Message != "last" {
+		t.Errorf("%d entries, last %q", len(history), history[len(history)-1].Message)
+	}
+}
@@ -0,0 +1,156 @@
+package manifest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"smart-proxy/internal/store"
+)
+
+// Actions of a change.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Change is what applying a document does to one route.
+type Change struct {
+	Action    string             `json:"action"`
+	RouteID   string             `json:"route_id,omitempty"` // Empty for routes created with a generated ID
+	Namespace string             `json:"namespace"`
+	Fields    []FieldChange      `json:"fields,omitempty"` // For updates
+	Route     *store.RouteConfig `json:"-"`                // To save, for creates and updates
+}
+
+// FieldChange is a changed field of an updated route, in document form: durations read "30m".
+type FieldChange struct {
+	Path string      `json:"path"` // e.g. idle_timeout or dependencies[0].name
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Plan is the diff of a document against the current routes.
+type Plan struct {
+	Changes   []Change `json:"changes"`
+	Unchanged int      `json:"unchanged"` // Routes of the document that are already as described
+}
+
+// Diff compares the routes of a document with the current ones. Current routes missing from the document are
+// deleted if prune returns true for them; prune may be nil to delete none.
+func Diff(current, desired []store.RouteConfig, prune func(store.RouteConfig) bool) (Plan, error) {
+	existing := make(map[string]store.RouteConfig, len(current))
+	for _, route := range current {
+		existing[route.ID] = route
+	}
+
+	plan := Plan{Changes: []Change{}}
+	wanted := make(map[string]bool, len(desired))
+	for i := range desired {
+		route := desired[i]
+		wanted[route.ID] = true
+		old, found := existing[route.ID]
+		if route.ID == "" || !found {
+			plan.Changes = append(plan.Changes, Change{Action: ActionCreate, RouteID: route.ID, Namespace: route.Namespace, Route: &route})
+			continue
+		}
+		fields, err := compare(old, route)
+		if err != nil {
+			return Plan{}, err
+		}
+		if len(fields) == 0 {
+			plan.Unchanged++
+			continue
+		}
+		plan.Changes = append(plan.Changes, Change{Action: ActionUpdate, RouteID: route.ID, Namespace: route.Namespace, Fields: fields, Route: &route})
+	}
+
+	if prune != nil {
+		for _, route := range current {
+			if !wanted[route.ID] && prune(route) {
+				plan.Changes = append(plan.Changes, Change{Action: ActionDelete, RouteID: route.ID, Namespace: route.Namespace})
+			}
+		}
+	}
+
+	// Creates, updates, then deletes, each by route ID
+	order := map[string]int{ActionCreate: 0, ActionUpdate: 1, ActionDelete: 2}
+	sort.SliceStable(plan.Changes, func(i, j int) bool {
+		a, b := plan.Changes[i], plan.Changes[j]
+		if a.Action != b.Action {
+			return order[a.Action] < order[b.Action]
+		}
+		return a.RouteID < b.RouteID
+	})
+	return plan, nil
+}
+
+// Counts returns how many routes a plan creates, updates and deletes.
+func (p Plan) Counts() (created, updated, deleted int) {
+	for _, c := range p.Changes {
+		switch c.Action {
+		case ActionCreate:
+			created++
+		case ActionUpdate:
+			updated++
+		case ActionDelete:
+			deleted++
+		}
+	}
+	return
+}
+
+// compare returns the fields that differ between two routes, in document form.
+func compare(old, new store.RouteConfig) ([]FieldChange, error) {
+	oldFields, err := Fields(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := Fields(new)
+	if err != nil {
+		return nil, err
+	}
+	before, after := map[string]interface{}{}, map[string]interface{}{}
+	flatten("", oldFields, before)
+	flatten("", newFields, after)
+
+	paths := make(map[string]bool, len(before)+len(after))
+	for path := range before {
+		paths[path] = true
+	}
+	for path := range after {
+		paths[path] = true
+	}
+	var changes []FieldChange
+	for path := range paths {
+		if !reflect.DeepEqual(before[path], after[path]) {
+			changes = append(changes, FieldChange{Path: path, Old: before[path], New: after[path]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// flatten lists the leaves of a JSON value by path: objects as "a.b", lists as "a[0]". Empty objects and
+// lists are leaves.
+func flatten(path string, v interface{}, out map[string]interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && path != "" {
+			out[path] = v
+		}
+		for key, value := range v {
+			flatten(join(path, key), value, out)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			out[path] = v
+		}
+		for i, item := range v {
+			flatten(fmt.Sprintf("%s[%d]", path, i), item, out)
+		}
+	default:
+		out[path] = v
+	}
+}
@@ -0,0 +1,67 @@
+package manifest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/store"
+)
+
+func TestDiff(t *testing.T) {
+	route := func(id, namespace string) store.RouteConfig {
+		return store.RouteConfig{ID: id, Path: "/" + id, Namespace: namespace, Deployment: id, IdleTimeout: 30 * time.Minute}
+	}
+	current := []store.RouteConfig{route("shop", "shop"), route("cart", "shop"), route("blog", "blog"), route("ing-web", "shop")}
+	current[0].LastActivity = time.Now() // Runtime fields are not compared
+	current[0].Mode = &store.RouteMode{State: store.ModeMaintenance}
+
+	changed := route("cart", "shop")
+	changed.IdleTimeout = time.Hour
+	changed.Dependencies = []store.DependencyConfig{{Name: "db"}}
+	unnamed := route("", "shop")
+	desired := []store.RouteConfig{route("shop", "shop"), changed, route("wiki", "blog"), unnamed}
+
+	prune := func(r store.RouteConfig) bool { return r.ID != "ing-web" }
+	plan, err := Diff(current, desired, prune)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Unchanged != 1 {
+		t.Errorf("%d unchanged routes, want 1", plan.Unchanged)
+	}
+	var got []string
+	for _, c := range plan.Changes {
+		got = append(got, c.Action+" "+c.RouteID)
+	}
+	// Creates, updates, then deletes, each by route ID
+	want := []string{"create ", "create wiki", "update cart", "delete blog"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes %q, want %q", got, want)
+	}
+
+	update := plan.Changes[2]
+	wantFields := []FieldChange{
+		{Path: "dependencies[0].name", New: "db"},
+		{Path: "idle_timeout", Old: "30m", New: "1h"},
+	}
+	if !reflect.DeepEqual(update.Fields, wantFields) {
+		t.Errorf("fields %+v, want %+v", update.Fields, wantFields)
+	}
+	if update.Route == nil || update.Route.IdleTimeout != time.Hour {
+		t.Errorf("route to save: %+v", update.Route)
+	}
+	if created, updated, deleted := plan.Counts(); created != 2 || updated != 1 || deleted != 1 {
+		t.Errorf("counts %d, %d, %d", created, updated, deleted)
+	}
+
+	// Without pruning, routes missing from the document stay
+	plan, _ = Diff(current, desired, nil)
+	if _, _, deleted := plan.Counts(); deleted != 0 {
+		t.Errorf("%d routes deleted without pruning", deleted)
+	}
+	plan, _ = Diff(current, current, func(store.RouteConfig) bool { return true })
+	if len(plan.Changes) != 0 || plan.Unchanged != len(current) {
+		t.Errorf("current routes against themselves: %+v", plan)
+	}
+}
@@ -0,0 +1,397 @@
+// Package manifest converts routes to and from declarative documents and diffs a document against the
+// current routes. Documents are YAML or JSON:
+//
+//	routes:
+//	  - id: shop
+//	    namespace: shop
+//	    deployment: frontend
+//	    path: /
+//	    idle_timeout: 30m
+//
+// Fields are those of the admin API, except that durations are written as "30m" rather than in nanoseconds
+// and empty fields are left out. The runtime fields of a route (its last activity and its mode) are not
+// part of documents.
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-proxy/internal/store"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Formats of documents.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// runtimeFields are route fields set by the proxy or by dedicated APIs, never by documents.
+var runtimeFields = map[string]string{
+	"last_activity": "is set by the proxy",
+	"mode":          "is changed with /api/routes/mode",
+}
+
+// FieldError is a problem at a path of a document, e.g. routes[2].idle_timeout.
+type FieldError = store.FieldError
+
+// Errors lists every problem found in a document, sorted by path.
+type Errors = store.FieldErrors
+
+// Encode renders routes as a document in format, yaml or json.
+func Encode(routes []store.RouteConfig, format string) ([]byte, error) {
+	doc := struct {
+		Routes []map[string]interface{} `json:"routes"`
+	}{Routes: make([]map[string]interface{}, 0, len(routes))}
+	for _, route := range routes {
+		fields, err := Fields(route)
+		if err != nil {
+			return nil, err
+		}
+		doc.Routes = append(doc.Routes, fields)
+	}
+
+	switch format {
+	case FormatYAML, "":
+		return yaml.Marshal(doc)
+	case FormatJSON:
+		return json.MarshalIndent(doc, "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown format %q, must be yaml or json", format)
+	}
+}
+
+// Fields returns a route as it appears in documents: without runtime and empty fields, with readable durations.
+func Fields(route store.RouteConfig) (map[string]interface{}, error) {
+	data, err := json.Marshal(route)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := decode(data, &fields); err != nil {
+		return nil, err
+	}
+	for name := range runtimeFields {
+		delete(fields, name)
+	}
+	humanize(routeType, fields)
+	return fields, nil
+}
+
+// Parse reads a YAML or JSON document. It reports every problem found, with its path, as Errors: syntax,
+// unknown fields, wrong types, invalid durations, missing required fields and duplicate IDs.
+func Parse(data []byte) ([]store.RouteConfig, error) {
+	var errs Errors
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		errs.Add("", "invalid document: %v", err)
+		return nil, errs.Err()
+	}
+	var doc map[string]interface{}
+	if err := decode(jsonData, &doc); err != nil {
+		errs.Add("", "the document must be an object with a routes list")
+		return nil, errs.Err()
+	}
+	for key := range doc {
+		if key != "routes" {
+			errs.Add(key, "unknown field")
+		}
+	}
+	list, ok := doc["routes"].([]interface{})
+	if !ok {
+		errs.Add("routes", "must be a list of routes")
+		return nil, errs.Err()
+	}
+
+	routes := make([]store.RouteConfig, 0, len(list))
+	ids := make(map[string]string) // Route ID -> path of its first occurrence
+	for i, item := range list {
+		path := fmt.Sprintf("routes[%d]", i)
+		route, ok := parseRoute(item, path, &errs)
+		if !ok {
+			continue
+		}
+		if route.ID != "" {
+			if first, dup := ids[route.ID]; dup {
+				errs.Add(path+".id", "duplicate of %s", first)
+			}
+			ids[route.ID] = path
+		}
+		routes = append(routes, route)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// ParseRoute reads a single route, YAML or JSON, as found in the routes list of a document.
+func ParseRoute(data []byte) (store.RouteConfig, error) {
+	var errs Errors
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		errs.Add("", "invalid document: %v", err)
+		return store.RouteConfig{}, errs.Err()
+	}
+	var item interface{}
+	if err := decode(jsonData, &item); err != nil {
+		errs.Add("", "invalid document: %v", err)
+		return store.RouteConfig{}, errs.Err()
+	}
+	route, _ := parseRoute(item, "", &errs)
+	return route, errs.Err()
+}
+
+// parseRoute converts a route of a document at path, adding its problems to errs. It reports whether the
+// route is valid.
+func parseRoute(item interface{}, path string, errs *Errors) (store.RouteConfig, bool) {
+	before := len(*errs)
+	fields, ok := item.(map[string]interface{})
+	if !ok {
+		errs.Add(path, "must be an object")
+		return store.RouteConfig{}, false
+	}
+	for name, reason := range runtimeFields {
+		if _, set := fields[name]; set {
+			errs.Add(join(path, name), "%s, not by documents", reason)
+			delete(fields, name)
+		}
+	}
+	normalize(routeType, fields, path, errs)
+	for _, name := range []string{"path", "namespace", "deployment"} {
+		if value, set := fields[name]; !set || value == "" {
+			errs.Add(join(path, name), "required")
+		}
+	}
+	if len(*errs) > before {
+		return store.RouteConfig{}, false
+	}
+
+	var route store.RouteConfig
+	encoded, _ := json.Marshal(fields)
+	if err := json.Unmarshal(encoded, &route); err != nil {
+		errs.Add(path, "%v", err)
+		return store.RouteConfig{}, false
+	}
+	return route, true
+}
+
+// decode decodes JSON keeping numbers exact, as durations in nanoseconds exceed float precision.
+func decode(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+var (
+	routeType    = reflect.TypeOf(store.RouteConfig{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	rawType      = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// jsonFields maps the JSON names of the fields of a struct type to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// humanize rewrites data, the JSON form of a value of type t, for documents: durations become strings such
+// as "30m" and empty struct fields are dropped. Map entries and list items are kept even if empty.
+func humanize(t reflect.Type, data interface{}) interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		if n, ok := data.(json.Number); ok {
+			if ns, err := n.Int64(); err == nil {
+				return FormatDuration(time.Duration(ns))
+			}
+		}
+		return data
+	case t == rawType || t == timeType:
+		return data
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return data
+		}
+		fields := jsonFields(t)
+		for name, value := range m {
+			if empty(value) {
+				delete(m, name)
+			} else if ft, ok := fields[name]; ok {
+				m[name] = humanize(ft, value)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if list, ok := data.([]interface{}); ok {
+			for i, item := range list {
+				list[i] = humanize(t.Elem(), item)
+			}
+		}
+	case reflect.Map:
+		if m, ok := data.(map[string]interface{}); ok {
+			for key, value := range m {
+				m[key] = humanize(t.Elem(), value)
+			}
+		}
+	}
+	return data
+}
+
+// empty reports whether a JSON value is the zero value of its type.
+func empty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// normalize checks data, the JSON form of a value of type t at path, and converts readable durations back
+// to nanoseconds. Problems are added to errs.
+func normalize(t reflect.Type, data interface{}, path string, errs *Errors) interface{} {
+	if data == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case durationType:
+		switch v := data.(type) {
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs.Add(path, "invalid duration %q, e.g. 30m or 1h30m", v)
+				return data
+			}
+			return json.Number(strconv.FormatInt(int64(d), 10))
+		case json.Number: // Nanoseconds, as in the admin API
+			if _, err := v.Int64(); err != nil {
+				errs.Add(path, "invalid duration %s", v)
+			}
+			return data
+		}
+		errs.Add(path, "must be a duration such as 30m")
+		return data
+	case rawType:
+		return data
+	case timeType:
+		if s, ok := data.(string); !ok {
+			errs.Add(path, "must be an RFC 3339 time")
+		} else if _, err := time.Parse(time.RFC3339, s); err != nil {
+			errs.Add(path, "invalid time %q, must be RFC 3339", s)
+		}
+		return data
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			errs.Add(path, "must be an object")
+			return data
+		}
+		fields := jsonFields(t)
+		for name, value := range m {
+			ft, ok := fields[name]
+			if !ok {
+				errs.Add(join(path, name), "unknown field")
+				continue
+			}
+			m[name] = normalize(ft, value, join(path, name), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := data.([]interface{})
+		if !ok {
+			errs.Add(path, "must be a list")
+			return data
+		}
+		for i, item := range list {
+			list[i] = normalize(t.Elem(), item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			errs.Add(path, "must be an object")
+			return data
+		}
+		for key, value := range m {
+			m[key] = normalize(t.Elem(), value, join(path, key), errs)
+		}
+	case reflect.String:
+		if _, ok := data.(string); !ok {
+			errs.Add(path, "must be a string")
+		}
+	case reflect.Bool:
+		if _, ok := data.(bool); !ok {
+			errs.Add(path, "must be true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, ok := data.(json.Number); !ok {
+			errs.Add(path, "must be an integer")
+		} else if _, err := n.Int64(); err != nil {
+			errs.Add(path, "must be an integer")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := data.(json.Number); !ok {
+			errs.Add(path, "must be a number")
+		}
+	}
+	return data
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// FormatDuration writes durations as "30m" or "1h30m" rather than "30m0s".
+func FormatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
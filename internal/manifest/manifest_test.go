@@ -0,0 +1,133 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/store"
+)
+
+func TestEncodeParseRoundTrip(t *testing.T) {
+	routes := []store.RouteConfig{{
+		ID:            "shop",
+		Host:          "shop.example.com",
+		Path:          "/",
+		TargetService: "web",
+		TargetPort:    8080,
+		Namespace:     "shop",
+		Deployment:    "web",
+		Dependencies:  []store.DependencyConfig{{Name: "db"}},
+		IdleTimeout:   90 * time.Minute,
+		LastActivity:  time.Now(),
+		Mode:          &store.RouteMode{State: store.ModePinned},
+	}}
+
+	for _, format := range []string{FormatYAML, FormatJSON} {
+		data, err := Encode(routes, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := string(data)
+		if !strings.Contains(doc, "1h30m") || strings.Contains(doc, "last_activity") || strings.Contains(doc, "mode") ||
+			strings.Contains(doc, "inject_badge") {
+			t.Errorf("%s document:\n%s", format, doc)
+		}
+		parsed, err := Parse(data)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		want := routes[0]
+		want.LastActivity, want.Mode = time.Time{}, nil
+		if len(parsed) != 1 || !reflect.DeepEqual(parsed[0], want) {
+			t.Errorf("%s: parsed %+v, want %+v", format, parsed, want)
+		}
+	}
+
+	if _, err := Encode(routes, "toml"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestParseReportsEveryProblem(t *testing.T) {
+	doc := `
+routes:
+  - id: shop
+    namespace: shop
+    deployment: web
+    path: /
+    idle_timeout: 30 minutes
+  - id: shop
+    namespace: shop
+    deployment: web
+    path: /cart
+    target_port: "80"
+  - namespace: blog
+    deployment: web
+    hostname: blog.example.com
+  - id: api
+    namespace: api
+    deployment: api
+    path: /api
+    last_activity: "2024-01-01T00:00:00Z"
+  - nope
+kind: Routes
+`
+	_, err := Parse([]byte(doc))
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("not a list of errors: %v", err)
+	}
+	var paths []string
+	for _, e := range errs {
+		paths = append(paths, e.Path)
+	}
+	want := []string{
+		"kind",
+		"routes[0].idle_timeout",
+		"routes[1].target_port",
+		"routes[2].hostname",
+		"routes[2].path",
+		"routes[3].last_activity",
+		"routes[4]",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("problems at %q, want %q:\n%v", paths, want, err)
+	}
+
+	dup := "routes:\n  - {id: shop, namespace: shop, deployment: web, path: /}\n  - {id: shop, namespace: shop, deployment: web, path: /cart}\n"
+	if _, err := Parse([]byte(dup)); err == nil || err.Error() != "routes[1].id: duplicate of routes[0]" {
+		t.Errorf("duplicate IDs: %v", err)
+	}
+
+	for _, doc := range []string{"routes: [", "- a\n- b\n", "routes: {}"} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("%q accepted", doc)
+		}
+	}
+}
+
+func TestParseRoute(t *testing.T) {
+	route, err := ParseRoute([]byte(`{"namespace": "shop", "deployment": "web", "path": "/", "idle_timeout": "15m", "wake_timeout": 60000000000}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Durations may also be given in nanoseconds, as the admin API returns them
+	if route.IdleTimeout != 15*time.Minute || route.WakeTimeout != time.Minute {
+		t.Errorf("durations: %s, %s", route.IdleTimeout, route.WakeTimeout)
+	}
+	if _, err := ParseRoute([]byte(`{"namespace": "shop"}`)); err == nil || !strings.Contains(err.Error(), "deployment: required") {
+		t.Errorf("missing fields: %v", err)
+	}
+}
+
+func TestErrorsAsJSON(t *testing.T) {
+	_, err := Parse([]byte("routes:\n  - namespace: shop\n    deployment: web\n"))
+	data, _ := json.Marshal(err)
+	if string(data) != `[{"path":"routes[0].path","message":"required"}]` {
+		t.Errorf("%s", data)
+	}
+}
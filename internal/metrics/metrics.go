@@ -0,0 +1,284 @@
+// Package metrics is a small, dependency-free implementation of Prometheus counters, gauges and
+// histograms with labels, served in the Prometheus text exposition format.
+// Series are registered once at package level on Default and are safe for concurrent use.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Default is the registry served on /metrics.
+var Default = NewRegistry()
+
+// DefBuckets are latency buckets in seconds suitable for HTTP requests.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds the metric families exposed by Handler.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+	hooks    []func()
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// OnScrape registers fn to run before every scrape, e.g. to refresh gauges derived from other state.
+func (r *Registry) OnScrape(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, fn)
+}
+
+// family is one metric name with its series, keyed by the joined label values.
+type family struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or histogram
+	labels  []string
+	buckets []float64 // Histograms only
+
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  atomicFloat // Counters and gauges
+
+	// Histograms
+	mu     sync.Mutex
+	counts []uint64 // Per bucket, non-cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func (r *Registry) register(name, help, kind string, buckets []float64, labels []string) *family {
+	f := &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.families {
+		if existing.name == name {
+			panic("metrics: duplicate metric " + name)
+		}
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+	s = &series{values: append([]string(nil), values...)}
+	if f.kind == "histogram" {
+		s.counts = make([]uint64, len(f.buckets)+1)
+	}
+	f.series[key] = s
+	return s
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct{ f *family }
+
+// NewCounterVec registers a counter.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, "counter", nil, labels)}
+}
+
+// Inc adds one to the series with the given label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.f.with(values).value.add(1)
+}
+
+// Add adds v, which must not be negative, to the series with the given label values.
+func (c *CounterVec) Add(v float64, values ...string) {
+	if v < 0 {
+		return
+	}
+	c.f.with(values).value.add(v)
+}
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct{ f *family }
+
+// NewGaugeVec registers a gauge.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(name, help, "gauge", nil, labels)}
+}
+
+// Set sets the series with the given label values.
+func (g *GaugeVec) Set(v float64, values ...string) {
+	g.f.with(values).value.store(v)
+}
+
+// Reset removes all series.
+func (g *GaugeVec) Reset() {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.series = make(map[string]*series)
+}
+
+// Sample is the value of one series, with its label values.
+type Sample struct {
+	Value  float64
+	Labels []string
+}
+
+// Replace swaps all series for samples at once, so a concurrent scrape sees either the old or the new set.
+func (g *GaugeVec) Replace(samples []Sample) {
+	all := make(map[string]*series, len(samples))
+	for _, sample := range samples {
+		if len(sample.Labels) != len(g.f.labels) {
+			panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", g.f.name, len(g.f.labels), len(sample.Labels)))
+		}
+		s := &series{values: append([]string(nil), sample.Labels...)}
+		s.value.store(sample.Value)
+		all[strings.Join(sample.Labels, "\xff")] = s
+	}
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.series = all
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct{ f *family }
+
+// NewHistogramVec registers a histogram with the given upper bucket bounds (sorted ascending).
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{r.register(name, help, "histogram", buckets, labels)}
+}
+
+// Observe records v in the series with the given label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	s := h.f.with(values)
+	i := sort.SearchFloat64s(h.f.buckets, v) // First bucket with bound >= v
+	s.mu.Lock()
+	s.counts[i]++
+	s.sum += v
+	s.count++
+	s.mu.Unlock()
+}
+
+// Handler serves the registry in the Prometheus text exposition format (version 0.0.4).
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		hooks := append([]func(){}, r.hooks...)
+		families := append([]*family{}, r.families...)
+		r.mu.Unlock()
+
+		for _, hook := range hooks {
+			hook()
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		var b strings.Builder
+		for _, f := range families {
+			f.write(&b)
+		}
+		w.Write([]byte(b.String()))
+	})
+}
+
+func (f *family) write(b *strings.Builder) {
+	f.mu.RLock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mu.RUnlock()
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].values, "\xff") < strings.Join(all[j].values, "\xff")
+	})
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+	for _, s := range all {
+		labels := f.labelPairs(s.values)
+		if f.kind != "histogram" {
+			fmt.Fprintf(b, "%s%s %s\n", f.name, wrap(labels), formatFloat(s.value.load()))
+			continue
+		}
+
+		s.mu.Lock()
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, wrap(append(labels, `le="`+formatFloat(bound)+`"`)), cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, wrap(append(labels, `le="+Inf"`)), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", f.name, wrap(labels), formatFloat(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", f.name, wrap(labels), s.count)
+		s.mu.Unlock()
+	}
+}
+
+func (f *family) labelPairs(values []string) []string {
+	pairs := make([]string, len(values))
+	for i, v := range values {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, f.labels[i], escapeLabel(v))
+	}
+	return pairs
+}
+
+func wrap(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// atomicFloat is a float64 updated with compare-and-swap.
+type atomicFloat struct{ bits atomic.Uint64 }
+
+func (a *atomicFloat) add(v float64) {
+	for {
+		old := a.bits.Load()
+		if a.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (a *atomicFloat) store(v float64) { a.bits.Store(math.Float64bits(v)) }
+func (a *atomicFloat) load() float64   { return math.Float64frombits(a.bits.Load()) }
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGaugeReplaceIsNeverSeenHalfDone(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeVec("state", "State.", "route", "state")
+	samples := []Sample{{1, []string{"a", "ready"}}, {0, []string{"a", "sleeping"}}, {1, []string{"b", "sleeping"}}}
+	g.Replace(samples)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			g.Replace(samples)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		w := httptest.NewRecorder()
+		r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		body, _ := io.ReadAll(w.Body)
+		if n := strings.Count(string(body), "\nstate{"); n != len(samples) {
+			t.Fatalf("scrape saw %d series:\n%s", n, body)
+		}
+	}
+	wg.Wait()
+
+	g.Replace([]Sample{{1, []string{"b", "ready"}}})
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if body := w.Body.String(); strings.Contains(body, `route="a"`) || !strings.Contains(body, `state{route="b",state="ready"} 1`) {
+		t.Errorf("after replace:\n%s", body)
+	}
+}
@@ -0,0 +1,494 @@
+// Package notify sends lifecycle events (wake, sleep, patch, ...) to webhooks such as Slack, Microsoft Teams
+// or Mattermost incoming webhooks. Targets are configured globally and per route; payloads are templated JSON,
+// optionally signed with HMAC-SHA256, and retried with exponential backoff. Recent deliveries are kept for the
+// admin API.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+
+	"github.com/google/uuid"
+)
+
+var log = logger.Component("notify")
+
+// Event types.
+const (
+	EventWakeStarted  = "wake.started"  // A request woke the route up
+	EventWakeFinished = "wake.finished" // All deployments of a woken route are ready
+	EventWakeFailed   = "wake.failed"   // A deployment could not be scaled up
+	EventWakeTimeout  = "wake.timeout"  // The route was still not ready after the wake timeout
+	EventSleep        = "sleep"         // The watcher scaled an idle route down
+	EventPatched      = "route.patched"
+	EventUnpatched    = "route.unpatched"
+)
+
+// Event is the payload sent to targets without a template, and the data passed to templates.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	RouteID    string    `json:"route_id"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Deployment string    `json:"deployment,omitempty"`
+	Host       string    `json:"host,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Message    string    `json:"message"`
+	Duration   float64   `json:"duration_seconds,omitempty"` // Cold start duration, for wake.finished
+}
+
+// Summary is a one-line human readable description, used by the chat templates.
+func (e Event) Summary() string {
+	return fmt.Sprintf("[%s] %s/%s (%s%s): %s", e.Type, e.Namespace, e.Deployment, e.Host, e.Path, e.Message)
+}
+
+// Target is a globally configured webhook, notified for every route.
+type Target struct {
+	Name     string            `json:"name,omitempty"`
+	URL      string            `json:"url"`
+	Events   []string          `json:"events,omitempty"`   // All if empty
+	Template string            `json:"template,omitempty"` // See store.NotificationTarget
+	Secret   string            `json:"secret,omitempty"`   // HMAC key signing the payloads
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+// Config configures a Notifier.
+type Config struct {
+	Targets     []Target
+	Secrets     func(namespace, name string) (map[string][]byte, error) // Reads the Secrets of per-route targets
+	MaxAttempts int                                                     // Default 5
+	Backoff     time.Duration                                           // First retry delay, doubled after each attempt; default 2s
+	Client      *http.Client
+}
+
+// Delivery is one event sent to one target, as listed by the admin API.
+type Delivery struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	EventID   string    `json:"event_id"`
+	RouteID   string    `json:"route_id"`
+	Namespace string    `json:"namespace,omitempty"`
+	Target    string    `json:"target"` // URL without path and query, which often hold a token
+	Status    string    `json:"status"` // pending, delivered, failed or dropped
+	Attempts  int       `json:"attempts"`
+	Code      int       `json:"code,omitempty"` // HTTP status of the last attempt
+	Error     string    `json:"error,omitempty"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+	StatusDropped   = "dropped"
+)
+
+const (
+	maxQueue      = 1024
+	maxDeliveries = 200 // Kept for the admin API
+	workers       = 4
+	maxBackoff    = 5 * time.Minute
+)
+
+// Notifier delivers events in the background. A nil *Notifier sends nothing.
+type Notifier struct {
+	config    Config
+	templates *templateCache
+	events    chan routeEvent
+	attempts  chan *attempt
+	done      chan struct{}
+	wg        sync.WaitGroup
+
+	mu         sync.Mutex
+	deliveries []*Delivery // Oldest first
+}
+
+// routeEvent is an event waiting for its targets to be resolved.
+type routeEvent struct {
+	event   Event
+	targets []store.NotificationTarget
+}
+
+// attempt is a rendered payload to (re)send to a target.
+type attempt struct {
+	delivery *Delivery
+	target   Target
+	body     []byte
+}
+
+// New starts a notifier.
+func New(config Config) *Notifier {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 2 * time.Second
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	n := &Notifier{
+		config:    config,
+		templates: newTemplateCache(),
+		events:    make(chan routeEvent, maxQueue),
+		attempts:  make(chan *attempt, maxQueue),
+		done:      make(chan struct{}),
+	}
+	n.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go n.run()
+	}
+	return n
+}
+
+// FromEnv configures the notifier from NOTIFY_TARGETS_FILE, a JSON list of global targets, and
+// NOTIFY_MAX_ATTEMPTS. secrets reads the Secrets referenced by per-route targets.
+func FromEnv(secrets func(namespace, name string) (map[string][]byte, error)) (*Notifier, error) {
+	config := Config{Secrets: secrets}
+	if path := os.Getenv("NOTIFY_TARGETS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &config.Targets); err != nil {
+			return nil, fmt.Errorf("invalid NOTIFY_TARGETS_FILE: %w", err)
+		}
+		for _, t := range config.Targets {
+			if _, err := url.ParseRequestURI(t.URL); err != nil {
+				return nil, fmt.Errorf("invalid notification target URL: %w", err)
+			}
+			if _, err := parseTemplate(t.Template); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s := os.Getenv("NOTIFY_MAX_ATTEMPTS"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid NOTIFY_MAX_ATTEMPTS %q", s)
+		}
+		config.MaxAttempts = n
+	}
+	return New(config), nil
+}
+
+// Notify queues an event of the given type about route. It never blocks.
+func (n *Notifier) Notify(route store.RouteConfig, eventType, message string) {
+	n.notify(route, Event{Type: eventType, Message: message})
+}
+
+// NotifyWakeFinished queues a wake.finished event with the cold start duration.
+func (n *Notifier) NotifyWakeFinished(route store.RouteConfig, coldStart time.Duration) {
+	n.notify(route, Event{
+		Type:     EventWakeFinished,
+		Message:  fmt.Sprintf("Ready after %s", coldStart.Round(time.Second)),
+		Duration: coldStart.Seconds(),
+	})
+}
+
+func (n *Notifier) notify(route store.RouteConfig, e Event) {
+	if n == nil {
+		return
+	}
+	e.ID = uuid.NewString()
+	e.Time = time.Now().UTC()
+	e.RouteID, e.Namespace, e.Deployment, e.Host, e.Path = route.ID, route.Namespace, route.Deployment, route.Host, route.Path
+
+	select {
+	case n.events <- routeEvent{event: e, targets: route.Notifications}:
+	default:
+		log.Warn("Dropped notification, the queue was full", "route_id", route.ID, "event", e.Type)
+	}
+}
+
+// Deliveries returns the most recent deliveries, newest first.
+func (n *Notifier) Deliveries() []Delivery {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	out := make([]Delivery, 0, len(n.deliveries))
+	for i := len(n.deliveries) - 1; i >= 0; i-- {
+		out = append(out, *n.deliveries[i])
+	}
+	return out
+}
+
+// Close stops the workers once the queued events have been sent once. Pending retries are abandoned.
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+	close(n.done)
+	n.wg.Wait()
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+	for {
+		select {
+		case e := <-n.events:
+			n.dispatch(e)
+		case a := <-n.attempts:
+			n.send(a)
+		case <-n.done:
+			for {
+				select {
+				case e := <-n.events:
+					n.dispatch(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// dispatch resolves the targets interested in the event and sends it to each of them.
+func (n *Notifier) dispatch(re routeEvent) {
+	e := re.event
+	var targets []Target
+	for _, t := range n.config.Targets {
+		if wants(t.Events, e.Type) {
+			targets = append(targets, t)
+		}
+	}
+	for _, rt := range re.targets {
+		if !wants(rt.Events, e.Type) {
+			continue
+		}
+		t, err := n.resolve(e.Namespace, rt)
+		if err != nil {
+			target := redact(rt.URL)
+			if rt.URL == "" {
+				target = "secret " + rt.SecretName
+			}
+			n.record(e, target, StatusFailed, err)
+			continue
+		}
+		targets = append(targets, t)
+	}
+
+	for _, t := range targets {
+		body, err := n.templates.render(t.Template, e)
+		if err != nil {
+			n.record(e, redact(t.URL), StatusFailed, err)
+			continue
+		}
+		n.send(&attempt{delivery: n.record(e, redact(t.URL), StatusPending, nil), target: t, body: body})
+	}
+}
+
+// resolve reads the URL and signing key of a per-route target from its Secret, if it has one.
+func (n *Notifier) resolve(namespace string, rt store.NotificationTarget) (Target, error) {
+	t := Target{URL: rt.URL, Events: rt.Events, Template: rt.Template}
+	if rt.SecretName != "" {
+		if n.config.Secrets == nil {
+			return t, fmt.Errorf("cannot read secret %s without a cluster", rt.SecretName)
+		}
+		data, err := n.config.Secrets(namespace, rt.SecretName)
+		if err != nil {
+			return t, fmt.Errorf("reading secret %s: %w", rt.SecretName, err)
+		}
+		t.Secret = string(data["hmac-secret"])
+		if t.URL == "" {
+			t.URL = strings.TrimSpace(string(data["url"]))
+		}
+	}
+	if t.URL == "" {
+		return t, fmt.Errorf("notification target has no URL")
+	}
+	return t, nil
+}
+
+func wants(events []string, eventType string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if e == eventType || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// send makes one attempt and schedules a retry after a network error, 429 or 5xx.
+func (n *Notifier) send(a *attempt) {
+	code, retryAfter, err := n.post(a)
+
+	n.mu.Lock()
+	d := a.delivery
+	d.Attempts++
+	d.Code = code
+	d.Updated = time.Now()
+	d.Error = ""
+	retry := false
+	switch {
+	case err == nil:
+		d.Status = StatusDelivered
+	case d.Attempts >= n.config.MaxAttempts || !retryable(code):
+		d.Status = StatusFailed
+		d.Error = err.Error()
+	default:
+		d.Error = err.Error()
+		retry = true
+	}
+	attempts, status := d.Attempts, d.Status
+	n.mu.Unlock()
+
+	if status == StatusFailed {
+		log.Warn("Notification failed", "route_id", d.RouteID, "event", d.Event, "target", d.Target, "attempts", attempts, "error", err)
+	}
+	if !retry {
+		return
+	}
+
+	delay := n.backoff(attempts)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	time.AfterFunc(delay, func() {
+		select {
+		case <-n.done:
+			n.finish(a.delivery, StatusDropped)
+		case n.attempts <- a:
+		default:
+			n.finish(a.delivery, StatusDropped)
+		}
+	})
+}
+
+// post sends the payload once. retryAfter is taken from the Retry-After header of 429/503 responses.
+func (n *Notifier) post(a *attempt) (code int, retryAfter time.Duration, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.target.URL, bytes.NewReader(a.body))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "smart-proxy-notifier")
+	for k, v := range a.target.Headers {
+		req.Header.Set(k, v)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(EventHeader, a.delivery.Event)
+	req.Header.Set(DeliveryHeader, a.delivery.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	if a.target.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(a.target.Secret, timestamp, a.body))
+	}
+
+	resp, err := n.config.Client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return resp.StatusCode, 0, nil
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		retryAfter = min(time.Duration(seconds)*time.Second, maxBackoff)
+	}
+	return resp.StatusCode, retryAfter, fmt.Errorf("target returned %s", resp.Status)
+}
+
+func retryable(code int) bool {
+	return code == 0 || code == http.StatusTooManyRequests || code >= 500
+}
+
+// backoff returns the delay before the next attempt, with ±20% jitter.
+func (n *Notifier) backoff(attempts int) time.Duration {
+	delay := n.config.Backoff << (attempts - 1)
+	if delay <= 0 || delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return time.Duration(float64(delay) * (0.8 + 0.4*rand.Float64()))
+}
+
+// record adds a delivery to the log, dropping the oldest beyond maxDeliveries. target must be redacted.
+func (n *Notifier) record(e Event, target, status string, err error) *Delivery {
+	now := time.Now()
+	d := &Delivery{
+		ID:        uuid.NewString(),
+		Event:     e.Type,
+		EventID:   e.ID,
+		RouteID:   e.RouteID,
+		Namespace: e.Namespace,
+		Target:    target,
+		Status:    status,
+		Created:   now,
+		Updated:   now,
+	}
+	if err != nil {
+		d.Error = err.Error()
+		log.Warn("Notification failed", "route_id", e.RouteID, "event", e.Type, "target", d.Target, "error", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.deliveries) >= maxDeliveries {
+		n.deliveries = n.deliveries[1:]
+	}
+	n.deliveries = append(n.deliveries, d)
+	return d
+}
+
+func (n *Notifier) finish(d *Delivery, status string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	d.Status = status
+	d.Updated = time.Now()
+}
+
+// redact keeps the scheme and host of a URL; chat webhook URLs carry their token in the path.
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "(invalid URL)"
+	}
+	return u.Scheme + "://" + u.Host + "/..."
+}
+
+// Headers set on every notification.
+const (
+	EventHeader     = "X-Smart-Proxy-Event"
+	DeliveryHeader  = "X-Smart-Proxy-Delivery"
+	TimestampHeader = "X-Smart-Proxy-Timestamp"
+	SignatureHeader = "X-Smart-Proxy-Signature" // "sha256=" + hex HMAC of "<timestamp>.<body>"
+)
+
+// Sign returns the signature header value for a payload.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a received notification.
+func Verify(secret, timestamp, signature string, body []byte) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
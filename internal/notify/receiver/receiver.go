@@ -0,0 +1,102 @@
+// Package receiver is an in-memory stand-in for a notification webhook. It checks signatures, keeps the
+// payloads it receives, and can fail on purpose to exercise retries, for tests and local debugging.
+package receiver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"smart-proxy/internal/notify"
+)
+
+// Notification is a received request.
+type Notification struct {
+	Event    string
+	Delivery string
+	Body     json.RawMessage
+	Signed   bool // The signature header was present and valid
+}
+
+// Receiver stores every notification it accepts.
+type Receiver struct {
+	Secret    string               // If set, unsigned or badly signed requests get 401
+	OnReceive func(n Notification) // Optional, called for every accepted notification
+
+	mu            sync.Mutex
+	notifications []Notification
+	failures      int
+	failStatus    int
+}
+
+// New returns a receiver verifying signatures with secret, or accepting anything if secret is empty.
+func New(secret string) *Receiver {
+	return &Receiver{Secret: secret}
+}
+
+// FailNext makes the next count requests fail with status, e.g. 503 or 429.
+func (rc *Receiver) FailNext(count, status int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.failures, rc.failStatus = count, status
+}
+
+// Handler accepts notifications on any path.
+func (rc *Receiver) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil || !json.Valid(body) {
+			http.Error(w, "Body must be JSON", http.StatusBadRequest)
+			return
+		}
+
+		signature := r.Header.Get(notify.SignatureHeader)
+		signed := signature != "" && rc.Secret != "" &&
+			notify.Verify(rc.Secret, r.Header.Get(notify.TimestampHeader), signature, body)
+		if rc.Secret != "" && !signed {
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		rc.mu.Lock()
+		if rc.failures > 0 {
+			rc.failures--
+			status := rc.failStatus
+			rc.mu.Unlock()
+			http.Error(w, "Failing on purpose", status)
+			return
+		}
+		n := Notification{
+			Event:    r.Header.Get(notify.EventHeader),
+			Delivery: r.Header.Get(notify.DeliveryHeader),
+			Body:     body,
+			Signed:   signed,
+		}
+		rc.notifications = append(rc.notifications, n)
+		rc.mu.Unlock()
+
+		if rc.OnReceive != nil {
+			rc.OnReceive(n)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Notifications returns a copy of the notifications received so far.
+func (rc *Receiver) Notifications() []Notification {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Notification(nil), rc.notifications...)
+}
+
+// Reset forgets all notifications and pending failures.
+func (rc *Receiver) Reset() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.notifications, rc.failures = nil, 0
+}
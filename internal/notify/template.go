@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// presets are the built-in templates for chat incoming webhooks, which all accept a "text" field.
+var presets = map[string]string{
+	"slack":      `{"text": {{json .Summary}}}`,
+	"teams":      `{"text": {{json .Summary}}}`,
+	"mattermost": `{"text": {{json .Summary}}, "username": "smart-proxy"}`,
+}
+
+var funcs = template.FuncMap{
+	// json encodes a value, e.g. {"message": {{json .Message}}}
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// parseTemplate parses a preset name or a custom Go template. An empty name returns nil: the event is sent as is.
+func parseTemplate(name string) (*template.Template, error) {
+	if name == "" {
+		return nil, nil
+	}
+	text, ok := presets[name]
+	if !ok {
+		if !strings.Contains(name, "{{") {
+			return nil, fmt.Errorf("unknown notification template %q", name)
+		}
+		text = name
+	}
+	tmpl, err := template.New("notification").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// templateCache keeps parsed templates, since per-route templates are only known when an event is sent.
+type templateCache struct {
+	mu        sync.Mutex
+	templates map[string]*template.Template
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{templates: make(map[string]*template.Template)}
+}
+
+// render returns the JSON payload of e for the template.
+func (c *templateCache) render(name string, e Event) ([]byte, error) {
+	if name == "" {
+		return json.Marshal(e)
+	}
+
+	c.mu.Lock()
+	tmpl, ok := c.templates[name]
+	if !ok {
+		var err error
+		if tmpl, err = parseTemplate(name); err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		c.templates[name] = tmpl
+	}
+	c.mu.Unlock()
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, e); err != nil {
+		return nil, fmt.Errorf("notification template: %w", err)
+	}
+	if !json.Valid(b.Bytes()) {
+		return nil, fmt.Errorf("notification template did not produce valid JSON")
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,266 @@
+// Package openapi builds OpenAPI 3 documents from Go types and checks HTTP responses against them.
+//
+// Schemas are generated by reflection from the types handlers encode, following their JSON tags, so that the
+// document cannot drift from the code. Only the parts of OpenAPI the admin API uses are modeled.
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of the documents.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+
+	types map[string]reflect.Type // Schema name -> Go type, to tell apart types of the same name
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag groups operations.
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lowercase HTTP methods to the operations of a path.
+type PathItem map[string]*Operation
+
+// Operation is an API operation.
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"` // Status code or "default" -> response
+}
+
+// Parameter is a path, query or header parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // path, query or header
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body of a request.
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// MediaType is the schema of a body in one content type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Response is a response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header is a response header.
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Components holds the schemas referenced by operations and the security schemes.
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is a way to authenticate.
+type SecurityScheme struct {
+	Type        string `json:"type"`             // http or apiKey
+	Scheme      string `json:"scheme,omitempty"` // For http, e.g. bearer
+	In          string `json:"in,omitempty"`     // For apiKey, e.g. cookie
+	Name        string `json:"name,omitempty"`   // For apiKey
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is a JSON schema, as OpenAPI 3.0 restricts it.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"` // false or a *Schema
+}
+
+// New returns an empty document.
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      make(map[string]PathItem),
+		Components: Components{Schemas: make(map[string]*Schema)},
+		types:      make(map[string]reflect.Type),
+	}
+}
+
+// Add adds an operation at path, e.g. "/api/v1/routes/{id}".
+func (d *Document) Add(method, path string, op *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = make(PathItem)
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// JSON returns the JSON body of an operation: the schema of the type of v.
+func (d *Document) JSON(v interface{}) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: d.Schema(v)}}
+}
+
+// Schema returns the schema of the type of v. Structs are added to the components and referenced.
+func (d *Document) Schema(v interface{}) *Schema {
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	rawMessageType    = reflect.TypeOf(json.RawMessage(nil))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	if t.Kind() == reflect.Pointer {
+		s := d.schemaOf(t.Elem())
+		if s.Ref != "" {
+			return s // $ref may not have siblings in OpenAPI 3.0
+		}
+		s.Nullable = true
+		return s
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "Duration in nanoseconds"}
+	case t == rawMessageType:
+		return &Schema{}
+	case t.Implements(textMarshalerType) && !t.Implements(jsonMarshalerType):
+		return &Schema{Type: "string"}
+	case t.Implements(jsonMarshalerType):
+		return &Schema{} // Anything: the type encodes itself
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schemaOf(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		return d.structSchema(t)
+	default:
+		return &Schema{} // Interfaces: anything
+	}
+}
+
+// structSchema references the schema of a struct, adding it to the components. Anonymous structs are inlined.
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	if t.Name() == "" {
+		return d.objectSchema(t)
+	}
+	name := exported(t.Name())
+	if other, ok := d.types[name]; ok && other != t {
+		// Same name in another package, e.g. admin.problem and client.problem
+		name = strings.ReplaceAll(t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:], "-", "_") + "." + exported(t.Name())
+	}
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, ok := d.types[name]; ok {
+		return ref
+	}
+	d.types[name] = t
+	d.Components.Schemas[name] = &Schema{Type: "object"} // Placeholder for recursive types
+	d.Components.Schemas[name] = d.objectSchema(t)
+	return ref
+}
+
+// exported capitalizes the name of an unexported type, e.g. routeStatus becomes RouteStatus.
+func exported(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// objectSchema describes the JSON fields of a struct; embedded structs are flattened, as encoding/json does.
+func (d *Document) objectSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema), AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for prop, schema := range d.objectSchema(embedded).Properties {
+					if _, shadowed := s.Properties[prop]; !shadowed {
+						s.Properties[prop] = schema
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = d.schemaOf(f.Type)
+	}
+	return s
+}
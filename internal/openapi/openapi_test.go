@@ -0,0 +1,155 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type base struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+type item struct {
+	base
+	Name     string            `json:"name"`
+	Timeout  time.Duration     `json:"timeout"`
+	Parent   *item             `json:"parent,omitempty"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels"`
+	Count    int32             `json:"count"`
+	Ratio    float64           `json:"ratio"`
+	Secret   string            `json:"-"`
+	internal string
+}
+
+func newDocument() *Document {
+	d := New(Info{Title: "Items", Version: "1"})
+	d.Add(http.MethodGet, "/items/{id}", &Operation{
+		OperationID: "getItem",
+		Responses: map[string]*Response{
+			"200":     {Description: "The item", Content: d.JSON(item{})},
+			"204":     {Description: "Nothing"},
+			"default": {Description: "An error", Content: map[string]MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}},
+		},
+	})
+	d.Add(http.MethodGet, "/items/new", &Operation{
+		OperationID: "newItem",
+		Responses:   map[string]*Response{"200": {Description: "A blank item", Content: d.JSON(item{})}},
+	})
+	d.Add(http.MethodGet, "/items/{id}/events", &Operation{
+		OperationID: "itemEvents",
+		Responses:   map[string]*Response{"200": {Description: "Events", Content: map[string]MediaType{"text/event-stream": {Schema: &Schema{Type: "string"}}}}},
+	})
+	return d
+}
+
+func TestSchemas(t *testing.T) {
+	d := newDocument()
+	s := d.Components.Schemas["Item"]
+	if s == nil {
+		t.Fatalf("item not in the components: %v", d.Components.Schemas)
+	}
+
+	var names []string
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	if len(names) != 9 || s.Properties["secret"] != nil || s.Properties["Secret"] != nil || s.Properties["internal"] != nil {
+		t.Errorf("properties %v", names)
+	}
+	// Embedded structs are flattened
+	if s.Properties["id"].Type != "string" || s.Properties["created"].Format != "date-time" {
+		t.Errorf("embedded fields: %+v, %+v", s.Properties["id"], s.Properties["created"])
+	}
+	if s.Properties["timeout"].Type != "integer" || s.Properties["count"].Format != "int32" || s.Properties["ratio"].Type != "number" {
+		t.Error("durations and numbers")
+	}
+	// Recursive types are referenced, without siblings
+	if parent := s.Properties["parent"]; parent.Ref != "#/components/schemas/Item" || parent.Nullable {
+		t.Errorf("parent: %+v", parent)
+	}
+	if tags := s.Properties["tags"]; tags.Type != "array" || !tags.Nullable || tags.Items.Type != "string" {
+		t.Errorf("tags: %+v", tags)
+	}
+	if labels := s.Properties["labels"]; labels.Type != "object" || labels.AdditionalProperties.(*Schema).Type != "string" {
+		t.Errorf("labels: %+v", labels)
+	}
+	if s.AdditionalProperties != false {
+		t.Error("undeclared properties allowed")
+	}
+
+	if _, err := json.Marshal(d); err != nil {
+		t.Errorf("document does not encode: %v", err)
+	}
+}
+
+func TestOperation(t *testing.T) {
+	d := newDocument()
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/items/new", "/items/new"}, // Literal segments win over wildcards
+		{http.MethodGet, "/items/a%2Fb", "/items/{id}"},
+		{http.MethodGet, "/items/a/events", "/items/{id}/events"},
+		{http.MethodGet, "/items/a/b", ""},
+		{http.MethodPost, "/items/a", ""},
+	}
+	for _, tt := range tests {
+		if _, template := d.Operation(tt.method, tt.path); template != tt.want {
+			t.Errorf("%s %s: %q, want %q", tt.method, tt.path, template, tt.want)
+		}
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	d := newDocument()
+	tests := []struct {
+		name, path  string
+		status      int
+		contentType string
+		body        string
+		problem     string // Empty if valid
+	}{
+		{"valid", "/items/a", 200, "application/json", `{"id":"a","name":"A","timeout":60000000000,"tags":null,"parent":{"id":"p"}}`, ""},
+		{"wrong types", "/items/a", 200, "application/json", `{"id":1,"timeout":1.5,"tags":[true],"labels":{"a":2}}`,
+			"$.id: expected a string; $.labels.a: expected a string; $.tags[0]: expected a string; $.timeout: expected an integer"},
+		{"undeclared property", "/items/a", 200, "application/json", `{"parent":{"extra":1}}`, "$.parent.extra: undeclared property"},
+		{"null", "/items/a", 200, "application/json", `{"name":null}`, "$.name: null, expected string"},
+		{"invalid JSON", "/items/a", 200, "application/json", `{`, "invalid JSON body"},
+		{"content type", "/items/a", 200, "text/html", `<p>`, `content type "text/html" is not declared`},
+		{"no body declared", "/items/a", 204, "", "", ""},
+		{"unexpected body", "/items/a", 204, "text/plain", "x", "declares no body"},
+		{"default response", "/items/a", 500, "text/plain; charset=utf-8", "oops", ""},
+		{"undeclared status", "/items/new", 404, "text/plain", "", "status 404 is not declared"},
+		{"undeclared path", "/other", 200, "application/json", `{}`, "is not declared"},
+		{"stream", "/items/a/events", 200, "text/event-stream", "data: {}\n\n", ""},
+	}
+	for _, tt := range tests {
+		err := d.ValidateResponse(http.MethodGet, tt.path, tt.status, tt.contentType, []byte(tt.body))
+		if tt.problem == "" && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.problem != "" && (err == nil || !strings.Contains(err.Error(), tt.problem)) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.problem)
+		}
+	}
+}
+
+func TestMiddlewareSendsResponsesUnchanged(t *testing.T) {
+	d := newDocument()
+	handler := Middleware(d, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"undeclared":true}`))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/a", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"undeclared":true}` {
+		t.Errorf("%d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,230 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"smart-proxy/internal/logger"
+)
+
+var log = logger.Component("openapi")
+
+// maxRecordedBody bounds the responses the middleware checks; larger ones are only checked for their status.
+const maxRecordedBody = 1 << 20
+
+// Operation returns the operation of the document matching a request method and path, with its path template.
+func (d *Document) Operation(method, path string) (*Operation, string) {
+	// Literal segments win over wildcards, as with http.ServeMux: try the templates with most literal text first
+	templates := make([]string, 0, len(d.Paths))
+	for template := range d.Paths {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		li, lj := len(wildcard.ReplaceAllString(templates[i], "")), len(wildcard.ReplaceAllString(templates[j], ""))
+		if li != lj {
+			return li > lj
+		}
+		return templates[i] < templates[j]
+	})
+	for _, template := range templates {
+		if templatePattern(template).MatchString(path) {
+			if op := d.Paths[template][strings.ToLower(method)]; op != nil {
+				return op, template
+			}
+		}
+	}
+	return nil, ""
+}
+
+var wildcard = regexp.MustCompile(`\{[^}/]+\}`)
+
+// templatePattern matches the paths of a template such as /routes/{id} or /resources/{kind}/{name}:patch.
+func templatePattern(template string) *regexp.Regexp {
+	parts := wildcard.Split(template, -1)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, "[^/]+") + "$")
+}
+
+// ValidateResponse checks a response against the document: the operation must be declared for the method and
+// path (the escaped request path), the status among its responses, and the body must match the schema of
+// its content type. Streams (text/event-stream) are only checked for their status.
+func (d *Document) ValidateResponse(method, path string, status int, contentType string, body []byte) error {
+	op, template := d.Operation(method, path)
+	if op == nil {
+		return fmt.Errorf("%s %s is not declared", method, path)
+	}
+	response := op.Responses[strconv.Itoa(status)]
+	if response == nil {
+		response = op.Responses["default"]
+	}
+	if response == nil {
+		return fmt.Errorf("%s %s: status %d is not declared", method, template, status)
+	}
+	if len(response.Content) == 0 {
+		if len(bytes.TrimSpace(body)) > 0 {
+			return fmt.Errorf("%s %s: status %d declares no body", method, template, status)
+		}
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	content, ok := response.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s %s: content type %q is not declared for status %d", method, template, contentType, status)
+	}
+	if content.Schema == nil || mediaType == "text/event-stream" || !strings.HasSuffix(mediaType, "json") {
+		return nil
+	}
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("%s %s: invalid JSON body: %v", method, template, err)
+	}
+	var problems []string
+	d.check(content.Schema, value, "$", &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("%s %s: status %d: %s", method, template, status, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// check validates a JSON value against a schema, adding what does not match to problems.
+func (d *Document) check(schema *Schema, value interface{}, path string, problems *[]string) {
+	if len(*problems) >= 10 {
+		return
+	}
+	if schema.Ref != "" {
+		resolved := d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if resolved == nil {
+			*problems = append(*problems, fmt.Sprintf("%s: unknown schema %s", path, schema.Ref))
+			return
+		}
+		schema = resolved
+	}
+	if value == nil {
+		if !schema.Nullable && schema.Type != "" {
+			*problems = append(*problems, fmt.Sprintf("%s: null, expected %s", path, schema.Type))
+		}
+		return
+	}
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		*problems = append(*problems, fmt.Sprintf("%s: %v is not one of %v", path, value, schema.Enum))
+	}
+
+	switch schema.Type {
+	case "":
+		// Anything
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected an object", path))
+			return
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, ok := schema.Properties[key]; ok {
+				d.check(property, object[key], path+"."+key, problems)
+			} else if additional, ok := schema.AdditionalProperties.(*Schema); ok {
+				d.check(additional, object[key], path+"."+key, problems)
+			} else if schema.AdditionalProperties == false {
+				*problems = append(*problems, fmt.Sprintf("%s.%s: undeclared property", path, key))
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected an array", path))
+			return
+		}
+		for i, item := range array {
+			d.check(schema.Items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected a string", path))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected a boolean", path))
+		}
+	case "integer":
+		if n, ok := value.(json.Number); !ok || strings.ContainsAny(n.String(), ".eE") {
+			*problems = append(*problems, fmt.Sprintf("%s: expected an integer", path))
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected a number", path))
+		}
+	}
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, v := range enum {
+		if fmt.Sprint(v) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware checks the responses of next against the document and logs those that do not match as contract
+// violations. Responses are sent unchanged: it is meant for development, end-to-end tests and staging.
+func Middleware(d *Document, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.truncated {
+			return
+		}
+		if op, _ := d.Operation(r.Method, r.URL.EscapedPath()); op == nil && (rec.status == http.StatusNotFound || rec.status == http.StatusMethodNotAllowed) {
+			return // Unknown path or method, answered by the mux
+		}
+		err := d.ValidateResponse(r.Method, r.URL.EscapedPath(), rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes())
+		if err != nil {
+			log.WarnContext(r.Context(), "Response does not match the OpenAPI document", "error", err)
+		}
+	})
+}
+
+// recorder keeps a copy of the response it writes.
+type recorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.body.Len()+len(p) > maxRecordedBody {
+		r.truncated = true
+	} else if !r.truncated {
+		r.body.Write(p)
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Flush lets event streams through.
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,626 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-proxy/internal/auth"
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+)
+
+// oidcCallbackPath receives the authorization code from the identity provider.
+const oidcCallbackPath = "/__smart_proxy/oidc/callback"
+
+// Identity headers sent upstream when AccessPolicy.ForwardIdentity is set.
+// They are always stripped from incoming requests on protected routes so clients cannot spoof them.
+var identityHeaders = []string{"X-Forwarded-User", "X-Forwarded-Email", "X-Forwarded-Groups"}
+
+// secretTTL is how long Secrets used by access policies are cached.
+const secretTTL = 30 * time.Second
+
+// accessIdentity is the user established by the access checks of a route.
+type accessIdentity struct {
+	User   string   `json:"user"`
+	Email  string   `json:"email,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// accessControl enforces per-route AccessPolicies.
+type accessControl struct {
+	secrets    func(namespace, name string) (map[string][]byte, error)
+	sessionKey []byte
+	trusted    []*net.IPNet // Proxies whose X-Forwarded-For is trusted
+
+	mu          sync.Mutex
+	secretCache map[string]cachedSecret // Key is namespace/name
+	providers   map[string]*auth.OIDC   // Key is issuer|client ID
+}
+
+type cachedSecret struct {
+	data    map[string][]byte
+	expires time.Time
+}
+
+// newAccessControl reads SESSION_SECRET (random if unset, invalidating sessions on restart)
+// and TRUSTED_PROXIES (comma-separated CIDRs allowed to set X-Forwarded-For).
+func newAccessControl(secrets func(namespace, name string) (map[string][]byte, error)) *accessControl {
+	key := []byte(os.Getenv("SESSION_SECRET"))
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+
+	var trusted []*net.IPNet
+	for _, cidr := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		if ipNet := parseCIDR(cidr); ipNet != nil {
+			trusted = append(trusted, ipNet)
+		} else {
+			log.Warn("Ignoring invalid TRUSTED_PROXIES entry", "cidr", cidr)
+		}
+	}
+
+	return &accessControl{
+		secrets:     secrets,
+		sessionKey:  key,
+		trusted:     trusted,
+		secretCache: make(map[string]cachedSecret),
+		providers:   make(map[string]*auth.OIDC),
+	}
+}
+
+// check enforces the route's policy. It writes the rejection (or login redirect) itself and
+// returns false if the request must not proceed; in that case nothing may be woken up.
+func (a *accessControl) check(w http.ResponseWriter, r *http.Request, route *store.RouteConfig) (*accessIdentity, bool) {
+	policy := route.Access
+	if policy == nil {
+		return nil, true
+	}
+
+	if !a.ipAllowed(policy, a.clientIP(r)) {
+		log.WarnContext(r.Context(), "Access denied: IP not allowed", "client_ip", a.clientIP(r).String())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	var identity *accessIdentity
+	if policy.BasicAuth != nil {
+		user, ok := a.checkBasicAuth(r, route)
+		if !ok {
+			realm := policy.BasicAuth.Realm
+			if realm == "" {
+				realm = "Restricted"
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return nil, false
+		}
+		identity = &accessIdentity{User: user}
+	}
+
+	if policy.OIDC != nil {
+		session, ok := a.readSession(r, route)
+		if !ok {
+			a.startLogin(w, r, route)
+			return nil, false
+		}
+		identity = session
+	}
+
+	return identity, true
+}
+
+// prepareUpstream strips client-supplied identity headers and the session cookie,
+// then forwards the established identity if the route asks for it.
+func (a *accessControl) prepareUpstream(r *http.Request, route *store.RouteConfig, identity *accessIdentity) {
+	if route.Access == nil {
+		return
+	}
+	for _, h := range identityHeaders {
+		r.Header.Del(h)
+	}
+	if route.Access.OIDC != nil {
+		removeCookie(r, sessionCookieName(route))
+	}
+	if route.Access.ForwardIdentity && identity != nil {
+		r.Header.Set("X-Forwarded-User", identity.User)
+		if identity.Email != "" {
+			r.Header.Set("X-Forwarded-Email", identity.Email)
+		}
+		if len(identity.Groups) > 0 {
+			r.Header.Set("X-Forwarded-Groups", strings.Join(identity.Groups, ","))
+		}
+	}
+}
+
+// IP allow/deny lists
+
+// clientIP returns the caller's IP. X-Forwarded-For is only honoured when the direct peer
+// is a trusted proxy, and then the right-most untrusted address is used.
+func (a *accessControl) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !a.isTrusted(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !a.isTrusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func (a *accessControl) isTrusted(ip net.IP) bool {
+	for _, n := range a.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *accessControl) ipAllowed(policy *store.AccessPolicy, ip net.IP) bool {
+	if len(policy.AllowCIDRs) == 0 && len(policy.DenyCIDRs) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	if matchesCIDRs(policy.DenyCIDRs, ip) {
+		return false
+	}
+	return len(policy.AllowCIDRs) == 0 || matchesCIDRs(policy.AllowCIDRs, ip)
+}
+
+func matchesCIDRs(cidrs []string, ip net.IP) bool {
+	for _, cidr := range cidrs {
+		if n := parseCIDR(cidr); n != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDR accepts both CIDRs and single addresses.
+func parseCIDR(s string) *net.IPNet {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil
+	}
+	return n
+}
+
+// Basic auth
+
+func (a *accessControl) checkBasicAuth(r *http.Request, route *store.RouteConfig) (string, bool) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", false
+	}
+
+	data, err := a.secret(route.Namespace, route.Access.BasicAuth.SecretName)
+	if err != nil {
+		log.ErrorContext(r.Context(), "Error reading basic auth secret", "secret", route.Access.BasicAuth.SecretName, "error", err)
+		return "", false
+	}
+
+	// kubernetes.io/basic-auth secrets hold a single user
+	if expectedUser, ok := data["username"]; ok {
+		userOK := subtle.ConstantTimeCompare(expectedUser, []byte(user)) == 1
+		passOK := subtle.ConstantTimeCompare(data["password"], []byte(password)) == 1
+		return user, userOK && passOK
+	}
+
+	expected, exists := data[user]
+	if !exists {
+		return "", false
+	}
+	return user, subtle.ConstantTimeCompare(expected, []byte(password)) == 1
+}
+
+func (a *accessControl) secret(namespace, name string) (map[string][]byte, error) {
+	key := namespace + "/" + name
+	a.mu.Lock()
+	if cached, ok := a.secretCache[key]; ok && time.Now().Before(cached.expires) {
+		a.mu.Unlock()
+		return cached.data, nil
+	}
+	a.mu.Unlock()
+
+	data, err := a.secrets(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.secretCache[key] = cachedSecret{data: data, expires: time.Now().Add(secretTTL)}
+	a.mu.Unlock()
+	return data, nil
+}
+
+// OIDC login flow
+
+// loginState is carried through the identity provider in the signed "state" parameter.
+type loginState struct {
+	RouteID  string `json:"route_id"`
+	Return   string `json:"return"`
+	Nonce    string `json:"nonce"`
+	Redirect string `json:"redirect_uri"`
+	Expires  int64  `json:"exp"`
+}
+
+// session is the payload of the signed session cookie.
+type session struct {
+	accessIdentity
+	RouteID string `json:"route_id"`
+	Expires int64  `json:"exp"`
+}
+
+// nonceCookie binds the login to the browser that started it.
+const nonceCookie = "smart_proxy_oidc_nonce"
+
+func (a *accessControl) provider(config *store.OIDCAccessConfig) *auth.OIDC {
+	key := config.IssuerURL + "|" + config.ClientID
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if p, ok := a.providers[key]; ok {
+		return p
+	}
+	p := auth.NewOIDC(auth.OIDCConfig{IssuerURL: config.IssuerURL, ClientID: config.ClientID})
+	a.providers[key] = p
+	return p
+}
+
+// startLogin redirects page navigations to the identity provider. Other requests (APIs, XHR,
+// the status poll) get a plain 401 since they cannot follow the login round-trip.
+func (a *accessControl) startLogin(w http.ResponseWriter, r *http.Request, route *store.RouteConfig) {
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	config := route.Access.OIDC
+	discovery, err := a.provider(config).Discovery()
+	if err != nil {
+		log.ErrorContext(r.Context(), "Error discovering OIDC provider", "issuer", config.IssuerURL, "error", err)
+		http.Error(w, "Login unavailable", http.StatusBadGateway)
+		return
+	}
+
+	nonce := randomToken()
+	redirectURI := a.callbackURL(r, config)
+	state, err := a.sign(purposeLogin, loginState{
+		RouteID:  route.ID,
+		Return:   r.URL.RequestURI(),
+		Nonce:    nonce,
+		Redirect: redirectURI,
+		Expires:  time.Now().Add(10 * time.Minute).Unix(),
+	})
+	if err != nil {
+		http.Error(w, "Login unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	scopes := append([]string{"openid", "email", "profile"}, config.Scopes...)
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {config.ClientID},
+		"redirect_uri":  {redirectURI},
+		"scope":         {strings.Join(scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     nonceCookie,
+		Value:    nonce,
+		Path:     oidcCallbackPath,
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   a.requestScheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, discovery.AuthorizationEndpoint+"?"+params.Encode(), http.StatusFound)
+}
+
+// handleCallback completes the login: it exchanges the code, verifies the ID token,
+// applies the group/email restrictions and sets the session cookie.
+func (a *accessControl) handleCallback(w http.ResponseWriter, r *http.Request, routes func(id string) (store.RouteConfig, bool)) {
+	var state loginState
+	if err := a.verify(purposeLogin, r.URL.Query().Get("state"), &state); err != nil || time.Now().Unix() > state.Expires {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+	nonce, err := r.Cookie(nonceCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(nonce.Value), []byte(state.Nonce)) != 1 {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	route, ok := routes(state.RouteID)
+	if !ok || route.Access == nil || route.Access.OIDC == nil {
+		http.Error(w, "Unknown route", http.StatusBadRequest)
+		return
+	}
+	config := route.Access.OIDC
+	ctx := logger.WithRouteID(r.Context(), route.ID)
+	if errMsg := r.URL.Query().Get("error"); errMsg != "" {
+		http.Error(w, "Login failed: "+errMsg, http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := a.exchangeCode(r, &route, state)
+	if err != nil {
+		log.WarnContext(ctx, "OIDC login failed", "error", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+	if n, _ := claims["nonce"].(string); n != state.Nonce {
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	identity := identityFromClaims(claims)
+	if !allowedIdentity(config, identity) {
+		log.WarnContext(ctx, "OIDC user is not allowed on route", "user", identity.User)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	ttl := config.SessionTTL
+	if ttl <= 0 {
+		ttl = 12 * time.Hour
+	}
+	value, err := a.sign(purposeSession, session{accessIdentity: identity, RouteID: route.ID, Expires: time.Now().Add(ttl).Unix()})
+	if err != nil {
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: nonceCookie, Path: oidcCallbackPath, MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName(&route),
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   a.requestScheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	returnTo := state.Return
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+		returnTo = "/" // Only same-host redirects
+	}
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+func (a *accessControl) exchangeCode(r *http.Request, route *store.RouteConfig, state loginState) (map[string]interface{}, error) {
+	config := route.Access.OIDC
+	provider := a.provider(config)
+	discovery, err := provider.Discovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {r.URL.Query().Get("code")},
+		"redirect_uri": {state.Redirect},
+		"client_id":    {config.ClientID},
+	}
+	if config.ClientSecretName != "" {
+		data, err := a.secret(route.Namespace, config.ClientSecretName)
+		if err != nil {
+			return nil, fmt.Errorf("reading client secret: %w", err)
+		}
+		form.Set("client_secret", string(data["client-secret"]))
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	return provider.Verify(tokens.IDToken)
+}
+
+func identityFromClaims(claims map[string]interface{}) accessIdentity {
+	identity := accessIdentity{}
+	identity.Email, _ = claims["email"].(string)
+	identity.User, _ = claims["preferred_username"].(string)
+	if identity.User == "" {
+		identity.User = identity.Email
+	}
+	if identity.User == "" {
+		identity.User, _ = claims["sub"].(string)
+	}
+	if groups, ok := claims["groups"].([]interface{}); ok {
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	}
+	return identity
+}
+
+// allowedIdentity applies the group and email restrictions; with none configured any login is accepted.
+func allowedIdentity(config *store.OIDCAccessConfig, identity accessIdentity) bool {
+	if len(config.AllowedGroups) == 0 && len(config.AllowedEmails) == 0 {
+		return true
+	}
+	for _, allowed := range config.AllowedGroups {
+		for _, g := range identity.Groups {
+			if g == allowed {
+				return true
+			}
+		}
+	}
+	email := strings.ToLower(identity.Email)
+	for _, allowed := range config.AllowedEmails {
+		allowed = strings.ToLower(allowed)
+		if email != "" && (email == allowed || (strings.HasPrefix(allowed, "@") && strings.HasSuffix(email, allowed))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *accessControl) readSession(r *http.Request, route *store.RouteConfig) (*accessIdentity, bool) {
+	cookie, err := r.Cookie(sessionCookieName(route))
+	if err != nil {
+		return nil, false
+	}
+	var s session
+	if err := a.verify(purposeSession, cookie.Value, &s); err != nil {
+		return nil, false
+	}
+	if s.RouteID != route.ID || time.Now().Unix() > s.Expires {
+		return nil, false
+	}
+	return &s.accessIdentity, true
+}
+
+// sessionCookieName is unique per route so routes sharing a host keep separate sessions.
+func sessionCookieName(route *store.RouteConfig) string {
+	sum := sha256.Sum256([]byte(route.ID))
+	return "smart_proxy_session_" + hex.EncodeToString(sum[:4])
+}
+
+// Purposes of signed values. The purpose is part of the signature, so that a value signed for one use, e.g. the
+// login state handed to anyone starting a login, is rejected for another, e.g. as a session.
+const (
+	purposeLogin    = "oidc-state"
+	purposeSession  = "session"
+	purposeWake     = "wake"
+	purposeWakeLink = "wake-link"
+)
+
+// Signed values: base64(JSON) + "." + base64(HMAC-SHA256(purpose + NUL + JSON))
+
+func (a *accessControl) sign(purpose string, v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(a.mac(purpose, payload)), nil
+}
+
+func (a *accessControl) mac(purpose string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, a.sessionKey)
+	mac.Write([]byte(purpose))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// verify checks that value was signed for purpose and decodes it into v.
+func (a *accessControl) verify(purpose, value string, v interface{}) error {
+	payloadB64, sigB64, ok := strings.Cut(value, ".")
+	if !ok {
+		return fmt.Errorf("malformed value")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadB64)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigB64)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(sig, a.mac(purpose, payload)) {
+		return fmt.Errorf("bad signature")
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// requestScheme returns the scheme the client used. X-Forwarded-Proto is only honoured from trusted proxies.
+func (a *accessControl) requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil && a.isTrusted(ip) && r.Header.Get("X-Forwarded-Proto") == "https" {
+		return "https"
+	}
+	return "http"
+}
+
+// callbackURL returns the redirect URI of a login: the configured one, else the callback path on the requested
+// host. Routes matching any host should configure it, since the Host header is chosen by the client.
+func (a *accessControl) callbackURL(r *http.Request, config *store.OIDCAccessConfig) string {
+	if config.RedirectURL != "" {
+		return config.RedirectURL
+	}
+	return a.requestScheme(r) + "://" + r.Host + oidcCallbackPath
+}
+
+// removeCookie drops a cookie from the request before it is proxied.
+func removeCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+}
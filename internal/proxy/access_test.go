@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/store"
+)
+
+func TestSignedValuesAreBoundToTheirPurpose(t *testing.T) {
+	a := newAccessControl(nil)
+	purposes := []string{purposeLogin, purposeSession, purposeWake, purposeWakeLink}
+	payload := struct {
+		RouteID string `json:"route_id"`
+		Expires int64  `json:"exp"`
+	}{"shop", time.Now().Add(time.Hour).Unix()}
+
+	for _, signedFor := range purposes {
+		value, err := a.sign(signedFor, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, usedFor := range purposes {
+			var decoded struct {
+				RouteID string `json:"route_id"`
+			}
+			err := a.verify(usedFor, value, &decoded)
+			if usedFor == signedFor && (err != nil || decoded.RouteID != "shop") {
+				t.Errorf("%s value rejected for its own purpose: %v", signedFor, err)
+			}
+			if usedFor != signedFor && err == nil {
+				t.Errorf("%s value accepted as %s", signedFor, usedFor)
+			}
+		}
+	}
+}
+
+func TestReadSessionRejectsOtherTokens(t *testing.T) {
+	a := newAccessControl(nil)
+	route := &store.RouteConfig{ID: "shop"}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	state, _ := a.sign(purposeLogin, loginState{RouteID: route.ID, Return: "/", Expires: exp})
+	wake, _ := a.sign(purposeWake, wakeToken{RouteID: route.ID, Expires: exp})
+	link, _ := a.sign(purposeWakeLink, wakeLinkToken{RouteID: route.ID, LinkID: "l", Expires: exp, Rate: 10})
+	valid, _ := a.sign(purposeSession, session{accessIdentity: accessIdentity{User: "ann"}, RouteID: route.ID, Expires: exp})
+
+	for name, value := range map[string]string{"login state": state, "wake token": wake, "wake link token": link} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: sessionCookieName(route), Value: value})
+		if _, ok := a.readSession(r, route); ok {
+			t.Errorf("%s accepted as a session", name)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookieName(route), Value: valid})
+	if identity, ok := a.readSession(r, route); !ok || identity.User != "ann" {
+		t.Errorf("valid session rejected")
+	}
+}
+
+func TestWakeEndpointsRejectOtherTokens(t *testing.T) {
+	s := store.NewStore(filepath.Join(t.TempDir(), "routes.json"))
+	s.AddRoute(&store.RouteConfig{ID: "shop", Path: "/", Namespace: "shop", Deployment: "web"})
+	h := NewHandler(nil, s)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	state, _ := h.access.sign(purposeLogin, loginState{RouteID: "shop", Return: "/", Expires: exp})
+	sess, _ := h.access.sign(purposeSession, session{RouteID: "shop", Expires: exp})
+	wake, _ := h.access.sign(purposeWake, wakeToken{RouteID: "shop", Expires: exp})
+	link, _ := h.access.sign(purposeWakeLink, wakeLinkToken{RouteID: "shop", LinkID: "l", Expires: exp, Rate: 10})
+
+	post := func(path, token string) int {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(url.Values{"token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if path == wakePath {
+			h.handleWake(w, r)
+		} else {
+			h.handleWakeLink(w, r)
+		}
+		return w.Code
+	}
+	for name, token := range map[string]string{"login state": state, "session": sess, "wake link token": link} {
+		if code := post(wakePath, token); code != http.StatusBadRequest {
+			t.Errorf("%s redeemed at %s: %d", name, wakePath, code)
+		}
+	}
+	for name, token := range map[string]string{"login state": state, "session": sess, "wake token": wake} {
+		if code := post(wakeLinkPath, token); code != http.StatusBadRequest {
+			t.Errorf("%s redeemed at %s: %d", name, wakeLinkPath, code)
+		}
+	}
+}
+
+func TestWakeLinkVisitOnlyAsksToConfirm(t *testing.T) {
+	s := store.NewStore(filepath.Join(t.TempDir(), "routes.json"))
+	s.AddRoute(&store.RouteConfig{ID: "shop", Host: "shop.example.com", Path: "/", Namespace: "shop", Deployment: "web"})
+	// In maintenance the route is not woken, which needs no cluster; the link is still used
+	s.SetMode("shop", &store.RouteMode{State: store.ModeMaintenance})
+	h := NewHandler(nil, s)
+	link, err := h.NewWakeLink("shop", time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := url.ParseQuery(strings.TrimPrefix(link.Path, wakeLinkPath+"?"))
+
+	visit := func(method string) *httptest.ResponseRecorder {
+		var r *http.Request
+		if method == http.MethodPost {
+			r = httptest.NewRequest(method, "http://shop.example.com"+wakeLinkPath, strings.NewReader(token.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			r = httptest.NewRequest(method, "http://shop.example.com"+link.Path, nil)
+		}
+		w := httptest.NewRecorder()
+		h.handleWakeLink(w, r)
+		return w
+	}
+
+	// Link previews and crawlers only GET the link
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodGet} {
+		w := visit(method)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", method, w.Code, w.Body)
+		}
+		if method == http.MethodGet && (!strings.Contains(w.Body.String(), `<form id="verify" method="post" action="/__smart_proxy/wake-link">`) ||
+			!strings.Contains(w.Body.String(), `name="token"`)) {
+			t.Errorf("no confirmation form:\n%s", w.Body)
+		}
+	}
+	if route, _ := s.GetRoute("shop"); !route.LastActivity.IsZero() {
+		t.Error("visiting the link counted as activity")
+	}
+
+	if w := visit(http.MethodPost); w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+		t.Errorf("confirmation: %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := visit(http.MethodPost); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second confirmation within the rate of 1: %d", w.Code)
+	}
+	if w := visit(http.MethodPut); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT: %d", w.Code)
+	}
+}
+
+func TestLoginRedirectURI(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	a := newAccessControl(nil)
+	config := &store.OIDCAccessConfig{IssuerURL: "https://login.example.com", ClientID: "shop"}
+
+	tests := []struct {
+		remote, proto, want string
+	}{
+		{"10.1.2.3:4000", "https", "https://shop.example.com/__smart_proxy/oidc/callback"},
+		{"10.1.2.3:4000", "", "http://shop.example.com/__smart_proxy/oidc/callback"},
+		{"203.0.113.5:4000", "https", "http://shop.example.com/__smart_proxy/oidc/callback"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://shop.example.com/", nil)
+		r.RemoteAddr = tt.remote
+		r.Header.Set("X-Forwarded-Proto", tt.proto)
+		if got := a.callbackURL(r, config); got != tt.want {
+			t.Errorf("from %s with %q: %s, want %s", tt.remote, tt.proto, got, tt.want)
+		}
+	}
+
+	config.RedirectURL = "https://shop.example.com/__smart_proxy/oidc/callback"
+	r := httptest.NewRequest(http.MethodGet, "http://evil.example.com/", nil)
+	if got := a.callbackURL(r, config); got != config.RedirectURL {
+		t.Errorf("configured redirect URL ignored: %s", got)
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-proxy/internal/k8s"
+	"smart-proxy/internal/store"
+)
+
+// diagnoseInterval is how long the diagnostics of a route are reused: every open loading page asks for
+// them, and they cost a few API server calls per deployment.
+const diagnoseInterval = 5 * time.Second
+
+// diagnosisCache keeps the latest diagnostics of each waking route.
+type diagnosisCache struct {
+	mu      sync.Mutex
+	entries map[string]diagnosisEntry // Key: Route ID
+}
+
+type diagnosisEntry struct {
+	at          time.Time
+	diagnostics []k8s.Diagnosis
+}
+
+func newDiagnosisCache() *diagnosisCache {
+	return &diagnosisCache{entries: make(map[string]diagnosisEntry)}
+}
+
+// diagnose returns the problems keeping the deployments of a route from becoming ready, empty if none
+// was found. Ready and sleeping deployments are skipped.
+func (h *Handler) diagnose(ctx context.Context, route store.RouteConfig) []k8s.Diagnosis {
+	h.diagnoses.mu.Lock()
+	entry, ok := h.diagnoses.entries[route.ID]
+	h.diagnoses.mu.Unlock()
+	if ok && time.Since(entry.at) < diagnoseInterval {
+		return entry.diagnostics
+	}
+
+	var diagnostics []k8s.Diagnosis
+	for _, target := range chainTargets(route) {
+		replicas, readyReplicas, err := h.k8sClient.GetDeploymentStatus(ctx, target.Namespace, target.Name)
+		if err != nil || replicas == 0 || readyReplicas >= replicas {
+			continue
+		}
+		found, err := h.k8sClient.DiagnoseDeployment(ctx, target.Namespace, target.Name)
+		if err != nil {
+			log.DebugContext(ctx, "Could not diagnose deployment", "deployment", target.Name, "error", err)
+		}
+		diagnostics = append(diagnostics, found...)
+	}
+
+	h.diagnoses.mu.Lock()
+	defer h.diagnoses.mu.Unlock()
+	for id, e := range h.diagnoses.entries {
+		if time.Since(e.at) >= diagnoseInterval {
+			delete(h.diagnoses.entries, id)
+		}
+	}
+	h.diagnoses.entries[route.ID] = diagnosisEntry{at: time.Now(), diagnostics: diagnostics}
+	return diagnostics
+}
+
+// diagnosisSummary describes diagnostics in one line, for logs, events and notifications.
+func diagnosisSummary(diagnostics []k8s.Diagnosis) string {
+	parts := make([]string, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		part := fmt.Sprintf("%s/%s: %s", d.Namespace, d.Deployment, d.Reason)
+		if d.Message != "" {
+			part += " (" + d.Message + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// routeWakeTimeout returns the wake timeout of a route.
+func (h *Handler) routeWakeTimeout(route store.RouteConfig) time.Duration {
+	if route.WakeTimeout > 0 {
+		return route.WakeTimeout
+	}
+	return h.wakeTimeout
+}
@@ -1,245 +1,400 @@
 // Package proxy implements the reverse proxy logic, including route matching,
-// idle detection, and response modification (e.g., badge injection).
+// idle detection, and response modification (e.g., badge injection and transforms).
 package proxy
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"html/template"
-	"io"
-	"log"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"smart-proxy/internal/accesslog"
+	"smart-proxy/internal/events"
 	"smart-proxy/internal/k8s"
 	"smart-proxy/internal/logger"
+	"smart-proxy/internal/metrics"
+	"smart-proxy/internal/notify"
+	"smart-proxy/internal/savings"
 	"smart-proxy/internal/store"
+	"smart-proxy/internal/stream"
+	"smart-proxy/internal/timeseries"
+	"smart-proxy/internal/tracing"
+	"smart-proxy/internal/transform"
+
+	"github.com/google/uuid"
 )
 
+var log = logger.Component("proxy")
+
+// requestIDHeader correlates a request across the proxy logs, the upstream and the client.
+const requestIDHeader = "X-Request-ID"
+
 type Handler struct {
-	k8sClient *k8s.Client
-	store     *store.Store
-	tmpl      *template.Template
-	Metrics   *Metrics
+	k8sClient  *k8s.Client
+	store      *store.Store
+	pages      *pageStore
+	access     *accessControl
+	wake       *wakeFilter
+	wakeLinks  *wakeLinkLimiter
+	progress   *progressHub
+	diagnoses  *diagnosisCache
+	transforms *transformCache
+	Metrics    *Metrics
+	AccessLog  *accesslog.Logger // Optional
+	Events     *events.Recorder  // Optional
+	Notifier   *notify.Notifier  // Optional
+	Savings    *savings.Tracker  // Optional
+	Traffic    *timeseries.DB    // Optional
+	Stream     *stream.Hub       // Optional
+
+	wakeTimeout      time.Duration // After which a woken route that is still not ready fails, unless the route sets its own
+	injectScanLimit  int64         // Bytes of an HTML response searched for </body>
+	transformMaxBody int64         // Largest decoded body transformed, unless a transform sets its own
 }
 
+// defaultWakeTimeout applies when WAKE_TIMEOUT is unset.
+const defaultWakeTimeout = 5 * time.Minute
+
 func NewHandler(k8sClient *k8s.Client, store *store.Store) *Handler {
-	tmpl, err := template.ParseFiles("web/templates/loading.html")
-	if err != nil {
-		logger.Printf("Warning: Could not parse loading template: %v", err)
+	pagesDir := os.Getenv("PAGE_TEMPLATES_DIR")
+	if pagesDir == "" {
+		pagesDir = "web/templates"
 	}
 
-	return &Handler{
+	h := &Handler{
 		k8sClient: k8sClient,
 		store:     store,
-		tmpl:      tmpl,
-		Metrics:   NewMetrics(),
+		pages: newPageStore(pagesDir, func(namespace, name string) (map[string]string, string, error) {
+			if k8sClient == nil {
+				return nil, "", fmt.Errorf("k8s client not initialized")
+			}
+			cm, err := k8sClient.GetConfigMap(namespace, name)
+			if err != nil {
+				return nil, "", err
+			}
+			return cm.Data, cm.ResourceVersion, nil
+		}),
+		access: newAccessControl(func(namespace, name string) (map[string][]byte, error) {
+			if k8sClient == nil {
+				return nil, fmt.Errorf("k8s client not initialized")
+			}
+			return k8sClient.GetSecret(namespace, name)
+		}),
+		wake:             newWakeFilter(),
+		wakeLinks:        newWakeLinkLimiter(),
+		progress:         newProgressHub(),
+		diagnoses:        newDiagnosisCache(),
+		transforms:       newTransformCache(),
+		Metrics:          NewMetrics(),
+		wakeTimeout:      defaultWakeTimeout,
+		injectScanLimit:  defaultInjectScanLimit,
+		transformMaxBody: transform.DefaultMaxBodyBytes,
 	}
-}
-
-type Metrics struct {
-	TotalRequests int64
-	RouteStats    map[string]int64 // Key: Route ID
-}
-
-func NewMetrics() *Metrics {
-	return &Metrics{
-		RouteStats: make(map[string]int64),
+	if s := os.Getenv("WAKE_TIMEOUT"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 {
+			h.wakeTimeout = d
+		} else {
+			log.Warn("Ignoring invalid WAKE_TIMEOUT", "value", s)
+		}
 	}
+	if s := os.Getenv("INJECT_MAX_SCAN_BYTES"); s != "" {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+			h.injectScanLimit = n
+		} else {
+			log.Warn("Ignoring invalid INJECT_MAX_SCAN_BYTES", "value", s)
+		}
+	}
+	if s := os.Getenv("TRANSFORM_MAX_BODY_BYTES"); s != "" {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+			h.transformMaxBody = n
+		} else {
+			log.Warn("Ignoring invalid TRANSFORM_MAX_BODY_BYTES", "value", s)
+		}
+	}
+	metrics.Default.OnScrape(h.updateRouteStates)
+	return h
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Continue the caller's trace, if any
+	ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "proxy.request",
+		tracing.WithKind(tracing.KindServer), tracing.WithAttributes(
+			tracing.String("http.method", r.Method), tracing.String("http.host", r.Host), tracing.String("http.target", r.URL.Path)))
+	defer span.End()
+
+	// Reuse the caller's request ID, if any, so that logs can be correlated end to end
+	requestID := requestIDFrom(r)
+	r.Header.Set(requestIDHeader, requestID)
+	w.Header().Set(requestIDHeader, requestID)
+	ctx = logger.WithRequestID(ctx, requestID)
+	r = r.WithContext(ctx)
+
+	// Record the request once it has been served, whatever the outcome
+	start := time.Now()
+	rec := &responseRecorder{ResponseWriter: w}
+	body := &countingReader{ReadCloser: r.Body}
+	w, r.Body = rec, body
+	var (
+		routeID, upstreamHost, user string
+		woke, special               bool
+	)
+	defer func() {
+		elapsed := time.Since(start)
+		if !special { // The request metrics only count route traffic
+			observeRequest(routeID, r, rec, body, elapsed)
+			h.Traffic.Record(routeID, rec.status(), elapsed)
+		}
+		span.SetHTTPStatus(rec.status())
+		if h.AccessLog == nil {
+			return
+		}
+		var clientIP string
+		if ip := h.access.clientIP(r); ip != nil {
+			clientIP = ip.String()
+		}
+		h.AccessLog.Log(accesslog.Entry{
+			Time:      start,
+			RequestID: requestID,
+			ClientIP:  clientIP,
+			User:      user,
+			Method:    r.Method,
+			Host:      r.Host,
+			URI:       r.RequestURI,
+			Proto:     r.Proto,
+			Status:    rec.status(),
+			Bytes:     rec.bytes,
+			Duration:  elapsed,
+			RouteID:   routeID,
+			Upstream:  upstreamHost,
+			Woke:      woke,
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		})
+	}()
+
 	// Special Endpoint: Status Check
 	if r.URL.Path == "/__smart_proxy/status" {
+		special = true
 		h.handleStatusCheck(w, r)
 		return
 	}
 
-	// 1. Match Route (Host + Path)
-	var matchedRoute store.RouteConfig
-	var matchedPath string
-	found := false
-
-	routes := h.store.GetAllRoutes()
-	for _, route := range routes {
-		// Host matching: If route.Host is set, it MUST match the request host.
-		// If route.Host is empty, it matches any host (legacy behavior or catch-all).
-		requestHost := r.Host
-		if strings.Contains(requestHost, ":") {
-			host, _, err := net.SplitHostPort(requestHost)
-			if err == nil {
-				requestHost = host
-			}
-		}
-		hostMatches := route.Host == "" || route.Host == requestHost
-
-		if hostMatches && strings.HasPrefix(r.URL.Path, route.Path) {
-			// Priority:
-			// 1. Longer Path wins
-			// 2. Specific Host wins over empty Host (if paths are same length)
+	// Special Endpoint: human verification for routes with WakePolicy.RequireHuman
+	if r.URL.Path == wakePath {
+		special = true
+		routeID, woke = h.handleWake(w, r)
+		return
+	}
 
-			isBetterMatch := false
-			if !found {
-				isBetterMatch = true
-			} else {
-				if len(route.Path) > len(matchedPath) {
-					isBetterMatch = true
-				} else if len(route.Path) == len(matchedPath) && route.Host != "" && matchedRoute.Host == "" {
-					isBetterMatch = true
-				}
-			}
+	// Special Endpoint: shareable wake links
+	if r.URL.Path == wakeLinkPath {
+		special = true
+		routeID, woke = h.handleWakeLink(w, r)
+		return
+	}
 
-			if isBetterMatch {
-				matchedRoute = route
-				matchedPath = route.Path
-				found = true
-			}
-		}
+	// Special Endpoint: OIDC login callback for protected routes
+	if r.URL.Path == oidcCallbackPath {
+		special = true
+		h.access.handleCallback(w, r, h.store.GetRoute)
+		return
 	}
 
+	// 1. Match Route (Host + Path)
+	_, matchSpan := tracing.Start(ctx, "proxy.match_route")
+	matchedRoute, found := h.matchRoute(r.Host, r.URL.Path)
+	matchSpan.SetAttributes(tracing.Bool("route.matched", found), tracing.String("route.id", matchedRoute.ID))
+	matchSpan.End()
+
 	// If no route matched
 	if !found {
-		http.NotFound(w, r)
+		h.serveNotFound(w, r)
 		return
 	}
 
-	// Update Activity
-	h.store.UpdateActivity(matchedRoute.ID) // Using ID for updates is cleaner if unique, otherwise Path+Host?
-	// Note: Store update logic might need to handle ID. Let's assume Path is still unique-ish or just update based on found route object which has ID.
-	// Actually previous code used matchedPath, but store might rely on Key.
-	// Let's stick to Path for now or update Store to use ID.
-	// For V2, let's assume we pass the Route ID to update activity if possible,
-	// but the Store interface currently takes "path".
-	// Let's rely on the Store implementation to handle unique identification.
-	// If Store uses Path as key, this breaks with Host.
-	// FIXME: Store needs to key by ID or Host+Path.
-	// For this step, I will pass the Path but we should refactor API to use ID.
-	// Hacking it for now:
-	h.store.UpdateActivity(matchedRoute.Path)
-
-	logger.Printf("Request: %s (Host: %s) -> Route: %s (Deps: %v)", r.URL.Path, r.Host, matchedRoute.Deployment, matchedRoute.Dependencies)
+	routeID = matchedRoute.ID
+	span.SetAttributes(tracing.String("route.id", routeID))
+	ctx = logger.WithRouteID(ctx, routeID)
+	r = r.WithContext(ctx)
 
-	// 2. Check Chain Status
-	// We need to check the Main Deployment AND all Dependencies
-	deploymentsToCheck := []string{matchedRoute.Deployment}
-	for _, d := range matchedRoute.Dependencies {
-		deploymentsToCheck = append(deploymentsToCheck, d.Name)
+	// Disabled routes answer as if they did not exist
+	mode := matchedRoute.CurrentMode()
+	if mode == store.ModeDisabled {
+		h.serveDisabled(w, r, matchedRoute)
+		return
 	}
 
-	allReady := true
+	// Enforce the access policy before anything can wake the deployment
+	identity, allowed := h.access.check(w, r, &matchedRoute)
+	if !allowed {
+		return
+	}
+	h.access.prepareUpstream(r, &matchedRoute, identity)
+	if identity != nil {
+		user = identity.User
+	}
 
-	for _, depName := range deploymentsToCheck {
-		// Assume dependencies are in the same namespace for now
-		// In a real V2, deps might be "namespace/name" string.
-		// For simplicity V2.0, same namespace.
-		targetNs := matchedRoute.Namespace
+	// Routes under maintenance are neither proxied nor woken
+	if mode == store.ModeMaintenance {
+		h.serveMaintenance(w, r, matchedRoute)
+		return
+	}
 
-		replicas, readyReplicas, err := h.k8sClient.GetDeploymentStatus(targetNs, depName)
-		if err != nil {
-			log.Printf("Error getting status for %s: %v", depName, err)
-			continue // Don't block everything on status error, or maybe we should?
+	// Requests filtered by the wake policy (bots, noise paths, ...) are served while the
+	// route is awake but never wake it up and never count as activity.
+	if reason := h.wake.filter(r, matchedRoute.WakePolicy); reason != "" {
+		if ready, _ := h.chainState(ctx, matchedRoute); !ready {
+			log.InfoContext(ctx, "Request filtered, not waking", "path", r.URL.Path, "host", r.Host, "deployment", matchedRoute.Deployment, "reason", reason)
+			serveFiltered(w)
+			return
 		}
-
-		if replicas == 0 {
-			logger.Printf("Dependency %s is sleeping. Waking up...", depName)
-			err := h.k8sClient.ScaleDeployment(targetNs, depName, 1)
-			if err != nil {
-				logger.Printf("Error waking up %s: %v", depName, err)
+	} else {
+		// Update Activity
+		h.store.UpdateActivity(matchedRoute.ID) // Using ID for updates is cleaner if unique, otherwise Path+Host?
+		// Note: Store update logic might need to handle ID. Let's assume Path is still unique-ish or just update based on found route object which has ID.
+		// Actually previous code used matchedPath, but store might rely on Key.
+		// Let's stick to Path for now or update Store to use ID.
+		// For V2, let's assume we pass the Route ID to update activity if possible,
+		// but the Store interface currently takes "path".
+		// Let's rely on the Store implementation to handle unique identification.
+		// If Store uses Path as key, this breaks with Host.
+		// FIXME: Store needs to key by ID or Host+Path.
+		// For this step, I will pass the Path but we should refactor API to use ID.
+		// Hacking it for now:
+		h.store.UpdateActivity(matchedRoute.Path)
+
+		log.DebugContext(ctx, "Request", "path", r.URL.Path, "host", r.Host, "deployment", matchedRoute.Deployment, "dependencies", len(matchedRoute.Dependencies))
+
+		// 2. Check Chain Status
+		// We need to check the Main Deployment AND all Dependencies
+		ready, sleeping := h.chainState(ctx, matchedRoute)
+		if !ready {
+			if sleeping && matchedRoute.WakePolicy != nil && matchedRoute.WakePolicy.RequireHuman {
+				h.serveVerificationPage(w, r, matchedRoute)
+				return
 			}
-			allReady = false
-		} else if readyReplicas == 0 {
-			logger.Printf("Dependency %s is waking up...", depName)
-			allReady = false
+			if sleeping {
+				woke = h.wakeChain(ctx, matchedRoute, causeRequest)
+			} else if failure, failed := h.Metrics.Failure(matchedRoute.ID); failed {
+				data := h.pageData(r, matchedRoute)
+				data.Failure = &failure
+				w.Header().Set("Retry-After", "30")
+				h.pages.render(w, http.StatusServiceUnavailable, &matchedRoute, pageFailed, data)
+				return
+			} else {
+				log.InfoContext(ctx, "Route is waking up...")
+			}
+			h.serveLoadingPage(w, r, matchedRoute)
+			return
 		}
-	}
-
-	if !allReady {
-		h.serveLoadingPage(w)
-		return
+		h.routeReady(matchedRoute)
 	}
 
 	// 4. Proxy Request
 	targetURLStr := fmt.Sprintf("http://%s.%s.svc.cluster.local:%d", matchedRoute.TargetService, matchedRoute.Namespace, matchedRoute.TargetPort)
 	targetURL, err := url.Parse(targetURLStr)
 	if err != nil {
-		logger.Printf("Invalid target URL: %v", err)
+		log.ErrorContext(ctx, "Invalid target URL", "error", err)
 		http.Error(w, "Invalid configuration", http.StatusInternalServerError)
 		return
 	}
 
 	// Track Metrics
-	h.Metrics.TotalRequests++
-	if matchedRoute.ID != "" {
-		h.Metrics.RouteStats[matchedRoute.ID]++
-	}
+	h.Metrics.recordRequest(matchedRoute.ID)
 
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
 
-	if matchedRoute.InjectBadge {
+	// Transform responses, then inject snippets in HTML ones, asking only for compressions that can be decoded
+	pipeline, inject := h.transformPipeline(matchedRoute), injects(matchedRoute)
+	if pipeline != nil || inject {
 		proxy.ModifyResponse = func(resp *http.Response) error {
-			if !strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
-				return nil
+			if pipeline != nil {
+				if err := pipeline.Apply(resp); err != nil {
+					return err
+				}
 			}
-
-			// Check for compression (not handling gzip here)
-			if resp.Header.Get("Content-Encoding") != "" {
-				return nil // Skip compressed responses
+			if inject {
+				return h.injectResponse(resp, matchedRoute)
 			}
-
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return err
-			}
-			resp.Body.Close()
-
-			badgeHTML := `
-<div style="position:fixed;bottom:12px;right:12px;display:flex;align-items:center;gap:8px;padding:8px 12px;background:rgba(15, 23, 42, 0.95);border:1px solid rgba(59, 130, 246, 0.5);border-radius:99px;color:#cbd5e1;font-family:'Inter',system-ui,sans-serif;font-size:12px;font-weight:500;box-shadow:0 4px 12px rgba(0,0,0,0.3);z-index:99999;backdrop-filter:blur(8px);pointer-events:none;user-select:none;">
-    <span style="color:#3b82f6;font-size:14px;">⚡</span>
-    <span>Powered by <span style="color:#fff;font-weight:600;">Smart Proxy</span></span>
-</div></body>`
-
-			// Replace closing body tag, or append if not found
-			newBodyStr := strings.Replace(string(body), "</body>", badgeHTML, 1)
-			if !strings.Contains(newBodyStr, "Protected by Smart Proxy") { // Simple check to avoid double inject if replace failed?
-				// Using "Powered by" as check string
-				if !strings.Contains(newBodyStr, "Powered by") {
-					newBodyStr += badgeHTML
-				}
+			return nil
+		}
+		originalDirector := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			originalDirector(req)
+			if accept := transform.AcceptEncoding(req.Header.Get("Accept-Encoding")); accept != "" {
+				req.Header.Set("Accept-Encoding", accept)
+			} else {
+				req.Header.Del("Accept-Encoding")
 			}
+		}
+	}
 
-			buf := bytes.NewBufferString(newBodyStr)
-			resp.Body = io.NopCloser(buf)
-			resp.ContentLength = int64(buf.Len())
-			resp.Header.Set("Content-Length", fmt.Sprint(buf.Len()))
+	// The upstream span covers the whole round trip, including streaming the response body
+	upstreamCtx, upstream := tracing.Start(ctx, "proxy.upstream", tracing.WithKind(tracing.KindClient),
+		tracing.WithAttributes(tracing.String("server.address", targetURL.Host)))
+	tracing.Inject(upstreamCtx, r.Header)
+	upstreamHost = targetURL.Host
+	proxy.ServeHTTP(w, r.WithContext(upstreamCtx))
+	upstream.SetHTTPStatus(rec.status())
+	upstream.End()
+}
 
-			// Disable caching of modified content
-			resp.Header.Del("ETag")
-			resp.Header.Del("Last-Modified")
+// requestIDFrom returns the request ID sent by the client, or a new one if it is missing or unusable.
+func requestIDFrom(r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" || len(id) > 128 {
+		return uuid.NewString()
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return uuid.NewString()
+		}
+	}
+	return id
+}
 
-			return nil
+// stripPort removes the port from a host, if present.
+func stripPort(host string) string {
+	if strings.Contains(host, ":") {
+		if hostOnly, _, err := net.SplitHostPort(host); err == nil {
+			return hostOnly
 		}
 	}
+	return host
+}
 
-	// Force identity encoding to avoid GZIP so we can modify the body
-	if matchedRoute.InjectBadge {
-		// We must modify the transport to not request compression,
-		// OR just strip the header. Stripping header in Director is easiest.
-		// However, httputil.ReverseProxy Director runs *before* we can easily set per-route logic
-		// if we constructed it dynamically?
-		// Actually, we create NewSingleHostReverseProxy here.
+// matchRoute finds the route for a host and path.
+// Priority:
+// 1. Longer Path wins
+// 2. Specific Host wins over empty Host (if paths are same length)
+// If route.Host is empty, it matches any host (legacy behavior or catch-all).
+func (h *Handler) matchRoute(host, path string) (store.RouteConfig, bool) {
+	host = stripPort(host)
 
-		originalDirector := proxy.Director
-		proxy.Director = func(req *http.Request) {
-			originalDirector(req)
-			req.Header.Del("Accept-Encoding") // Force backend to send plain text
+	var matchedRoute store.RouteConfig
+	found := false
+	for _, route := range h.store.GetAllRoutes() {
+		hostMatches := route.Host == "" || route.Host == host
+		if !hostMatches || !strings.HasPrefix(path, route.Path) {
+			continue
 		}
-	}
 
-	proxy.ServeHTTP(w, r)
+		isBetterMatch := !found ||
+			len(route.Path) > len(matchedRoute.Path) ||
+			(len(route.Path) == len(matchedRoute.Path) && route.Host != "" && matchedRoute.Host == "")
+		if isBetterMatch {
+			matchedRoute = route
+			found = true
+		}
+	}
+	return matchedRoute, found
 }
 
 func (h *Handler) handleStatusCheck(w http.ResponseWriter, r *http.Request) {
@@ -255,61 +410,69 @@ func (h *Handler) handleStatusCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find Route (Duplicate logic, ideally refactor finding logic)
-	var matchedRoute store.RouteConfig
-	var matchedPath string
-	found := false
-	routes := h.store.GetAllRoutes()
-	for _, route := range routes {
-		// Fix: Strip port from client-provided host param if present
-		checkHost := host
-		if strings.Contains(checkHost, ":") {
-			h, _, err := net.SplitHostPort(checkHost)
-			if err == nil {
-				checkHost = h
-			}
-		}
+	matchedRoute, found := h.matchRoute(host, path)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	r = r.WithContext(logger.WithRouteID(r.Context(), matchedRoute.ID))
+	if _, allowed := h.access.check(w, r, &matchedRoute); !allowed {
+		return
+	}
 
-		hostMatches := route.Host == "" || route.Host == checkHost
-		if hostMatches && strings.HasPrefix(path, route.Path) {
-			isBetterMatch := false
-			if !found {
-				isBetterMatch = true
-			} else {
-				if len(route.Path) > len(matchedPath) {
-					isBetterMatch = true
-				} else if len(route.Path) == len(matchedPath) && route.Host != "" && matchedRoute.Host == "" {
-					isBetterMatch = true
-				}
-			}
-			if isBetterMatch {
-				matchedRoute = route
-				matchedPath = route.Path
-				found = true
-			}
-		}
+	if r.URL.Query().Get("stream") == "sse" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		h.streamProgress(w, r, matchedRoute)
+		return
 	}
 
-	if !found {
-		http.NotFound(w, r)
+	// The loading page reloads to show the maintenance or not found page
+	if mode, blocked := h.blocked(matchedRoute.ID); blocked {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": mode})
 		return
 	}
 
 	// Check ALL Dependencies
-	deploymentsToCheck := []string{matchedRoute.Deployment}
-	for _, d := range matchedRoute.Dependencies {
-		deploymentsToCheck = append(deploymentsToCheck, d.Name)
+	details, allReady := h.targetStatuses(r.Context(), matchedRoute)
+	if allReady && matchedRoute.WarmupPath != "" {
+		allReady = h.warmUp(r.Context(), matchedRoute)
 	}
-	allReady := true
 
-	type ServiceStatus struct {
-		Name   string `json:"name"`
-		Status string `json:"status"` // Ready, Scaling, Sleep, Error
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]interface{}{
+		"status":  "waiting",
+		"details": details,
+	}
+	if allReady {
+		response["status"] = "ready"
+		h.routeReady(matchedRoute)
+	} else {
+		if diagnostics := h.diagnose(r.Context(), matchedRoute); len(diagnostics) > 0 {
+			response["diagnostics"] = diagnostics
+		}
+		if failure, failed := h.Metrics.Failure(matchedRoute.ID); failed {
+			response["status"] = "failed"
+			response["failure"] = failure
+		}
 	}
-	var details []ServiceStatus
 
-	for _, depName := range deploymentsToCheck {
-		replicas, readyReplicas, err := h.k8sClient.GetDeploymentStatus(matchedRoute.Namespace, depName)
+	json.NewEncoder(w).Encode(response)
+}
+
+// routeReady stops the cold-start timer of a route whose deployments are all ready, and reports the
+// end of the wake-up if one was pending.
+func (h *Handler) routeReady(route store.RouteConfig) {
+	if coldStart, woken := h.Metrics.recordReady(route.ID); woken {
+		h.Notifier.NotifyWakeFinished(route, coldStart)
+		h.Savings.Ready(route.ID, coldStart)
+	}
+}
+
+// targetStatuses returns the status of every deployment of the route, and whether all of them are ready.
+func (h *Handler) targetStatuses(ctx context.Context, route store.RouteConfig) (statuses []stream.TargetInfo, allReady bool) {
+	allReady = true
+	for _, target := range chainTargets(route) {
+		replicas, readyReplicas, err := h.k8sClient.GetDeploymentStatus(ctx, target.Namespace, target.Name)
 		status := "Unknown"
 		if err != nil {
 			status = "Error"
@@ -324,26 +487,137 @@ func (h *Handler) handleStatusCheck(w http.ResponseWriter, r *http.Request) {
 			status = "Ready"
 		}
 
-		details = append(details, ServiceStatus{Name: depName, Status: status})
+		statuses = append(statuses, stream.TargetInfo{Name: target.Label, Status: status})
 	}
+	return statuses, allReady
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	response := map[string]interface{}{
-		"status":  "waiting",
-		"details": details,
+// chainTarget is a deployment that must be running for a route to be served.
+type chainTarget struct {
+	Namespace string
+	Name      string
+	Label     string // Name as configured, possibly "namespace/name"
+}
+
+// chainTargets returns the main deployment of the route followed by its dependencies.
+// Dependencies may live in other namespaces when referenced as "namespace/name".
+func chainTargets(route store.RouteConfig) []chainTarget {
+	targets := []chainTarget{{Namespace: route.Namespace, Name: route.Deployment, Label: route.Deployment}}
+	for _, d := range route.Dependencies {
+		ns, name := d.Target(route.Namespace)
+		targets = append(targets, chainTarget{Namespace: ns, Name: name, Label: d.Name})
 	}
-	if allReady {
-		response["status"] = "ready"
+	return targets
+}
+
+// chainState reports whether every deployment of the route is ready and whether any is scaled to zero.
+// Deployments whose status cannot be read don't block the route.
+func (h *Handler) chainState(ctx context.Context, route store.RouteConfig) (ready, sleeping bool) {
+	ctx, span := tracing.Start(ctx, "proxy.check_chain")
+	defer func() {
+		span.SetAttributes(tracing.Bool("chain.ready", ready), tracing.Bool("chain.sleeping", sleeping))
+		span.End()
+	}()
+
+	ready = true
+	for _, target := range chainTargets(route) {
+		replicas, readyReplicas, err := h.k8sClient.GetDeploymentStatus(ctx, target.Namespace, target.Name)
+		if err != nil {
+			log.ErrorContext(ctx, "Error getting deployment status", "deployment", target.Name, "error", err)
+			continue // Don't block everything on status error, or maybe we should?
+		}
+
+		if replicas == 0 {
+			ready, sleeping = false, true
+		} else if readyReplicas == 0 {
+			ready = false
+		}
+	}
+	return ready, sleeping
+}
+
+// wakeChain scales every sleeping deployment of the route to one replica and reports whether it scaled any.
+// route must carry the LastActivity from before the wake-up, for the time-asleep metric. Cause completes
+// "Route <id> ..." in events and notifications, e.g. causeRequest.
+func (h *Handler) wakeChain(ctx context.Context, route store.RouteConfig, cause string) (woke bool) {
+	ctx, span := tracing.Start(ctx, "proxy.wake", tracing.WithAttributes(tracing.String("route.id", route.ID)))
+	defer span.End()
+
+	var woken []events.Target
+	for _, target := range chainTargets(route) {
+		replicas, _, err := h.k8sClient.GetDeploymentStatus(ctx, target.Namespace, target.Name)
+		if err != nil || replicas != 0 {
+			continue
+		}
+		log.InfoContext(ctx, "Deployment is sleeping. Waking up...", "deployment", target.Name)
+		if err := h.k8sClient.ScaleDeployment(ctx, target.Namespace, target.Name, 1); err != nil {
+			span.RecordError(err)
+			log.ErrorContext(ctx, "Error waking up deployment", "deployment", target.Name, "error", err)
+			h.Events.ScaleFailed(route, events.Target{Namespace: target.Namespace, Name: target.Name}, 1, err)
+			h.Notifier.Notify(route, notify.EventWakeFailed, fmt.Sprintf("Failed to scale %s/%s to 1 replica: %v", target.Namespace, target.Name, err))
+			continue
+		}
+		h.Savings.Woke(target.Namespace, target.Name)
+		woken = append(woken, events.Target{Namespace: target.Namespace, Name: target.Name})
+	}
+	if len(woken) == 0 {
+		return false
 	}
 
-	json.NewEncoder(w).Encode(response)
+	h.Metrics.recordWake(ctx, route)
+	h.Events.Waking(route, cause, woken)
+	h.Notifier.Notify(route, notify.EventWakeStarted, fmt.Sprintf("%s, scaled %s to 1 replica", capitalize(cause), targetNames(woken)))
+	started, _ := h.Metrics.wakeStarted(route.ID)
+	time.AfterFunc(h.routeWakeTimeout(route), func() { h.checkWakeTimeout(route, started) })
+	return true
 }
 
-func (h *Handler) serveLoadingPage(w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "text/html")
-	if h.tmpl != nil {
-		h.tmpl.Execute(w, nil)
-	} else {
-		w.Write([]byte("<h1>Waking up... please wait...</h1><script>setTimeout(() => location.reload(), 2000)</script>"))
+// checkWakeTimeout moves a woken route that is still not ready once the wake timeout has passed into
+// the failed state, with the diagnostics of its deployments, and reports it. started identifies the
+// wake-up: nothing is done if the route became ready or was woken again since.
+func (h *Handler) checkWakeTimeout(route store.RouteConfig, started time.Time) {
+	ctx := logger.WithRouteID(context.Background(), route.ID)
+	if current, pending := h.Metrics.wakeStarted(route.ID); !pending || !current.Equal(started) {
+		return
+	}
+	if ready, sleeping := h.chainState(ctx, route); ready || sleeping {
+		return
+	}
+	timeout := h.routeWakeTimeout(route)
+	diagnostics := h.diagnose(ctx, route)
+	h.Metrics.recordFailure(route.ID, WakeFailure{Time: time.Now().UTC(), Timeout: timeout.Seconds(), Diagnostics: diagnostics})
+
+	summary := diagnosisSummary(diagnostics)
+	log.WarnContext(ctx, "Route is still not ready after waking up", "timeout", timeout.String(), "diagnostics", summary)
+	h.Events.WakeTimedOut(route, timeout, summary)
+	message := fmt.Sprintf("Still not ready %s after waking up", timeout)
+	if summary != "" {
+		message += ": " + summary
 	}
+	h.Notifier.Notify(route, notify.EventWakeTimeout, message)
+}
+
+func targetNames(targets []events.Target) string {
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.Namespace + "/" + t.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// serveVerificationPage shows the loading page with a button that wakes the route, so that
+// clients not running JavaScript or not clicking never wake it.
+func (h *Handler) serveVerificationPage(w http.ResponseWriter, r *http.Request, route store.RouteConfig) {
+	token, err := h.access.sign(purposeWake, wakeToken{RouteID: route.ID, Expires: time.Now().Add(10 * time.Minute).Unix()})
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	data := h.pageData(r, route)
+	data.VerifyToken = token
+	h.pages.render(w, http.StatusOK, &route, pageLoading, data)
+}
+
+func (h *Handler) serveLoadingPage(w http.ResponseWriter, r *http.Request, route store.RouteConfig) {
+	h.pages.render(w, http.StatusOK, &route, pageLoading, h.pageData(r, route))
 }
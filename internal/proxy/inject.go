@@ -0,0 +1,289 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"smart-proxy/internal/store"
+	"smart-proxy/internal/transform"
+)
+
+const (
+	// defaultInjectScanLimit is how far into an HTML response the injector looks for </body>, when
+	// INJECT_MAX_SCAN_BYTES is unset. Past it, the rest of the response is passed through unchanged.
+	defaultInjectScanLimit = 8 << 20
+	// injectChunkSize is how much decoded HTML the injector handles at once; with the </body> carry-over,
+	// it bounds the memory used per response.
+	injectChunkSize = 32 << 10
+)
+
+var bodyEnd = []byte("</body>")
+
+// injects reports whether snippets are added to the HTML responses of the route.
+func injects(route store.RouteConfig) bool {
+	if route.InjectBadge {
+		return true
+	}
+	i := route.Inject
+	return i != nil && (i.Banner != "" || i.HTML != "" || (i.Countdown && route.IdleTimeout > 0))
+}
+
+// injectResponse rewrites an HTML response of the route as it streams, adding the snippets before </body>
+// (or at the end if there is none). Compressed bodies are decoded and encoded again with the same coding;
+// responses in other codings are left alone.
+func (h *Handler) injectResponse(resp *http.Response, route store.RouteConfig) error {
+	if !strings.Contains(resp.Header.Get("Content-Type"), "text/html") || resp.Request.Method == http.MethodHead ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	encoding := transform.ContentEncoding(resp.Header.Get("Content-Encoding"))
+	if !transform.SupportsEncoding(encoding) {
+		return nil
+	}
+
+	nonce := ""
+	if candidate := newNonce(); addCSPNonce(resp.Header, candidate) {
+		nonce = candidate
+	}
+	resp.Body = &injectReader{
+		body:     resp.Body,
+		encoding: encoding,
+		snippet:  snippetHTML(route, nonce),
+		limit:    h.injectScanLimit,
+		scanning: true,
+	}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+
+	// Disable caching of modified content
+	resp.Header.Del("ETag")
+	resp.Header.Del("Last-Modified")
+	return nil
+}
+
+// injectReader decodes the upstream body, adds the snippet and encodes the result, one chunk at a time.
+type injectReader struct {
+	body     io.ReadCloser // Upstream body, encoded
+	encoding string
+	snippet  []byte
+	limit    int64 // Bytes scanned for </body> before giving up
+
+	src      io.Reader         // Decoded body, opened on the first read
+	enc      transform.Encoder // Encodes into out
+	out      bytes.Buffer
+	buf      []byte
+	tail     []byte // End of the scanned data, which may be the start of </body>
+	scanned  int64
+	scanning bool // Still looking for </body>
+	eof      bool
+}
+
+func (r *injectReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	return r.out.Read(p)
+}
+
+func (r *injectReader) Close() error {
+	return r.body.Close()
+}
+
+// fill handles the next chunk of the body, leaving its encoded output in out.
+func (r *injectReader) fill() error {
+	if r.src == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+	n, err := r.src.Read(r.buf)
+	if n > 0 {
+		r.process(r.buf[:n])
+	}
+	if err == io.EOF {
+		if r.scanning {
+			// No </body>: append the snippet, as browsers render it anyway
+			r.enc.Write(r.tail)
+			r.enc.Write(r.snippet)
+		}
+		r.eof = true
+		return r.enc.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return r.enc.Flush() // Keep streamed pages streaming
+}
+
+func (r *injectReader) open() error {
+	src, err := transform.NewDecoder(r.encoding, r.body)
+	if err != nil {
+		return err
+	}
+	r.buf = make([]byte, injectChunkSize)
+	r.src, r.enc = src, transform.NewEncoder(r.encoding, &r.out)
+	return nil
+}
+
+// process writes a decoded chunk, adding the snippet before the first </body>. The end of the chunk is held
+// back when it could be the start of a </body> split across chunks.
+func (r *injectReader) process(chunk []byte) {
+	if !r.scanning {
+		r.enc.Write(chunk)
+		return
+	}
+	data := append(r.tail, chunk...)
+	r.scanned += int64(len(chunk))
+	if i := indexFold(data, bodyEnd); i >= 0 {
+		r.enc.Write(data[:i])
+		r.enc.Write(r.snippet)
+		r.enc.Write(data[i:])
+		r.scanning, r.tail = false, nil
+		return
+	}
+	if r.scanned > r.limit {
+		log.Debug("No </body> within the scan limit, not injecting", "limit", r.limit)
+		r.enc.Write(data)
+		r.scanning, r.tail = false, nil
+		return
+	}
+	keep := min(len(bodyEnd)-1, len(data))
+	r.enc.Write(data[:len(data)-keep])
+	r.tail = append([]byte(nil), data[len(data)-keep:]...)
+}
+
+// indexFold returns the index of the first ASCII case-insensitive match of sep in s, or -1.
+func indexFold(s, sep []byte) int {
+	for i := 0; i+len(sep) <= len(s); i++ {
+		if s[i] == sep[0] && bytes.EqualFold(s[i:i+len(sep)], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// addCSPNonce allows the nonce in the script and style sources of the response's Content Security Policies
+// that would block the inline snippets. It reports whether any policy needs it.
+func addCSPNonce(header http.Header, nonce string) bool {
+	needed := false
+	for _, name := range []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only"} {
+		policies := header.Values(name)
+		if len(policies) == 0 {
+			continue
+		}
+		header.Del(name)
+		for _, policy := range policies {
+			policy, changed := nonceCSP(policy, nonce)
+			needed = needed || changed
+			header.Add(name, policy)
+		}
+	}
+	return needed
+}
+
+// nonceCSP adds the nonce to the script-src and style-src directives of a policy, or to default-src
+// for the missing ones, unless they already allow inline content.
+func nonceCSP(policy, nonce string) (string, bool) {
+	directives := strings.Split(policy, ";")
+	find := func(name string) int {
+		for i, d := range directives {
+			if fields := strings.Fields(d); len(fields) > 0 && strings.EqualFold(fields[0], name) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	source := "'nonce-" + nonce + "'"
+	changed := false
+	for _, name := range []string{"script-src", "style-src"} {
+		i := find(name)
+		if i < 0 {
+			if i = find("default-src"); i < 0 {
+				continue
+			}
+		}
+		if allowsInline(directives[i]) || strings.Contains(directives[i], source) {
+			continue
+		}
+		directives[i] = strings.TrimRight(directives[i], " ") + " " + source
+		changed = true
+	}
+	return strings.Join(directives, ";"), changed
+}
+
+// allowsInline reports whether a directive allows inline scripts or styles: with 'unsafe-inline', unless a
+// nonce, a hash or 'strict-dynamic' makes browsers ignore it.
+func allowsInline(directive string) bool {
+	d := strings.ToLower(directive)
+	if !strings.Contains(d, "'unsafe-inline'") {
+		return false
+	}
+	for _, s := range []string{"'nonce-", "'sha256-", "'sha384-", "'sha512-", "'strict-dynamic'"} {
+		if strings.Contains(d, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// cssColor matches the colors accepted in snippets: names, hex, rgb()/hsl() functions.
+var cssColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+|(rgb|rgba|hsl|hsla)\([0-9., %]+\))$`)
+
+// snippetHTML returns the snippets of a route. Styles live in <style> elements rather than attributes, so that
+// the nonce covers them.
+func snippetHTML(route store.RouteConfig, nonce string) []byte {
+	attr := ""
+	if nonce != "" {
+		attr = ` nonce="` + nonce + `"`
+	}
+	var b strings.Builder
+	if route.InjectBadge {
+		fmt.Fprintf(&b, `
+<style%s>.sp-badge{position:fixed;bottom:12px;right:12px;display:flex;align-items:center;gap:8px;padding:8px 12px;background:rgba(15,23,42,0.95);border:1px solid rgba(59,130,246,0.5);border-radius:99px;color:#cbd5e1;font-family:'Inter',system-ui,sans-serif;font-size:12px;font-weight:500;box-shadow:0 4px 12px rgba(0,0,0,0.3);z-index:99999;backdrop-filter:blur(8px);pointer-events:none;user-select:none}.sp-badge b{color:#fff;font-weight:600}.sp-badge i{color:#3b82f6;font-size:14px;font-style:normal}</style>
+<div class="sp-badge"><i>⚡</i><span>Powered by <b>Smart Proxy</b></span></div>`, attr)
+	}
+
+	inject := route.Inject
+	if inject == nil {
+		return []byte(b.String())
+	}
+	if inject.Countdown && route.IdleTimeout > 0 {
+		fmt.Fprintf(&b, `
+<style%s>.sp-countdown{position:fixed;bottom:12px;left:12px;padding:6px 10px;background:rgba(15,23,42,0.9);border-radius:99px;color:#cbd5e1;font-family:system-ui,sans-serif;font-size:12px;z-index:99999;pointer-events:none}</style>
+<div class="sp-countdown" id="sp-countdown"></div>
+<script%s>(function(){var end=Date.now()+%d,el=document.getElementById('sp-countdown');function tick(){var s=Math.max(0,Math.round((end-Date.now())/1000));el.textContent='Sleeps in '+Math.floor(s/60)+':'+String(s%%60).padStart(2,'0')+' if idle';if(s>0)setTimeout(tick,1000)}tick()})();</script>`,
+			attr, attr, route.IdleTimeout.Milliseconds())
+	}
+	if inject.Banner != "" {
+		color := "#ea580c"
+		if cssColor.MatchString(inject.BannerColor) {
+			color = inject.BannerColor
+		}
+		fmt.Fprintf(&b, `
+<style%s>.sp-banner{position:fixed;top:0;left:50%%;transform:translateX(-50%%);padding:2px 12px;background:%s;border-radius:0 0 6px 6px;color:#fff;font-family:system-ui,sans-serif;font-size:12px;font-weight:600;letter-spacing:.05em;z-index:99999;pointer-events:none}</style>
+<div class="sp-banner">%s</div>`, attr, color, html.EscapeString(inject.Banner))
+	}
+	if inject.HTML != "" {
+		b.WriteString("\n" + strings.ReplaceAll(inject.HTML, "{{nonce}}", nonce))
+	}
+	return []byte(b.String())
+}
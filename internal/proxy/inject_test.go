@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/andybalholm/brotli"
+
+	"smart-proxy/internal/store"
+)
+
+// inject runs body, encoded with encoding, through an injectReader and returns the decoded result.
+func inject(t *testing.T, body, encoding string, limit int64, oneByte bool) string {
+	t.Helper()
+	var encoded bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&encoded)
+	case "deflate":
+		w = zlib.NewWriter(&encoded)
+	case "br":
+		w = brotli.NewWriter(&encoded)
+	default:
+		encoded.WriteString(body)
+	}
+	if w != nil {
+		w.Write([]byte(body))
+		w.Close()
+	}
+
+	var src io.Reader = &encoded
+	if oneByte {
+		src = iotest.OneByteReader(src)
+	}
+	r := &injectReader{body: io.NopCloser(src), encoding: encoding, snippet: []byte("<p>snippet</p>"), limit: limit, scanning: true}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s: %v", encoding, err)
+	}
+
+	var decoded io.Reader = bytes.NewReader(out)
+	switch encoding {
+	case "gzip":
+		decoded, err = gzip.NewReader(decoded)
+	case "deflate":
+		decoded, err = zlib.NewReader(decoded)
+	case "br":
+		decoded = brotli.NewReader(decoded)
+	}
+	if err != nil {
+		t.Fatalf("%s: %v", encoding, err)
+	}
+	result, err := io.ReadAll(decoded)
+	if err != nil {
+		t.Fatalf("%s: %v", encoding, err)
+	}
+	return string(result)
+}
+
+func TestInjectBeforeBodyEnd(t *testing.T) {
+	for _, encoding := range []string{"identity", "gzip", "deflate", "br"} {
+		got := inject(t, "<html><body>hi</BODY></body></html>", encoding, 1<<20, false)
+		if got != "<html><body>hi<p>snippet</p></BODY></body></html>" {
+			t.Errorf("%s: %q", encoding, got)
+		}
+	}
+}
+
+func TestInjectAcrossChunks(t *testing.T) {
+	// </body> split by the chunk boundary
+	page := strings.Repeat("a", injectChunkSize-3) + "</body></html>"
+	if got := inject(t, page, "gzip", 1<<20, false); got != strings.Replace(page, "</body>", "<p>snippet</p></body>", 1) {
+		t.Errorf("split at the chunk boundary: ...%q", got[injectChunkSize-10:])
+	}
+
+	// </body> read one byte at a time, after partial matches
+	page = "<html><body></b></bo</bod</body></html>"
+	if got := inject(t, page, "identity", 1<<20, true); got != "<html><body></b></bo</bod<p>snippet</p></body></html>" {
+		t.Errorf("one byte at a time: %q", got)
+	}
+}
+
+func TestInjectWithoutBodyEnd(t *testing.T) {
+	if got := inject(t, "<h1>fragment</h1></bo", "br", 1<<20, true); got != "<h1>fragment</h1></bo<p>snippet</p>" {
+		t.Errorf("no </body>: %q", got)
+	}
+	page := strings.Repeat("a", 100) + "</body>"
+	if got := inject(t, page, "identity", 50, true); got != page {
+		t.Errorf("past the scan limit: %q", got)
+	}
+	if got := inject(t, "", "gzip", 1<<20, false); got != "<p>snippet</p>" {
+		t.Errorf("empty page: %q", got)
+	}
+}
+
+func TestNonceCSP(t *testing.T) {
+	tests := []struct {
+		policy  string
+		want    string
+		changed bool
+	}{
+		{"default-src 'self'", "default-src 'self' 'nonce-N'", true},
+		{"script-src 'self'; style-src 'self' ; img-src *", "script-src 'self' 'nonce-N'; style-src 'self' 'nonce-N'; img-src *", true},
+		{"default-src 'self'; Script-Src 'self'", "default-src 'self' 'nonce-N'; Script-Src 'self' 'nonce-N'", true},
+		{"script-src 'unsafe-inline'; style-src 'unsafe-inline'", "script-src 'unsafe-inline'; style-src 'unsafe-inline'", false},
+		// A nonce or 'strict-dynamic' makes browsers ignore 'unsafe-inline'
+		{"script-src 'unsafe-inline' 'nonce-other'; style-src 'unsafe-inline' 'strict-dynamic'",
+			"script-src 'unsafe-inline' 'nonce-other' 'nonce-N'; style-src 'unsafe-inline' 'strict-dynamic' 'nonce-N'", true},
+		{"img-src *; frame-ancestors 'none'", "img-src *; frame-ancestors 'none'", false},
+		{"default-src 'self' 'nonce-N'", "default-src 'self' 'nonce-N'", false},
+	}
+	for _, tt := range tests {
+		got, changed := nonceCSP(tt.policy, "N")
+		if got != tt.want || changed != tt.changed {
+			t.Errorf("%q:\ngot  %q, %v\nwant %q, %v", tt.policy, got, changed, tt.want, tt.changed)
+		}
+	}
+}
+
+func TestInjectResponse(t *testing.T) {
+	h := &Handler{injectScanLimit: defaultInjectScanLimit}
+	route := store.RouteConfig{ID: "shop", Inject: &store.InjectConfig{Banner: "<staging>"}}
+	response := func(contentType, encoding string) *http.Response {
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{"Content-Type": {contentType}, "Content-Length": {"28"}, "Etag": {`"v1"`},
+				"Content-Security-Policy": {"default-src 'self'", "img-src *"}},
+			Body:    io.NopCloser(strings.NewReader("<html><body></body></html>")),
+			Request: httptest.NewRequest(http.MethodGet, "/", nil),
+		}
+		if encoding != "" {
+			resp.Header.Set("Content-Encoding", encoding)
+		}
+		return resp
+	}
+
+	resp := response("text/html; charset=utf-8", "")
+	h.injectResponse(resp, route)
+	body, _ := io.ReadAll(resp.Body)
+	policies := resp.Header.Values("Content-Security-Policy")
+	nonce := strings.TrimSuffix(strings.TrimPrefix(policies[0], "default-src 'self' 'nonce-"), "'")
+	if len(policies) != 2 || nonce == policies[0] || policies[1] != "img-src *" {
+		t.Fatalf("policies %q", policies)
+	}
+	if !strings.Contains(string(body), `<style nonce="`+nonce+`">`) || !strings.Contains(string(body), "&lt;staging&gt;") {
+		t.Errorf("body %s", body)
+	}
+	if resp.ContentLength != -1 || resp.Header.Get("Content-Length") != "" || resp.Header.Get("ETag") != "" {
+		t.Errorf("headers %v", resp.Header)
+	}
+
+	for _, resp := range []*http.Response{response("application/json", ""), response("text/html", "zstd")} {
+		h.injectResponse(resp, route)
+		if body, _ := io.ReadAll(resp.Body); string(body) != "<html><body></body></html>" {
+			t.Errorf("%s in %s rewritten: %s", resp.Header.Get("Content-Type"), resp.Header.Get("Content-Encoding"), body)
+		}
+	}
+}
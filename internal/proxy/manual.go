@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"smart-proxy/internal/k8s"
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+	"smart-proxy/internal/stream"
+)
+
+// Causes of wake-ups, completing "Route <id> ..." in events and notifications.
+const (
+	causeRequest  = "received a request"
+	causeWakeLink = "was woken by a wake link"
+)
+
+// ErrWakeBlocked is returned when waking a route whose mode forbids it.
+var ErrWakeBlocked = errors.New("route cannot be woken")
+
+// readyInterval is how often WaitReady checks the deployments of a route.
+const readyInterval = time.Second
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// Wake wakes a route without a request, e.g. to warm it before a demo or before tests. The route counts as
+// active, as if it had been visited. Cause completes "Route <id> ...", e.g. "was woken by alice". Wake
+// reports whether a deployment was scaled up: a route that is not asleep, be it ready, waking up or
+// failed, is left as it is.
+func (h *Handler) Wake(ctx context.Context, routeID, cause string) (bool, error) {
+	route, ok := h.store.GetRoute(routeID)
+	if !ok {
+		return false, store.ErrRouteNotFound
+	}
+	if mode, blocked := h.blocked(routeID); blocked {
+		return false, fmt.Errorf("%w: %s", ErrWakeBlocked, mode)
+	}
+	if h.k8sClient == nil {
+		return false, errors.New("k8s client not initialized")
+	}
+
+	ctx = logger.WithRouteID(ctx, routeID)
+	before := route
+	h.store.UpdateActivity(routeID)
+	if _, sleeping := h.chainState(ctx, route); !sleeping {
+		return false, nil
+	}
+	return h.wakeChain(ctx, before, cause), nil
+}
+
+// ReadyStatus is the state of a route awaited by WaitReady.
+type ReadyStatus struct {
+	Status      string              `json:"status"` // ready, waiting, or failed (past the wake timeout)
+	Elapsed     float64             `json:"elapsed_seconds"`
+	Details     []stream.TargetInfo `json:"details"`
+	Diagnostics []k8s.Diagnosis     `json:"diagnostics,omitempty"` // When not ready: what keeps deployments from becoming ready
+}
+
+// WaitReady waits until every deployment of a route is ready and its warm-up passed, or ctx is done.
+func (h *Handler) WaitReady(ctx context.Context, routeID string) (ReadyStatus, error) {
+	route, ok := h.store.GetRoute(routeID)
+	if !ok {
+		return ReadyStatus{}, store.ErrRouteNotFound
+	}
+	if h.k8sClient == nil {
+		return ReadyStatus{}, errors.New("k8s client not initialized")
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(readyInterval)
+	defer ticker.Stop()
+	for {
+		details, ready := h.targetStatuses(ctx, route)
+		if ready && route.WarmupPath != "" {
+			ready = h.warmUp(ctx, route)
+		}
+		status := ReadyStatus{Status: "ready", Elapsed: math.Round(time.Since(start).Seconds()*10) / 10, Details: details}
+		if ready {
+			h.routeReady(route)
+			return status, nil
+		}
+
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+		}
+
+		// Out of time: report why, with a context of its own
+		diagnoseCtx, cancel := context.WithTimeout(logger.WithRouteID(context.Background(), routeID), 5*time.Second)
+		defer cancel()
+		status.Status = "waiting"
+		status.Diagnostics = h.diagnose(diagnoseCtx, route)
+		if _, failed := h.Metrics.Failure(routeID); failed {
+			status.Status = "failed"
+		}
+		return status, nil
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/store"
+)
+
+func TestWakeLeavesRoutesNotAsleepAlone(t *testing.T) {
+	cluster, client := newFakeCluster(t)
+	s := store.NewStore(filepath.Join(t.TempDir(), "routes.json"))
+	s.AddRoute(&store.RouteConfig{ID: "shop", Path: "/", Namespace: "shop", Deployment: "web"})
+	h := NewHandler(client, s)
+
+	cluster.set("web", 1, 1)
+	if woke, err := h.Wake(t.Context(), "shop", "was woken by ann"); woke || err != nil {
+		t.Errorf("ready route: woke %v, %v", woke, err)
+	}
+	if _, pending := h.Metrics.wakeStarted("shop"); pending {
+		t.Error("ready route waking")
+	}
+
+	cluster.set("web", 1, 0)
+	h.Metrics.recordFailure("shop", WakeFailure{Timeout: 60})
+	if woke, err := h.Wake(t.Context(), "shop", "was woken by ann"); woke || err != nil {
+		t.Errorf("failed route: woke %v, %v", woke, err)
+	}
+	if _, failed := h.Metrics.Failure("shop"); !failed {
+		t.Error("failure cleared without a wake-up")
+	}
+	if cluster.scaleCount() != 0 {
+		t.Errorf("%d scales of a route not asleep", cluster.scaleCount())
+	}
+
+	cluster.set("web", 0, 0)
+	if woke, err := h.Wake(t.Context(), "shop", "was woken by ann"); !woke || err != nil || cluster.scaleCount() != 1 {
+		t.Errorf("sleeping route: woke %v, %v, %d scales", woke, err, cluster.scaleCount())
+	}
+
+	s.SetMode("shop", &store.RouteMode{State: store.ModeMaintenance})
+	if _, err := h.Wake(t.Context(), "shop", "was woken by ann"); !errors.Is(err, ErrWakeBlocked) {
+		t.Errorf("route in maintenance: %v", err)
+	}
+}
+
+func TestWakeTokenIsNoAccessPass(t *testing.T) {
+	cluster, client := newFakeCluster(t)
+	cluster.set("web", 0, 0)
+	cluster.set("blog", 1, 1)
+	s := store.NewStore(filepath.Join(t.TempDir(), "routes.json"))
+	s.AddRoute(&store.RouteConfig{ID: "shop", Path: "/", Namespace: "shop", Deployment: "web",
+		Access: &store.AccessPolicy{DenyCIDRs: []string{"192.0.2.0/24"}}})
+	s.AddRoute(&store.RouteConfig{ID: "blog", Path: "/blog/", Namespace: "shop", Deployment: "blog"})
+	h := NewHandler(client, s)
+
+	post := func(routeID string) int {
+		token, _ := h.access.sign(purposeWake, wakeToken{RouteID: routeID, Expires: time.Now().Add(time.Minute).Unix()})
+		r := httptest.NewRequest(http.MethodPost, wakePath, strings.NewReader(url.Values{"token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.handleWake(w, r)
+		return w.Code
+	}
+	if code := post("shop"); code != http.StatusForbidden {
+		t.Errorf("denied client: %d", code)
+	}
+	if code := post("blog"); code != http.StatusNoContent {
+		t.Errorf("awake route: %d", code)
+	}
+	if cluster.scaleCount() != 0 {
+		t.Errorf("%d scales", cluster.scaleCount())
+	}
+	if _, pending := h.Metrics.wakeStarted("blog"); pending {
+		t.Error("awake route waking")
+	}
+}
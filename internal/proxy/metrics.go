@@ -0,0 +1,293 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"smart-proxy/internal/k8s"
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/metrics"
+	"smart-proxy/internal/store"
+	"smart-proxy/internal/tracing"
+)
+
+// Prometheus series exposed on /metrics.
+var (
+	requestsTotal = metrics.Default.NewCounterVec("smart_proxy_http_requests_total",
+		"Requests handled by the proxy.", "route", "method", "code")
+	requestDuration = metrics.Default.NewHistogramVec("smart_proxy_http_request_duration_seconds",
+		"Time to serve a request, including loading pages and rejections.", metrics.DefBuckets, "route", "method")
+	requestBytes = metrics.Default.NewCounterVec("smart_proxy_http_request_bytes_total",
+		"Request body bytes received from clients.", "route")
+	responseBytes = metrics.Default.NewCounterVec("smart_proxy_http_response_bytes_total",
+		"Response body bytes sent to clients.", "route")
+	wakeEvents = metrics.Default.NewCounterVec("smart_proxy_wake_events_total",
+		"Times a sleeping route was woken up.", "route")
+	coldStartDuration = metrics.Default.NewHistogramVec("smart_proxy_cold_start_duration_seconds",
+		"Time from waking a route until all its deployments were ready.",
+		[]float64{1, 2, 5, 10, 20, 30, 60, 120, 300, 600}, "route")
+	asleepSeconds = metrics.Default.NewCounterVec("smart_proxy_route_asleep_seconds_total",
+		"Time routes spent scaled to zero, added when they are woken up.", "route")
+	routeState = metrics.Default.NewGaugeVec("smart_proxy_route_state",
+		"Current state of each route (1 for the active state).", "route", "namespace", "state")
+)
+
+// unmatchedRoute labels requests that matched no route.
+const unmatchedRoute = "none"
+
+// Metrics holds the request counters served as JSON by the admin API, and the
+// bookkeeping needed to measure cold starts. It is safe for concurrent use.
+type Metrics struct {
+	mu            sync.RWMutex
+	totalRequests int64
+	routeStats    map[string]int64        // Key: Route ID
+	waking        map[string]pendingStart // Key: Route ID
+	failed        map[string]WakeFailure  // Key: Route ID
+}
+
+// pendingStart is a wake-up whose deployments are not all ready yet.
+type pendingStart struct {
+	started time.Time
+	span    *tracing.Span // Wait-for-ready phase, in the trace of the request that woke the route
+}
+
+// Stats is a point-in-time copy of the request counters.
+type Stats struct {
+	TotalRequests int64
+	RouteStats    map[string]int64 // Key: Route ID
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		routeStats: make(map[string]int64),
+		waking:     make(map[string]pendingStart),
+		failed:     make(map[string]WakeFailure),
+	}
+}
+
+// Snapshot returns a copy of the request counters.
+func (m *Metrics) Snapshot() Stats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := Stats{TotalRequests: m.totalRequests, RouteStats: make(map[string]int64, len(m.routeStats))}
+	for id, count := range m.routeStats {
+		stats.RouteStats[id] = count
+	}
+	return stats
+}
+
+// recordRequest counts a request proxied upstream.
+func (m *Metrics) recordRequest(routeID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.totalRequests++
+	if routeID != "" {
+		m.routeStats[routeID]++
+	}
+}
+
+// recordWake counts a wake-up and starts the cold-start timer. The time the route spent
+// asleep is estimated from its last activity before the wake-up and its idle timeout.
+func (m *Metrics) recordWake(ctx context.Context, route store.RouteConfig) {
+	wakeEvents.Inc(route.ID)
+	if !route.LastActivity.IsZero() && route.IdleTimeout > 0 {
+		if asleep := time.Since(route.LastActivity.Add(route.IdleTimeout)); asleep > 0 {
+			asleepSeconds.Add(asleep.Seconds(), route.ID)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.failed, route.ID)
+	if _, pending := m.waking[route.ID]; !pending {
+		_, span := tracing.Start(ctx, "proxy.wait_for_ready", tracing.WithAttributes(tracing.String("route.id", route.ID)))
+		m.waking[route.ID] = pendingStart{started: time.Now(), span: span}
+	}
+}
+
+// wakeStarted returns when the pending wake-up of a route started, if one is running.
+func (m *Metrics) wakeStarted(routeID string) (time.Time, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	start, pending := m.waking[routeID]
+	return start.started, pending
+}
+
+// WakeFailure is a wake-up that did not complete within the wake timeout. The route stays failed until
+// it becomes ready or is woken again.
+type WakeFailure struct {
+	Time        time.Time       `json:"time"`
+	Timeout     float64         `json:"timeout_seconds"`
+	Diagnostics []k8s.Diagnosis `json:"diagnostics,omitempty"` // When the timeout passed
+}
+
+// Failure returns the failure of the route's latest wake-up, if it failed.
+func (m *Metrics) Failure(routeID string) (WakeFailure, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, failed := m.failed[routeID]
+	return f, failed
+}
+
+func (m *Metrics) recordFailure(routeID string, f WakeFailure) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed[routeID] = f
+}
+
+// recordReady stops the cold-start timer of a route and returns the cold start duration, if one was running.
+func (m *Metrics) recordReady(routeID string) (coldStart time.Duration, pending bool) {
+	m.mu.Lock()
+	start, pending := m.waking[routeID]
+	delete(m.waking, routeID)
+	delete(m.failed, routeID)
+	m.mu.Unlock()
+	if !pending {
+		return 0, false
+	}
+	coldStart = time.Since(start.started)
+	coldStartDuration.Observe(coldStart.Seconds(), routeID)
+	start.span.End()
+	return coldStart, true
+}
+
+// updateRouteStates refreshes the route state gauge; it runs on every scrape. The series are swapped in at once
+// so that concurrent scrapes never see the gauge empty or half filled.
+func (h *Handler) updateRouteStates() {
+	var samples []metrics.Sample
+	states := h.RouteStates()
+	for _, route := range h.store.GetAllRoutes() {
+		state, ok := states[route.ID]
+		if !ok {
+			continue
+		}
+		for _, s := range []string{"ready", "waking", "failed", "sleeping"} {
+			value := 0.0
+			if s == state {
+				value = 1
+			}
+			samples = append(samples, metrics.Sample{Value: value, Labels: []string{route.ID, route.Namespace, s}})
+		}
+	}
+	routeState.Replace(samples)
+}
+
+// RouteStates returns the state of every route: "ready", "waking", "failed" or "sleeping". It is empty without a cluster.
+func (h *Handler) RouteStates() map[string]string {
+	states := make(map[string]string)
+	if h.k8sClient == nil {
+		return states
+	}
+	for _, route := range h.store.GetAllRoutes() {
+		states[route.ID] = h.routeState(logger.WithRouteID(context.Background(), route.ID), route)
+	}
+	return states
+}
+
+// routeState returns the state of a route: "ready", "waking", "failed" (waking for longer than the wake timeout)
+// or "sleeping".
+func (h *Handler) routeState(ctx context.Context, route store.RouteConfig) string {
+	ready, sleeping := h.chainState(ctx, route)
+	switch {
+	case sleeping:
+		return "sleeping"
+	case ready:
+		return "ready"
+	}
+	if _, failed := h.Metrics.Failure(route.ID); failed {
+		return "failed"
+	}
+	return "waking"
+}
+
+// observeRequest records the Prometheus request series once a request has been served.
+func observeRequest(routeID string, r *http.Request, rec *responseRecorder, body *countingReader, elapsed time.Duration) {
+	if routeID == "" {
+		routeID = unmatchedRoute
+	}
+	method := methodLabel(r.Method)
+	requestsTotal.Inc(routeID, method, strconv.Itoa(rec.status()))
+	requestDuration.Observe(elapsed.Seconds(), routeID, method)
+	requestBytes.Add(float64(body.n.Load()), routeID)
+	responseBytes.Add(float64(rec.bytes), routeID)
+}
+
+// methodLabel returns the method label of a request: clients choose the method, so anything but the
+// standard methods is counted as "OTHER" to keep the number of series bounded.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// responseRecorder captures the status code and body size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
+
+// Flush keeps streamed responses (SSE, chunked) flowing through the recorder.
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack supports WebSocket upgrades. Bytes sent over hijacked connections are not counted.
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if r.code == 0 {
+		r.code = http.StatusSwitchingProtocols
+	}
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// countingReader counts the request body bytes read by the proxy.
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/k8s"
+	"smart-proxy/internal/store"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestMethodLabel(t *testing.T) {
+	for method, want := range map[string]string{
+		"GET": "GET", "DELETE": "DELETE", "OPTIONS": "OPTIONS",
+		"get": "OTHER", "PROPFIND": "OTHER", "X-RANDOM-1234": "OTHER", "": "OTHER",
+	} {
+		if got := methodLabel(method); got != want {
+			t.Errorf("methodLabel(%q) = %q, want %q", method, got, want)
+		}
+	}
+}
+
+// fakeCluster serves the deployments of the shop namespace from the API. Scaling them fails while
+// scaleErrors is set.
+type fakeCluster struct {
+	mu          sync.Mutex
+	deployments map[string]*appsv1.Deployment
+	scaled      []string
+	scaleErrors bool
+}
+
+func newFakeCluster(t *testing.T) (*fakeCluster, *k8s.Client) {
+	c := &fakeCluster{deployments: make(map[string]*appsv1.Deployment)}
+	ts := httptest.NewServer(http.HandlerFunc(c.serve))
+	t.Cleanup(ts.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, &k8s.Client{Clientset: clientset, Namespace: "shop", Scope: k8s.NamespaceScope{Mode: k8s.ModeAll}}
+}
+
+func (c *fakeCluster) set(name string, replicas, ready int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deployments[name] = &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: ready},
+	}
+}
+
+func (c *fakeCluster) scaleCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.scaled)
+}
+
+func (c *fakeCluster) serve(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	name, scale := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/apis/apps/v1/namespaces/shop/deployments/"), "/scale")
+	deployment, found := c.deployments[name]
+	switch {
+	case !found:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`)
+	case !scale:
+		json.NewEncoder(w).Encode(deployment)
+	case r.Method == http.MethodPut && c.scaleErrors:
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"kind": "Status", "apiVersion": "v1", "status": "Failure", "code": 500}`)
+	case r.Method == http.MethodPut:
+		var s autoscalingv1.Scale
+		json.NewDecoder(r.Body).Decode(&s)
+		deployment.Spec.Replicas = &s.Spec.Replicas
+		c.scaled = append(c.scaled, name)
+		json.NewEncoder(w).Encode(s)
+	default:
+		json.NewEncoder(w).Encode(autoscalingv1.Scale{
+			TypeMeta:   metav1.TypeMeta{Kind: "Scale", APIVersion: "autoscaling/v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop"},
+			Spec:       autoscalingv1.ScaleSpec{Replicas: *deployment.Spec.Replicas},
+		})
+	}
+}
+
+func TestFailedScaleIsNotAWake(t *testing.T) {
+	cluster, client := newFakeCluster(t)
+	cluster.set("web", 0, 0)
+	cluster.scaleErrors = true
+	h := &Handler{k8sClient: client, Metrics: NewMetrics()}
+	route := store.RouteConfig{ID: "shop", Namespace: "shop", Deployment: "web"}
+	h.Metrics.recordFailure(route.ID, WakeFailure{Timeout: 60})
+
+	if h.wakeChain(t.Context(), route, causeRequest) {
+		t.Error("woke without scaling anything")
+	}
+	if _, pending := h.Metrics.wakeStarted(route.ID); pending {
+		t.Error("wake-up pending after a failed scale")
+	}
+	if _, failed := h.Metrics.Failure(route.ID); !failed {
+		t.Error("failure cleared by a failed scale")
+	}
+
+	cluster.mu.Lock()
+	cluster.scaleErrors = false
+	cluster.mu.Unlock()
+	if !h.wakeChain(t.Context(), route, causeRequest) || cluster.scaleCount() != 1 {
+		t.Fatalf("not woken, %d scales", cluster.scaleCount())
+	}
+	if _, pending := h.Metrics.wakeStarted(route.ID); !pending {
+		t.Error("no pending wake-up")
+	}
+	if _, failed := h.Metrics.Failure(route.ID); failed {
+		t.Error("failure kept after waking")
+	}
+}
+
+func TestWakeTimeoutFailsRoute(t *testing.T) {
+	cluster, client := newFakeCluster(t)
+	cluster.set("web", 1, 0)
+	h := &Handler{k8sClient: client, Metrics: NewMetrics(), diagnoses: newDiagnosisCache(), wakeTimeout: time.Minute}
+	route := store.RouteConfig{ID: "shop", Namespace: "shop", Deployment: "web", WakeTimeout: 90 * time.Second}
+
+	h.checkWakeTimeout(route, time.Now()) // Not waking
+	h.Metrics.recordWake(t.Context(), route)
+	started, _ := h.Metrics.wakeStarted(route.ID)
+	h.checkWakeTimeout(route, started.Add(-time.Second)) // Another wake-up
+	if _, failed := h.Metrics.Failure(route.ID); failed {
+		t.Fatal("failed without a pending wake-up")
+	}
+
+	h.checkWakeTimeout(route, started)
+	failure, failed := h.Metrics.Failure(route.ID)
+	if !failed || failure.Timeout != 90 {
+		t.Fatalf("failure %+v, %v", failure, failed)
+	}
+
+	// Becoming ready clears the failure
+	if _, pending := h.Metrics.recordReady(route.ID); !pending {
+		t.Error("wake-up no longer pending after the timeout")
+	}
+	if _, failed := h.Metrics.Failure(route.ID); failed {
+		t.Error("failure kept once ready")
+	}
+}
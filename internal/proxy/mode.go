@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-proxy/internal/store"
+)
+
+// maintenanceRetryAfter is sent with the maintenance page when the end of the maintenance is unknown.
+const maintenanceRetryAfter = 5 * time.Minute
+
+// serveDisabled answers a request for a disabled route as if no route matched, or redirects it if the
+// mode sets a redirect URL.
+func (h *Handler) serveDisabled(w http.ResponseWriter, r *http.Request, route store.RouteConfig) {
+	w.Header().Set("Cache-Control", "no-store")
+	if route.Mode.RedirectURL != "" {
+		http.Redirect(w, r, route.Mode.RedirectURL, http.StatusFound)
+		return
+	}
+	h.serveNotFound(w, r)
+}
+
+// serveNotFound answers a request no route serves.
+func (h *Handler) serveNotFound(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		h.pages.render(w, http.StatusNotFound, nil, pageNotFound, PageData{Host: r.Host, Path: r.URL.Path})
+	} else {
+		http.NotFound(w, r)
+	}
+}
+
+// serveMaintenance serves the maintenance page of a route, without waking it.
+func (h *Handler) serveMaintenance(w http.ResponseWriter, r *http.Request, route store.RouteConfig) {
+	retryAfter := maintenanceRetryAfter
+	if left := time.Until(route.Mode.Until); !route.Mode.Until.IsZero() && left > 0 {
+		retryAfter = left
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	data := h.pageData(r, route)
+	data.Reason, data.Until = route.Mode.Reason, route.Mode.Until
+	h.pages.render(w, http.StatusServiceUnavailable, &route, pageMaintenance, data)
+}
+
+// blocked reports whether the current operational state of a route keeps it from being woken, and the state.
+func (h *Handler) blocked(routeID string) (string, bool) {
+	route, ok := h.store.GetRoute(routeID)
+	if !ok {
+		return "", false
+	}
+	mode := route.CurrentMode()
+	return mode, mode == store.ModeMaintenance || mode == store.ModeDisabled
+}
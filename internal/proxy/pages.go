@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"smart-proxy/internal/store"
+	"smart-proxy/web/templates"
+)
+
+// Pages served instead of the upstream, each rendered from "<kind>.html".
+const (
+	pageLoading     = "loading"     // While the route wakes up; also asks for a click with WakePolicy.RequireHuman
+	pageFailed      = "failed"      // When the wake-up passed the wake timeout
+	pageMaintenance = "maintenance" // While the route is in maintenance mode
+	pageNotFound    = "not_found"   // When no route matches; global only
+)
+
+var pageKinds = []string{pageLoading, pageFailed, pageMaintenance, pageNotFound}
+
+// pageReloadInterval is how often template files and ConfigMaps are checked for changes.
+const pageReloadInterval = 10 * time.Second
+
+// PageData is passed to the page templates. It is the documented data model for custom pages.
+type PageData struct {
+	Route         PageRoute
+	Dependencies  []string     // Deployments the route also wakes, as configured ("name" or "namespace/name")
+	ETASeconds    float64      // Expected wake-up time, from previous wake-ups; 0 if unknown
+	Branding      PageBranding // From the route's "pages" settings
+	VerifyToken   string       // Loading page: set when a click is required before waking
+	WakeLinkToken string       // Loading page: set when a wake link is visited, to confirm the wake-up
+	Failure       *WakeFailure // Failed page: the failure and its diagnostics
+	Reason        string       // Maintenance page: why the route is under maintenance
+	Until         time.Time    // Maintenance page: when it should end; zero if unknown
+	Host          string       // Requested host
+	Path          string       // Requested path
+}
+
+// PageRoute describes the route a page is served for. It is empty on the not found page.
+type PageRoute struct {
+	ID         string
+	Name       string // Branding title, or the deployment name
+	Host       string
+	Path       string
+	Namespace  string
+	Deployment string
+}
+
+// PageBranding lets teams brand their pages.
+type PageBranding struct {
+	Title        string
+	LogoURL      string
+	PrimaryColor string
+	SupportURL   string
+}
+
+// pageStore loads the page templates: the embedded defaults, overridden by the files of a directory,
+// themselves overridden per route by the keys of a ConfigMap. Changes are picked up without a restart.
+type pageStore struct {
+	dir        string
+	configMaps func(namespace, name string) (data map[string]string, version string, err error)
+
+	mu       sync.Mutex
+	defaults map[string]*template.Template // Key: page kind
+	files    map[string]time.Time          // Modification time of the files in dir that override a default
+	checked  time.Time                     // Last check of dir
+	routes   map[string]*configMapPages    // Key: namespace/name of the ConfigMap
+}
+
+// configMapPages are the templates of a ConfigMap.
+type configMapPages struct {
+	checked time.Time
+	version string // resourceVersion the templates were parsed from
+	pages   map[string]*template.Template
+}
+
+// embeddedPages are the built-in templates; they must parse.
+var embeddedPages = func() map[string]*template.Template {
+	pages := make(map[string]*template.Template)
+	for _, kind := range pageKinds {
+		pages[kind] = template.Must(template.ParseFS(templates.FS, kind+".html"))
+	}
+	return pages
+}()
+
+func newPageStore(dir string, configMaps func(namespace, name string) (map[string]string, string, error)) *pageStore {
+	p := &pageStore{
+		dir:        dir,
+		configMaps: configMaps,
+		defaults:   make(map[string]*template.Template),
+		files:      make(map[string]time.Time),
+		routes:     make(map[string]*configMapPages),
+	}
+	for kind, tmpl := range embeddedPages {
+		p.defaults[kind] = tmpl
+	}
+	p.reloadFiles()
+	return p
+}
+
+// get returns the template of a page for a route, or the default one if route is nil or doesn't override it.
+func (p *pageStore) get(route *store.RouteConfig, kind string) *template.Template {
+	if route != nil && route.Pages != nil && route.Pages.ConfigMap != "" {
+		if tmpl := p.fromConfigMap(route.Namespace, route.Pages.ConfigMap, kind); tmpl != nil {
+			return tmpl
+		}
+	}
+	p.mu.Lock()
+	stale := time.Since(p.checked) >= pageReloadInterval
+	p.mu.Unlock()
+	if stale {
+		p.reloadFiles()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.defaults[kind]
+}
+
+// reloadFiles parses the files of dir that changed. A file that no longer parses keeps its previous version;
+// a removed file restores the embedded default.
+func (p *pageStore) reloadFiles() {
+	p.mu.Lock()
+	p.checked = time.Now()
+	p.mu.Unlock()
+	if p.dir == "" {
+		return
+	}
+
+	for _, kind := range pageKinds {
+		path := filepath.Join(p.dir, kind+".html")
+		info, err := os.Stat(path)
+
+		p.mu.Lock()
+		modTime, loaded := p.files[kind]
+		p.mu.Unlock()
+		if err != nil {
+			if loaded {
+				log.Info("Page template removed, using the default", "path", path)
+				p.setDefault(kind, embeddedPages[kind], time.Time{})
+			}
+			continue
+		}
+		if loaded && info.ModTime().Equal(modTime) {
+			continue
+		}
+
+		tmpl, err := template.ParseFiles(path)
+		if err != nil {
+			log.Warn("Invalid page template, keeping the previous one", "path", path, "error", err)
+			p.mu.Lock()
+			p.files[kind] = info.ModTime() // Don't parse it again until it changes
+			p.mu.Unlock()
+			continue
+		}
+		log.Info("Loaded page template", "path", path)
+		p.setDefault(kind, tmpl, info.ModTime())
+	}
+}
+
+func (p *pageStore) setDefault(kind string, tmpl *template.Template, modTime time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.defaults[kind] = tmpl
+	if modTime.IsZero() {
+		delete(p.files, kind)
+	} else {
+		p.files[kind] = modTime
+	}
+}
+
+// fromConfigMap returns the template of a page from a ConfigMap, or nil if the ConfigMap doesn't have it.
+// The ConfigMap is read again every pageReloadInterval, without blocking other pages meanwhile.
+func (p *pageStore) fromConfigMap(namespace, name, kind string) *template.Template {
+	key := namespace + "/" + name
+	p.mu.Lock()
+	cached, ok := p.routes[key]
+	if !ok {
+		cached = &configMapPages{}
+		p.routes[key] = cached
+	}
+	if p.configMaps == nil || time.Since(cached.checked) < pageReloadInterval {
+		defer p.mu.Unlock()
+		return cached.pages[kind]
+	}
+	cached.checked = time.Now() // Other requests keep the current templates while this one reads the ConfigMap
+	version := cached.version
+	p.mu.Unlock()
+
+	data, newVersion, err := p.configMaps(namespace, name)
+	if err != nil {
+		log.Warn("Could not read the pages ConfigMap", "namespace", namespace, "configmap", name, "error", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil && newVersion != version {
+		pages := make(map[string]*template.Template)
+		for _, k := range pageKinds {
+			text, ok := data[k+".html"]
+			if !ok {
+				continue
+			}
+			tmpl, err := template.New(k + ".html").Parse(text)
+			if err != nil {
+				log.Warn("Invalid page template in ConfigMap, keeping the previous one", "namespace", namespace, "configmap", name, "key", k+".html", "error", err)
+				tmpl = cached.pages[k]
+			}
+			if tmpl != nil {
+				pages[k] = tmpl
+			}
+		}
+		cached.pages, cached.version = pages, newVersion
+	}
+	return cached.pages[kind]
+}
+
+// render writes a page. If a custom template fails, the embedded default is used instead.
+func (p *pageStore) render(w http.ResponseWriter, status int, route *store.RouteConfig, kind string, data PageData) {
+	var buf bytes.Buffer
+	tmpl := p.get(route, kind)
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Warn("Failed to render page template, using the default", "page", kind, "error", err)
+		buf.Reset()
+		if err := embeddedPages[kind].Execute(&buf, data); err != nil {
+			log.Error("Failed to render default page template", "page", kind, "error", err)
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// pageData returns the data of a page served for a route.
+func (h *Handler) pageData(r *http.Request, route store.RouteConfig) PageData {
+	data := PageData{
+		Route: PageRoute{
+			ID: route.ID, Name: route.Deployment, Host: route.Host, Path: route.Path,
+			Namespace: route.Namespace, Deployment: route.Deployment,
+		},
+		ETASeconds: h.expectedWake(route),
+		Host:       r.Host,
+		Path:       r.URL.Path,
+	}
+	for _, d := range route.Dependencies {
+		data.Dependencies = append(data.Dependencies, d.Name)
+	}
+	if b := route.Pages; b != nil {
+		data.Branding = PageBranding{Title: b.Title, LogoURL: b.LogoURL, PrimaryColor: b.PrimaryColor, SupportURL: b.SupportURL}
+		if b.Title != "" {
+			data.Route.Name = b.Title
+		}
+	}
+	return data
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/store"
+)
+
+func execute(t *testing.T, p *pageStore, route *store.RouteConfig, kind string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := p.get(route, kind).Execute(&buf, PageData{Route: PageRoute{Name: "web"}}); err != nil {
+		t.Fatalf("%s: %v", kind, err)
+	}
+	return buf.String()
+}
+
+func TestDefaultPagesRender(t *testing.T) {
+	p := newPageStore("", nil)
+	for _, kind := range pageKinds {
+		w := httptest.NewRecorder()
+		p.render(w, http.StatusServiceUnavailable, nil, kind, PageData{
+			Route:   PageRoute{ID: "shop", Name: "Shop"},
+			Failure: &WakeFailure{Timeout: 60},
+		})
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("Cache-Control") != "no-store" || !strings.Contains(w.Body.String(), "</html>") {
+			t.Errorf("%s: %d %v\n%s", kind, w.Code, w.Header(), w.Body.String())
+		}
+	}
+}
+
+func TestPageFilesOverrideDefaults(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "loading.html")
+	os.WriteFile(path, []byte("custom {{.Route.Name}}"), 0o644)
+	p := newPageStore(dir, nil)
+	if got := execute(t, p, nil, pageLoading); got != "custom web" {
+		t.Errorf("loading page %q", got)
+	}
+	if got := execute(t, p, nil, pageFailed); strings.HasPrefix(got, "custom") {
+		t.Error("failed page overridden")
+	}
+
+	// A file that no longer parses keeps the previous version
+	os.WriteFile(path, []byte("broken {{.Route.Name"), 0o644)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+	p.checked = time.Time{}
+	if got := execute(t, p, nil, pageLoading); got != "custom web" {
+		t.Errorf("loading page %q after an invalid change", got)
+	}
+
+	// A removed file restores the default
+	os.Remove(path)
+	p.checked = time.Time{}
+	if got := execute(t, p, nil, pageLoading); strings.HasPrefix(got, "custom") {
+		t.Error("removed template still used")
+	}
+}
+
+func TestPageConfigMaps(t *testing.T) {
+	reads := 0
+	data := map[string]string{"loading.html": "shop {{.Route.Name}}", "failed.html": "{{.Missing}}"}
+	version := "1"
+	var readErr error
+	p := newPageStore("", func(namespace, name string) (map[string]string, string, error) {
+		if namespace != "shop" || name != "pages" {
+			t.Errorf("read ConfigMap %s/%s", namespace, name)
+		}
+		reads++
+		return data, version, readErr
+	})
+	route := &store.RouteConfig{ID: "shop", Namespace: "shop", Pages: &store.PagesConfig{ConfigMap: "pages"}}
+	reload := func() { p.routes["shop/pages"].checked = time.Time{} }
+
+	if got := execute(t, p, route, pageLoading); got != "shop web" {
+		t.Errorf("loading page %q", got)
+	}
+	if got := execute(t, p, route, pageMaintenance); strings.HasPrefix(got, "shop") || reads != 1 {
+		t.Errorf("maintenance page %q, %d reads", got, reads)
+	}
+	if got := execute(t, p, nil, pageLoading); strings.HasPrefix(got, "shop") {
+		t.Error("ConfigMap used without a route")
+	}
+
+	// A custom page that fails to render falls back to the default
+	w := httptest.NewRecorder()
+	p.render(w, http.StatusServiceUnavailable, route, pageFailed, PageData{Failure: &WakeFailure{}})
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "</html>") {
+		t.Errorf("failed page %d\n%s", w.Code, w.Body.String())
+	}
+
+	// An invalid change keeps the previous template, as do read errors
+	data = map[string]string{"loading.html": "{{if}}"}
+	version = "2"
+	reload()
+	if got := execute(t, p, route, pageLoading); got != "shop web" {
+		t.Errorf("loading page %q after an invalid change", got)
+	}
+	data, version, readErr = nil, "", errors.New("forbidden")
+	reload()
+	if got := execute(t, p, route, pageLoading); got != "shop web" || reads != 3 {
+		t.Errorf("loading page %q after a read error, %d reads", got, reads)
+	}
+}
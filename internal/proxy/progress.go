@@ -0,0 +1,384 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"smart-proxy/internal/k8s"
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+	"smart-proxy/internal/stream"
+)
+
+// Wake-up steps of a deployment, in order, followed by the warm-up of the route.
+const (
+	stepScheduled   = "scheduled"         // A pod is bound to a node
+	stepImagePulled = "image_pulled"      // Its images are pulled
+	stepStarted     = "container_started" // All its containers are running
+	stepReady       = "ready"             // It passes its readiness probe
+	stepWarmUp      = "warm_up"           // The route's WarmupPath answers
+)
+
+var podSteps = []string{stepScheduled, stepImagePulled, stepStarted, stepReady}
+
+const (
+	// progressInterval is how often the progress of a waking route is sent to its loading pages.
+	progressInterval = time.Second
+	// warmupTimeout bounds each request to a route's WarmupPath.
+	warmupTimeout = 2 * time.Second
+	// etaWeight is the weight of the latest wake-up in the moving average of step times.
+	etaWeight = 0.3
+)
+
+// warmupClient does not follow redirects: a 3xx answer passes the warm-up.
+var warmupClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// progressStep is one step of a wake-up.
+type progressStep struct {
+	Name string  `json:"name"`
+	Done bool    `json:"done"`
+	ETA  float64 `json:"eta_seconds,omitempty"` // Expected seconds from the start of the wake-up, from previous ones
+}
+
+// targetProgress is the progress of one deployment. Name and Status are the same as in polling mode.
+type targetProgress struct {
+	stream.TargetInfo
+	Step  string         `json:"step,omitempty"` // First step not done yet; empty once ready
+	Steps []progressStep `json:"steps"`
+}
+
+// wakeProgress is what the status endpoint streams to a loading page.
+type wakeProgress struct {
+	Status      string           `json:"status"` // waiting, failed (past the wake timeout; it may still recover), ready, maintenance or disabled
+	Elapsed     float64          `json:"elapsed_seconds"`
+	ETA         float64          `json:"eta_seconds,omitempty"` // Expected total wake-up time, from previous ones
+	Details     []targetProgress `json:"details"`
+	WarmUp      *progressStep    `json:"warm_up,omitempty"`     // Only for routes with a WarmupPath
+	Diagnostics []k8s.Diagnosis  `json:"diagnostics,omitempty"` // Problems keeping deployments from becoming ready
+}
+
+// progressHub shares one progress watcher per route between all the loading pages streaming it,
+// so that the API server is polled once per route rather than once per page.
+type progressHub struct {
+	mu       sync.Mutex
+	watchers map[string]map[chan wakeProgress]struct{} // Subscribers, by route ID
+	latest   map[string]wakeProgress                   // Last progress sent, by route ID
+	eta      map[string]float64                        // Moving average of step times in seconds; key: route|target|step
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{
+		watchers: make(map[string]map[chan wakeProgress]struct{}),
+		latest:   make(map[string]wakeProgress),
+		eta:      make(map[string]float64),
+	}
+}
+
+// subscribe returns a channel receiving the progress of a route, starting with the latest one if any.
+// start is true if no watcher runs for the route yet: the caller must start one.
+func (p *progressHub) subscribe(routeID string) (ch chan wakeProgress, start bool) {
+	ch = make(chan wakeProgress, 1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	subscribers, running := p.watchers[routeID]
+	if !running {
+		subscribers = make(map[chan wakeProgress]struct{})
+		p.watchers[routeID] = subscribers
+	} else if latest, ok := p.latest[routeID]; ok {
+		ch <- latest
+	}
+	subscribers[ch] = struct{}{}
+	return ch, !running
+}
+
+func (p *progressHub) unsubscribe(routeID string, ch chan wakeProgress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.watchers[routeID], ch)
+}
+
+// publish sends the progress of a route to its subscribers, replacing any progress they have not read yet.
+// Once the route is ready, their channels are closed. It reports false when the watcher should stop.
+func (p *progressHub) publish(routeID string, progress wakeProgress) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	subscribers := p.watchers[routeID]
+	if len(subscribers) == 0 || progress.Status == "ready" {
+		for ch := range subscribers {
+			send(ch, progress)
+			close(ch)
+		}
+		delete(p.watchers, routeID)
+		delete(p.latest, routeID)
+		return false
+	}
+	for ch := range subscribers {
+		send(ch, progress)
+	}
+	p.latest[routeID] = progress
+	return true
+}
+
+// send never blocks: publish is the only writer of ch, which holds one value.
+func send(ch chan wakeProgress, progress wakeProgress) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- progress
+}
+
+func (p *progressHub) expected(key string) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return math.Round(p.eta[key])
+}
+
+func (p *progressHub) observe(key string, seconds float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if prev, ok := p.eta[key]; ok {
+		seconds = prev + etaWeight*(seconds-prev)
+	}
+	p.eta[key] = seconds
+}
+
+// progressState is what a watcher remembers between two polls.
+type progressState struct {
+	first   time.Time       // Start of the watch, used when the start of the wake-up is unknown
+	pending map[string]bool // Steps seen not done yet; their completion times feed the ETAs
+	warm    bool            // The warm-up passed
+}
+
+// streamProgress streams the wake-up progress of a route as server-sent "progress" events, one per second,
+// and a final "ready" event once every deployment is ready and the warm-up passed.
+func (h *Handler) streamProgress(w http.ResponseWriter, r *http.Request, route store.RouteConfig) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	flusher.Flush()
+
+	ch, start := h.progress.subscribe(route.ID)
+	defer h.progress.unsubscribe(route.ID, ch)
+	if start {
+		go h.watchProgress(route)
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case progress, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(progress)
+			event := "progress"
+			if progress.Status == "ready" {
+				event = "ready"
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			flusher.Flush()
+			if event == "ready" {
+				return
+			}
+		}
+	}
+}
+
+// watchProgress polls the progress of a route until it is ready or nobody streams it anymore.
+func (h *Handler) watchProgress(route store.RouteConfig) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	state := &progressState{first: time.Now(), pending: make(map[string]bool)}
+	for {
+		progress := h.checkProgress(route, state)
+		if progress.Status == "ready" {
+			h.routeReady(route)
+		}
+		if !h.progress.publish(route.ID, progress) {
+			return
+		}
+		<-ticker.C
+	}
+}
+
+// checkProgress returns the current progress of a route, and learns how long each step takes.
+func (h *Handler) checkProgress(route store.RouteConfig, state *progressState) wakeProgress {
+	ctx, cancel := context.WithTimeout(logger.WithRouteID(context.Background(), route.ID), 5*time.Second)
+	defer cancel()
+
+	origin, waking := h.Metrics.wakeStarted(route.ID)
+	if !waking {
+		origin = state.first
+	}
+	elapsed := time.Since(origin).Seconds()
+
+	// Only steps completed during a wake-up started by the proxy are timed
+	track := func(key string, done bool) {
+		if !done {
+			state.pending[key] = true
+		} else if state.pending[key] {
+			delete(state.pending, key)
+			if waking {
+				h.progress.observe(key, elapsed)
+			}
+		}
+	}
+
+	progress := wakeProgress{Status: "waiting", Elapsed: math.Round(elapsed*10) / 10}
+	if mode, blocked := h.blocked(route.ID); blocked {
+		progress.Status = mode // The loading page reloads to show the maintenance or not found page
+		return progress
+	}
+
+	statuses, allReady := h.targetStatuses(ctx, route)
+	for i, target := range chainTargets(route) {
+		done := len(podSteps)
+		if statuses[i].Status != "Ready" {
+			done = h.podStepsDone(ctx, target)
+		}
+		tp := targetProgress{TargetInfo: statuses[i]}
+		for j, name := range podSteps {
+			key := route.ID + "|" + target.Label + "|" + name
+			step := progressStep{Name: name, Done: j < done, ETA: h.progress.expected(key)}
+			track(key, step.Done)
+			if !step.Done && tp.Step == "" {
+				tp.Step = name
+			}
+			tp.Steps = append(tp.Steps, step)
+		}
+		progress.Details = append(progress.Details, tp)
+	}
+
+	ready := allReady
+	if route.WarmupPath != "" {
+		key := route.ID + "||" + stepWarmUp
+		if allReady && !state.warm {
+			state.warm = h.warmUp(ctx, route)
+		}
+		step := progressStep{Name: stepWarmUp, Done: allReady && state.warm, ETA: h.progress.expected(key)}
+		track(key, step.Done)
+		progress.WarmUp = &step
+		ready = step.Done
+	}
+
+	track(totalKey(route), ready)
+	progress.ETA = h.expectedWake(route)
+	if ready {
+		progress.Status = "ready"
+		return progress
+	}
+	if !allReady {
+		progress.Diagnostics = h.diagnose(ctx, route)
+	}
+	if _, failed := h.Metrics.Failure(route.ID); failed {
+		progress.Status = "failed"
+	}
+	return progress
+}
+
+func totalKey(route store.RouteConfig) string {
+	return route.ID + "||total"
+}
+
+// expectedWake returns the expected wake-up time of a route in seconds, learned from previous wake-ups or,
+// after a restart, from the cold starts recorded by the savings tracker. It is 0 if unknown.
+func (h *Handler) expectedWake(route store.RouteConfig) float64 {
+	if eta := h.progress.expected(totalKey(route)); eta > 0 {
+		return eta
+	}
+	return math.Round(h.Savings.AverageColdStart(route.ID).Seconds())
+}
+
+// podStepsDone returns how many wake-up steps the most advanced pod of a deployment has completed.
+// Terminating pods are ignored.
+func (h *Handler) podStepsDone(ctx context.Context, target chainTarget) int {
+	pods, err := h.k8sClient.ListDeploymentPods(ctx, target.Namespace, target.Name)
+	if err != nil {
+		log.DebugContext(ctx, "Could not list pods", "deployment", target.Name, "error", err)
+		return 0
+	}
+	best := 0
+	for i := range pods {
+		if pods[i].DeletionTimestamp != nil {
+			continue
+		}
+		if n := podStepsDone(&pods[i]); n > best {
+			best = n
+		}
+	}
+	return best
+}
+
+func podStepsDone(pod *corev1.Pod) int {
+	if !podCondition(pod, corev1.PodScheduled) {
+		return 0
+	}
+	statuses := pod.Status.ContainerStatuses
+	if len(statuses) == 0 {
+		return 1
+	}
+	for _, cs := range statuses {
+		if cs.ImageID == "" {
+			return 1
+		}
+	}
+	for _, cs := range statuses {
+		if cs.State.Running == nil {
+			return 2
+		}
+	}
+	if !podCondition(pod, corev1.PodReady) {
+		return 3
+	}
+	return 4
+}
+
+func podCondition(pod *corev1.Pod, condition corev1.PodConditionType) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == condition {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// warmUp requests the route's WarmupPath on its target service and reports whether it answered 2xx or 3xx.
+func (h *Handler) warmUp(ctx context.Context, route store.RouteConfig) bool {
+	ctx, cancel := context.WithTimeout(ctx, warmupTimeout)
+	defer cancel()
+	path := route.WarmupPath
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	target := fmt.Sprintf("http://%s.%s.svc.cluster.local:%d%s", route.TargetService, route.Namespace, route.TargetPort, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		log.WarnContext(ctx, "Invalid warm-up URL", "url", target, "error", err)
+		return true // Don't block the route on a configuration mistake
+	}
+	resp, err := warmupClient.Do(req)
+	if err != nil {
+		log.DebugContext(ctx, "Warm-up request failed", "url", target, "error", err)
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 400
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProgressHub(t *testing.T) {
+	p := newProgressHub()
+	first, start := p.subscribe("shop")
+	if !start {
+		t.Fatal("no watcher to start for the first page")
+	}
+	p.publish("shop", wakeProgress{Status: "waiting", Elapsed: 1})
+	p.publish("shop", wakeProgress{Status: "waiting", Elapsed: 2})
+	if progress := <-first; progress.Elapsed != 2 {
+		t.Errorf("got %+v, want only the latest progress", progress)
+	}
+
+	// Later pages share the watcher and start from the latest progress
+	second, start := p.subscribe("shop")
+	if start {
+		t.Error("second watcher started")
+	}
+	if progress := <-second; progress.Elapsed != 2 {
+		t.Errorf("second page starts with %+v", progress)
+	}
+
+	if p.publish("shop", wakeProgress{Status: "ready", Elapsed: 3}) {
+		t.Error("watcher kept running once ready")
+	}
+	for _, ch := range []chan wakeProgress{first, second} {
+		if progress := <-ch; progress.Status != "ready" {
+			t.Errorf("got %+v", progress)
+		}
+		if _, open := <-ch; open {
+			t.Error("channel left open once ready")
+		}
+	}
+
+	// A watcher nobody listens to anymore stops
+	ch, _ := p.subscribe("blog")
+	p.unsubscribe("blog", ch)
+	if p.publish("blog", wakeProgress{Status: "waiting"}) {
+		t.Error("watcher kept running without pages")
+	}
+	if _, start := p.subscribe("blog"); !start {
+		t.Error("no watcher to restart")
+	}
+}
+
+func TestStepETAs(t *testing.T) {
+	p := newProgressHub()
+	if eta := p.expected("shop|web|ready"); eta != 0 {
+		t.Errorf("ETA %v before any wake-up", eta)
+	}
+	p.observe("shop|web|ready", 10)
+	p.observe("shop|web|ready", 20)
+	if eta := p.expected("shop|web|ready"); eta != 13 {
+		t.Errorf("ETA %v, want the moving average 13", eta)
+	}
+}
+
+func TestPodStepsDone(t *testing.T) {
+	condition := func(c corev1.PodConditionType, ok bool) corev1.PodCondition {
+		status := corev1.ConditionFalse
+		if ok {
+			status = corev1.ConditionTrue
+		}
+		return corev1.PodCondition{Type: c, Status: status}
+	}
+	pulled := corev1.ContainerStatus{ImageID: "docker.io/library/nginx@sha256:0"}
+	running := pulled
+	running.State.Running = &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(time.Now())}
+	pod := func(status corev1.PodStatus) *corev1.Pod { return &corev1.Pod{Status: status} }
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want int
+	}{
+		{"pending", pod(corev1.PodStatus{}), 0},
+		{"unschedulable", pod(corev1.PodStatus{Conditions: []corev1.PodCondition{condition(corev1.PodScheduled, false)}}), 0},
+		{"scheduled", pod(corev1.PodStatus{Conditions: []corev1.PodCondition{condition(corev1.PodScheduled, true)}}), 1},
+		{"pulling", pod(corev1.PodStatus{Conditions: []corev1.PodCondition{condition(corev1.PodScheduled, true)},
+			ContainerStatuses: []corev1.ContainerStatus{pulled, {}}}), 1},
+		{"pulled", pod(corev1.PodStatus{Conditions: []corev1.PodCondition{condition(corev1.PodScheduled, true)},
+			ContainerStatuses: []corev1.ContainerStatus{running, pulled}}), 2},
+		{"started", pod(corev1.PodStatus{Conditions: []corev1.PodCondition{condition(corev1.PodScheduled, true), condition(corev1.PodReady, false)},
+			ContainerStatuses: []corev1.ContainerStatus{running}}), 3},
+		{"ready", pod(corev1.PodStatus{Conditions: []corev1.PodCondition{condition(corev1.PodScheduled, true), condition(corev1.PodReady, true)},
+			ContainerStatuses: []corev1.ContainerStatus{running}}), 4},
+	}
+	for _, tt := range tests {
+		if got := podStepsDone(tt.pod); got != tt.want {
+			t.Errorf("%s: %d steps done, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/stream"
+)
+
+// stateInterval is how often WatchStates checks the deployments of every route.
+const stateInterval = 2 * time.Second
+
+// watchedRoute is what WatchStates last published about a route.
+type watchedRoute struct {
+	state    string
+	progress []stream.TargetInfo
+}
+
+// WatchStates publishes route.state events when a route changes state, and wake.progress events when a
+// deployment of a waking route changes status. It reads the informer caches, and never returns.
+func (h *Handler) WatchStates() {
+	if h.Stream == nil || h.k8sClient == nil {
+		return
+	}
+	last := make(map[string]*watchedRoute)
+	ticker := time.NewTicker(stateInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		seen := make(map[string]bool)
+		for _, route := range h.store.GetAllRoutes() {
+			seen[route.ID] = true
+			ctx := logger.WithRouteID(context.Background(), route.ID)
+
+			state := h.routeState(ctx, route)
+
+			prev, known := last[route.ID]
+			if !known {
+				prev = &watchedRoute{}
+				last[route.ID] = prev
+			}
+
+			// Progress while waking, and once more when the wake-up completes
+			if waking(state) || waking(prev.state) {
+				statuses, _ := h.targetStatuses(ctx, route)
+				if !sameStatuses(statuses, prev.progress) {
+					progress := stream.Progress{Total: len(statuses), Targets: statuses}
+					for _, s := range statuses {
+						if s.Status == "Ready" {
+							progress.Ready++
+						}
+					}
+					h.Stream.Publish(stream.WakeProgress, route.ID, route.Namespace, progress)
+					prev.progress = statuses
+				}
+			} else {
+				prev.progress = nil
+			}
+
+			if state != prev.state {
+				h.Stream.Publish(stream.RouteState, route.ID, route.Namespace, stream.StateChange{From: prev.state, To: state})
+				prev.state = state
+			}
+		}
+		for id := range last {
+			if !seen[id] {
+				delete(last, id)
+			}
+		}
+	}
+}
+
+func waking(state string) bool {
+	return state == "waking" || state == "failed"
+}
+
+func sameStatuses(a, b []stream.TargetInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
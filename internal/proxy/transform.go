@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"encoding/json"
+	"sync"
+
+	"smart-proxy/internal/store"
+	"smart-proxy/internal/transform"
+)
+
+// transformCache keeps the response transformation pipeline of each route, built again when its
+// transforms change.
+type transformCache struct {
+	mu      sync.Mutex
+	entries map[string]transformEntry // Key: Route ID
+}
+
+type transformEntry struct {
+	config   string // JSON of the transforms the pipeline was built from
+	pipeline *transform.Pipeline
+}
+
+func newTransformCache() *transformCache {
+	return &transformCache{entries: make(map[string]transformEntry)}
+}
+
+// transformPipeline returns the pipeline of a route, nil if it has no valid transforms. Invalid transforms
+// are logged once per change and left out.
+func (h *Handler) transformPipeline(route store.RouteConfig) *transform.Pipeline {
+	if len(route.Transforms) == 0 {
+		return nil
+	}
+	config, _ := json.Marshal(route.Transforms)
+
+	h.transforms.mu.Lock()
+	defer h.transforms.mu.Unlock()
+	entry, ok := h.transforms.entries[route.ID]
+	if !ok || entry.config != string(config) {
+		pipeline, err := transform.NewPipeline(route.Transforms, h.transformMaxBody)
+		if err != nil {
+			log.Warn("Invalid response transforms, leaving them out", "route", route.ID, "error", err)
+		}
+		entry = transformEntry{config: string(config), pipeline: pipeline}
+		h.transforms.entries[route.ID] = entry
+	}
+	if entry.pipeline.Len() == 0 {
+		return nil
+	}
+	return entry.pipeline
+}
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+)
+
+// wakePath receives the click of the human verification step on the loading page.
+const wakePath = "/__smart_proxy/wake"
+
+// botUserAgents matches crawlers, uptime checkers, load balancer probes and vulnerability scanners.
+// Empty user agents are treated as bots as well.
+var botUserAgents = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|facebookexternalhit|uptime|pingdom|statuscake|monitor|kube-probe|healthcheck|health-check|elb-healthchecker|zgrab|masscan|nmap|nikto|sqlmap|nuclei|censys|expanse`)
+
+// botPaths are requested by browsers and bots alike without anyone wanting the app itself.
+var botPaths = []string{"/favicon.ico", "/robots.txt", "/.well-known/", "/apple-touch-icon", "/sitemap.xml"}
+
+// wakeFilter applies route WakePolicies. Compiled user agent patterns are cached.
+type wakeFilter struct {
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp // nil for invalid patterns
+}
+
+func newWakeFilter() *wakeFilter {
+	return &wakeFilter{patterns: make(map[string]*regexp.Regexp)}
+}
+
+// filter returns why r may not wake the route, or "" if it may.
+func (f *wakeFilter) filter(r *http.Request, policy *store.WakePolicy) string {
+	if policy == nil {
+		return ""
+	}
+
+	if len(policy.WakeMethods) > 0 && !containsFold(policy.WakeMethods, r.Method) {
+		return "method " + r.Method
+	}
+
+	path := r.URL.Path
+	for _, prefix := range policy.IgnorePaths {
+		if strings.HasPrefix(path, prefix) {
+			return "path " + path
+		}
+	}
+
+	ua := r.UserAgent()
+	if policy.IgnoreBots {
+		for _, prefix := range botPaths {
+			if strings.HasPrefix(path, prefix) {
+				return "path " + path
+			}
+		}
+		if ua == "" || botUserAgents.MatchString(ua) {
+			return "bot"
+		}
+	}
+	for _, pattern := range policy.IgnoreUserAgents {
+		if re := f.compile(pattern); re != nil && re.MatchString(ua) {
+			return "user agent"
+		}
+	}
+	return ""
+}
+
+func (f *wakeFilter) compile(pattern string) *regexp.Regexp {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if re, ok := f.patterns[pattern]; ok {
+		return re
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		log.Warn("Ignoring invalid user agent pattern", "pattern", pattern, "error", err)
+		re = nil
+	}
+	f.patterns[pattern] = re
+	return re
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveFiltered answers a filtered request for a sleeping route without touching the cluster.
+func serveFiltered(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", "60")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	http.Error(w, "Service is sleeping", http.StatusServiceUnavailable)
+}
+
+// wakeToken is embedded in the human verification page and redeemed at wakePath.
+type wakeToken struct {
+	RouteID string `json:"route_id"`
+	Expires int64  `json:"exp"`
+}
+
+// handleWake wakes the route named by a verification token. Only POST is accepted so that
+// link prefetchers and crawlers following URLs cannot trigger it, and the route's access policy is
+// enforced again: a token is not a pass for someone who could not load the page. A route that is no
+// longer asleep is left as it is. It returns the route ID, if the token was valid, and whether a
+// deployment was scaled up.
+func (h *Handler) handleWake(w http.ResponseWriter, r *http.Request) (routeID string, woke bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var token wakeToken
+	if err := h.access.verify(purposeWake, r.FormValue("token"), &token); err != nil || time.Now().Unix() > token.Expires {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	route, ok := h.store.GetRoute(token.RouteID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if _, allowed := h.access.check(w, r, &route); !allowed {
+		return
+	}
+
+	if mode, blocked := h.blocked(route.ID); blocked {
+		http.Error(w, "Route is "+mode, http.StatusConflict)
+		return
+	}
+
+	ctx := logger.WithRouteID(r.Context(), route.ID)
+	before := route
+	h.store.UpdateActivity(route.ID)
+	if _, sleeping := h.chainState(ctx, route); sleeping {
+		log.InfoContext(ctx, "Human verification passed. Waking up...")
+		woke = h.wakeChain(ctx, before, causeRequest)
+	}
+
+	// Plain form posts go back to the page; the loading page script expects no content
+	if returnTo := r.FormValue("return"); strings.HasPrefix(returnTo, "/") && !strings.HasPrefix(returnTo, "//") {
+		http.Redirect(w, r, returnTo, http.StatusSeeOther)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return route.ID, woke
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"smart-proxy/internal/store"
+)
+
+func TestWakeFilter(t *testing.T) {
+	const browser = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	bots := &store.WakePolicy{IgnoreBots: true}
+	tests := []struct {
+		name      string
+		policy    *store.WakePolicy
+		method    string
+		path      string
+		userAgent string
+		want      string
+	}{
+		{"no policy", nil, "GET", "/robots.txt", "", ""},
+		{"browser", bots, "GET", "/cart", browser, ""},
+		{"crawler", bots, "GET", "/cart", "Mozilla/5.0 (compatible; Googlebot/2.1)", "bot"},
+		{"probe", bots, "GET", "/", "kube-probe/1.28", "bot"},
+		{"scanner", bots, "GET", "/", "Mozilla/5.0 zgrab/0.x", "bot"},
+		{"empty user agent", bots, "GET", "/", "", "bot"},
+		{"favicon", bots, "GET", "/favicon.ico", browser, "path /favicon.ico"},
+		{"well-known", bots, "GET", "/.well-known/security.txt", browser, "path /.well-known/security.txt"},
+		{"bots allowed", &store.WakePolicy{}, "GET", "/", "Googlebot", ""},
+		{"ignored path", &store.WakePolicy{IgnorePaths: []string{"/metrics"}}, "GET", "/metrics/x", browser, "path /metrics/x"},
+		{"ignored user agent", &store.WakePolicy{IgnoreUserAgents: []string{"^curl/"}}, "GET", "/", "CURL/8.5", "user agent"},
+		{"other user agent", &store.WakePolicy{IgnoreUserAgents: []string{"^curl/"}}, "GET", "/", browser, ""},
+		{"invalid pattern", &store.WakePolicy{IgnoreUserAgents: []string{"curl("}}, "GET", "/", "curl(", ""},
+		{"wake method", &store.WakePolicy{WakeMethods: []string{"get", "POST"}}, "GET", "/", browser, ""},
+		{"other method", &store.WakePolicy{WakeMethods: []string{"GET"}}, "HEAD", "/", browser, "method HEAD"},
+	}
+
+	f := newWakeFilter()
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		r.Header.Set("User-Agent", tt.userAgent)
+		if got := f.filter(r, tt.policy); got != tt.want {
+			t.Errorf("%s: filtered for %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestServeFiltered(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveFiltered(w)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("%d %v", w.Code, w.Header())
+	}
+}
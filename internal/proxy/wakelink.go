@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// wakeLinkPath redeems wake links, on any host served by the proxy.
+const wakeLinkPath = "/__smart_proxy/wake-link"
+
+// Wake link limits.
+const (
+	DefaultWakeLinkTTL  = 24 * time.Hour
+	MaxWakeLinkTTL      = 30 * 24 * time.Hour
+	DefaultWakeLinkRate = 10 // Visits per hour
+)
+
+// wakeLinkToken is signed into wake links.
+type wakeLinkToken struct {
+	RouteID string `json:"route_id"`
+	LinkID  string `json:"link_id"`
+	Expires int64  `json:"exp"`
+	Rate    int    `json:"rate"` // Visits allowed per hour
+}
+
+// WakeLink is a shareable URL that wakes a route, for people without access to the admin API.
+type WakeLink struct {
+	ID          string    `json:"id"`
+	RouteID     string    `json:"route_id"`
+	Path        string    `json:"path"` // Path and query on the proxy
+	Expires     time.Time `json:"expires"`
+	RatePerHour int       `json:"rate_per_hour"`
+}
+
+// NewWakeLink signs a wake link for a route, valid for ttl and usable ratePerHour times per hour. Links are
+// signed with SESSION_SECRET: they stop working when it changes.
+func (h *Handler) NewWakeLink(routeID string, ttl time.Duration, ratePerHour int) (WakeLink, error) {
+	if _, ok := h.store.GetRoute(routeID); !ok {
+		return WakeLink{}, store.ErrRouteNotFound
+	}
+	if ttl <= 0 || ttl > MaxWakeLinkTTL {
+		return WakeLink{}, errors.New("the link must expire within 30 days")
+	}
+	if ratePerHour <= 0 {
+		return WakeLink{}, errors.New("the rate must be positive")
+	}
+
+	link := WakeLink{ID: uuid.New().String(), RouteID: routeID, Expires: time.Now().Add(ttl).Truncate(time.Second), RatePerHour: ratePerHour}
+	token, err := h.access.sign(purposeWakeLink, wakeLinkToken{RouteID: routeID, LinkID: link.ID, Expires: link.Expires.Unix(), Rate: ratePerHour})
+	if err != nil {
+		return WakeLink{}, err
+	}
+	link.Path = wakeLinkPath + "?token=" + url.QueryEscape(token)
+	return link, nil
+}
+
+// wakeLinkLimiter counts the visits of each wake link in fixed one-hour windows.
+type wakeLinkLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*linkWindow // Key: link ID
+}
+
+type linkWindow struct {
+	start  time.Time
+	visits int
+}
+
+func newWakeLinkLimiter() *wakeLinkLimiter {
+	return &wakeLinkLimiter{windows: make(map[string]*linkWindow)}
+}
+
+// allow counts a visit of a link and reports whether it is within the rate.
+func (l *wakeLinkLimiter) allow(linkID string, rate int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for id, w := range l.windows {
+		if now.Sub(w.start) >= time.Hour {
+			delete(l.windows, id)
+		}
+	}
+	w, ok := l.windows[linkID]
+	if !ok {
+		w = &linkWindow{start: now}
+		l.windows[linkID] = w
+	}
+	if w.visits >= rate {
+		return false
+	}
+	w.visits++
+	return true
+}
+
+// handleWakeLink serves wake links. Visiting a link (GET) only shows a page asking to confirm, so that link
+// previews of chat apps and crawlers neither wake the route nor use up the link; the confirmation (POST) wakes
+// the route and redirects to it, where the loading page follows the wake-up. The route's access policy still
+// applies there. It returns the route ID, if the link was used, and whether a deployment was scaled up.
+func (h *Handler) handleWakeLink(w http.ResponseWriter, r *http.Request) (routeID string, woke bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	raw := r.FormValue("token")
+	var token wakeLinkToken
+	if err := h.access.verify(purposeWakeLink, raw, &token); err != nil || token.LinkID == "" {
+		http.Error(w, "Invalid wake link", http.StatusBadRequest)
+		return
+	}
+	if time.Now().Unix() > token.Expires {
+		http.Error(w, "This wake link has expired", http.StatusGone)
+		return
+	}
+	route, ok := h.store.GetRoute(token.RouteID)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		data := h.pageData(r, route)
+		data.WakeLinkToken = raw
+		h.pages.render(w, http.StatusOK, &route, pageLoading, data)
+		return
+	}
+
+	ctx := logger.WithRouteID(r.Context(), route.ID)
+	if !h.wakeLinks.allow(token.LinkID, token.Rate) {
+		log.InfoContext(ctx, "Wake link rate exceeded", "link_id", token.LinkID)
+		w.Header().Set("Retry-After", "3600")
+		http.Error(w, "This wake link was used too often, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	// Blocked routes are not woken; the redirect shows their maintenance or not found page
+	var err error
+	if woke, err = h.Wake(ctx, route.ID, causeWakeLink); err != nil && !errors.Is(err, ErrWakeBlocked) {
+		log.ErrorContext(ctx, "Wake link failed", "link_id", token.LinkID, "error", err)
+		http.Error(w, "Could not wake the environment", http.StatusInternalServerError)
+		return
+	}
+	log.InfoContext(ctx, "Wake link used", "link_id", token.LinkID, "woke", woke)
+	http.Redirect(w, r, routeLocation(r, route), http.StatusSeeOther)
+	return route.ID, woke
+}
+
+// routeLocation returns where to send a client to reach a route: its path, on the route host if the request
+// came through another one.
+func routeLocation(r *http.Request, route store.RouteConfig) string {
+	path := route.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if route.Host == "" || strings.EqualFold(stripPort(r.Host), route.Host) {
+		return path
+	}
+	return "//" + route.Host + path
+}
@@ -0,0 +1,210 @@
+package savings
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Periods a report can be aggregated by.
+const (
+	Daily  = "day"
+	Weekly = "week" // Weeks start on Monday
+)
+
+// Query selects the intervals of a report.
+type Query struct {
+	Period  string
+	From    time.Time
+	To      time.Time
+	Include func(Interval) bool // Optional, e.g. to keep the namespaces the caller may view
+}
+
+// Row is the savings of one deployment over one period.
+type Row struct {
+	Period         time.Time `json:"period,omitzero"` // Start of the day or week, in UTC
+	RouteID        string    `json:"route_id,omitempty"`
+	Namespace      string    `json:"namespace,omitempty"`
+	Deployment     string    `json:"deployment,omitempty"`
+	SleepHours     float64   `json:"sleep_hours"`
+	CPUHours       float64   `json:"cpu_core_hours"`
+	MemoryGiBHours float64   `json:"memory_gib_hours"`
+	Cost           float64   `json:"cost,omitempty"`
+	Wakes          int       `json:"wakes"`
+	AvgColdStart   float64   `json:"avg_cold_start_seconds,omitempty"`
+	MaxColdStart   float64   `json:"max_cold_start_seconds,omitempty"`
+
+	coldStarts int // Wakes with a known cold start duration
+}
+
+// Report is the result of Tracker.Report. Total sums every row; its Period and names are empty.
+type Report struct {
+	Period string    `json:"period"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Prices Prices    `json:"prices"`
+	Rows   []Row     `json:"rows"`
+	Total  Row       `json:"total"`
+}
+
+// Report aggregates the sleep intervals overlapping [q.From, q.To) per period and deployment.
+// Intervals still open count until now.
+func (t *Tracker) Report(q Query) (*Report, error) {
+	if q.Period != Daily && q.Period != Weekly {
+		return nil, fmt.Errorf("invalid period %q, must be %q or %q", q.Period, Daily, Weekly)
+	}
+	if !q.To.After(q.From) {
+		return nil, fmt.Errorf("the end of the report must be after its start")
+	}
+	var prices Prices
+	if t != nil {
+		prices = t.Prices
+	}
+
+	type key struct {
+		period                         time.Time
+		routeID, namespace, deployment string
+	}
+	rows := make(map[key]*Row)
+	row := func(period time.Time, iv Interval) *Row {
+		k := key{period, iv.RouteID, iv.Namespace, iv.Deployment}
+		r, ok := rows[k]
+		if !ok {
+			r = &Row{Period: period, RouteID: iv.RouteID, Namespace: iv.Namespace, Deployment: iv.Deployment}
+			rows[k] = r
+		}
+		return r
+	}
+
+	now := time.Now()
+	for _, iv := range t.Intervals() {
+		if q.Include != nil && !q.Include(iv) {
+			continue
+		}
+
+		// Split the part of the interval inside the report into periods
+		end := iv.End
+		if iv.Open() {
+			end = now
+		}
+		start, end := later(iv.Start, q.From), earlier(end, q.To)
+		for p := periodStart(start, q.Period); p.Before(end); p = nextPeriod(p, q.Period) {
+			hours := earlier(end, nextPeriod(p, q.Period)).Sub(later(start, p)).Hours()
+			if hours <= 0 {
+				continue
+			}
+			r := row(p, iv)
+			r.SleepHours += hours
+			r.CPUHours += hours * iv.CPU
+			r.MemoryGiBHours += hours * iv.MemoryGiB
+		}
+
+		// The wake-up counts in the period it happened in
+		if !iv.Open() && !iv.End.Before(q.From) && iv.End.Before(q.To) {
+			r := row(periodStart(iv.End, q.Period), iv)
+			r.Wakes++
+			if iv.ColdStart > 0 {
+				r.addColdStart(iv.ColdStart.Seconds())
+			}
+		}
+	}
+
+	report := &Report{Period: q.Period, From: q.From, To: q.To, Prices: prices, Rows: make([]Row, 0, len(rows))}
+	for _, r := range rows {
+		r.Cost = r.CPUHours*prices.CPUHour + r.MemoryGiBHours*prices.MemoryGiBHour
+		report.Rows = append(report.Rows, *r)
+
+		total := &report.Total
+		total.SleepHours += r.SleepHours
+		total.CPUHours += r.CPUHours
+		total.MemoryGiBHours += r.MemoryGiBHours
+		total.Cost += r.Cost
+		total.Wakes += r.Wakes
+		if r.coldStarts > 0 {
+			total.AvgColdStart = (total.AvgColdStart*float64(total.coldStarts) + r.AvgColdStart*float64(r.coldStarts)) /
+				float64(total.coldStarts+r.coldStarts)
+			total.coldStarts += r.coldStarts
+			total.MaxColdStart = max(total.MaxColdStart, r.MaxColdStart)
+		}
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if !a.Period.Equal(b.Period) {
+			return a.Period.Before(b.Period)
+		}
+		if a.RouteID != b.RouteID {
+			return a.RouteID < b.RouteID
+		}
+		return a.Namespace+"/"+a.Deployment < b.Namespace+"/"+b.Deployment
+	})
+	return report, nil
+}
+
+func (r *Row) addColdStart(seconds float64) {
+	r.AvgColdStart = (r.AvgColdStart*float64(r.coldStarts) + seconds) / float64(r.coldStarts+1)
+	r.coldStarts++
+	r.MaxColdStart = max(r.MaxColdStart, seconds)
+}
+
+// WriteCSV writes one line per row, without the total.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"period", "route_id", "namespace", "deployment", "sleep_hours", "cpu_core_hours",
+		"memory_gib_hours", "cost", "currency", "wakes", "avg_cold_start_seconds", "max_cold_start_seconds"})
+	for _, row := range r.Rows {
+		cw.Write([]string{
+			row.Period.Format("2006-01-02"),
+			row.RouteID,
+			row.Namespace,
+			row.Deployment,
+			formatFloat(row.SleepHours),
+			formatFloat(row.CPUHours),
+			formatFloat(row.MemoryGiBHours),
+			formatFloat(row.Cost),
+			r.Prices.Currency,
+			strconv.Itoa(row.Wakes),
+			formatFloat(row.AvgColdStart),
+			formatFloat(row.MaxColdStart),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
+
+// periodStart returns the start of the UTC day or week containing t.
+func periodStart(t time.Time, period string) time.Time {
+	y, m, d := t.UTC().Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if period == Weekly {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+func nextPeriod(p time.Time, period string) time.Time {
+	if period == Weekly {
+		return p.AddDate(0, 0, 7)
+	}
+	return p.AddDate(0, 0, 1)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,82 @@
+package savings
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(day, hour int) time.Time {
+	return time.Date(2024, time.March, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestDailyReport(t *testing.T) {
+	tracker := &Tracker{Prices: Prices{CPUHour: 0.5, MemoryGiBHour: 0.25, Currency: "EUR"}, intervals: []Interval{
+		// Asleep from 20:00 on the 4th to 08:00 on the 5th
+		{RouteID: "shop", Namespace: "shop", Deployment: "web", Start: date(4, 20), End: date(5, 8), CPU: 1, MemoryGiB: 2, ColdStart: 4 * time.Second},
+		{RouteID: "shop", Namespace: "shop", Deployment: "web", Start: date(5, 12), End: date(5, 13), CPU: 1, MemoryGiB: 2, ColdStart: 8 * time.Second},
+		// Starts before the report
+		{RouteID: "blog", Namespace: "blog", Deployment: "web", Start: date(1, 0), End: date(4, 2), CPU: 2},
+		{RouteID: "hidden", Namespace: "hidden", Deployment: "web", Start: date(4, 0), End: date(4, 1), CPU: 1},
+	}}
+
+	report, err := tracker.Report(Query{Period: Daily, From: date(4, 0), To: date(6, 0),
+		Include: func(iv Interval) bool { return iv.Namespace != "hidden" }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Row{
+		{Period: date(4, 0), RouteID: "blog", Namespace: "blog", Deployment: "web", SleepHours: 2, CPUHours: 4, Cost: 2, Wakes: 1},
+		{Period: date(4, 0), RouteID: "shop", Namespace: "shop", Deployment: "web", SleepHours: 4, CPUHours: 4, MemoryGiBHours: 8, Cost: 4},
+		{Period: date(5, 0), RouteID: "shop", Namespace: "shop", Deployment: "web", SleepHours: 9, CPUHours: 9, MemoryGiBHours: 18, Cost: 9,
+			Wakes: 2, AvgColdStart: 6, MaxColdStart: 8, coldStarts: 2},
+	}
+	if len(report.Rows) != len(want) {
+		t.Fatalf("rows %+v", report.Rows)
+	}
+	for i := range want {
+		if report.Rows[i] != want[i] {
+			t.Errorf("row %d:\ngot  %+v\nwant %+v", i, report.Rows[i], want[i])
+		}
+	}
+	total := Row{SleepHours: 15, CPUHours: 17, MemoryGiBHours: 26, Cost: 15, Wakes: 3, AvgColdStart: 6, MaxColdStart: 8, coldStarts: 2}
+	if report.Total != total {
+		t.Errorf("total %+v, want %+v", report.Total, total)
+	}
+
+	var csv bytes.Buffer
+	if err := report.WriteCSV(&csv); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 4 || lines[3] != "2024-03-05,shop,shop,web,9.000,9.000,18.000,9.000,EUR,2,6.000,8.000" {
+		t.Errorf("CSV:\n%s", csv.String())
+	}
+}
+
+func TestWeeklyReport(t *testing.T) {
+	// Friday the 8th to Tuesday the 12th crosses into the week starting Monday the 11th
+	tracker := &Tracker{intervals: []Interval{{RouteID: "shop", Start: date(8, 0), End: date(12, 0), CPU: 1}}}
+	report, err := tracker.Report(Query{Period: Weekly, From: date(1, 0), To: date(31, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 2 || !report.Rows[0].Period.Equal(date(4, 0)) || report.Rows[0].SleepHours != 72 ||
+		!report.Rows[1].Period.Equal(date(11, 0)) || report.Rows[1].SleepHours != 24 || report.Rows[1].Wakes != 1 {
+		t.Errorf("rows %+v", report.Rows)
+	}
+}
+
+func TestInvalidReport(t *testing.T) {
+	var tracker *Tracker
+	if _, err := tracker.Report(Query{Period: "month", From: date(1, 0), To: date(2, 0)}); err == nil {
+		t.Error("monthly report")
+	}
+	if _, err := tracker.Report(Query{Period: Daily, From: date(2, 0), To: date(2, 0)}); err == nil {
+		t.Error("empty range")
+	}
+	if report, err := tracker.Report(Query{Period: Daily, From: date(1, 0), To: date(2, 0)}); err != nil || len(report.Rows) != 0 {
+		t.Errorf("report of a nil tracker: %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,285 @@
+// Package savings records when deployments sleep and wake up, and what they would have requested meanwhile,
+// to report the CPU and memory (and optionally the money) saved by scaling idle routes to zero.
+package savings
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+var log = logger.Component("savings")
+
+// Interval is a period during which a deployment was scaled to zero.
+type Interval struct {
+	RouteID    string        `json:"route_id"`
+	Namespace  string        `json:"namespace"`
+	Deployment string        `json:"deployment"`
+	Start      time.Time     `json:"start"`
+	End        time.Time     `json:"end"`        // Zero while still asleep
+	Replicas   int32         `json:"replicas"`   // Replicas scaled down
+	CPU        float64       `json:"cpu"`        // Cores requested by those replicas
+	MemoryGiB  float64       `json:"memory_gib"` // Memory requested by those replicas
+	ColdStart  time.Duration `json:"cold_start,omitempty"`
+}
+
+// Open reports whether the deployment is still asleep.
+func (i Interval) Open() bool {
+	return i.End.IsZero()
+}
+
+// Prices converts resources into money. Zero prices leave costs out of the report.
+type Prices struct {
+	CPUHour       float64 `json:"cpu_hour"`        // Per core-hour
+	MemoryGiBHour float64 `json:"memory_gib_hour"` // Per GiB-hour
+	Currency      string  `json:"currency,omitempty"`
+}
+
+// Tracker keeps the sleep intervals in a JSON file. A nil *Tracker records nothing.
+type Tracker struct {
+	mu        sync.Mutex
+	intervals []Interval
+	filePath  string
+	retention time.Duration
+	Prices    Prices
+}
+
+// defaultRetention applies when SAVINGS_RETENTION is unset.
+const defaultRetention = 90 * 24 * time.Hour
+
+// NewTracker loads the intervals saved at filePath, if any. An empty filePath keeps them in memory only.
+func NewTracker(filePath string, retention time.Duration) (*Tracker, error) {
+	t := &Tracker{filePath: filePath, retention: retention}
+	if filePath == "" {
+		return t, nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return t, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &t.intervals); err != nil {
+		return nil, fmt.Errorf("invalid savings file %s: %w", filePath, err)
+	}
+	return t, nil
+}
+
+// FromEnv returns a tracker configured by SAVINGS_PATH (default: savings.json), SAVINGS_RETENTION (default: 2160h),
+// SAVINGS_CPU_PRICE, SAVINGS_MEMORY_PRICE and SAVINGS_CURRENCY.
+func FromEnv() (*Tracker, error) {
+	path := os.Getenv("SAVINGS_PATH")
+	if path == "" {
+		path = "savings.json"
+	}
+	retention := defaultRetention
+	if s := os.Getenv("SAVINGS_RETENTION"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SAVINGS_RETENTION %q", s)
+		}
+		retention = d
+	}
+
+	var prices Prices
+	for _, p := range []struct {
+		env   string
+		value *float64
+	}{{"SAVINGS_CPU_PRICE", &prices.CPUHour}, {"SAVINGS_MEMORY_PRICE", &prices.MemoryGiBHour}} {
+		if s := os.Getenv(p.env); s != "" {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil || f < 0 {
+				return nil, fmt.Errorf("invalid %s %q", p.env, s)
+			}
+			*p.value = f
+		}
+	}
+	prices.Currency = os.Getenv("SAVINGS_CURRENCY")
+
+	t, err := NewTracker(path, retention)
+	if err != nil {
+		return nil, err
+	}
+	t.Prices = prices
+	return t, nil
+}
+
+// Requests returns the CPU (cores) and memory (GiB) requested by one replica of the deployment.
+func Requests(deployment *appsv1.Deployment) (cpu, memoryGiB float64) {
+	for _, c := range deployment.Spec.Template.Spec.Containers {
+		if q, ok := c.Resources.Requests["cpu"]; ok {
+			cpu += q.AsApproximateFloat64()
+		}
+		if q, ok := c.Resources.Requests["memory"]; ok {
+			memoryGiB += q.AsApproximateFloat64() / (1 << 30)
+		}
+	}
+	return cpu, memoryGiB
+}
+
+// Slept records that the deployment, which belongs to route, was scaled to zero. deployment must be read
+// before scaling, so that its spec still holds the replicas that were running.
+func (t *Tracker) Slept(route store.RouteConfig, deployment *appsv1.Deployment) {
+	if t == nil || deployment == nil {
+		return
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	if replicas == 0 {
+		return
+	}
+	cpu, memory := Requests(deployment)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.open(deployment.Namespace, deployment.Name) >= 0 {
+		return // Shared dependency, already asleep for another route
+	}
+	t.intervals = append(t.intervals, Interval{
+		RouteID:    route.ID,
+		Namespace:  deployment.Namespace,
+		Deployment: deployment.Name,
+		Start:      time.Now(),
+		Replicas:   replicas,
+		CPU:        cpu * float64(replicas),
+		MemoryGiB:  memory * float64(replicas),
+	})
+	t.save()
+}
+
+// Woke records that the deployment was scaled up again.
+func (t *Tracker) Woke(namespace, name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i := t.open(namespace, name); i >= 0 {
+		t.intervals[i].End = time.Now()
+		t.prune()
+		t.save()
+	}
+}
+
+// Ready records the cold start duration of the route's latest wake-up.
+func (t *Tracker) Ready(routeID string, coldStart time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := len(t.intervals) - 1; i >= 0; i-- {
+		if iv := &t.intervals[i]; iv.RouteID == routeID && !iv.Open() {
+			if iv.ColdStart == 0 {
+				iv.ColdStart = coldStart
+				t.save()
+			}
+			return
+		}
+	}
+}
+
+// AverageColdStart returns the mean cold start of the route's last wake-ups (up to 10), or 0 if none
+// was recorded.
+func (t *Tracker) AverageColdStart(routeID string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var total time.Duration
+	n := 0
+	for i := len(t.intervals) - 1; i >= 0 && n < 10; i-- {
+		if iv := t.intervals[i]; iv.RouteID == routeID && iv.ColdStart > 0 {
+			total += iv.ColdStart
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / time.Duration(n)
+}
+
+// Reconcile closes the intervals of deployments scaled up without the proxy, e.g. with kubectl.
+// awake reports whether a deployment currently has replicas.
+func (t *Tracker) Reconcile(awake func(namespace, name string) bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	var sleeping []Interval
+	for _, iv := range t.intervals {
+		if iv.Open() {
+			sleeping = append(sleeping, iv)
+		}
+	}
+	t.mu.Unlock()
+
+	// Checked without the lock, awake may call the API server
+	for _, iv := range sleeping {
+		if awake(iv.Namespace, iv.Deployment) {
+			log.Debug("Deployment was scaled up outside the proxy", "route_id", iv.RouteID, "deployment", iv.Deployment)
+			t.Woke(iv.Namespace, iv.Deployment)
+		}
+	}
+}
+
+// Intervals returns a copy of the recorded intervals.
+func (t *Tracker) Intervals() []Interval {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Interval(nil), t.intervals...)
+}
+
+// open returns the index of the open interval of a deployment, or -1.
+func (t *Tracker) open(namespace, name string) int {
+	for i, iv := range t.intervals {
+		if iv.Open() && iv.Namespace == namespace && iv.Deployment == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// prune drops intervals that ended before the retention period.
+func (t *Tracker) prune() {
+	if t.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-t.retention)
+	kept := t.intervals[:0]
+	for _, iv := range t.intervals {
+		if iv.Open() || iv.End.After(cutoff) {
+			kept = append(kept, iv)
+		}
+	}
+	t.intervals = kept
+}
+
+func (t *Tracker) save() {
+	if t.filePath == "" {
+		return
+	}
+	data, err := json.Marshal(t.intervals)
+	if err == nil {
+		err = os.WriteFile(t.filePath, data, 0644)
+	}
+	if err != nil {
+		log.Warn("Failed to save sleep intervals", "path", t.filePath, "error", err)
+	}
+}
@@ -0,0 +1,119 @@
+package savings
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/store"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func deployment(name string, replicas int32) *appsv1.Deployment {
+	container := func(cpu, memory string) corev1.Container {
+		return corev1.Container{Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceCPU: resource.MustParse(cpu), corev1.ResourceMemory: resource.MustParse(memory)}}}
+	}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+				container("250m", "256Mi"), container("250m", "768Mi"),
+			}}},
+		},
+	}
+}
+
+func TestTrackSleepAndWake(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "savings.json")
+	tracker, err := NewTracker(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shop := store.RouteConfig{ID: "shop"}
+
+	tracker.Slept(shop, deployment("web", 2))
+	tracker.Slept(store.RouteConfig{ID: "blog"}, deployment("web", 2)) // Shared, already asleep
+	tracker.Slept(shop, deployment("db", 0))                           // Nothing was running
+	intervals := tracker.Intervals()
+	if len(intervals) != 1 {
+		t.Fatalf("intervals %+v", intervals)
+	}
+	if iv := intervals[0]; iv.RouteID != "shop" || iv.Replicas != 2 || iv.CPU != 1 || iv.MemoryGiB != 2 || !iv.Open() {
+		t.Errorf("interval %+v", iv)
+	}
+
+	tracker.Ready("shop", time.Second) // Still asleep, nothing to complete
+	tracker.Woke("shop", "web")
+	tracker.Ready("shop", 5*time.Second)
+	tracker.Ready("shop", 9*time.Second) // Only the first readiness counts
+	reloaded, err := NewTracker(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intervals = reloaded.Intervals()
+	if len(intervals) != 1 || intervals[0].Open() || intervals[0].ColdStart != 5*time.Second {
+		t.Errorf("reloaded intervals %+v", intervals)
+	}
+}
+
+func TestReconcileAndRetention(t *testing.T) {
+	old := time.Now().Add(-3 * time.Hour)
+	tracker := &Tracker{retention: time.Hour, intervals: []Interval{
+		{RouteID: "shop", Namespace: "shop", Deployment: "old", Start: old, End: old.Add(time.Hour)},
+		{RouteID: "shop", Namespace: "shop", Deployment: "web", Start: old},
+		{RouteID: "shop", Namespace: "shop", Deployment: "db", Start: old},
+	}}
+
+	tracker.Reconcile(func(namespace, name string) bool { return name == "web" })
+	intervals := tracker.Intervals()
+	if len(intervals) != 2 || intervals[0].Deployment != "web" || intervals[0].Open() || !intervals[1].Open() {
+		t.Errorf("intervals %+v", intervals)
+	}
+
+	var none *Tracker
+	none.Slept(store.RouteConfig{ID: "shop"}, deployment("web", 1))
+	if none.Intervals() != nil {
+		t.Error("nil tracker recorded an interval")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("SAVINGS_PATH", filepath.Join(t.TempDir(), "savings.json"))
+	t.Setenv("SAVINGS_CPU_PRICE", "0.03")
+	t.Setenv("SAVINGS_CURRENCY", "EUR")
+	tracker, err := FromEnv()
+	if err != nil || tracker.Prices != (Prices{CPUHour: 0.03, Currency: "EUR"}) || tracker.retention != defaultRetention {
+		t.Errorf("tracker %+v, %v", tracker, err)
+	}
+
+	for env, value := range map[string]string{"SAVINGS_RETENTION": "-1h", "SAVINGS_MEMORY_PRICE": "free"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := FromEnv(); err == nil {
+				t.Errorf("%s=%s accepted", env, value)
+			}
+		})
+	}
+}
+
+func TestAverageColdStart(t *testing.T) {
+	tracker := &Tracker{}
+	for i := 1; i <= 12; i++ {
+		tracker.intervals = append(tracker.intervals, Interval{RouteID: "shop", End: time.Now(), ColdStart: time.Duration(i) * time.Second})
+	}
+	tracker.intervals = append(tracker.intervals, Interval{RouteID: "blog", End: time.Now(), ColdStart: time.Minute}, Interval{RouteID: "shop"})
+
+	// The last 10 wake-ups of the route: 3s to 12s
+	if avg := tracker.AverageColdStart("shop"); avg != 7500*time.Millisecond {
+		t.Errorf("average %s", avg)
+	}
+	if avg := tracker.AverageColdStart("other"); avg != 0 {
+		t.Errorf("average %s without wake-ups", avg)
+	}
+}
@@ -4,7 +4,9 @@ package store
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,30 +15,210 @@ import (
 
 // DependencyConfig defines a dependent deployment that should be managed alongside the main route.
 type DependencyConfig struct {
-	Name       string `json:"name"`
+	Name       string `json:"name"` // Deployment name, or "namespace/name" for another namespace
 	StopOnIdle bool   `json:"stop_on_idle"`
 }
 
+// Target returns the namespace and deployment name of the dependency.
+// Unqualified names live in defaultNamespace (the route's namespace).
+func (d DependencyConfig) Target(defaultNamespace string) (string, string) {
+	if ns, name, ok := strings.Cut(d.Name, "/"); ok {
+		return ns, name
+	}
+	return defaultNamespace, d.Name
+}
+
+// ResourceID returns the route ID for a patched Ingress (prefix "ing-") or OpenShift Route (prefix "route-").
+// Objects in homeNamespace keep the legacy "<prefix><name>" form; others are qualified as "<prefix><namespace>/<name>".
+func ResourceID(prefix, homeNamespace, namespace, name string) string {
+	if namespace == "" || namespace == homeNamespace {
+		return prefix + name
+	}
+	return prefix + namespace + "/" + name
+}
+
+// ParseResourceID is the inverse of ResourceID. It reports false if id does not start with prefix.
+func ParseResourceID(prefix, homeNamespace, id string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(id, prefix)
+	if !ok || rest == "" {
+		return "", "", false
+	}
+	if ns, name, qualified := strings.Cut(rest, "/"); qualified {
+		return ns, name, true
+	}
+	return homeNamespace, rest, true
+}
+
 // RouteConfig represents the configuration for a single proxied route.
 type RouteConfig struct {
-	ID            string             `json:"id"`
-	Host          string             `json:"host"` // Domain to match (e.g. app.local)
-	Path          string             `json:"path"` // URL Path to match
-	TargetService string             `json:"target_service"`
-	TargetPort    int                `json:"target_port"`
-	Namespace     string             `json:"namespace"`
-	Deployment    string             `json:"deployment"`
-	Dependencies  []DependencyConfig `json:"dependencies"` // List of dependent deployments
-	IdleTimeout   time.Duration      `json:"idle_timeout"`
-	LastActivity  time.Time          `json:"last_activity"`
-	InjectBadge   bool               `json:"inject_badge"` // If true, injects a visible badge in HTML responses
+	ID            string               `json:"id"`
+	Host          string               `json:"host"` // Domain to match (e.g. app.local)
+	Path          string               `json:"path"` // URL Path to match
+	TargetService string               `json:"target_service"`
+	TargetPort    int                  `json:"target_port"`
+	Namespace     string               `json:"namespace"`
+	Deployment    string               `json:"deployment"`
+	Dependencies  []DependencyConfig   `json:"dependencies"` // List of dependent deployments
+	IdleTimeout   time.Duration        `json:"idle_timeout"`
+	WakeTimeout   time.Duration        `json:"wake_timeout,omitempty"` // After which a wake-up that is not ready fails; default WAKE_TIMEOUT
+	LastActivity  time.Time            `json:"last_activity"`
+	InjectBadge   bool                 `json:"inject_badge"`            // If true, injects a visible badge in HTML responses
+	Access        *AccessPolicy        `json:"access,omitempty"`        // Optional access protection, checked before waking
+	WakePolicy    *WakePolicy          `json:"wake_policy,omitempty"`   // Optional filter for requests allowed to wake the route
+	Notifications []NotificationTarget `json:"notifications,omitempty"` // Webhooks called on lifecycle events, besides the global ones
+	WarmupPath    string               `json:"warmup_path,omitempty"`   // If set, must answer 2xx/3xx on the target service before the loading page redirects
+	Pages         *PagesConfig         `json:"pages,omitempty"`         // Optional custom pages and branding
+	Inject        *InjectConfig        `json:"inject,omitempty"`        // Optional snippets added to HTML responses, besides the badge
+	Transforms    []TransformConfig    `json:"transforms,omitempty"`    // Response transformation pipeline, applied in order
+	Mode          *RouteMode           `json:"mode,omitempty"`          // Operational state set by operators; normal if nil
+}
+
+// Operational states of a route.
+const (
+	ModeNormal      = "normal"
+	ModeMaintenance = "maintenance" // Serves the maintenance page; the route is neither woken nor put to sleep
+	ModePinned      = "pinned"      // Never put to sleep when idle
+	ModeDisabled    = "disabled"    // Answers 404, or redirects to RedirectURL; the route is never woken
+)
+
+// RouteMode is an operational state set on a route, e.g. during maintenance.
+type RouteMode struct {
+	State       string    `json:"state"`
+	Reason      string    `json:"reason,omitempty"`
+	Until       time.Time `json:"until,omitzero"`         // When the route goes back to normal; never if zero
+	RedirectURL string    `json:"redirect_url,omitempty"` // Disabled routes redirect there instead of answering 404
+	SetBy       string    `json:"set_by,omitempty"`
+	SetAt       time.Time `json:"set_at,omitzero"`
+}
+
+// Expired reports whether the mode no longer applies.
+func (m *RouteMode) Expired() bool {
+	return !m.Until.IsZero() && !time.Now().Before(m.Until)
+}
+
+// CurrentMode returns the operational state in effect, ModeNormal once the mode expired.
+func (r RouteConfig) CurrentMode() string {
+	if r.Mode == nil || r.Mode.State == "" || r.Mode.Expired() {
+		return ModeNormal
+	}
+	return r.Mode.State
+}
+
+// TransformConfig is a step of a route's response transformation pipeline. Type selects the transformer;
+// the other fields apply to the types named in their comments.
+type TransformConfig struct {
+	Type         string         `json:"type"`                     // html_inject, regex_replace, json_patch, headers, or a registered custom type
+	ContentTypes []string       `json:"content_types,omitempty"`  // Media type patterns such as "text/*"; default depends on the type
+	MaxBodyBytes int64          `json:"max_body_bytes,omitempty"` // Larger bodies are left alone; default TRANSFORM_MAX_BODY_BYTES
+	When         *TransformWhen `json:"when,omitempty"`           // Optional conditions on the response
+
+	HTML          string               `json:"html,omitempty"`           // html_inject: the snippet
+	Position      string               `json:"position,omitempty"`       // html_inject: "head_end", "body_start" or "body_end" (default)
+	Pattern       string               `json:"pattern,omitempty"`        // regex_replace: Go regular expression
+	Replacement   string               `json:"replacement,omitempty"`    // regex_replace: may refer to groups as $1 or ${name}
+	Patch         []JSONPatchOperation `json:"patch,omitempty"`          // json_patch: RFC 6902 operations
+	SetHeaders    map[string]string    `json:"set_headers,omitempty"`    // headers: response headers to set
+	RemoveHeaders []string             `json:"remove_headers,omitempty"` // headers: response headers to remove
+	Options       map[string]string    `json:"options,omitempty"`        // Settings of custom types
+}
+
+// TransformWhen restricts a transform to some responses. All set conditions must hold.
+type TransformWhen struct {
+	Status          []int             `json:"status,omitempty"`           // Response status codes
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`  // Header name to a regular expression its value must match
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"` // Same, for response headers
+}
+
+// JSONPatchOperation is an RFC 6902 operation: add, remove, replace, move, copy or test.
+type JSONPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// InjectConfig adds snippets before the closing </body> tag of the route's HTML responses.
+type InjectConfig struct {
+	Countdown   bool   `json:"countdown,omitempty"`    // Shows the time left before the route goes to sleep if left idle
+	Banner      string `json:"banner,omitempty"`       // Text of an environment banner across the top of the page, e.g. "STAGING"
+	BannerColor string `json:"banner_color,omitempty"` // CSS color of the banner; default orange
+	HTML        string `json:"html,omitempty"`         // Custom snippet; "{{nonce}}" is replaced by the CSP nonce, if any
+}
+
+// PagesConfig customizes the pages served for the route while it is not available.
+type PagesConfig struct {
+	ConfigMap    string `json:"config_map,omitempty"`    // In the route namespace; keys loading.html, failed.html and maintenance.html override the defaults
+	Title        string `json:"title,omitempty"`         // Shown instead of the deployment name
+	LogoURL      string `json:"logo_url,omitempty"`      // Image shown at the top of the pages
+	PrimaryColor string `json:"primary_color,omitempty"` // CSS color of the accents, e.g. "#e11d48"
+	SupportURL   string `json:"support_url,omitempty"`   // Linked from the pages, e.g. a chat channel or a ticket form
+}
+
+// NotificationTarget is a webhook notified of the route's lifecycle events (wake, sleep, patch, ...).
+type NotificationTarget struct {
+	URL        string   `json:"url,omitempty"`         // If empty, read from the "url" key of the Secret
+	Events     []string `json:"events,omitempty"`      // Event types to send, e.g. "wake.started"; all if empty
+	Template   string   `json:"template,omitempty"`    // "slack", "teams", "mattermost", a Go template producing JSON, or empty for the raw event
+	SecretName string   `json:"secret_name,omitempty"` // Secret in the route namespace; its "hmac-secret" key signs the payloads
+}
+
+// WakePolicy decides which requests may wake a sleeping route. Filtered requests never wake it
+// and are not counted as activity; while the route is awake they are still proxied.
+type WakePolicy struct {
+	IgnoreBots       bool     `json:"ignore_bots,omitempty"`        // Filters well-known bots, scanners, uptime checkers and noise paths
+	IgnoreUserAgents []string `json:"ignore_user_agents,omitempty"` // Case-insensitive regular expressions
+	IgnorePaths      []string `json:"ignore_paths,omitempty"`       // Path prefixes, e.g. "/favicon.ico" or "/.well-known/"
+	WakeMethods      []string `json:"wake_methods,omitempty"`       // If set, only these methods wake the route (e.g. GET)
+	RequireHuman     bool     `json:"require_human,omitempty"`      // Asks for a click on the loading page before waking
+}
+
+// AccessPolicy restricts who can reach a route. All configured checks must pass.
+type AccessPolicy struct {
+	AllowCIDRs      []string          `json:"allow_cidrs,omitempty"` // If set, only these client IPs/CIDRs are allowed
+	DenyCIDRs       []string          `json:"deny_cidrs,omitempty"`  // Always rejected, even if allowed
+	BasicAuth       *BasicAuthConfig  `json:"basic_auth,omitempty"`
+	OIDC            *OIDCAccessConfig `json:"oidc,omitempty"`
+	ForwardIdentity bool              `json:"forward_identity,omitempty"` // Sends X-Forwarded-User/Email/Groups upstream
+}
+
+// BasicAuthConfig checks HTTP basic credentials against a Secret in the route namespace.
+// The Secret is either of type kubernetes.io/basic-auth (username/password keys)
+// or holds one key per user with the password as value.
+type BasicAuthConfig struct {
+	SecretName string `json:"secret_name"`
+	Realm      string `json:"realm,omitempty"`
 }
 
+// OIDCAccessConfig protects a route with an OpenID Connect login and a session cookie.
+type OIDCAccessConfig struct {
+	IssuerURL        string        `json:"issuer_url"`
+	ClientID         string        `json:"client_id"`
+	ClientSecretName string        `json:"client_secret_name"` // Secret in the route namespace with a "client-secret" key
+	Scopes           []string      `json:"scopes,omitempty"`   // Added to "openid email profile"
+	AllowedGroups    []string      `json:"allowed_groups,omitempty"`
+	AllowedEmails    []string      `json:"allowed_emails,omitempty"` // Exact addresses, or "@domain" for a whole domain
+	SessionTTL       time.Duration `json:"session_ttl,omitempty"`    // Default: 12h
+	RedirectURL      string        `json:"redirect_url,omitempty"`   // Callback URL registered with the provider; default: the callback path on the requested host
+}
+
+// Change is the kind of change passed to the OnChange listeners.
+type Change string
+
+const (
+	RouteCreated Change = "created"
+	RouteUpdated Change = "updated"
+	RouteDeleted Change = "deleted"
+)
+
+// ErrRouteNotFound is returned for unknown route IDs.
+var ErrRouteNotFound = errors.New("route not found")
+
 // Store provides a thread-safe implementation for managing RouteConfigs.
 type Store struct {
-	mu       sync.RWMutex
-	routes   map[string]*RouteConfig // Key is ID
-	filePath string
+	mu        sync.RWMutex
+	routes    map[string]*RouteConfig // Key is ID
+	filePath  string
+	listeners []func(Change, RouteConfig)
 }
 
 func NewStore(filePath string) *Store {
@@ -48,34 +230,130 @@ func NewStore(filePath string) *Store {
 	return s
 }
 
-// AddRoute adds or updates a route. ID is generated if empty.
-func (s *Store) AddRoute(config *RouteConfig) error {
+// OnChange registers fn to be called after a route is added, updated or removed, outside the store lock.
+// Activity updates are not reported.
+func (s *Store) OnChange(fn func(change Change, route RouteConfig)) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+func (s *Store) notify(change Change, route RouteConfig) {
+	s.mu.RLock()
+	listeners := s.listeners
+	s.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(change, route)
+	}
+}
+
+// AddRoute adds or updates a route. ID is generated if empty. The route is saved as is: callers check it
+// first with Validate and Conflicts.
+func (s *Store) AddRoute(config *RouteConfig) error {
+	return s.AddRouteIf(config, nil)
+}
+
+// AddRouteIf is AddRoute if check, called under the store lock with the current version of the route (nil
+// if there is none), returns nil: the route is not saved and the error of check is returned otherwise.
+// It lets callers update a route only if it did not change since they read it. check may be nil.
+func (s *Store) AddRouteIf(config *RouteConfig, check func(current *RouteConfig) error) error {
+	s.mu.Lock()
 
 	if config.ID == "" {
 		config.ID = uuid.New().String()
 	}
 
-	// Validate uniqueness? For now, we allow overrides or duplicates on different IDs.
-	// In V2, we might want to check if Host+Path combo exists, but let's keep it simple.
+	current, exists := s.routes[config.ID]
+	if check != nil {
+		if err := check(current); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	route := *config
+	s.routes[config.ID] = &route
+	err := s.saveToFile()
+	s.mu.Unlock()
 
-	s.routes[config.ID] = config
-	return s.saveToFile()
+	change := RouteCreated
+	if exists {
+		change = RouteUpdated
+	}
+	s.notify(change, route)
+	return err
 }
 
 func (s *Store) RemoveRoute(id string) error {
+	return s.RemoveRouteIf(id, nil)
+}
+
+// RemoveRouteIf is RemoveRoute if check, called under the store lock with the current version of the route
+// (nil if there is none), returns nil. check may be nil.
+func (s *Store) RemoveRouteIf(id string, check func(current *RouteConfig) error) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	route, exists := s.routes[id]
+	if check != nil {
+		if err := check(route); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
 	delete(s.routes, id)
-	return s.saveToFile()
+	err := s.saveToFile()
+	s.mu.Unlock()
+
+	if exists {
+		s.notify(RouteDeleted, *route)
+	}
+	return err
 }
 
-func (s *Store) GetRoute(id string) (*RouteConfig, bool) {
+// SetMode sets the operational state of a route, nil for normal, and returns the updated route.
+func (s *Store) SetMode(id string, mode *RouteMode) (RouteConfig, error) {
+	s.mu.Lock()
+	route, exists := s.routes[id]
+	if !exists {
+		s.mu.Unlock()
+		return RouteConfig{}, ErrRouteNotFound
+	}
+	route.Mode = mode
+	err := s.saveToFile()
+	updated := *route
+	s.mu.Unlock()
+
+	s.notify(RouteUpdated, updated)
+	return updated, err
+}
+
+// ExpireMode resets the operational state of a route to normal if it expired, and returns the expired
+// state, or nil if there was none.
+func (s *Store) ExpireMode(id string) (*RouteMode, error) {
+	s.mu.Lock()
+	route, exists := s.routes[id]
+	if !exists || route.Mode == nil || !route.Mode.Expired() {
+		s.mu.Unlock()
+		return nil, nil
+	}
+	expired := route.Mode
+	route.Mode = nil
+	err := s.saveToFile()
+	updated := *route
+	s.mu.Unlock()
+
+	s.notify(RouteUpdated, updated)
+	return expired, err
+}
+
+// GetRoute returns a copy of a route: the store updates its routes in place under its lock, so callers never
+// hold them.
+func (s *Store) GetRoute(id string) (RouteConfig, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	config, exists := s.routes[id]
-	return config, exists
+	if !exists {
+		return RouteConfig{}, false
+	}
+	return *config, true
 }
 
 func (s *Store) UpdateActivity(id string) {
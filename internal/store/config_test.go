@@ -0,0 +1,108 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoutesAreCopied(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "routes.json"))
+	config := &RouteConfig{ID: "shop", Path: "/", Namespace: "shop", Deployment: "web"}
+	if err := s.AddRoute(config); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Namespace = "changed"
+	if route, _ := s.GetRoute("shop"); route.Namespace != "shop" {
+		t.Errorf("AddRoute kept the caller's route: namespace %q", route.Namespace)
+	}
+
+	route, _ := s.GetRoute("shop")
+	route.Namespace = "changed"
+	if route, _ := s.GetRoute("shop"); route.Namespace != "shop" {
+		t.Errorf("GetRoute returned the stored route: namespace %q", route.Namespace)
+	}
+}
+
+// Run with -race: modes are written under the lock while the proxy reads routes.
+func TestModeChangesDoNotRaceWithReads(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "routes.json"))
+	s.AddRoute(&RouteConfig{ID: "shop", Path: "/", Namespace: "shop", Deployment: "web"})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			s.SetMode("shop", &RouteMode{State: ModeMaintenance, Until: time.Now().Add(-time.Second)})
+			s.ExpireMode("shop")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if route, ok := s.GetRoute("shop"); ok {
+				_ = route.CurrentMode()
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestNoConflictsUnderConcurrentSaves(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "routes.json"))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			route := &RouteConfig{ID: fmt.Sprintf("r%d", i), Host: "shop.example.com", Path: "/", Namespace: "shop", Deployment: "web"}
+			errs[i] = s.AddRouteIf(route, s.NoConflicts(route, nil))
+		}()
+	}
+	wg.Wait()
+
+	saved := 0
+	for _, err := range errs {
+		var conflict *ConflictError
+		switch {
+		case err == nil:
+			saved++
+		case !errors.As(err, &conflict):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if saved != 1 || len(s.GetAllRoutes()) != 1 {
+		t.Errorf("%d saves succeeded, %d routes stored; want 1", saved, len(s.GetAllRoutes()))
+	}
+
+	// Saving the route again is not a conflict with itself
+	route := s.GetAllRoutes()[0]
+	route.IdleTimeout = time.Hour
+	if err := s.AddRouteIf(&route, s.NoConflicts(&route, nil)); err != nil {
+		t.Errorf("updating the route: %v", err)
+	}
+}
+
+func TestRedirectURLValidation(t *testing.T) {
+	for raw, valid := range map[string]bool{
+		"https://shop.example.com/__smart_proxy/oidc/callback":      true,
+		"http://localhost:8080/__smart_proxy/oidc/callback":         true,
+		"/__smart_proxy/oidc/callback":                              false,
+		"https://shop.example.com/callback":                         false,
+		"https://shop.example.com/__smart_proxy/oidc/callback?x=1":  false,
+		"javascript://shop.example.com/__smart_proxy/oidc/callback": false,
+	} {
+		route := RouteConfig{ID: "shop", Path: "/", Namespace: "shop", Deployment: "web", TargetService: "web", TargetPort: 80,
+			IdleTimeout: time.Hour, Access: &AccessPolicy{OIDC: &OIDCAccessConfig{RedirectURL: raw}}}
+		if err := route.Validate(time.Minute).Err(); (err == nil) != valid {
+			t.Errorf("%s: %v", raw, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultMinIdleTimeout is the shortest idle timeout accepted when MIN_IDLE_TIMEOUT is unset.
+const DefaultMinIdleTimeout = time.Minute
+
+// FieldError is a problem with a field, at a path such as idle_timeout or dependencies[0].name.
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// FieldErrors lists every problem found, sorted by path.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add records a problem at path.
+func (e *FieldErrors) Add(path, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Prefix returns the errors with their paths under prefix, e.g. routes[2].
+func (e FieldErrors) Prefix(prefix string) FieldErrors {
+	prefixed := make(FieldErrors, len(e))
+	for i, err := range e {
+		prefixed[i] = FieldError{Path: prefix, Message: err.Message}
+		if err.Path != "" {
+			prefixed[i].Path = prefix + "." + err.Path
+		}
+	}
+	return prefixed
+}
+
+// Err returns the errors sorted by path, or nil if there are none.
+func (e FieldErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	sort.SliceStable(e, func(i, j int) bool { return e[i].Path < e[j].Path })
+	return e
+}
+
+var (
+	// dnsLabel is a Kubernetes namespace or Service name (RFC 1123 label)
+	dnsLabel = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	// dnsSubdomain is a Kubernetes Deployment name or a host name (RFC 1123 subdomain)
+	dnsSubdomain = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// Validate checks a route on its own: required fields, the syntax of its host, path and names, its port, its
+// timeouts and its dependencies. Idle timeouts shorter than minIdleTimeout are refused, as the route would
+// be put to sleep between two requests. It does not look at other routes nor at the cluster.
+func (r RouteConfig) Validate(minIdleTimeout time.Duration) FieldErrors {
+	var errs FieldErrors
+	if r.Host != "" {
+		if problem := hostProblem(r.Host); problem != "" {
+			errs.Add("host", "%s", problem)
+		}
+	}
+	if r.Path == "" {
+		errs.Add("path", "required")
+	} else if problem := pathProblem(r.Path); problem != "" {
+		errs.Add("path", "%s", problem)
+	}
+	checkName(&errs, "namespace", r.Namespace, dnsLabel, 63)
+	checkName(&errs, "deployment", r.Deployment, dnsSubdomain, 253)
+	checkName(&errs, "target_service", r.TargetService, dnsLabel, 63)
+	if r.TargetPort < 1 || r.TargetPort > 65535 {
+		errs.Add("target_port", "must be between 1 and 65535")
+	}
+	if r.IdleTimeout < minIdleTimeout {
+		errs.Add("idle_timeout", "must be at least %s", minIdleTimeout)
+	}
+	if r.WakeTimeout < 0 {
+		errs.Add("wake_timeout", "must not be negative")
+	}
+	if r.WarmupPath != "" {
+		if problem := pathProblem(r.WarmupPath); problem != "" {
+			errs.Add("warmup_path", "%s", problem)
+		}
+	}
+
+	if r.Access != nil && r.Access.OIDC != nil && r.Access.OIDC.RedirectURL != "" {
+		if problem := redirectURLProblem(r.Access.OIDC.RedirectURL); problem != "" {
+			errs.Add("access.oidc.redirect_url", "%s", problem)
+		}
+	}
+
+	seen := make(map[string]int, len(r.Dependencies))
+	for i, dep := range r.Dependencies {
+		path := fmt.Sprintf("dependencies[%d].name", i)
+		namespace, name := dep.Target(r.Namespace)
+		if dep.Name == "" {
+			errs.Add(path, "required")
+			continue
+		}
+		if strings.Contains(dep.Name, "/") && !dnsLabel.MatchString(namespace) {
+			errs.Add(path, "invalid namespace %q", namespace)
+			continue
+		}
+		if !dnsSubdomain.MatchString(name) || len(name) > 253 {
+			errs.Add(path, "invalid deployment name %q, must be lowercase letters, digits, '-' and '.'", name)
+			continue
+		}
+		if namespace == r.Namespace && name == r.Deployment {
+			errs.Add(path, "is the deployment of the route itself")
+			continue
+		}
+		target := namespace + "/" + name
+		if first, dup := seen[target]; dup {
+			errs.Add(path, "duplicate of dependencies[%d]", first)
+			continue
+		}
+		seen[target] = i
+	}
+	return errs
+}
+
+// checkName checks a required Kubernetes name.
+func checkName(errs *FieldErrors, path, name string, pattern *regexp.Regexp, maxLength int) {
+	switch {
+	case name == "":
+		errs.Add(path, "required")
+	case len(name) > maxLength:
+		errs.Add(path, "must be at most %d characters", maxLength)
+	case !pattern.MatchString(name) && pattern == dnsSubdomain:
+		errs.Add(path, "invalid name %q, must be lowercase letters, digits, '-' and '.'", name)
+	case !pattern.MatchString(name):
+		errs.Add(path, "invalid name %q, must be lowercase letters, digits and '-'", name)
+	}
+}
+
+// hostProblem describes what is wrong with a host to match, or returns "".
+func hostProblem(host string) string {
+	switch {
+	case strings.Contains(host, "://"):
+		return "must be a host name, without scheme"
+	case strings.ContainsAny(host, ":/"):
+		return "must be a host name, without port nor path"
+	case strings.Contains(host, "*"):
+		return "wildcards are not supported, leave the host empty to match any"
+	case len(host) > 253 || !dnsSubdomain.MatchString(host):
+		return fmt.Sprintf("invalid host name %q, must be lowercase letters, digits, '-' and '.'", host)
+	}
+	return ""
+}
+
+// pathProblem describes what is wrong with a URL path, or returns "".
+func pathProblem(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "must start with /"
+	}
+	if strings.ContainsAny(path, "?#") {
+		return "must not contain a query nor a fragment"
+	}
+	for _, c := range path {
+		if c <= ' ' || c == 0x7f {
+			return "must not contain spaces nor control characters"
+		}
+	}
+	if _, err := url.PathUnescape(path); err != nil {
+		return "invalid escape sequence"
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return "must not contain . or .. segments"
+		}
+	}
+	return ""
+}
+
+// redirectURLProblem describes what is wrong with an OIDC redirect URL, or returns "". The proxy only answers
+// the callback on /__smart_proxy/oidc/callback.
+func redirectURLProblem(raw string) string {
+	u, err := url.Parse(raw)
+	switch {
+	case err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "":
+		return "must be an absolute http or https URL"
+	case u.Path != "/__smart_proxy/oidc/callback" || u.RawQuery != "" || u.Fragment != "":
+		return "must be the /__smart_proxy/oidc/callback path of a host served by the route, without query"
+	}
+	return ""
+}
+
+// Conflicts returns the routes among others that match the same host and path as route: the proxy could
+// not tell them apart. others may include a previous version of route, which is skipped by ID.
+func Conflicts(route RouteConfig, others []RouteConfig) []RouteConfig {
+	var conflicts []RouteConfig
+	for _, other := range others {
+		if route.ID != "" && other.ID == route.ID {
+			continue
+		}
+		if other.Path == route.Path && strings.EqualFold(other.Host, route.Host) {
+			conflicts = append(conflicts, other)
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].ID < conflicts[j].ID })
+	return conflicts
+}
+
+// ConflictError is returned by checks of NoConflicts: the route serves the same host and path as Routes.
+type ConflictError struct {
+	Route  RouteConfig
+	Routes []RouteConfig
+}
+
+func (e *ConflictError) Error() string {
+	host := e.Route.Host
+	if host == "" {
+		host = "any host"
+	}
+	return fmt.Sprintf("%s on %s is already served by another route", e.Route.Path, host)
+}
+
+// NoConflicts returns a check for AddRouteIf that runs check, which may be nil, then fails with a
+// *ConflictError if config serves the same host and path as another stored route. It runs under the store
+// lock, so that routes saved concurrently cannot both take the same host and path.
+func (s *Store) NoConflicts(config *RouteConfig, check func(current *RouteConfig) error) func(current *RouteConfig) error {
+	return func(current *RouteConfig) error {
+		if check != nil {
+			if err := check(current); err != nil {
+				return err
+			}
+		}
+		others := make([]RouteConfig, 0, len(s.routes))
+		for _, route := range s.routes {
+			others = append(others, *route)
+		}
+		if conflicts := Conflicts(*config, others); len(conflicts) > 0 {
+			return &ConflictError{Route: *config, Routes: conflicts}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+// Package stream broadcasts typed route events (changes, state transitions, wake progress) to live
+// subscribers such as the admin /api/events endpoint. It works like the logger broadcast: a bounded
+// history and non-blocking fan-out, plus increasing event IDs so that clients can resume after a disconnect.
+package stream
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	RouteCreated = "route.created"
+	RouteUpdated = "route.updated"
+	RouteDeleted = "route.deleted"
+	RouteState   = "route.state"   // Data: StateChange
+	WakeProgress = "wake.progress" // Data: Progress
+	Metrics      = "metrics"       // Sent by the admin API to each subscriber; never stored
+)
+
+// Event is a message on the stream.
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	Time      time.Time   `json:"time"`
+	RouteID   string      `json:"route_id,omitempty"`
+	Namespace string      `json:"namespace,omitempty"` // Used to filter events by the subscriber's permissions
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// StateChange is the data of a route.state event.
+type StateChange struct {
+	From string `json:"from,omitempty"` // Empty for the first state seen
+	To   string `json:"to"`             // ready, waking or sleeping
+}
+
+// Progress is the data of a wake.progress event: the status of every deployment of a waking route.
+type Progress struct {
+	Ready   int          `json:"ready"`
+	Total   int          `json:"total"`
+	Targets []TargetInfo `json:"targets"`
+}
+
+// TargetInfo is the status of one deployment of a route.
+type TargetInfo struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // Ready, Scaling, Sleep or Error
+}
+
+const (
+	historySize    = 1000
+	subscriberSize = 100
+)
+
+// Hub keeps recent events and fans them out to subscribers. A nil *Hub drops every event.
+type Hub struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event // Oldest first
+	subscribers map[chan Event]struct{}
+}
+
+// NewHub returns an empty hub. IDs start from the current time in microseconds, so that they keep
+// increasing across restarts and a client resuming from before a restart is told it missed events.
+func NewHub() *Hub {
+	return &Hub{lastID: uint64(time.Now().UnixMicro()), subscribers: make(map[chan Event]struct{})}
+}
+
+// Publish assigns the next ID to an event and sends it to every subscriber. Slow subscribers miss events;
+// they notice the gap in IDs and can resume from the last one they got.
+func (h *Hub) Publish(eventType, routeID, namespace string, data interface{}) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	e := Event{ID: h.lastID, Type: eventType, Time: time.Now().UTC(), RouteID: routeID, Namespace: namespace, Data: data}
+	if len(h.history) >= historySize {
+		h.history = h.history[1:]
+	}
+	h.history = append(h.history, e)
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// Drop if subscriber is slow
+		}
+	}
+}
+
+// Subscribe returns the stored events after lastID and a channel receiving the following ones, with no gap
+// between the two. complete is false if events after lastID were already dropped from the history.
+// A lastID of 0 replays nothing.
+func (h *Hub) Subscribe(lastID uint64) (missed []Event, complete bool, ch chan Event) {
+	ch = make(chan Event, subscriberSize)
+	if h == nil {
+		return nil, true, ch
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[ch] = struct{}{}
+
+	if lastID == 0 || lastID == h.lastID {
+		return nil, true, ch
+	}
+	if lastID > h.lastID {
+		return nil, false, ch // From a clock ahead of ours; assume a gap
+	}
+	complete = len(h.history) > 0 && h.history[0].ID <= lastID+1
+	for _, e := range h.history {
+		if e.ID > lastID {
+			missed = append(missed, e)
+		}
+	}
+	return missed, complete, ch
+}
+
+// Unsubscribe removes a subscriber and closes its channel.
+func (h *Hub) Unsubscribe(ch chan Event) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers, ch)
+	close(ch)
+}
@@ -0,0 +1,96 @@
+package stream
+
+import "testing"
+
+func ids(events []Event) []uint64 {
+	var ids []uint64
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestSubscribeResumes(t *testing.T) {
+	h := NewHub()
+	first := h.lastID
+	for i := 0; i < 3; i++ {
+		h.Publish(RouteUpdated, "shop", "shop", nil)
+	}
+
+	tests := []struct {
+		name     string
+		lastID   uint64
+		missed   int
+		complete bool
+	}{
+		{"new subscriber", 0, 0, true},
+		{"up to date", first + 3, 0, true},
+		{"one behind", first + 2, 1, true},
+		{"from before the first event", first, 3, true},
+		{"from before a restart", first - 10, 3, false},
+		{"from the future", first + 100, 0, false},
+	}
+	for _, tt := range tests {
+		missed, complete, ch := h.Subscribe(tt.lastID)
+		if len(missed) != tt.missed || complete != tt.complete {
+			t.Errorf("%s: missed %v, complete %v; want %d, %v", tt.name, ids(missed), complete, tt.missed, tt.complete)
+		}
+		if len(missed) > 0 && missed[len(missed)-1].ID != first+3 {
+			t.Errorf("%s: missed %v", tt.name, ids(missed))
+		}
+		h.Unsubscribe(ch)
+	}
+
+	// Nothing is lost between the replay and the live events
+	missed, _, ch := h.Subscribe(first + 2)
+	defer h.Unsubscribe(ch)
+	h.Publish(RouteState, "shop", "shop", StateChange{From: "sleeping", To: "waking"})
+	if e := <-ch; len(missed) != 1 || e.ID != missed[0].ID+1 || e.Type != RouteState {
+		t.Errorf("missed %v, then %+v", ids(missed), e)
+	}
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	h := NewHub()
+	first := h.lastID
+	for i := 0; i < historySize+5; i++ {
+		h.Publish(RouteUpdated, "shop", "shop", nil)
+	}
+	if len(h.history) != historySize || h.history[0].ID != first+6 {
+		t.Fatalf("history of %d from %d", len(h.history), h.history[0].ID-first)
+	}
+
+	// Events 1 to 5 are gone
+	missed, complete, ch := h.Subscribe(first + 1)
+	h.Unsubscribe(ch)
+	if complete || len(missed) != historySize {
+		t.Errorf("resumed from a dropped event: %d missed, complete %v", len(missed), complete)
+	}
+	missed, complete, ch = h.Subscribe(first + 5)
+	h.Unsubscribe(ch)
+	if !complete || len(missed) != historySize {
+		t.Errorf("resumed from the last dropped event: %d missed, complete %v", len(missed), complete)
+	}
+}
+
+func TestSlowSubscribersMissEvents(t *testing.T) {
+	h := NewHub()
+	_, _, slow := h.Subscribe(0)
+	defer h.Unsubscribe(slow)
+	for i := 0; i < subscriberSize+10; i++ {
+		h.Publish(WakeProgress, "shop", "shop", Progress{})
+	}
+	if len(slow) != subscriberSize {
+		t.Errorf("%d events queued, want %d", len(slow), subscriberSize)
+	}
+}
+
+func TestNilHub(t *testing.T) {
+	var h *Hub
+	h.Publish(RouteCreated, "shop", "shop", nil)
+	missed, complete, ch := h.Subscribe(42)
+	if missed != nil || !complete || ch == nil {
+		t.Errorf("subscribe to a nil hub: %v, %v, %v", missed, complete, ch)
+	}
+	h.Unsubscribe(ch)
+}
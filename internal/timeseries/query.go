@@ -0,0 +1,91 @@
+package timeseries
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxPoints bounds the number of points a query returns.
+const MaxPoints = 10000
+
+// Point is the traffic of one step. Hour buckets, kept beyond the raw retention, are counted in the step
+// their hour starts in, so steps shorter than an hour are only accurate within the raw retention.
+type Point struct {
+	Time     time.Time `json:"time"` // Start of the step
+	Requests int64     `json:"requests"`
+	Errors   int64     `json:"errors"`
+	P50      float64   `json:"p50_ms"`
+	P95      float64   `json:"p95_ms"`
+	State    string    `json:"state,omitempty"` // At the end of the step; only when querying a single route
+}
+
+// Query returns the merged traffic of the routes between from and to, one point per step. step must be
+// a whole number of minutes; from is rounded down to a multiple of step.
+func (db *DB) Query(routeIDs []string, from, to time.Time, step time.Duration) ([]Point, error) {
+	if step < time.Minute || step%time.Minute != 0 {
+		return nil, fmt.Errorf("step must be a whole number of minutes")
+	}
+	from, to = from.UTC().Truncate(step), to.UTC()
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+	n := int((to.Sub(from) + step - 1) / step)
+	if n > MaxPoints {
+		return nil, fmt.Errorf("the query would return %d points, more than %d; use a larger step", n, MaxPoints)
+	}
+
+	buckets := make([]*bucket, n)
+	for i := range buckets {
+		buckets[i] = newBucket(from.Add(time.Duration(i) * step))
+	}
+	add := func(b *bucket) {
+		if b.Start.Before(from) || !b.Start.Before(to) {
+			return
+		}
+		buckets[int(b.Start.Sub(from)/step)].merge(b)
+	}
+
+	points := make([]Point, n)
+	if db != nil {
+		db.mu.Lock()
+		for _, id := range routeIDs {
+			s, ok := db.series[id]
+			if !ok {
+				continue
+			}
+			for _, b := range s.Hours {
+				add(b)
+			}
+			for _, b := range s.Minutes {
+				add(b)
+			}
+			if len(routeIDs) == 1 {
+				fillStates(points, s.States, from, step)
+			}
+		}
+		db.mu.Unlock()
+	}
+
+	for i, b := range buckets {
+		points[i].Time = b.Start
+		points[i].Requests = b.Requests
+		points[i].Errors = b.Errors
+		points[i].P50 = b.quantile(0.5)
+		points[i].P95 = b.quantile(0.95)
+	}
+	return points, nil
+}
+
+// fillStates sets the state of each point to the last state entered before the end of its step.
+func fillStates(points []Point, states []stateChange, from time.Time, step time.Duration) {
+	next := 0
+	state := ""
+	for i := range points {
+		end := from.Add(time.Duration(i+1) * step)
+		for next < len(states) && states[next].Time.Before(end) {
+			state = states[next].State
+			next++
+		}
+		points[i].State = state
+	}
+}
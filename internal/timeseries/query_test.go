@@ -0,0 +1,124 @@
+package timeseries
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, time.March, 4, 10, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return t0.Add(time.Duration(minutes) * time.Minute)
+}
+
+// requests returns a bucket of n requests at the given latency slot, errors of which failed.
+func requests(start time.Time, n, errors int64, slot int) *bucket {
+	b := newBucket(start)
+	b.Requests, b.Errors, b.Latency[slot] = n, errors, n
+	return b
+}
+
+func TestQueryBuckets(t *testing.T) {
+	db, _ := New(Config{})
+	db.series["shop"] = &series{
+		Hours:   []*bucket{requests(at(-120), 100, 0, 0)},
+		Minutes: []*bucket{requests(at(0), 4, 1, 2), requests(at(4), 6, 0, 3), requests(at(7), 10, 0, 4), requests(at(15), 1, 0, 0)},
+	}
+	db.series["blog"] = &series{Minutes: []*bucket{requests(at(3), 2, 2, 2)}}
+
+	// from is rounded down to the step, to excludes the bucket starting at it
+	points, err := db.Query([]string{"shop", "blog", "unknown"}, at(2), at(15), 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Point{
+		{Time: at(0), Requests: 12, Errors: 3},
+		{Time: at(5), Requests: 10},
+		{Time: at(10)},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("points %+v", points)
+	}
+	for i, p := range points {
+		if p.Time != want[i].Time || p.Requests != want[i].Requests || p.Errors != want[i].Errors || p.State != "" {
+			t.Errorf("point %d: %+v, want %+v", i, p, want[i])
+		}
+	}
+	// 6 requests within 10-25ms and 6 within 25-50ms
+	if points[0].P50 != 25 || points[0].P95 <= 25 || points[0].P95 > 50 {
+		t.Errorf("quantiles %v, %v", points[0].P50, points[0].P95)
+	}
+	if points[1].P50 != 75 || points[2].P50 != 0 {
+		t.Errorf("quantiles %v, %v", points[1].P50, points[2].P50)
+	}
+
+	// Hour buckets fall in the step their hour starts in
+	points, _ = db.Query([]string{"shop"}, at(-180), at(0), time.Hour)
+	if len(points) != 3 || points[1].Requests != 100 || points[0].Requests+points[2].Requests != 0 {
+		t.Errorf("hourly points %+v", points)
+	}
+}
+
+func TestQueryStates(t *testing.T) {
+	db, _ := New(Config{})
+	db.series["shop"] = &series{States: []stateChange{{at(-30), "sleeping"}, {at(3), "waking"}, {at(4), "ready"}, {at(12), "sleeping"}}}
+	db.series["blog"] = &series{States: []stateChange{{at(0), "ready"}}}
+
+	points, _ := db.Query([]string{"shop"}, at(0), at(15), 5*time.Minute)
+	var states []string
+	for _, p := range points {
+		states = append(states, p.State)
+	}
+	if !reflect.DeepEqual(states, []string{"ready", "ready", "sleeping"}) {
+		t.Errorf("states %v", states)
+	}
+
+	// States only describe a single route
+	points, _ = db.Query([]string{"shop", "blog"}, at(0), at(15), 5*time.Minute)
+	for _, p := range points {
+		if p.State != "" {
+			t.Errorf("state %q of several routes", p.State)
+		}
+	}
+}
+
+func TestFillStates(t *testing.T) {
+	points := make([]Point, 4)
+	fillStates(points, []stateChange{{at(1), "waking"}, {at(2), "ready"}, {at(10), "sleeping"}}, at(0), 5*time.Minute)
+	var states []string
+	for _, p := range points {
+		states = append(states, p.State)
+	}
+	// A change at the end of a step belongs to the next one
+	if !reflect.DeepEqual(states, []string{"ready", "ready", "sleeping", "sleeping"}) {
+		t.Errorf("states %v", states)
+	}
+
+	// No state before the first change
+	points = make([]Point, 2)
+	fillStates(points, []stateChange{{at(7), "ready"}}, at(0), 5*time.Minute)
+	if points[0].State != "" || points[1].State != "ready" {
+		t.Errorf("points %+v", points)
+	}
+}
+
+func TestInvalidQueries(t *testing.T) {
+	var db *DB
+	for name, q := range map[string]struct {
+		from, to time.Time
+		step     time.Duration
+	}{
+		"step under a minute": {at(0), at(10), 30 * time.Second},
+		"partial minutes":     {at(0), at(10), 90 * time.Second},
+		"empty range":         {at(10), at(10), time.Minute},
+		"too many points":     {at(0), at(2 * MaxPoints), time.Minute},
+	} {
+		if _, err := db.Query([]string{"shop"}, q.from, q.to, q.step); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+	if points, err := db.Query([]string{"shop"}, at(0), at(10), time.Minute); err != nil || len(points) != 10 || points[9].Time != at(9) {
+		t.Errorf("query of a nil DB: %v, %v", points, err)
+	}
+}
@@ -0,0 +1,292 @@
+// Package timeseries is a small embedded time-series store for per-route traffic: requests, errors and latency
+// in one-minute buckets, downsampled to one-hour buckets after a while, plus the route state over time.
+// It is bounded by its retention periods and saved to a file, so trends survive restarts.
+package timeseries
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"smart-proxy/internal/logger"
+)
+
+var log = logger.Component("timeseries")
+
+// latencyBounds are the upper bounds, in milliseconds, of the latency histogram buckets. Quantiles are
+// interpolated within a bucket, so they are approximations.
+var latencyBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// bucket aggregates the requests of a route over one minute or one hour.
+type bucket struct {
+	Start    time.Time `json:"t"`
+	Requests int64     `json:"n"`
+	Errors   int64     `json:"e,omitempty"` // 5xx responses
+	Latency  []int64   `json:"l"`           // Counts per latencyBounds bucket, the last one for slower requests
+}
+
+func newBucket(start time.Time) *bucket {
+	return &bucket{Start: start, Latency: make([]int64, len(latencyBounds)+1)}
+}
+
+func (b *bucket) merge(o *bucket) {
+	b.Requests += o.Requests
+	b.Errors += o.Errors
+	for i := range b.Latency {
+		if i < len(o.Latency) {
+			b.Latency[i] += o.Latency[i]
+		}
+	}
+}
+
+// quantile estimates the q-quantile latency in milliseconds.
+func (b *bucket) quantile(q float64) float64 {
+	var total int64
+	for _, n := range b.Latency {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen float64
+	for i, n := range b.Latency {
+		if n == 0 {
+			continue
+		}
+		if seen+float64(n) >= rank {
+			if i == len(latencyBounds) {
+				return latencyBounds[i-1] // Slower than the last bound
+			}
+			lower := 0.0
+			if i > 0 {
+				lower = latencyBounds[i-1]
+			}
+			return lower + (latencyBounds[i]-lower)*(rank-seen)/float64(n)
+		}
+		seen += float64(n)
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+// stateChange is the time a route entered a state.
+type stateChange struct {
+	Time  time.Time `json:"t"`
+	State string    `json:"s"`
+}
+
+// series holds the data of one route. Minutes and Hours are disjoint and ordered, oldest first.
+type series struct {
+	Minutes []*bucket     `json:"minutes,omitempty"`
+	Hours   []*bucket     `json:"hours,omitempty"`
+	States  []stateChange `json:"states,omitempty"`
+}
+
+// Config configures a DB.
+type Config struct {
+	Path         string        // File the data is saved to; empty keeps it in memory
+	RawRetention time.Duration // How long one-minute buckets are kept before being merged into hours; default 24h
+	Retention    time.Duration // How long data is kept at all; default 30 days
+}
+
+// DB stores the time series of every route. A nil *DB records nothing.
+type DB struct {
+	config Config
+	mu     sync.Mutex
+	series map[string]*series // Key: Route ID
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New returns a DB, loading the data saved at config.Path if any.
+func New(config Config) (*DB, error) {
+	if config.RawRetention <= 0 {
+		config.RawRetention = 24 * time.Hour
+	}
+	if config.Retention <= 0 {
+		config.Retention = 30 * 24 * time.Hour
+	}
+	if config.Retention < config.RawRetention {
+		return nil, fmt.Errorf("time series retention (%s) is shorter than the raw retention (%s)", config.Retention, config.RawRetention)
+	}
+	db := &DB{config: config, series: make(map[string]*series), done: make(chan struct{})}
+	if config.Path == "" {
+		return db, nil
+	}
+	data, err := os.ReadFile(config.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return db, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &db.series); err != nil {
+		return nil, fmt.Errorf("invalid time series file %s: %w", config.Path, err)
+	}
+	db.compact(time.Now())
+	return db, nil
+}
+
+// FromEnv returns a DB configured by TIMESERIES_PATH (default: timeseries.json), TIMESERIES_RAW_RETENTION
+// (default: 24h) and TIMESERIES_RETENTION (default: 720h).
+func FromEnv() (*DB, error) {
+	config := Config{Path: os.Getenv("TIMESERIES_PATH")}
+	if config.Path == "" {
+		config.Path = "timeseries.json"
+	}
+	for _, p := range []struct {
+		env   string
+		value *time.Duration
+	}{{"TIMESERIES_RAW_RETENTION", &config.RawRetention}, {"TIMESERIES_RETENTION", &config.Retention}} {
+		if s := os.Getenv(p.env); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid %s %q", p.env, s)
+			}
+			*p.value = d
+		}
+	}
+	return New(config)
+}
+
+// Record counts a request served for the route.
+func (db *DB) Record(routeID string, status int, latency time.Duration) {
+	if db == nil || routeID == "" {
+		return
+	}
+	ms := float64(latency.Microseconds()) / 1000
+	slot := sort.SearchFloat64s(latencyBounds, ms)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	s := db.get(routeID)
+	minute := time.Now().UTC().Truncate(time.Minute)
+	if n := len(s.Minutes); n == 0 || s.Minutes[n-1].Start.Before(minute) {
+		s.Minutes = append(s.Minutes, newBucket(minute))
+	}
+	b := s.Minutes[len(s.Minutes)-1]
+	b.Requests++
+	if status >= 500 {
+		b.Errors++
+	}
+	b.Latency[slot]++
+}
+
+// SetStates records the current state of each route, e.g. "ready", "waking" or "sleeping".
+// Only changes are stored.
+func (db *DB) SetStates(states map[string]string) {
+	if db == nil {
+		return
+	}
+	now := time.Now().UTC()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for routeID, state := range states {
+		s := db.get(routeID)
+		if n := len(s.States); n == 0 || s.States[n-1].State != state {
+			s.States = append(s.States, stateChange{Time: now, State: state})
+		}
+	}
+}
+
+func (db *DB) get(routeID string) *series {
+	s, ok := db.series[routeID]
+	if !ok {
+		s = &series{}
+		db.series[routeID] = s
+	}
+	return s
+}
+
+// Start samples the route states with states every minute, downsamples old buckets and saves the data,
+// until Close is called.
+func (db *DB) Start(states func() map[string]string) {
+	if db == nil {
+		return
+	}
+	db.wg.Add(1)
+	go func() {
+		defer db.wg.Done()
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			db.SetStates(states())
+			select {
+			case <-ticker.C:
+				db.compact(time.Now())
+				db.save()
+			case <-db.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background loop and saves the data.
+func (db *DB) Close() {
+	if db == nil {
+		return
+	}
+	close(db.done)
+	db.wg.Wait()
+	db.save()
+}
+
+// compact merges minutes older than the raw retention into hours and drops data older than the retention.
+func (db *DB) compact(now time.Time) {
+	rawCutoff := now.Add(-db.config.RawRetention)
+	cutoff := now.Add(-db.config.Retention)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for routeID, s := range db.series {
+		kept := 0
+		for _, m := range s.Minutes {
+			if !m.Start.Before(rawCutoff) {
+				break
+			}
+			hour := m.Start.Truncate(time.Hour)
+			if n := len(s.Hours); n == 0 || s.Hours[n-1].Start.Before(hour) {
+				s.Hours = append(s.Hours, newBucket(hour))
+			}
+			s.Hours[len(s.Hours)-1].merge(m)
+			kept++
+		}
+		s.Minutes = s.Minutes[kept:]
+
+		for len(s.Hours) > 0 && s.Hours[0].Start.Before(cutoff) {
+			s.Hours = s.Hours[1:]
+		}
+		// Keep the last change before the cutoff: it is the state at the start of the retained period
+		for len(s.States) > 1 && s.States[1].Time.Before(cutoff) {
+			s.States = s.States[1:]
+		}
+
+		if len(s.Minutes) == 0 && len(s.Hours) == 0 && (len(s.States) == 0 || s.States[len(s.States)-1].Time.Before(cutoff)) {
+			delete(db.series, routeID)
+		}
+	}
+}
+
+// save writes the data atomically, through a temporary file.
+func (db *DB) save() {
+	if db.config.Path == "" {
+		return
+	}
+	db.mu.Lock()
+	data, err := json.Marshal(db.series)
+	db.mu.Unlock()
+	if err == nil {
+		tmp := filepath.Join(filepath.Dir(db.config.Path), "."+filepath.Base(db.config.Path)+".tmp")
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, db.config.Path)
+		}
+	}
+	if err != nil {
+		log.Warn("Failed to save time series", "path", db.config.Path, "error", err)
+	}
+}
@@ -0,0 +1,87 @@
+package timeseries
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordAndPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timeseries.json")
+	db, err := New(Config{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Record("shop", 200, 3*time.Millisecond)
+	db.Record("shop", 503, 70*time.Millisecond)
+	db.Record("", 200, time.Millisecond) // No route matched
+	db.SetStates(map[string]string{"shop": "waking"})
+	db.SetStates(map[string]string{"shop": "waking"})
+	db.SetStates(map[string]string{"shop": "ready"})
+	db.Start(func() map[string]string { return map[string]string{"shop": "ready"} })
+	db.Close()
+
+	reloaded, err := New(Config{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := reloaded.series["shop"]
+	if len(reloaded.series) != 1 || len(s.States) != 2 || s.States[1].State != "ready" {
+		t.Fatalf("reloaded %+v", reloaded.series)
+	}
+	// The requests may straddle two minutes
+	total := newBucket(time.Time{})
+	for _, b := range s.Minutes {
+		total.merge(b)
+	}
+	if total.Requests != 2 || total.Errors != 1 || total.Latency[0] != 1 || total.Latency[4] != 1 {
+		t.Errorf("minutes %+v", total)
+	}
+
+	var none *DB
+	none.Record("shop", 200, time.Millisecond)
+	none.SetStates(map[string]string{"shop": "ready"})
+	none.Close()
+}
+
+func TestCompact(t *testing.T) {
+	db, err := New(Config{RawRetention: time.Hour, Retention: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := at(0)
+	db.series["shop"] = &series{
+		Hours:   []*bucket{requests(now.Add(-30*time.Hour), 1, 0, 0), requests(now.Add(-5*time.Hour), 2, 0, 0)},
+		Minutes: []*bucket{requests(at(-150), 1, 0, 0), requests(at(-130), 2, 1, 0), requests(at(-70), 4, 0, 0), requests(at(-30), 8, 0, 0)},
+		States:  []stateChange{{now.Add(-40 * time.Hour), "ready"}, {now.Add(-30 * time.Hour), "sleeping"}, {at(-10), "waking"}},
+	}
+	db.series["gone"] = &series{
+		Hours:  []*bucket{requests(now.Add(-48*time.Hour), 1, 0, 0)},
+		States: []stateChange{{now.Add(-48 * time.Hour), "sleeping"}},
+	}
+	db.compact(now)
+
+	s := db.series["shop"]
+	var hours []int64
+	for _, b := range s.Hours {
+		hours = append(hours, b.Requests)
+	}
+	// Minutes older than an hour went into the hours they started in: 7:00 (1+2) and 8:00 (4)
+	if len(hours) != 3 || hours[0] != 2 || hours[1] != 3 || hours[2] != 4 || s.Hours[1].Errors != 1 || !s.Hours[1].Start.Equal(at(-180)) {
+		t.Errorf("hours %v", hours)
+	}
+	if len(s.Minutes) != 1 || s.Minutes[0].Requests != 8 {
+		t.Errorf("minutes %+v", s.Minutes)
+	}
+	// The state at the start of the retained period is kept
+	if len(s.States) != 2 || s.States[0].State != "sleeping" {
+		t.Errorf("states %+v", s.States)
+	}
+	if _, ok := db.series["gone"]; ok {
+		t.Error("series without data in the retention kept")
+	}
+
+	if _, err := New(Config{RawRetention: 48 * time.Hour, Retention: 24 * time.Hour}); err == nil {
+		t.Error("retention shorter than the raw retention")
+	}
+}
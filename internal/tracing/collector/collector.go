@@ -0,0 +1,111 @@
+// Package collector is an in-memory stand-in for an OpenTelemetry collector. It accepts OTLP/HTTP
+// JSON trace exports on /v1/traces and keeps the spans, for tests and local debugging.
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"smart-proxy/internal/tracing"
+)
+
+// Span is a received span with its service name.
+type Span struct {
+	Service string
+	tracing.OTLPSpan
+}
+
+// Attribute returns the value of an attribute as text, or "".
+func (s Span) Attribute(key string) string {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value.String()
+		}
+	}
+	return ""
+}
+
+// Collector stores every span it receives.
+type Collector struct {
+	mu       sync.Mutex
+	spans    []Span
+	OnExport func(spans []Span) // Optional, called for every export request
+}
+
+// New returns an empty collector.
+func New() *Collector {
+	return &Collector{}
+}
+
+// Handler serves the OTLP/HTTP trace endpoint.
+func (c *Collector) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/traces", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			http.Error(w, "Only the OTLP JSON encoding is supported", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var req tracing.ExportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var received []Span
+		for _, rs := range req.ResourceSpans {
+			service := ""
+			for _, kv := range rs.Resource.Attributes {
+				if kv.Key == "service.name" {
+					service = kv.Value.String()
+				}
+			}
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					received = append(received, Span{Service: service, OTLPSpan: s})
+				}
+			}
+		}
+
+		c.mu.Lock()
+		c.spans = append(c.spans, received...)
+		c.mu.Unlock()
+		if c.OnExport != nil {
+			c.OnExport(received)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	})
+	return mux
+}
+
+// Spans returns a copy of the spans received so far.
+func (c *Collector) Spans() []Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Span(nil), c.spans...)
+}
+
+// Trace returns the spans of one trace.
+func (c *Collector) Trace(traceID string) []Span {
+	var out []Span
+	for _, s := range c.Spans() {
+		if s.TraceID == traceID {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Reset forgets all spans.
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spans = nil
+}
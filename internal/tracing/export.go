@@ -0,0 +1,370 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"smart-proxy/internal/logger"
+)
+
+var log = logger.Component("tracing")
+
+// Exporter sends ended spans to a backend.
+type Exporter interface {
+	Export(spans []SpanData) error
+}
+
+// Config configures the tracer.
+type Config struct {
+	ServiceName string
+	Exporter    Exporter
+	SampleRatio float64 // Share of new traces recorded; children follow their parent's decision
+}
+
+// tracer batches ended spans and hands them to the exporter.
+type tracer struct {
+	config    Config
+	processor *batchProcessor
+}
+
+var active atomic.Pointer[tracer]
+
+func current() *tracer {
+	return active.Load()
+}
+
+// Enabled reports whether a tracer is installed.
+func Enabled() bool {
+	return current() != nil
+}
+
+// sample decides from the trace ID, so that all services sampling at the same ratio agree.
+func (t *tracer) sample(id TraceID) bool {
+	ratio := t.config.SampleRatio
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(id[8:])>>1) < ratio*float64(uint64(1)<<63)
+}
+
+// Init installs a tracer and returns a function that flushes pending spans and uninstalls it.
+func Init(config Config) func() {
+	if config.ServiceName == "" {
+		config.ServiceName = "smart-proxy"
+	}
+	if otlp, ok := config.Exporter.(*OTLPExporter); ok {
+		otlp.service = config.ServiceName
+	}
+	t := &tracer{config: config, processor: newBatchProcessor(config.Exporter)}
+	active.Store(t)
+	return func() {
+		active.CompareAndSwap(t, nil)
+		t.processor.shutdown()
+	}
+}
+
+// InitFromEnv configures tracing from the standard OpenTelemetry variables:
+// OTEL_TRACES_EXPORTER ("otlp", "console" or "none", the default), OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS, OTEL_SERVICE_NAME and
+// OTEL_TRACES_SAMPLER_ARG (sampling ratio, default 1). It returns nil if tracing stays disabled.
+func InitFromEnv() (func(), error) {
+	ratio := 1.0
+	if arg := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); arg != "" {
+		r, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG: %w", err)
+		}
+		ratio = r
+	}
+
+	var exporter Exporter
+	switch mode := os.Getenv("OTEL_TRACES_EXPORTER"); mode {
+	case "", "none":
+		return nil, nil
+	case "otlp":
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+		if endpoint == "" {
+			base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+			if base == "" {
+				base = "http://localhost:4318"
+			}
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+		exporter = NewOTLPExporter(endpoint, parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")))
+	case "console":
+		exporter = ConsoleExporter{}
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", mode)
+	}
+
+	return Init(Config{ServiceName: os.Getenv("OTEL_SERVICE_NAME"), Exporter: exporter, SampleRatio: ratio}), nil
+}
+
+func parseHeaders(raw string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return headers
+}
+
+// batchProcessor exports spans in batches of up to maxBatch, at least every flushInterval.
+type batchProcessor struct {
+	exporter Exporter
+	queue    chan SpanData
+	done     chan struct{}
+	wg       sync.WaitGroup
+	dropped  atomic.Int64
+}
+
+const (
+	maxQueue      = 2048
+	maxBatch      = 512
+	flushInterval = 5 * time.Second
+)
+
+func newBatchProcessor(exporter Exporter) *batchProcessor {
+	p := &batchProcessor{exporter: exporter, queue: make(chan SpanData, maxQueue), done: make(chan struct{})}
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+// enqueue never blocks the request path; spans are dropped when the queue is full.
+func (p *batchProcessor) enqueue(span SpanData) {
+	select {
+	case p.queue <- span:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+func (p *batchProcessor) run() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []SpanData
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := p.exporter.Export(batch); err != nil {
+			log.Error("Error exporting spans", "spans", len(batch), "error", err)
+		}
+		if n := p.dropped.Swap(0); n > 0 {
+			log.Warn("Dropped spans, the trace queue was full", "spans", n)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case span := <-p.queue:
+			batch = append(batch, span)
+			if len(batch) >= maxBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-p.done:
+			for {
+				select {
+				case span := <-p.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *batchProcessor) shutdown() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+// ConsoleExporter logs one line per span, which is handy when no collector is at hand.
+type ConsoleExporter struct{}
+
+// Export implements Exporter.
+func (ConsoleExporter) Export(spans []SpanData) error {
+	for _, s := range spans {
+		log.Info("Span "+s.Name, "trace_id", s.Context.TraceID.String(), "span_id", s.Context.SpanID.String(),
+			"parent", s.Parent.String(), "duration", s.End.Sub(s.Start), "attributes", fmt.Sprint(s.Attributes))
+	}
+	return nil
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP endpoint using the JSON encoding.
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+	service  string // Set by Init
+}
+
+// NewOTLPExporter returns an exporter posting to endpoint (e.g. http://collector:4318/v1/traces).
+func NewOTLPExporter(endpoint string, headers map[string]string) *OTLPExporter {
+	return &OTLPExporter{endpoint: endpoint, headers: headers, client: &http.Client{Timeout: 10 * time.Second}, service: "smart-proxy"}
+}
+
+// Export implements Exporter.
+func (e *OTLPExporter) Export(spans []SpanData) error {
+	body, err := json.Marshal(EncodeOTLP(e.service, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP JSON encoding (opentelemetry/proto/collector/trace/v1 ExportTraceServiceRequest).
+// IDs are hex strings and 64-bit integers are decimal strings, as required by the OTLP JSON mapping.
+
+// ExportRequest is the body of an OTLP/HTTP trace export.
+type ExportRequest struct {
+	ResourceSpans []ResourceSpans `json:"resourceSpans"`
+}
+
+type ResourceSpans struct {
+	Resource   Resource     `json:"resource"`
+	ScopeSpans []ScopeSpans `json:"scopeSpans"`
+}
+
+type Resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+type ScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []OTLPSpan `json:"spans"`
+}
+
+type OTLPSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Status            struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+type AnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// String returns the value as text, whatever its type.
+func (v AnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.IntValue != nil:
+		return *v.IntValue
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'g', -1, 64)
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	default:
+		return ""
+	}
+}
+
+// EncodeOTLP converts spans to an OTLP export request.
+func EncodeOTLP(service string, spans []SpanData) ExportRequest {
+	scope := ScopeSpans{}
+	scope.Scope.Name = "smart-proxy"
+	for _, s := range spans {
+		span := OTLPSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        encodeAttributes(s.Attributes),
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		span.Status.Code = s.Status
+		span.Status.Message = s.Message
+		scope.Spans = append(scope.Spans, span)
+	}
+
+	return ExportRequest{ResourceSpans: []ResourceSpans{{
+		Resource:   Resource{Attributes: encodeAttributes([]Attribute{String("service.name", service)})},
+		ScopeSpans: []ScopeSpans{scope},
+	}}}
+}
+
+func encodeAttributes(attributes []Attribute) []KeyValue {
+	out := make([]KeyValue, 0, len(attributes))
+	for _, a := range attributes {
+		var v AnyValue
+		switch value := a.Value.(type) {
+		case string:
+			v.StringValue = &value
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &value
+		case bool:
+			v.BoolValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		out = append(out, KeyValue{Key: a.Key, Value: v})
+	}
+	return out
+}
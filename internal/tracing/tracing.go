@@ -0,0 +1,295 @@
+// Package tracing is a lightweight OpenTelemetry-compatible tracer. Spans carry W3C trace context
+// (the traceparent header) and are exported over OTLP/HTTP in its JSON encoding, so any OpenTelemetry
+// collector or tracing backend can receive them. Tracing is off until Init is called with an exporter;
+// while off, Start returns nil spans and every Span method is a no-op.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID and SpanID identify traces and spans as in the W3C trace context specification.
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether the ID is not all zeros.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether the ID is not all zeros.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span that is propagated to other services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// SpanKind follows the OTLP enumeration.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Status codes follow the OTLP enumeration.
+const (
+	statusUnset = 0
+	statusOK    = 1
+	statusError = 2
+)
+
+// Attribute is a key/value pair attached to a span. Value is a string, int64, float64 or bool.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute { return Attribute{key, value} }
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute { return Attribute{key, int64(value)} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute { return Attribute{key, value} }
+
+// Span is a timed operation. A nil *Span is valid and records nothing.
+type Span struct {
+	tracer *tracer
+
+	mu         sync.Mutex
+	name       string
+	kind       SpanKind
+	context    SpanContext
+	parent     SpanID
+	start, end time.Time
+	attributes []Attribute
+	status     int
+	message    string
+	ended      bool
+}
+
+// SpanData is the immutable snapshot of an ended span handed to exporters.
+type SpanData struct {
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanID
+	Start, End time.Time
+	Attributes []Attribute
+	Status     int
+	Message    string
+}
+
+// Context returns the span's trace context.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, attributes...)
+}
+
+// RecordError marks the span as failed. A nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = statusError
+	s.message = err.Error()
+}
+
+// SetHTTPStatus records an HTTP status code, marking 5xx responses as errors.
+func (s *Span) SetHTTPStatus(code int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, Int("http.status_code", code))
+	if code >= 500 {
+		s.status = statusError
+		s.message = http.StatusText(code)
+	}
+}
+
+// End finishes the span and queues it for export. Calls after the first are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	data := SpanData{
+		Name:       s.name,
+		Kind:       s.kind,
+		Context:    s.context,
+		Parent:     s.parent,
+		Start:      s.start,
+		End:        s.end,
+		Attributes: append([]Attribute(nil), s.attributes...),
+		Status:     s.status,
+		Message:    s.message,
+	}
+	s.mu.Unlock()
+
+	if s.context.Sampled {
+		s.tracer.processor.enqueue(data)
+	}
+}
+
+// Option configures a span started by Start.
+type Option func(*Span)
+
+// WithKind sets the span kind (default: internal).
+func WithKind(kind SpanKind) Option {
+	return func(s *Span) { s.kind = kind }
+}
+
+// WithAttributes sets initial attributes.
+func WithAttributes(attributes ...Attribute) Option {
+	return func(s *Span) { s.attributes = append(s.attributes, attributes...) }
+}
+
+// WithStartTime backdates the span, e.g. for phases only known to have started once they end.
+func WithStartTime(t time.Time) Option {
+	return func(s *Span) { s.start = t }
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan returns a copy of ctx with span as the current span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// Start begins a span as a child of the span in ctx (or of a remote parent extracted into ctx).
+// It returns nil when tracing is disabled.
+func Start(ctx context.Context, name string, options ...Option) (context.Context, *Span) {
+	t := current()
+	if t == nil {
+		return ctx, nil
+	}
+
+	var parent SpanContext
+	if p := SpanFromContext(ctx); p != nil {
+		parent = p.context
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		parent = remote
+	}
+
+	span := &Span{tracer: t, name: name, kind: KindInternal, start: time.Now()}
+	if parent.TraceID.IsValid() {
+		span.context.TraceID = parent.TraceID
+		span.context.Sampled = parent.Sampled
+		span.parent = parent.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Sampled = t.sample(span.context.TraceID)
+	}
+	rand.Read(span.context.SpanID[:])
+
+	for _, option := range options {
+		option(span)
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// W3C trace context
+
+const traceparentHeader = "traceparent"
+
+// Extract reads the traceparent header into ctx, so that the next Start continues the caller's trace.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, ok := parseTraceparent(header.Get(traceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Inject writes the trace context of the span in ctx into header. The tracestate header of the
+// incoming request, if any, is forwarded unchanged by the proxy.
+func Inject(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set(traceparentHeader, formatTraceparent(span.context))
+}
+
+func formatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+func parseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	if n, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil || n != 16 || len(parts[1]) != 32 {
+		return SpanContext{}, false
+	}
+	if n, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil || n != 8 || len(parts[2]) != 16 {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return SpanContext{}, false
+	}
+	if !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
@@ -0,0 +1,199 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"smart-proxy/internal/tracing"
+	"smart-proxy/internal/tracing/collector"
+)
+
+// startCollector runs the collector stand-in and installs a tracer exporting to it. The returned function
+// flushes the spans, so that the collector holds them all once it returns.
+func startCollector(t *testing.T, ratio float64) (*collector.Collector, func()) {
+	c := collector.New()
+	srv := httptest.NewServer(c.Handler())
+	t.Cleanup(srv.Close)
+	shutdown := tracing.Init(tracing.Config{
+		ServiceName: "smart-proxy-test",
+		Exporter:    tracing.NewOTLPExporter(srv.URL+"/v1/traces", nil),
+		SampleRatio: ratio,
+	})
+	var once sync.Once
+	flush := func() { once.Do(shutdown) }
+	t.Cleanup(flush)
+	return c, flush
+}
+
+const (
+	remoteTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	remoteSpan  = "00f067aa0ba902b7"
+)
+
+func TestTraceparentParsing(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		continued   bool // The span joins the remote trace
+		sampled     bool
+	}{
+		{"sampled", "00-" + remoteTrace + "-" + remoteSpan + "-01", true, true},
+		{"not sampled", "00-" + remoteTrace + "-" + remoteSpan + "-00", true, false},
+		{"other flags", "00-" + remoteTrace + "-" + remoteSpan + "-03", true, true},
+		{"future version with more fields", "cc-" + remoteTrace + "-" + remoteSpan + "-01-what-the-future-holds", true, true},
+		{"surrounding spaces", " 00-" + remoteTrace + "-" + remoteSpan + "-01 ", true, true},
+		{"version ff", "ff-" + remoteTrace + "-" + remoteSpan + "-01", false, true},
+		{"version 00 with more fields", "00-" + remoteTrace + "-" + remoteSpan + "-01-extra", false, true},
+		{"zero trace ID", "00-00000000000000000000000000000000-" + remoteSpan + "-01", false, true},
+		{"zero span ID", "00-" + remoteTrace + "-0000000000000000-01", false, true},
+		{"short trace ID", "00-" + remoteTrace[2:] + "-" + remoteSpan + "-01", false, true},
+		{"non-hex span ID", "00-" + remoteTrace + "-00f067aa0ba902bz-01", false, true},
+		{"long flags", "00-" + remoteTrace + "-" + remoteSpan + "-001", false, true},
+		{"empty", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, shutdown := startCollector(t, 1)
+			defer shutdown()
+
+			header := http.Header{}
+			if tt.traceparent != "" {
+				header.Set("traceparent", tt.traceparent)
+			}
+			_, span := tracing.Start(tracing.Extract(context.Background(), header), "request")
+			span.End()
+
+			sc := span.Context()
+			if continued := sc.TraceID.String() == remoteTrace; continued != tt.continued {
+				t.Errorf("trace %s continued: %v, want %v", sc.TraceID, continued, tt.continued)
+			}
+			if sc.Sampled != tt.sampled {
+				t.Errorf("sampled: %v, want %v", sc.Sampled, tt.sampled)
+			}
+		})
+	}
+}
+
+func TestExportToCollector(t *testing.T) {
+	c, shutdown := startCollector(t, 1)
+
+	header := http.Header{"Traceparent": {"00-" + remoteTrace + "-" + remoteSpan + "-01"}}
+	ctx, root := tracing.Start(tracing.Extract(context.Background(), header), "proxy.request",
+		tracing.WithKind(tracing.KindServer), tracing.WithAttributes(tracing.String("http.method", "GET")))
+	_, child := tracing.Start(ctx, "proxy.wake", tracing.WithAttributes(tracing.Int("replicas", 2), tracing.Bool("cold", true)))
+	child.RecordError(errors.New("deployment not ready"))
+	child.End()
+	root.SetHTTPStatus(http.StatusServiceUnavailable)
+	root.End()
+	root.End() // Ignored
+	shutdown()
+
+	spans := c.Trace(remoteTrace)
+	if len(spans) != 2 {
+		t.Fatalf("%d spans of the trace exported, want 2: %+v", len(spans), c.Spans())
+	}
+	byName := map[string]collector.Span{}
+	for _, s := range spans {
+		byName[s.Name] = s
+		if s.Service != "smart-proxy-test" {
+			t.Errorf("%s: service %q", s.Name, s.Service)
+		}
+	}
+	server, wake := byName["proxy.request"], byName["proxy.wake"]
+	if server.ParentSpanID != remoteSpan || server.Kind != int(tracing.KindServer) {
+		t.Errorf("server span parent %s, kind %d", server.ParentSpanID, server.Kind)
+	}
+	if wake.ParentSpanID != server.SpanID {
+		t.Errorf("child parent %s, want %s", wake.ParentSpanID, server.SpanID)
+	}
+	if server.Attribute("http.method") != "GET" || server.Attribute("http.status_code") != "503" || server.Status.Code != 2 {
+		t.Errorf("server span attributes %+v, status %+v", server.Attributes, server.Status)
+	}
+	if wake.Attribute("replicas") != "2" || wake.Attribute("cold") != "true" || wake.Status.Message != "deployment not ready" {
+		t.Errorf("child span attributes %+v, status %+v", wake.Attributes, wake.Status)
+	}
+}
+
+func TestUnsampledTracesAreNotExported(t *testing.T) {
+	c, shutdown := startCollector(t, 0)
+	ctx, root := tracing.Start(context.Background(), "request")
+	_, child := tracing.Start(ctx, "child")
+	child.End()
+	root.End()
+
+	// The caller's decision wins over the ratio
+	header := http.Header{"Traceparent": {"00-" + remoteTrace + "-" + remoteSpan + "-01"}}
+	_, remote := tracing.Start(tracing.Extract(context.Background(), header), "request")
+	remote.End()
+	shutdown()
+
+	if spans := c.Spans(); len(spans) != 1 || spans[0].TraceID != remoteTrace {
+		t.Errorf("exported %+v, want the sampled remote trace only", spans)
+	}
+}
+
+// TestPropagation follows a trace from the proxy to a downstream service, which continues it.
+func TestPropagation(t *testing.T) {
+	c, shutdown := startCollector(t, 1)
+
+	var received string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+		_, span := tracing.Start(tracing.Extract(r.Context(), r.Header), "backend", tracing.WithKind(tracing.KindServer))
+		span.End()
+	}))
+	defer backend.Close()
+
+	ctx, upstream := tracing.Start(context.Background(), "proxy.upstream", tracing.WithKind(tracing.KindClient))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, backend.URL, nil)
+	tracing.Inject(ctx, req.Header)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	upstream.End()
+	shutdown()
+
+	sc := upstream.Context()
+	if want := "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-01"; received != want {
+		t.Errorf("traceparent %q, want %q", received, want)
+	}
+	spans := c.Trace(sc.TraceID.String())
+	if len(spans) != 2 {
+		t.Fatalf("%d spans in the trace, want 2", len(spans))
+	}
+	for _, s := range spans {
+		if s.Name == "backend" && s.ParentSpanID != sc.SpanID.String() {
+			t.Errorf("backend span parent %s, want %s", s.ParentSpanID, sc.SpanID)
+		}
+	}
+
+	// Nothing is injected outside a trace
+	header := http.Header{}
+	tracing.Inject(context.Background(), header)
+	if header.Get("traceparent") != "" {
+		t.Errorf("traceparent injected without a span: %q", header.Get("traceparent"))
+	}
+}
+
+func TestDisabledTracing(t *testing.T) {
+	if tracing.Enabled() {
+		t.Fatal("tracing enabled by another test")
+	}
+	ctx, span := tracing.Start(context.Background(), "request")
+	if span != nil || tracing.SpanFromContext(ctx) != nil {
+		t.Error("span started while tracing is disabled")
+	}
+	span.SetAttributes(tracing.String("k", "v")) // No-ops on nil spans
+	span.RecordError(errors.New("x"))
+	span.End()
+	if sc := span.Context(); sc.TraceID.IsValid() || strings.Trim(sc.SpanID.String(), "0") != "" {
+		t.Errorf("nil span context %+v", sc)
+	}
+}
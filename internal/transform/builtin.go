@@ -0,0 +1,161 @@
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"smart-proxy/internal/store"
+)
+
+func init() {
+	Register("html_inject", newHTMLInject)
+	Register("regex_replace", newRegexReplace)
+	Register("json_patch", newJSONPatch)
+	Register("headers", newHeaders)
+}
+
+// htmlInject adds a snippet to HTML documents.
+type htmlInject struct {
+	html     []byte
+	position string
+}
+
+func newHTMLInject(config store.TransformConfig) (Transformer, error) {
+	if config.HTML == "" {
+		return nil, errors.New("html is required")
+	}
+	position := config.Position
+	switch position {
+	case "":
+		position = "body_end"
+	case "head_end", "body_start", "body_end":
+	default:
+		return nil, fmt.Errorf("invalid position %q", position)
+	}
+	return &htmlInject{html: []byte(config.HTML), position: position}, nil
+}
+
+func (*htmlInject) ContentTypes() []string {
+	return []string{"text/html", "application/xhtml+xml"}
+}
+
+// Transform inserts the snippet before </head>, after <body ...> or before </body>. Missing tags fall back
+// to the next position: after <body>, then the start or the end of the document.
+func (t *htmlInject) Transform(resp *Response) error {
+	body := resp.Body
+	at := -1
+	switch t.position {
+	case "head_end":
+		if at = indexFold(body, []byte("</head>")); at < 0 {
+			at = afterBodyTag(body)
+		}
+	case "body_start":
+		at = afterBodyTag(body)
+	case "body_end":
+		if at = indexFold(body, []byte("</body>")); at < 0 {
+			at = len(body)
+		}
+	}
+	if at < 0 {
+		at = 0
+	}
+
+	out := make([]byte, 0, len(body)+len(t.html))
+	out = append(out, body[:at]...)
+	out = append(out, t.html...)
+	resp.Body = append(out, body[at:]...)
+	return nil
+}
+
+// afterBodyTag returns the index following the <body> start tag, or -1.
+func afterBodyTag(body []byte) int {
+	for from := 0; ; {
+		i := indexFold(body[from:], []byte("<body"))
+		if i < 0 {
+			return -1
+		}
+		i += from + len("<body")
+		if i < len(body) && (body[i] == '>' || body[i] == ' ' || body[i] == '\t' || body[i] == '\n' || body[i] == '\r') {
+			if end := bytes.IndexByte(body[i:], '>'); end >= 0 {
+				return i + end + 1
+			}
+			return -1
+		}
+		from = i // e.g. <bodyguard>
+	}
+}
+
+// indexFold returns the index of the first ASCII case-insensitive match of sep in s, or -1.
+func indexFold(s, sep []byte) int {
+	for i := 0; i+len(sep) <= len(s); i++ {
+		if bytes.EqualFold(s[i:i+len(sep)], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// regexReplace replaces the matches of a regular expression, e.g. to rewrite absolute URLs for a route
+// served under a path prefix.
+type regexReplace struct {
+	pattern     *regexp.Regexp
+	replacement []byte
+}
+
+func newRegexReplace(config store.TransformConfig) (Transformer, error) {
+	if config.Pattern == "" {
+		return nil, errors.New("pattern is required")
+	}
+	re, err := regexp.Compile(config.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &regexReplace{pattern: re, replacement: []byte(config.Replacement)}, nil
+}
+
+func (*regexReplace) ContentTypes() []string {
+	return []string{"text/*", "application/json", "application/*+json", "application/javascript", "application/xml", "application/*+xml"}
+}
+
+func (t *regexReplace) Transform(resp *Response) error {
+	resp.Body = t.pattern.ReplaceAll(resp.Body, t.replacement)
+	return nil
+}
+
+// headers sets and removes response headers.
+type headers struct {
+	set    map[string]string
+	remove []string
+}
+
+func newHeaders(config store.TransformConfig) (Transformer, error) {
+	if len(config.SetHeaders) == 0 && len(config.RemoveHeaders) == 0 {
+		return nil, errors.New("set_headers or remove_headers is required")
+	}
+	names := append([]string(nil), config.RemoveHeaders...)
+	for name := range config.SetHeaders {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding":
+			return nil, fmt.Errorf("header %s is managed by the proxy", name)
+		}
+	}
+	return &headers{set: config.SetHeaders, remove: config.RemoveHeaders}, nil
+}
+
+func (*headers) HeadersOnly() bool { return true }
+
+func (t *headers) Transform(resp *Response) error {
+	for _, name := range t.remove {
+		resp.Header.Del(name)
+	}
+	for name, value := range t.set {
+		resp.Header.Set(name, value)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package transform
+
+import (
+	"testing"
+
+	"smart-proxy/internal/store"
+)
+
+func TestHTMLInjectPositions(t *testing.T) {
+	tests := []struct {
+		position, body, want string
+	}{
+		{"head_end", "<html><head></head><body></body></html>", "<html><head>X</head><body></body></html>"},
+		{"head_end", "<html><BODY class=a>hi</body>", "<html><BODY class=a>Xhi</body>"},
+		{"head_end", "hi", "Xhi"},
+		{"body_start", "<bodyguard><body\nid=b>hi</body>", "<bodyguard><body\nid=b>Xhi</body>"},
+		{"body_start", "<body", "X<body"},
+		{"body_end", "<body>hi</BODY></html>", "<body>hiX</BODY></html>"},
+		{"", "<body>hi</body>", "<body>hiX</body>"},
+		{"body_end", "hi", "hiX"},
+	}
+	for _, tt := range tests {
+		inject, err := newHTMLInject(store.TransformConfig{HTML: "X", Position: tt.position})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := &Response{Body: []byte(tt.body)}
+		inject.Transform(resp)
+		if string(resp.Body) != tt.want {
+			t.Errorf("%s in %q: %q, want %q", tt.position, tt.body, resp.Body, tt.want)
+		}
+	}
+}
+
+func TestRegexReplace(t *testing.T) {
+	replace, err := newRegexReplace(store.TransformConfig{Pattern: `(src|href)="/(?P<path>[^"]*)"`, Replacement: `$1="/shop/${path}"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &Response{Body: []byte(`<a href="/cart"><img src="/logo.png"> <a href="https://example.com/">`)}
+	replace.Transform(resp)
+	if want := `<a href="/shop/cart"><img src="/shop/logo.png"> <a href="https://example.com/">`; string(resp.Body) != want {
+		t.Errorf("%s, want %s", resp.Body, want)
+	}
+}
+
+func TestBuiltinValidation(t *testing.T) {
+	tests := []struct {
+		kind   string
+		config store.TransformConfig
+	}{
+		{"html_inject", store.TransformConfig{}},
+		{"html_inject", store.TransformConfig{HTML: "x", Position: "head_start"}},
+		{"regex_replace", store.TransformConfig{}},
+		{"regex_replace", store.TransformConfig{Pattern: "[a"}},
+		{"headers", store.TransformConfig{}},
+		{"headers", store.TransformConfig{RemoveHeaders: []string{"transfer-encoding"}}},
+		{"headers", store.TransformConfig{SetHeaders: map[string]string{"Content-Encoding": "gzip"}}},
+		{"json_patch", store.TransformConfig{}},
+	}
+	for _, tt := range tests {
+		if _, err := factories[tt.kind](tt.config); err == nil {
+			t.Errorf("%s accepted %+v", tt.kind, tt.config)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package transform
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// encodings are the content codings that can be decoded and encoded again. They are the only ones asked
+// from the upstream when a route rewrites responses, so that compression stays on.
+var encodings = map[string]bool{"gzip": true, "deflate": true, "br": true, "identity": true}
+
+// Encoder compresses a body in a content coding.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error // Writes what was compressed so far
+}
+
+type identityEncoder struct{ io.Writer }
+
+func (identityEncoder) Flush() error { return nil }
+func (identityEncoder) Close() error { return nil }
+
+// ContentEncoding returns the content coding of a Content-Encoding header value, "identity" if empty.
+func ContentEncoding(header string) string {
+	coding := strings.ToLower(strings.TrimSpace(header))
+	if coding == "" {
+		return "identity"
+	}
+	return coding
+}
+
+// SupportsEncoding reports whether bodies in a content coding can be rewritten.
+func SupportsEncoding(coding string) bool {
+	return encodings[coding]
+}
+
+// AcceptEncoding keeps the content codings of an Accept-Encoding header that can be rewritten.
+func AcceptEncoding(header string) string {
+	var kept []string
+	for _, part := range strings.Split(header, ",") {
+		coding, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if encodings[strings.ToLower(strings.TrimSpace(coding))] {
+			kept = append(kept, strings.TrimSpace(part))
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+// NewDecoder returns a reader of the decoded body. The coding must be supported.
+func NewDecoder(coding string, body io.Reader) (io.Reader, error) {
+	switch coding {
+	case "gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return zlib.NewReader(body)
+	case "br":
+		return brotli.NewReader(body), nil
+	default:
+		return body, nil
+	}
+}
+
+// NewEncoder returns a writer encoding into w. The coding must be supported.
+func NewEncoder(coding string, w io.Writer) Encoder {
+	switch coding {
+	case "gzip":
+		return gzip.NewWriter(w)
+	case "deflate":
+		return zlib.NewWriter(w)
+	case "br":
+		return brotli.NewWriterLevel(w, 5)
+	default:
+		return identityEncoder{w}
+	}
+}
@@ -0,0 +1,235 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"smart-proxy/internal/store"
+)
+
+// errTestFailed is returned by a failed "test" operation, which leaves the document unchanged on purpose.
+var errTestFailed = errors.New("test failed")
+
+// jsonPatch applies RFC 6902 operations to JSON documents. Operations apply all or none: if one fails,
+// the document is left unchanged. Object keys come out sorted.
+type jsonPatch struct {
+	ops []store.JSONPatchOperation
+}
+
+func newJSONPatch(config store.TransformConfig) (Transformer, error) {
+	if len(config.Patch) == 0 {
+		return nil, errors.New("patch is required")
+	}
+	for i, op := range config.Patch {
+		if _, err := parsePointer(op.Path); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+			if _, err := decodeJSON(op.Value); err != nil {
+				return nil, fmt.Errorf("operation %d: invalid value: %w", i, err)
+			}
+		case "move", "copy":
+			if _, err := parsePointer(op.From); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+	}
+	return &jsonPatch{ops: config.Patch}, nil
+}
+
+func (*jsonPatch) ContentTypes() []string {
+	return []string{"application/json", "application/*+json"}
+}
+
+func (t *jsonPatch) Transform(resp *Response) error {
+	doc, err := decodeJSON(resp.Body)
+	if err != nil {
+		return err
+	}
+	for i, op := range t.ops {
+		if doc, err = applyOperation(doc, op); errors.Is(err, errTestFailed) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	resp.Body = body
+	return nil
+}
+
+// decodeJSON decodes a document, keeping numbers as they were written.
+func decodeJSON(data []byte) (any, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty document")
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func applyOperation(doc any, op store.JSONPatchOperation) (any, error) {
+	path, _ := parsePointer(op.Path)
+	switch op.Op {
+	case "add", "replace":
+		value, _ := decodeJSON(op.Value) // A fresh copy each time: documents are changed in place
+		return patchAt(doc, path, op.Op, value)
+	case "remove":
+		return patchAt(doc, path, "remove", nil)
+	case "test":
+		want, _ := decodeJSON(op.Value)
+		got, err := getAt(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return nil, errTestFailed
+		}
+		return doc, nil
+	case "move", "copy":
+		from, _ := parsePointer(op.From)
+		value, err := getAt(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if doc, err = patchAt(doc, from, "remove", nil); err != nil {
+				return nil, err
+			}
+		} else if value, err = copyJSON(value); err != nil {
+			return nil, err
+		}
+		return patchAt(doc, path, "add", value)
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func getAt(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			child, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+			doc = child
+		case []any:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("no member %q", token)
+		}
+	}
+	return doc, nil
+}
+
+// patchAt adds, replaces or removes the value at path, and returns the new document.
+func patchAt(doc any, path []string, op string, value any) (any, error) {
+	if len(path) == 0 {
+		if op == "remove" {
+			return nil, errors.New("cannot remove the whole document")
+		}
+		return value, nil
+	}
+
+	token, last := path[0], len(path) == 1
+	switch node := doc.(type) {
+	case map[string]any:
+		child, exists := node[token]
+		if !last {
+			if !exists {
+				return nil, fmt.Errorf("no member %q", token)
+			}
+			child, err := patchAt(child, path[1:], op, value)
+			node[token] = child
+			return node, err
+		}
+		if !exists && op != "add" {
+			return nil, fmt.Errorf("no member %q", token)
+		}
+		if op == "remove" {
+			delete(node, token)
+		} else {
+			node[token] = value
+		}
+		return node, nil
+	case []any:
+		if last && op == "add" {
+			i := len(node)
+			if token != "-" {
+				var err error
+				if i, err = arrayIndex(token, len(node)); err != nil {
+					return nil, err
+				}
+			}
+			return slices.Insert(node, i, value), nil
+		}
+		i, err := arrayIndex(token, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		if !last {
+			child, err := patchAt(node[i], path[1:], op, value)
+			node[i] = child
+			return node, err
+		}
+		if op == "remove" {
+			return slices.Delete(node, i, i+1), nil
+		}
+		node[i] = value
+		return node, nil
+	}
+	return nil, fmt.Errorf("no member %q", token)
+}
+
+// arrayIndex parses an array index of at most maxIndex.
+func arrayIndex(token string, maxIndex int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > maxIndex || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func copyJSON(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(data)
+}
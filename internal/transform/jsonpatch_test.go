@@ -0,0 +1,78 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"smart-proxy/internal/store"
+)
+
+func op(op, path, value string) store.JSONPatchOperation {
+	o := store.JSONPatchOperation{Op: op, Path: path}
+	if value != "" {
+		o.Value = json.RawMessage(value)
+	}
+	return o
+}
+
+func TestJSONPatch(t *testing.T) {
+	doc := `{"name":"shop","tags":["a","b"],"price":1.10,"meta":{"a/b":1,"m~n":2}}`
+	tests := []struct {
+		name string
+		ops  []store.JSONPatchOperation
+		want string
+	}{
+		{"add member", []store.JSONPatchOperation{op("add", "/env", `"staging"`)},
+			`{"env":"staging","meta":{"a/b":1,"m~n":2},"name":"shop","price":1.10,"tags":["a","b"]}`},
+		{"add to array", []store.JSONPatchOperation{op("add", "/tags/0", `"z"`), op("add", "/tags/-", `"c"`)},
+			`{"meta":{"a/b":1,"m~n":2},"name":"shop","price":1.10,"tags":["z","a","b","c"]}`},
+		{"replace and remove", []store.JSONPatchOperation{op("replace", "/name", `"store"`), op("remove", "/tags/1", ""), op("remove", "/meta/a~1b", "")},
+			`{"meta":{"m~n":2},"name":"store","price":1.10,"tags":["a"]}`},
+		{"move and copy", []store.JSONPatchOperation{
+			{Op: "move", Path: "/title", From: "/name"},
+			{Op: "copy", Path: "/meta/tags", From: "/tags"},
+			op("add", "/meta/tags/-", `"c"`),
+		}, `{"meta":{"a/b":1,"m~n":2,"tags":["a","b","c"]},"price":1.10,"tags":["a","b"],"title":"shop"}`},
+		{"test passes", []store.JSONPatchOperation{op("test", "/meta/m~0n", `2`), op("remove", "/meta", "")},
+			`{"name":"shop","price":1.10,"tags":["a","b"]}`},
+		{"whole document", []store.JSONPatchOperation{op("replace", "", `[1]`)}, `[1]`},
+
+		// Failed operations leave the document unchanged, including the operations before them
+		{"test fails", []store.JSONPatchOperation{op("remove", "/meta", ""), op("test", "/name", `"other"`)}, doc},
+		{"missing member", []store.JSONPatchOperation{op("remove", "/meta", ""), op("replace", "/missing", `1`)}, doc},
+		{"index out of range", []store.JSONPatchOperation{op("add", "/tags/3", `"c"`)}, doc},
+		{"leading zero index", []store.JSONPatchOperation{op("remove", "/tags/01", "")}, doc},
+		{"remove everything", []store.JSONPatchOperation{op("remove", "", "")}, doc},
+	}
+	for _, tt := range tests {
+		patch, err := newJSONPatch(store.TransformConfig{Patch: tt.ops})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp := &Response{Body: []byte(doc)}
+		err = patch.Transform(resp)
+		if got := string(resp.Body); got != tt.want {
+			t.Errorf("%s: %s, want %s (%v)", tt.name, got, tt.want, err)
+		}
+	}
+}
+
+func TestJSONPatchRejectsInvalidOperations(t *testing.T) {
+	for _, ops := range [][]store.JSONPatchOperation{
+		{op("add", "no-slash", `1`)},
+		{op("add", "/a", "")},
+		{op("replace", "/a", `{`)},
+		{{Op: "move", Path: "/a", From: "b"}},
+		{op("merge", "/a", `1`)},
+	} {
+		if _, err := newJSONPatch(store.TransformConfig{Patch: ops}); err == nil {
+			t.Errorf("%+v accepted", ops)
+		}
+	}
+
+	patch, _ := newJSONPatch(store.TransformConfig{Patch: []store.JSONPatchOperation{op("add", "/a", `1`)}})
+	resp := &Response{Body: []byte("not json")}
+	if err := patch.Transform(resp); err == nil || string(resp.Body) != "not json" {
+		t.Errorf("invalid document: %v, %s", err, resp.Body)
+	}
+}
@@ -0,0 +1,289 @@
+// Package transform rewrites proxied responses with a pipeline of transformers configured per route.
+// Built-in transformers inject HTML, replace regular expressions, patch JSON and set headers; others can be
+// added with Register.
+package transform
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+)
+
+var log = logger.Component("transform")
+
+// DefaultMaxBodyBytes is the largest decoded body transformed when TRANSFORM_MAX_BODY_BYTES is unset.
+const DefaultMaxBodyBytes = 4 << 20
+
+// Response is a response handed to transformers.
+type Response struct {
+	Request    *http.Request
+	StatusCode int         // Read only
+	Header     http.Header // Changes are sent to the client
+	Body       []byte      // Decoded body, to be replaced rather than changed in place; nil for header-only steps
+}
+
+// Transformer rewrites responses. A transformer that fails must leave the response unchanged: the failure
+// is logged and the pipeline goes on with the next step. Transformers are shared by concurrent responses.
+type Transformer interface {
+	Transform(resp *Response) error
+}
+
+// ContentTyper is implemented by transformers that only make sense for some media types. They apply to these
+// unless the step sets its own content types; other transformers apply to all responses by default.
+type ContentTyper interface {
+	ContentTypes() []string
+}
+
+// HeadersOnly is implemented by transformers that never read nor change the body, so that it is not
+// buffered for them.
+type HeadersOnly interface {
+	HeadersOnly() bool
+}
+
+// Factory builds a transformer from a step of a route's configuration. Its error rejects the step.
+type Factory func(config store.TransformConfig) (Transformer, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a transformer type available to route configurations. It panics if the type is already
+// registered, and is meant to be called from init functions.
+func Register(kind string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, exists := factories[kind]; exists {
+		panic("transform: type registered twice: " + kind)
+	}
+	factories[kind] = factory
+}
+
+// Types returns the registered transformer types, sorted.
+func Types() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	kinds := make([]string, 0, len(factories))
+	for kind := range factories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Pipeline applies the transforms of a route in order.
+type Pipeline struct {
+	steps []step
+}
+
+type step struct {
+	kind         string
+	transformer  Transformer
+	contentTypes []string // Empty for all
+	maxBody      int64
+	headersOnly  bool
+	status       []int
+	requestIf    map[string]*regexp.Regexp
+	responseIf   map[string]*regexp.Regexp
+}
+
+// NewPipeline builds the pipeline of a route. Steps that are invalid are left out and reported in the error;
+// the pipeline of the valid ones is returned anyway.
+func NewPipeline(configs []store.TransformConfig, maxBodyBytes int64) (*Pipeline, error) {
+	p := &Pipeline{}
+	var errs []error
+	for i, config := range configs {
+		s, err := newStep(config, maxBodyBytes)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("transform %d (%s): %w", i, config.Type, err))
+			continue
+		}
+		p.steps = append(p.steps, s)
+	}
+	return p, errors.Join(errs...)
+}
+
+func newStep(config store.TransformConfig, maxBodyBytes int64) (step, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[config.Type]
+	factoriesMu.RUnlock()
+	if !ok {
+		return step{}, fmt.Errorf("unknown type")
+	}
+	t, err := factory(config)
+	if err != nil {
+		return step{}, err
+	}
+
+	s := step{kind: config.Type, transformer: t, contentTypes: config.ContentTypes, maxBody: config.MaxBodyBytes}
+	if len(s.contentTypes) == 0 {
+		if ct, ok := t.(ContentTyper); ok {
+			s.contentTypes = ct.ContentTypes()
+		}
+	}
+	for _, pattern := range s.contentTypes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return step{}, fmt.Errorf("invalid content type %q", pattern)
+		}
+	}
+	if s.maxBody <= 0 {
+		s.maxBody = maxBodyBytes
+	}
+	if h, ok := t.(HeadersOnly); ok {
+		s.headersOnly = h.HeadersOnly()
+	}
+	if w := config.When; w != nil {
+		s.status = w.Status
+		if s.requestIf, err = compileHeaderConditions(w.RequestHeaders); err != nil {
+			return step{}, err
+		}
+		if s.responseIf, err = compileHeaderConditions(w.ResponseHeaders); err != nil {
+			return step{}, err
+		}
+	}
+	return s, nil
+}
+
+func compileHeaderConditions(conditions map[string]string) (map[string]*regexp.Regexp, error) {
+	compiled := make(map[string]*regexp.Regexp, len(conditions))
+	for name, pattern := range conditions {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition on header %s: %w", name, err)
+		}
+		compiled[name] = re
+	}
+	return compiled, nil
+}
+
+// Len returns the number of valid steps.
+func (p *Pipeline) Len() int {
+	return len(p.steps)
+}
+
+// applies reports whether a step applies to a response of a media type.
+func (s step) applies(resp *http.Response, mediaType string) bool {
+	if len(s.contentTypes) > 0 && !slices.ContainsFunc(s.contentTypes, func(pattern string) bool {
+		matched, _ := path.Match(pattern, mediaType)
+		return matched
+	}) {
+		return false
+	}
+	if len(s.status) > 0 && !slices.Contains(s.status, resp.StatusCode) {
+		return false
+	}
+	for name, re := range s.requestIf {
+		if !re.MatchString(resp.Request.Header.Get(name)) {
+			return false
+		}
+	}
+	for name, re := range s.responseIf {
+		if !re.MatchString(resp.Header.Get(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply runs the pipeline on a response; it is meant for ReverseProxy.ModifyResponse. Bodies are decoded,
+// buffered up to the largest limit of the steps that need them, and encoded again in the same coding.
+// Bodies over the limit, or in a coding that cannot be decoded, are streamed unchanged.
+func (p *Pipeline) Apply(resp *http.Response) error {
+	if resp.Request.Method == http.MethodHead || resp.StatusCode < 200 ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	var active []step
+	var limit int64
+	for _, s := range p.steps {
+		if s.applies(resp, mediaType) {
+			active = append(active, s)
+			if !s.headersOnly {
+				limit = max(limit, s.maxBody)
+			}
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	tr := &Response{Request: resp.Request, StatusCode: resp.StatusCode, Header: resp.Header}
+	var original []byte
+	coding := ContentEncoding(resp.Header.Get("Content-Encoding"))
+	if limit > 0 && SupportsEncoding(coding) {
+		body, raw, complete := readBody(resp.Body, coding, limit)
+		if complete {
+			resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(raw))
+			tr.Body, original = body, body
+		} else {
+			log.Debug("Response body too large or undecodable, not transforming it", "limit", limit, "encoding", coding)
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(raw), resp.Body), resp.Body}
+		}
+	}
+
+	for _, s := range active {
+		if !s.headersOnly && (tr.Body == nil || int64(len(tr.Body)) > s.maxBody) {
+			continue
+		}
+		if err := s.transformer.Transform(tr); err != nil {
+			log.Warn("Response transform failed, skipping it", "type", s.kind, "path", resp.Request.URL.Path, "error", err)
+		}
+	}
+
+	if original == nil || bytes.Equal(original, tr.Body) {
+		return nil
+	}
+	var encoded bytes.Buffer
+	enc := NewEncoder(coding, &encoded)
+	enc.Write(tr.Body)
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(&encoded)
+	resp.ContentLength = int64(encoded.Len())
+	resp.Header.Set("Content-Length", fmt.Sprint(encoded.Len()))
+
+	// Disable caching of modified content
+	resp.Header.Del("ETag")
+	resp.Header.Del("Last-Modified")
+	return nil
+}
+
+// readBody reads and decodes a body of at most limit decoded bytes. It returns the raw bytes read so far
+// in any case, so that an incomplete body can still be sent as is.
+func readBody(body io.Reader, coding string, limit int64) (decoded, raw []byte, complete bool) {
+	var rawBuf bytes.Buffer
+	tee := io.TeeReader(body, &rawBuf)
+	dec, err := NewDecoder(coding, tee)
+	if err != nil {
+		return nil, rawBuf.Bytes(), false
+	}
+	decoded, err = io.ReadAll(io.LimitReader(dec, limit+1))
+	if err != nil || int64(len(decoded)) > limit {
+		return nil, rawBuf.Bytes(), false
+	}
+	if coding != "identity" {
+		io.Copy(&rawBuf, body) // Whatever follows the compressed stream
+	}
+	if decoded == nil {
+		decoded = []byte{}
+	}
+	return decoded, rawBuf.Bytes(), true
+}
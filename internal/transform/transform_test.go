@@ -0,0 +1,343 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"smart-proxy/internal/store"
+)
+
+// response builds a proxied response with a body already in coding.
+func response(t *testing.T, method string, status int, contentType, coding string, body []byte) *http.Response {
+	t.Helper()
+	header := http.Header{"Content-Type": {contentType}, "Etag": {`"v1"`}}
+	if coding != "" {
+		header.Set("Content-Encoding", coding)
+	}
+	return &http.Response{
+		Request:    httptest.NewRequest(method, "/page", nil),
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}
+}
+
+func encode(t *testing.T, coding string, body []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := NewEncoder(coding, &buf)
+	enc.Write(body)
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decodedBody reads the body of a response as the client would.
+func decodedBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	dec, err := NewDecoder(ContentEncoding(resp.Header.Get("Content-Encoding")), resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func mustPipeline(t *testing.T, maxBodyBytes int64, configs ...store.TransformConfig) *Pipeline {
+	t.Helper()
+	p, err := NewPipeline(configs, maxBodyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestApplyReencodes(t *testing.T) {
+	p := mustPipeline(t, DefaultMaxBodyBytes,
+		store.TransformConfig{Type: "regex_replace", Pattern: `href="/`, Replacement: `href="/shop/`},
+		store.TransformConfig{Type: "html_inject", HTML: "<script></script>"})
+
+	for _, coding := range []string{"", "gzip", "deflate", "br"} {
+		body := []byte(`<html><body><a href="/cart">Cart</a></body></html>`)
+		if coding != "" {
+			body = encode(t, coding, body)
+		}
+		resp := response(t, http.MethodGet, http.StatusOK, "text/html; charset=utf-8", coding, body)
+		if err := p.Apply(resp); err != nil {
+			t.Fatalf("%q: %v", coding, err)
+		}
+		if got, want := decodedBody(t, resp), `<html><body><a href="/shop/cart">Cart</a><script></script></body></html>`; got != want {
+			t.Errorf("%q: %s, want %s", coding, got, want)
+		}
+		if resp.Header.Get("Content-Encoding") != coding {
+			t.Errorf("%q: re-encoded as %q", coding, resp.Header.Get("Content-Encoding"))
+		}
+		if resp.Header.Get("Content-Length") != fmt.Sprint(resp.ContentLength) || resp.ContentLength <= 0 {
+			t.Errorf("%q: content length %d, header %q", coding, resp.ContentLength, resp.Header.Get("Content-Length"))
+		}
+		if resp.Header.Get("ETag") != "" {
+			t.Errorf("%q: ETag kept on a modified body", coding)
+		}
+	}
+}
+
+func TestApplyLeavesUnchangedBodiesAlone(t *testing.T) {
+	p := mustPipeline(t, DefaultMaxBodyBytes, store.TransformConfig{Type: "regex_replace", Pattern: "nothing", Replacement: "x"})
+	resp := response(t, http.MethodGet, http.StatusOK, "text/plain", "", []byte("hello"))
+	if err := p.Apply(resp); err != nil {
+		t.Fatal(err)
+	}
+	if decodedBody(t, resp) != "hello" || resp.Header.Get("ETag") == "" || resp.Header.Get("Content-Length") != "" {
+		t.Errorf("unchanged body was rewritten: %v", resp.Header)
+	}
+}
+
+func TestApplyBodyLimit(t *testing.T) {
+	body := strings.Repeat("a", 100)
+
+	p := mustPipeline(t, DefaultMaxBodyBytes, store.TransformConfig{Type: "regex_replace", Pattern: "a", Replacement: "b", MaxBodyBytes: 99})
+	resp := response(t, http.MethodGet, http.StatusOK, "text/plain", "gzip", encode(t, "gzip", []byte(body)))
+	if err := p.Apply(resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := decodedBody(t, resp); got != body {
+		t.Errorf("body over the step limit was changed: %s", got)
+	}
+	if resp.Header.Get("ETag") == "" {
+		t.Error("ETag removed from an unchanged body")
+	}
+
+	// The pipeline default applies to steps without a limit of their own
+	p = mustPipeline(t, 100, store.TransformConfig{Type: "regex_replace", Pattern: "a", Replacement: "b"})
+	resp = response(t, http.MethodGet, http.StatusOK, "text/plain", "", []byte(body))
+	p.Apply(resp)
+	if got := decodedBody(t, resp); got != strings.Repeat("b", 100) {
+		t.Errorf("body at the limit was not changed: %s", got)
+	}
+
+	// A larger limit of one step buffers the body, but does not extend to the other steps
+	p = mustPipeline(t, DefaultMaxBodyBytes,
+		store.TransformConfig{Type: "regex_replace", Pattern: "a", Replacement: "b", MaxBodyBytes: 10},
+		store.TransformConfig{Type: "html_inject", HTML: "!", ContentTypes: []string{"text/plain"}})
+	resp = response(t, http.MethodGet, http.StatusOK, "text/plain", "", []byte(body))
+	p.Apply(resp)
+	if got := decodedBody(t, resp); got != body+"!" {
+		t.Errorf("steps under their own limits: %s", got)
+	}
+}
+
+func TestApplyStreamsUndecodableBodies(t *testing.T) {
+	p := mustPipeline(t, DefaultMaxBodyBytes, store.TransformConfig{Type: "regex_replace", Pattern: "a", Replacement: "b"})
+
+	for _, tt := range []struct {
+		coding string
+		body   []byte
+	}{
+		{"gzip", []byte("aaaa not gzip at all")},
+		{"gzip", encode(t, "gzip", []byte("aaaa"))[:12]}, // Truncated
+		{"zstd", []byte("aaaa")},
+	} {
+		resp := response(t, http.MethodGet, http.StatusOK, "text/plain", tt.coding, tt.body)
+		if err := p.Apply(resp); err != nil {
+			t.Fatalf("%s: %v", tt.coding, err)
+		}
+		got, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tt.body) {
+			t.Errorf("%s: %q streamed as %q", tt.coding, tt.body, got)
+		}
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	compressed := encode(t, "gzip", []byte(strings.Repeat("x", 1000)))
+	decoded, raw, complete := readBody(bytes.NewReader(compressed), "gzip", 1000)
+	if !complete || len(decoded) != 1000 || !bytes.Equal(raw, compressed) {
+		t.Errorf("complete body: %d decoded, %d of %d raw bytes, complete %t", len(decoded), len(raw), len(compressed), complete)
+	}
+
+	// Over the limit, the bytes read so far are kept to be sent ahead of the rest
+	body := bytes.NewReader(compressed)
+	decoded, raw, complete = readBody(body, "gzip", 999)
+	rest, _ := io.ReadAll(body)
+	if complete || decoded != nil || !bytes.Equal(append(raw, rest...), compressed) {
+		t.Errorf("body over the limit: complete %t, %d + %d of %d bytes", complete, len(raw), len(rest), len(compressed))
+	}
+
+	if decoded, raw, complete = readBody(strings.NewReader(""), "identity", 10); !complete || decoded == nil || len(raw) != 0 {
+		t.Errorf("empty body: %q %q %t", decoded, raw, complete)
+	}
+	if _, raw, complete = readBody(strings.NewReader("plain"), "gzip", 10); complete || string(raw) != "plain" {
+		t.Errorf("invalid gzip: %q %t", raw, complete)
+	}
+}
+
+func TestApplySkips(t *testing.T) {
+	p := mustPipeline(t, DefaultMaxBodyBytes, store.TransformConfig{Type: "regex_replace", Pattern: "a", Replacement: "b"})
+	for _, tt := range []struct {
+		method      string
+		status      int
+		contentType string
+	}{
+		{http.MethodHead, http.StatusOK, "text/plain"},
+		{http.MethodGet, http.StatusNoContent, "text/plain"},
+		{http.MethodGet, http.StatusNotModified, "text/plain"},
+		{http.MethodGet, http.StatusOK, "image/png"},
+	} {
+		resp := response(t, tt.method, tt.status, tt.contentType, "", []byte("aaa"))
+		p.Apply(resp)
+		if got := decodedBody(t, resp); got != "aaa" {
+			t.Errorf("%s %d %s: %s", tt.method, tt.status, tt.contentType, got)
+		}
+	}
+}
+
+func TestWhenConditions(t *testing.T) {
+	p := mustPipeline(t, DefaultMaxBodyBytes, store.TransformConfig{
+		Type:        "regex_replace",
+		Pattern:     "a",
+		Replacement: "b",
+		When: &store.TransformWhen{
+			Status:          []int{http.StatusOK},
+			RequestHeaders:  map[string]string{"User-Agent": "^Mozilla/"},
+			ResponseHeaders: map[string]string{"X-Version": "^2"},
+		},
+	})
+	for _, tt := range []struct {
+		status    int
+		agent     string
+		version   string
+		transform bool
+	}{
+		{http.StatusOK, "Mozilla/5.0", "2.1", true},
+		{http.StatusNotFound, "Mozilla/5.0", "2.1", false},
+		{http.StatusOK, "curl/8.0", "2.1", false},
+		{http.StatusOK, "Mozilla/5.0", "1.9", false},
+		{http.StatusOK, "Mozilla/5.0", "", false},
+	} {
+		resp := response(t, http.MethodGet, tt.status, "text/plain", "", []byte("a"))
+		resp.Request.Header.Set("User-Agent", tt.agent)
+		resp.Header.Set("X-Version", tt.version)
+		p.Apply(resp)
+		if got := decodedBody(t, resp); (got == "b") != tt.transform {
+			t.Errorf("%d %q %q: %s", tt.status, tt.agent, tt.version, got)
+		}
+	}
+}
+
+func TestHeadersOnlyStepsDoNotBuffer(t *testing.T) {
+	p := mustPipeline(t, DefaultMaxBodyBytes, store.TransformConfig{
+		Type:          "headers",
+		SetHeaders:    map[string]string{"Cache-Control": "no-store"},
+		RemoveHeaders: []string{"Server"},
+	})
+	resp := response(t, http.MethodGet, http.StatusOK, "image/png", "gzip", []byte("not even gzip"))
+	resp.Header.Set("Server", "nginx")
+	body := resp.Body
+	if err := p.Apply(resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != body {
+		t.Error("body buffered for a header-only step")
+	}
+	if resp.Header.Get("Cache-Control") != "no-store" || resp.Header.Get("Server") != "" {
+		t.Errorf("headers: %v", resp.Header)
+	}
+}
+
+func TestNewPipelineKeepsValidSteps(t *testing.T) {
+	p, err := NewPipeline([]store.TransformConfig{
+		{Type: "regex_replace", Pattern: "a", Replacement: "b"},
+		{Type: "unknown"},
+		{Type: "regex_replace", Pattern: "("},
+		{Type: "html_inject", HTML: "x", Position: "footer"},
+		{Type: "headers", SetHeaders: map[string]string{"content-length": "1"}},
+		{Type: "regex_replace", Pattern: "a", ContentTypes: []string{"text/["}},
+		{Type: "regex_replace", Pattern: "a", When: &store.TransformWhen{RequestHeaders: map[string]string{"Accept": "("}}},
+		{Type: "headers", RemoveHeaders: []string{"Server"}},
+	}, DefaultMaxBodyBytes)
+	if err == nil {
+		t.Fatal("invalid steps accepted")
+	}
+	for _, want := range []string{"transform 1 (unknown)", "transform 2", "transform 3", "transform 4", "transform 5", "transform 6"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q not reported in %v", want, err)
+		}
+	}
+	if p.Len() != 2 {
+		t.Errorf("%d valid steps, want 2", p.Len())
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test_upper", func(config store.TransformConfig) (Transformer, error) {
+		return upper{}, nil
+	})
+	defer func() {
+		factoriesMu.Lock()
+		delete(factories, "test_upper")
+		factoriesMu.Unlock()
+	}()
+
+	types := Types()
+	for _, kind := range []string{"headers", "html_inject", "json_patch", "regex_replace", "test_upper"} {
+		found := false
+		for _, t := range types {
+			found = found || t == kind
+		}
+		if !found {
+			t.Errorf("%s not in %v", kind, types)
+		}
+	}
+
+	p := mustPipeline(t, DefaultMaxBodyBytes, store.TransformConfig{Type: "test_upper"})
+	resp := response(t, http.MethodGet, http.StatusOK, "application/octet-stream", "", []byte("abc"))
+	p.Apply(resp)
+	if got := decodedBody(t, resp); got != "ABC" {
+		t.Errorf("custom transformer on all media types: %s", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a type twice did not panic")
+		}
+	}()
+	Register("test_upper", nil)
+}
+
+type upper struct{}
+
+func (upper) Transform(resp *Response) error {
+	resp.Body = bytes.ToUpper(resp.Body)
+	return nil
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	tests := map[string]string{
+		"gzip, deflate, br, zstd":    "gzip, deflate, br",
+		"zstd;q=1.0, GZIP;q=0.5":     "GZIP;q=0.5",
+		"identity":                   "identity",
+		"zstd":                       "",
+		"":                           "",
+		" br ; q=0.9 , compress , *": "br ; q=0.9",
+	}
+	for header, want := range tests {
+		if got := AcceptEncoding(header); got != want {
+			t.Errorf("AcceptEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+	if ContentEncoding("") != "identity" || ContentEncoding(" GZip ") != "gzip" {
+		t.Error("ContentEncoding does not normalize the coding")
+	}
+}
@@ -0,0 +1,102 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/store"
+
+	routev1 "github.com/openshift/api/route/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// proxyServiceName is the Service patched Ingresses and Routes point to (see the admin patch actions and the webhook).
+const proxyServiceName = "smart-proxy"
+
+// checkPatchDrift warns about routes whose Ingress or OpenShift Route was changed back, e.g. by a GitOps tool
+// re-applying the original manifest, so that traffic no longer goes through the proxy.
+// Each drift is reported once, when it is first seen.
+func (w *Watcher) checkPatchDrift() {
+	if w.k8sClient == nil {
+		return
+	}
+
+	ingresses := make(map[string]*networkingv1.Ingress)
+	routes := make(map[string]*routev1.Route)
+	var ingressesListed, routesListed bool
+	for _, route := range w.store.GetAllRoutes() {
+		var detail string
+		if ns, name, ok := store.ParseResourceID("ing-", w.k8sClient.Namespace, route.ID); ok {
+			if !ingressesListed {
+				ingressesListed = true
+				list, err := w.k8sClient.ListIngresses("")
+				if err != nil {
+					continue
+				}
+				for _, ing := range list {
+					ingresses[ing.Namespace+"/"+ing.Name] = ing
+				}
+			}
+			ing, found := ingresses[ns+"/"+name]
+			if !found {
+				continue // Deleted; nothing is bypassing the proxy
+			}
+			detail = ingressDrift(ing)
+		} else if ns, name, ok := store.ParseResourceID("route-", w.k8sClient.Namespace, route.ID); ok {
+			if !routesListed {
+				routesListed = true
+				list, err := w.k8sClient.ListRoutes("")
+				if err != nil {
+					continue // Not OpenShift, or the API is unavailable
+				}
+				for _, rt := range list {
+					routes[rt.Namespace+"/"+rt.Name] = rt
+				}
+			}
+			rt, found := routes[ns+"/"+name]
+			if !found {
+				continue
+			}
+			detail = routeDrift(rt)
+		} else {
+			continue // Created by hand in the admin UI, not from a resource
+		}
+
+		if detail == "" {
+			delete(w.drifted, route.ID)
+			continue
+		}
+		if !w.drifted[route.ID] {
+			w.drifted[route.ID] = true
+			log.WarnContext(logger.WithRouteID(context.TODO(), route.ID), "Patch drift detected", "detail", detail)
+			w.Events.PatchDrift(route, detail)
+		}
+	}
+}
+
+// ingressDrift describes how a patched Ingress no longer matches the patch, or returns "".
+func ingressDrift(ing *networkingv1.Ingress) string {
+	if ing.Annotations["smart-proxy/patched"] != "true" {
+		return fmt.Sprintf("Ingress %s/%s is no longer marked as patched", ing.Namespace, ing.Name)
+	}
+	if len(ing.Spec.Rules) == 0 || ing.Spec.Rules[0].HTTP == nil || len(ing.Spec.Rules[0].HTTP.Paths) == 0 {
+		return fmt.Sprintf("Ingress %s/%s has no rules", ing.Namespace, ing.Name)
+	}
+	backend := ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service
+	if backend == nil || backend.Name != proxyServiceName {
+		return fmt.Sprintf("Ingress %s/%s no longer points to the %s Service", ing.Namespace, ing.Name, proxyServiceName)
+	}
+	return ""
+}
+
+// routeDrift describes how a patched OpenShift Route no longer matches the patch, or returns "".
+func routeDrift(rt *routev1.Route) string {
+	if rt.Annotations["smart-proxy/patched"] != "true" {
+		return fmt.Sprintf("Route %s/%s is no longer marked as patched", rt.Namespace, rt.Name)
+	}
+	if rt.Spec.To.Name != proxyServiceName {
+		return fmt.Sprintf("Route %s/%s no longer points to the %s Service", rt.Namespace, rt.Name, proxyServiceName)
+	}
+	return ""
+}
@@ -1,32 +1,98 @@
 package watcher
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"time"
 
+	"smart-proxy/internal/audit"
+	"smart-proxy/internal/events"
 	"smart-proxy/internal/k8s"
 	"smart-proxy/internal/logger"
+	"smart-proxy/internal/notify"
+	"smart-proxy/internal/savings"
 	"smart-proxy/internal/store"
 )
 
+var log = logger.Component("watcher")
+
 type Watcher struct {
 	k8sClient *k8s.Client
 	store     *store.Store
+	Events    *events.Recorder // Optional
+	Notifier  *notify.Notifier // Optional
+	Savings   *savings.Tracker // Optional
+	Audit     *audit.Log       // Optional
+
+	drifted map[string]bool // Key: Route ID, for routes whose Ingress/Route no longer points to the proxy
 }
 
 func NewWatcher(k8sClient *k8s.Client, store *store.Store) *Watcher {
 	return &Watcher{
 		k8sClient: k8sClient,
 		store:     store,
+		drifted:   make(map[string]bool),
 	}
 }
 
 func (w *Watcher) Start() {
-	logger.Println("Watcher started. Checking for idle services every 30s...")
+	log.Info("Watcher started. Checking for idle services every 30s...")
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
+		w.expireModes()
 		w.checkIdleRoutes()
+		w.checkPatchDrift()
+		w.Savings.Reconcile(w.awake)
+	}
+}
+
+// scaleDown scales a deployment of the route to zero, recording the resources it frees for the savings report.
+func (w *Watcher) scaleDown(ctx context.Context, route store.RouteConfig, target events.Target) error {
+	// Read before scaling, the spec still holds the running replicas
+	deployment, getErr := w.k8sClient.GetDeployment(ctx, target.Namespace, target.Name)
+	if err := w.k8sClient.ScaleDeployment(ctx, target.Namespace, target.Name, 0); err != nil {
+		return err
+	}
+	if getErr == nil {
+		w.Savings.Slept(route, deployment)
+	}
+	return nil
+}
+
+// awake reports whether a deployment has replicas; deployments that cannot be read count as asleep.
+func (w *Watcher) awake(namespace, name string) bool {
+	if w.k8sClient == nil {
+		return false
+	}
+	replicas, _, err := w.k8sClient.GetDeploymentStatus(context.TODO(), namespace, name)
+	return err == nil && replicas > 0
+}
+
+// expireModes puts the routes whose operational state expired back to normal.
+func (w *Watcher) expireModes() {
+	for _, route := range w.store.GetAllRoutes() {
+		if route.Mode == nil || !route.Mode.Expired() {
+			continue
+		}
+		expired, err := w.store.ExpireMode(route.ID)
+		if err != nil {
+			log.Error("Error saving expired route mode", "route_id", route.ID, "error", err)
+		}
+		if expired == nil {
+			continue // Changed meanwhile
+		}
+		log.Info("Route mode expired, back to normal", "route_id", route.ID, "mode", expired.State)
+		w.Audit.Record(audit.Entry{
+			Actor:     audit.SystemActor,
+			Action:    audit.ActionRouteMode,
+			RouteID:   route.ID,
+			Namespace: route.Namespace,
+			Reason:    "expired",
+			Details:   map[string]string{"state": store.ModeNormal, "previous": expired.State},
+		})
 	}
 }
 
@@ -59,34 +125,72 @@ func (w *Watcher) checkIdleRoutes() {
 
 		timeout := route.IdleTimeout
 
+		// Pinned routes stay up, and routes under maintenance are left as they are
+		if mode := route.CurrentMode(); mode == store.ModePinned || mode == store.ModeMaintenance {
+			continue
+		}
+
 		if time.Since(route.LastActivity) > timeout {
+			ctx := logger.WithRouteID(context.TODO(), route.ID)
+
 			// Check current replicas
-			replicas, _, err := w.k8sClient.GetDeploymentStatus(route.Namespace, route.Deployment)
+			replicas, _, err := w.k8sClient.GetDeploymentStatus(ctx, route.Namespace, route.Deployment)
 			if err != nil {
-				logger.Printf("Error getting status for idle check %s/%s: %v", route.Namespace, route.Deployment, err)
+				log.ErrorContext(ctx, "Error getting status for idle check",
+					"namespace", route.Namespace, "deployment", route.Deployment, "error", err)
 				continue
 			}
 
 			if replicas > 0 {
-				logger.Printf("Route %s is idle (Last active: %s). Scaling down deployment %s...",
-					route.Path, route.LastActivity.Format(time.RFC3339), route.Deployment)
-
-				err := w.k8sClient.ScaleDeployment(route.Namespace, route.Deployment, 0)
-				if err != nil {
-					logger.Printf("Error scaling down %s: %v", route.Deployment, err)
-				}
-
-				// Scale down dependencies
-				for _, dep := range route.Dependencies {
-					if dep.StopOnIdle {
-						logger.Printf("Scaling down dependency %s for route %s...", dep.Name, route.Path)
-						err := w.k8sClient.ScaleDeployment(route.Namespace, dep.Name, 0)
-						if err != nil {
-							logger.Printf("Error scaling down dependency %s: %v", dep.Name, err)
-						}
-					}
-				}
+				log.InfoContext(ctx, "Route is idle. Scaling down deployment...",
+					"path", route.Path, "last_active", route.LastActivity.Format(time.RFC3339), "deployment", route.Deployment)
+				idle := time.Since(route.LastActivity).Round(time.Second)
+				w.Sleep(ctx, route, fmt.Sprintf("was idle for %s", idle))
 			}
 		}
 	}
 }
+
+// Sleep scales the deployment of a route and its stop-on-idle dependencies to zero, and reports it in events
+// and notifications. Cause completes "Route <id> ...", e.g. "was idle for 30m0s". It returns the deployments
+// scaled down; failures are logged and reported.
+func (w *Watcher) Sleep(ctx context.Context, route store.RouteConfig, cause string) []events.Target {
+	var scaled []events.Target
+	main := events.Target{Namespace: route.Namespace, Name: route.Deployment}
+	err := w.scaleDown(ctx, route, main)
+	if err != nil {
+		log.ErrorContext(ctx, "Error scaling down deployment", "deployment", route.Deployment, "error", err)
+		w.Events.ScaleFailed(route, main, 0, err)
+	} else {
+		scaled = append(scaled, main)
+	}
+
+	// Scale down dependencies
+	for _, dep := range route.Dependencies {
+		if dep.StopOnIdle {
+			log.InfoContext(ctx, "Scaling down dependency...", "dependency", dep.Name, "path", route.Path)
+			depNs, depName := dep.Target(route.Namespace)
+			target := events.Target{Namespace: depNs, Name: depName}
+			err := w.scaleDown(ctx, route, target)
+			if err != nil {
+				log.ErrorContext(ctx, "Error scaling down dependency", "dependency", dep.Name, "error", err)
+				w.Events.ScaleFailed(route, target, 0, err)
+			} else {
+				scaled = append(scaled, target)
+			}
+		}
+	}
+
+	if len(scaled) > 0 {
+		w.Events.Sleeping(route, cause, scaled)
+		w.Notifier.Notify(route, notify.EventSleep, fmt.Sprintf("%s, scaled %d deployment(s) to 0 replicas", capitalize(cause), len(scaled)))
+	}
+	return scaled
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
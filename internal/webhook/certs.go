@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// certLoader serves the webhook certificate and reloads it when the files change,
+// so rotations by cert-manager or the OpenShift service CA do not need a restart.
+type certLoader struct {
+	mu       sync.Mutex
+	certFile string
+	keyFile  string
+	modTime  time.Time
+	cert     *tls.Certificate
+}
+
+func newCertLoader(dir string) (*certLoader, error) {
+	l := &certLoader{
+		certFile: filepath.Join(dir, "tls.crt"),
+		keyFile:  filepath.Join(dir, "tls.key"),
+	}
+
+	if _, err := os.Stat(l.certFile); os.IsNotExist(err) {
+		log.Warn("No certificate found, generating a self-signed one (not for production)", "dir", dir)
+		if err := writeSelfSigned(dir, l.certFile, l.keyFile); err != nil {
+			return nil, fmt.Errorf("generating self-signed certificate: %w", err)
+		}
+	}
+
+	if _, err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// TLSConfig returns a tls.Config that always serves the latest certificate on disk.
+func (l *certLoader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return l.load()
+		},
+	}
+}
+
+// load returns the cached certificate, re-reading it if the certificate file changed.
+func (l *certLoader) load() (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info, err := os.Stat(l.certFile)
+	if err != nil {
+		if l.cert != nil {
+			return l.cert, nil // Keep serving the last good certificate during a rotation
+		}
+		return nil, err
+	}
+	if l.cert != nil && info.ModTime().Equal(l.modTime) {
+		return l.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		if l.cert != nil {
+			log.Error("Failed to reload certificate, keeping previous one", "error", err)
+			return l.cert, nil
+		}
+		return nil, err
+	}
+
+	if l.cert != nil {
+		log.Info("Reloaded serving certificate")
+	}
+	l.cert = &cert
+	l.modTime = info.ModTime()
+	return l.cert, nil
+}
+
+// writeSelfSigned generates a self-signed certificate valid for the in-cluster
+// service names of the proxy and writes it to certFile/keyFile.
+func writeSelfSigned(dir, certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		namespace = "default"
+	}
+	svc := ProxyServiceName + "-webhook"
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: svc + "." + namespace + ".svc"},
+		DNSNames: []string{
+			svc,
+			svc + "." + namespace,
+			svc + "." + namespace + ".svc",
+			"localhost",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
@@ -0,0 +1,421 @@
+// Package webhook implements an optional mutating admission webhook for the Smart Proxy.
+// Opted-in Ingresses and OpenShift Routes are rewritten to point at the proxy at admission
+// time, so there is no window where traffic bypasses it and GitOps tools see a stable object.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-proxy/internal/k8s"
+	"smart-proxy/internal/logger"
+	"smart-proxy/internal/notify"
+	"smart-proxy/internal/store"
+
+	routev1 "github.com/openshift/api/route/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var log = logger.Component("webhook")
+
+// OptInKey is the label (or annotation) that opts an Ingress/Route into admission-time patching.
+const OptInKey = "smart-proxy/enabled"
+
+// ProxyServiceName is the Service the patched backends are rewritten to.
+const ProxyServiceName = "smart-proxy"
+
+// Server is the HTTPS server answering AdmissionReview requests from the API server.
+type Server struct {
+	store          *store.Store
+	Namespace      string // The proxy's own namespace, used to build route IDs (see store.ResourceID)
+	ProxyPort      int
+	DryRun         bool             // If true, patches are computed and logged but never returned
+	CertDir        string           // Directory containing tls.crt and tls.key
+	MinIdleTimeout time.Duration    // Shortest idle timeout of the routes, as in the admin API
+	K8sClient      *k8s.Client      // Optional: without it, objects are patched in any namespace
+	Notifier       *notify.Notifier // Optional
+}
+
+// NewServer creates a new webhook Server.
+// It reads SMART_PROXY_PORT (default: 80), WEBHOOK_DRY_RUN, WEBHOOK_CERT_DIR
+// (default: /tmp/k8s-webhook-server/serving-certs) and MIN_IDLE_TIMEOUT from the environment.
+func NewServer(configStore *store.Store, namespace string) *Server {
+	port := 80
+	if p, err := strconv.Atoi(os.Getenv("SMART_PROXY_PORT")); err == nil {
+		port = p
+	}
+	minIdleTimeout := store.DefaultMinIdleTimeout
+	if d, err := time.ParseDuration(os.Getenv("MIN_IDLE_TIMEOUT")); err == nil && d >= 0 {
+		minIdleTimeout = d
+	}
+
+	certDir := os.Getenv("WEBHOOK_CERT_DIR")
+	if certDir == "" {
+		certDir = "/tmp/k8s-webhook-server/serving-certs"
+	}
+
+	return &Server{
+		store:          configStore,
+		Namespace:      namespace,
+		ProxyPort:      port,
+		DryRun:         os.Getenv("WEBHOOK_DRY_RUN") == "true",
+		CertDir:        certDir,
+		MinIdleTimeout: minIdleTimeout,
+	}
+}
+
+// Handler returns the HTTP handler serving the webhook endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mutate", s.handleMutate)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// ListenAndServeTLS starts the webhook server on the specified address.
+// Certificates are loaded from CertDir and reloaded when they change on disk;
+// if none are present a self-signed pair is generated for local development.
+func (s *Server) ListenAndServeTLS(addr string) error {
+	certs, err := newCertLoader(s.CertDir)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   s.Handler(),
+		TLSConfig: certs.TLSConfig(),
+	}
+	return srv.ListenAndServeTLS("", "")
+}
+
+func (s *Server) handleMutate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "Invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	response := s.mutate(review.Request)
+	response.UID = review.Request.UID
+
+	review.Response = response
+	review.Request = nil
+	review.APIVersion = "admission.k8s.io/v1"
+	review.Kind = "AdmissionReview"
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// mutate computes the admission response for a single request.
+// Errors never reject the object: the webhook allows it, with or without a patch. Only opted-in objects
+// without a name (generateName) are rejected, as their route could not be stored.
+func (s *Server) mutate(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	allowed := &admissionv1.AdmissionResponse{Allowed: true}
+
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return allowed
+	}
+
+	var (
+		ops    []patchOperation
+		config *store.RouteConfig
+		err    error
+	)
+	name := req.Name // Empty on CREATE when the object uses generateName
+
+	switch req.Kind.Kind {
+	case "Ingress":
+		var ing networkingv1.Ingress
+		if err = json.Unmarshal(req.Object.Raw, &ing); err == nil {
+			if ing.Namespace == "" {
+				ing.Namespace = req.Namespace
+			}
+			name = ing.Name
+			ops, config, err = s.patchIngress(&ing)
+		}
+	case "Route":
+		var route routev1.Route
+		if err = json.Unmarshal(req.Object.Raw, &route); err == nil {
+			if route.Namespace == "" {
+				route.Namespace = req.Namespace
+			}
+			name = route.Name
+			ops, config, err = s.patchRoute(&route)
+		}
+	default:
+		return allowed
+	}
+
+	if err != nil {
+		log.Warn("Skipping object", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", name, "error", err)
+		allowed.Warnings = []string{"smart-proxy: " + err.Error()}
+		return allowed
+	}
+	if len(ops) == 0 {
+		return allowed
+	}
+	// The route ID derives from the name, which the API server only assigns once the object is persisted
+	if name == "" {
+		return &admissionv1.AdmissionResponse{Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusUnprocessableEntity,
+			Reason:  metav1.StatusReasonInvalid,
+			Message: "smart-proxy: objects opted in with " + OptInKey + " need a name; generateName is not supported",
+		}}
+	}
+	if err := s.checkRoute(config); err != nil {
+		log.Warn("Not patching object", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", name, "error", err)
+		allowed.Warnings = []string{"smart-proxy: not patched: " + err.Error()}
+		return allowed
+	}
+
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		log.Error("Failed to encode patch", "error", err)
+		return allowed
+	}
+
+	if s.DryRun {
+		log.Info("Dry-run: would patch object", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", name, "patch", string(patch))
+		allowed.Warnings = []string{"smart-proxy webhook is in dry-run mode; object was not patched"}
+		return allowed
+	}
+
+	// The store is our only side effect, so skip it for server-side dry-run requests. Conflicts are checked
+	// again under the store lock; the mode of a route patched again is kept.
+	if req.DryRun == nil || !*req.DryRun {
+		err := s.store.AddRouteIf(config, s.store.NoConflicts(config, func(current *store.RouteConfig) error {
+			if current != nil {
+				config.Mode = current.Mode
+			}
+			return nil
+		}))
+		if err != nil {
+			log.Warn("Failed to add route to store", "route_id", config.ID, "error", err)
+			allowed.Warnings = []string{"smart-proxy: not patched: " + err.Error()}
+			return allowed
+		}
+		s.Notifier.Notify(*config, notify.EventPatched, fmt.Sprintf("%s %s/%s was patched on admission to point to the proxy", req.Kind.Kind, req.Namespace, name))
+	}
+
+	log.Info("Patched object to point to the proxy", "kind", req.Kind.Kind, "namespace", req.Namespace, "name", name, "service", ProxyServiceName)
+	patchType := admissionv1.PatchTypeJSONPatch
+	allowed.Patch = patch
+	allowed.PatchType = &patchType
+	return allowed
+}
+
+// patchOperation is a single RFC 6902 JSON Patch operation.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// checkRoute returns why the route of an object may not be stored, as the admin API would refuse it: its
+// namespace is not watched, it is invalid, or another route serves its host and path. nil if it may.
+func (s *Server) checkRoute(config *store.RouteConfig) error {
+	if s.K8sClient != nil && !s.K8sClient.Watches(config.Namespace) {
+		return fmt.Errorf("namespace %s is not watched", config.Namespace)
+	}
+	if err := config.Validate(s.MinIdleTimeout).Err(); err != nil {
+		return err
+	}
+	if conflicts := store.Conflicts(*config, s.store.GetAllRoutes()); len(conflicts) > 0 {
+		return &store.ConflictError{Route: *config, Routes: conflicts}
+	}
+	return nil
+}
+
+// optedIn reports whether the object carries the opt-in label or annotation.
+func optedIn(meta metav1.ObjectMeta) bool {
+	return meta.Labels[OptInKey] == "true" || meta.Annotations[OptInKey] == "true"
+}
+
+// patchIngress returns the operations rewriting the first rule/path backend of an Ingress,
+// matching what the admin "Patch" action does after creation. Backends already pointing to the proxy are
+// left alone; others are patched even if annotated as patched, e.g. when a GitOps tool restored them.
+func (s *Server) patchIngress(ing *networkingv1.Ingress) ([]patchOperation, *store.RouteConfig, error) {
+	if !optedIn(ing.ObjectMeta) {
+		return nil, nil, nil
+	}
+	if len(ing.Spec.Rules) == 0 || ing.Spec.Rules[0].HTTP == nil || len(ing.Spec.Rules[0].HTTP.Paths) == 0 {
+		return nil, nil, fmt.Errorf("ingress has no rules")
+	}
+	rule := ing.Spec.Rules[0]
+	path := rule.HTTP.Paths[0]
+	if path.Backend.Service == nil {
+		return nil, nil, fmt.Errorf("ingress backend is not a service")
+	}
+
+	originalSvc := path.Backend.Service.Name
+	originalPort := int(path.Backend.Service.Port.Number)
+	if name := path.Backend.Service.Port.Name; originalPort == 0 && name != "" {
+		port, err := s.resolvePort(ing.Namespace, originalSvc, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		originalPort = port
+	}
+	if originalPort == 0 {
+		originalPort = 80
+	}
+	if originalSvc == ProxyServiceName && originalPort == s.ProxyPort {
+		return nil, nil, nil
+	}
+
+	config := s.newRouteConfig(ing.Name, "ing-", rule.Host, path.Path, ing.Namespace, originalSvc, originalPort)
+	ops, err := annotationOps(ing.Annotations, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backend := "/spec/rules/0/http/paths/0/backend/service"
+	ops = append(ops,
+		patchOperation{Op: "replace", Path: backend + "/name", Value: ProxyServiceName},
+		patchOperation{Op: "replace", Path: backend + "/port", Value: networkingv1.ServiceBackendPort{Number: int32(s.ProxyPort)}},
+	)
+	return ops, config, nil
+}
+
+// patchRoute returns the operations rewriting an OpenShift Route to target the proxy, unless it already
+// does (see patchIngress).
+func (s *Server) patchRoute(route *routev1.Route) ([]patchOperation, *store.RouteConfig, error) {
+	if !optedIn(route.ObjectMeta) {
+		return nil, nil, nil
+	}
+	if route.Spec.To.Name == "" {
+		return nil, nil, fmt.Errorf("route has no target service")
+	}
+
+	originalSvc := route.Spec.To.Name
+	originalPort := 80 // Same assumption as the admin patch: backend service listens on 80
+	if route.Spec.Port != nil {
+		switch target := route.Spec.Port.TargetPort; {
+		case target.Type == intstr.String && target.StrVal != "":
+			port, err := s.resolvePort(route.Namespace, originalSvc, target.StrVal)
+			if err != nil {
+				return nil, nil, err
+			}
+			originalPort = port
+		case target.IntValue() != 0:
+			originalPort = target.IntValue()
+		}
+	}
+	if originalSvc == ProxyServiceName && originalPort == s.ProxyPort {
+		return nil, nil, nil
+	}
+
+	config := s.newRouteConfig(route.Name, "route-", route.Spec.Host, route.Spec.Path, route.Namespace, originalSvc, originalPort)
+	ops, err := annotationOps(route.Annotations, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ops = append(ops,
+		patchOperation{Op: "replace", Path: "/spec/to/name", Value: ProxyServiceName},
+		patchOperation{Op: "add", Path: "/spec/port", Value: map[string]interface{}{"targetPort": s.ProxyPort}},
+	)
+	return ops, config, nil
+}
+
+// resolvePort returns the number of a named port of a Service: the port with that name, or the one whose
+// target port has it. The proxy connects to Service ports, so objects whose port cannot be resolved are not
+// patched.
+func (s *Server) resolvePort(namespace, service, name string) (int, error) {
+	if s.K8sClient == nil {
+		return 0, fmt.Errorf("named port %q of service %s cannot be resolved without a cluster", name, service)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	svc, err := s.K8sClient.GetService(ctx, namespace, service)
+	if err != nil {
+		return 0, fmt.Errorf("resolving named port %q of service %s: %w", name, service, err)
+	}
+	for _, p := range svc.Spec.Ports {
+		if p.Name == name || (p.TargetPort.Type == intstr.String && p.TargetPort.StrVal == name) {
+			return int(p.Port), nil
+		}
+	}
+	return 0, fmt.Errorf("service %s has no port named %q", service, name)
+}
+
+// newRouteConfig builds the store entry for a patched object. The ID is left empty when the name is not
+// yet known (generateName): such objects are rejected. Objects without a path serve all paths.
+func (s *Server) newRouteConfig(name, idPrefix, host, path, namespace, service string, port int) *store.RouteConfig {
+	id := ""
+	if name != "" {
+		id = store.ResourceID(idPrefix, s.Namespace, namespace, name)
+	}
+	if path == "" {
+		path = "/"
+	}
+	return &store.RouteConfig{
+		ID:            id,
+		Host:          host,
+		Path:          path,
+		TargetService: service,
+		TargetPort:    port,
+		Namespace:     namespace,
+		Deployment:    service, // Assumption: Deployment Name == Service Name
+		Dependencies:  []store.DependencyConfig{},
+		IdleTimeout:   30 * time.Minute,
+		LastActivity:  time.Now(),
+	}
+}
+
+// annotationOps returns the operations adding the smart-proxy/* state annotations.
+func annotationOps(existing map[string]string, config *store.RouteConfig) ([]patchOperation, error) {
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := map[string]string{
+		"smart-proxy/patched":          "true",
+		"smart-proxy/original-service": config.TargetService,
+		"smart-proxy/original-port":    strconv.Itoa(config.TargetPort),
+		"smart-proxy/config":           string(configBytes),
+	}
+
+	// JSON Patch cannot add a key to a missing map, so create the whole map in that case.
+	if existing == nil {
+		return []patchOperation{{Op: "add", Path: "/metadata/annotations", Value: annotations}}, nil
+	}
+
+	var ops []patchOperation
+	for key, value := range annotations {
+		ops = append(ops, patchOperation{Op: "add", Path: "/metadata/annotations/" + escapeJSONPointer(key), Value: value})
+	}
+	return ops, nil
+}
+
+// escapeJSONPointer escapes a map key for use in a JSON Pointer (RFC 6901).
+func escapeJSONPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
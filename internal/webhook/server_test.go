@@ -0,0 +1,395 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-proxy/internal/k8s"
+	"smart-proxy/internal/store"
+
+	routev1 "github.com/openshift/api/route/v1"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const proxyNamespace = "smart-proxy"
+
+// apiServer stands in for the local API server of envtest: it sends objects to the webhook over HTTPS as
+// the admission chain does, and applies the JSON patch it returns.
+type apiServer struct {
+	t      *testing.T
+	client *http.Client
+	url    string
+}
+
+func newAPIServer(t *testing.T, s *Server) *apiServer {
+	ts := httptest.NewTLSServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return &apiServer{t: t, client: ts.Client(), url: ts.URL + "/mutate"}
+}
+
+// admit sends obj through the webhook and decodes the object as admitted into out, which may be nil.
+func (a *apiServer) admit(op admissionv1.Operation, kind string, obj metav1.Object, dryRun bool, out interface{}) *admissionv1.AdmissionResponse {
+	a.t.Helper()
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("uid-" + obj.GetName()),
+			Kind:      metav1.GroupVersionKind{Kind: kind},
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			Operation: op,
+			Object:    runtime.RawExtension{Raw: raw},
+			DryRun:    &dryRun,
+		},
+	}
+	body, _ := json.Marshal(review)
+	resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		a.t.Fatalf("webhook answered %d", resp.StatusCode)
+	}
+	var answer admissionv1.AdmissionReview
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		a.t.Fatal(err)
+	}
+	if answer.Response == nil || answer.Response.UID != review.Request.UID {
+		a.t.Fatalf("response does not answer the request: %+v", answer.Response)
+	}
+	if out != nil {
+		if answer.Response.Patch != nil {
+			raw = applyPatch(a.t, raw, answer.Response.Patch)
+		}
+		if err := json.Unmarshal(raw, out); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	return answer.Response
+}
+
+// applyPatch applies the add and replace operations of a JSON patch, the ones the webhook uses.
+func applyPatch(t *testing.T, doc, patch []byte) []byte {
+	t.Helper()
+	var root interface{}
+	var ops []patchOperation
+	if err := json.Unmarshal(doc, &root); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range ops {
+		keys := strings.Split(strings.TrimPrefix(op.Path, "/"), "/")
+		for i, key := range keys {
+			keys[i] = strings.ReplaceAll(strings.ReplaceAll(key, "~1", "/"), "~0", "~")
+		}
+		parent := root
+		for _, key := range keys[:len(keys)-1] {
+			switch node := parent.(type) {
+			case map[string]interface{}:
+				parent = node[key]
+			case []interface{}:
+				i, _ := strconv.Atoi(key)
+				parent = node[i]
+			}
+		}
+		last := keys[len(keys)-1]
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, exists := node[last]; op.Op == "replace" && !exists {
+				t.Fatalf("replace of missing %s", op.Path)
+			}
+			node[last] = op.Value
+		default:
+			t.Fatalf("unsupported patch path %s", op.Path)
+		}
+	}
+	out, _ := json.Marshal(root)
+	return out
+}
+
+func newTestServer(t *testing.T) (*Server, *store.Store) {
+	s := store.NewStore(filepath.Join(t.TempDir(), "routes.json"))
+	server := NewServer(s, proxyNamespace)
+	server.ProxyPort = 8080
+	return server, s
+}
+
+func newIngress(name, service string, port int32) *networkingv1.Ingress {
+	prefix := networkingv1.PathTypePrefix
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", Labels: map[string]string{OptInKey: "true"}},
+		Spec: networkingv1.IngressSpec{Rules: []networkingv1.IngressRule{{
+			Host: "shop.example.com",
+			IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+				Paths: []networkingv1.HTTPIngressPath{{
+					Path:     "/",
+					PathType: &prefix,
+					Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+						Name: service,
+						Port: networkingv1.ServiceBackendPort{Number: port},
+					}},
+				}},
+			}},
+		}}},
+	}
+}
+
+func backendOf(ing *networkingv1.Ingress) (string, int32) {
+	service := ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service
+	return service.Name, service.Port.Number
+}
+
+func TestIngressIsPatchedUntilItPointsToTheProxy(t *testing.T) {
+	server, s := newTestServer(t)
+	api := newAPIServer(t, server)
+	id := store.ResourceID("ing-", proxyNamespace, "shop", "web")
+
+	var created networkingv1.Ingress
+	if resp := api.admit(admissionv1.Create, "Ingress", newIngress("web", "web", 8000), false, &created); !resp.Allowed {
+		t.Fatalf("create denied: %+v", resp.Result)
+	}
+	if name, port := backendOf(&created); name != ProxyServiceName || port != 8080 {
+		t.Errorf("backend %s:%d, want %s:8080", name, port, ProxyServiceName)
+	}
+	if created.Annotations["smart-proxy/original-service"] != "web" || created.Annotations["smart-proxy/original-port"] != "8000" {
+		t.Errorf("original annotations %v", created.Annotations)
+	}
+	route, ok := s.GetRoute(id)
+	if !ok || route.TargetService != "web" || route.TargetPort != 8000 {
+		t.Fatalf("stored route %+v, %v", route, ok)
+	}
+	s.SetMode(id, &store.RouteMode{State: store.ModeMaintenance})
+
+	// Unrelated updates of the patched object are left alone
+	if resp := api.admit(admissionv1.Update, "Ingress", &created, false, nil); resp.Patch != nil {
+		t.Errorf("patched object patched again: %s", resp.Patch)
+	}
+
+	// A GitOps tool re-applies the original backend and keeps the annotations
+	restored := created.DeepCopy()
+	restored.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name = "web"
+	restored.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port.Number = 8001
+	var repatched networkingv1.Ingress
+	api.admit(admissionv1.Update, "Ingress", restored, false, &repatched)
+	if name, _ := backendOf(&repatched); name != ProxyServiceName {
+		t.Errorf("restored backend not patched: %s", name)
+	}
+	route, _ = s.GetRoute(id)
+	if route.TargetPort != 8001 || route.CurrentMode() != store.ModeMaintenance {
+		t.Errorf("route after restore: port %d, mode %s", route.TargetPort, route.CurrentMode())
+	}
+}
+
+func TestOpenShiftRouteIsPatched(t *testing.T) {
+	server, s := newTestServer(t)
+	api := newAPIServer(t, server)
+
+	rt := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Annotations: map[string]string{OptInKey: "true"}},
+		Spec:       routev1.RouteSpec{Host: "shop.example.com", To: routev1.RouteTargetReference{Kind: "Service", Name: "web"}},
+	}
+	var patched routev1.Route
+	api.admit(admissionv1.Create, "Route", rt, false, &patched)
+	if patched.Spec.To.Name != ProxyServiceName || patched.Spec.Port == nil || patched.Spec.Port.TargetPort.IntValue() != 8080 {
+		t.Errorf("route target %s %+v", patched.Spec.To.Name, patched.Spec.Port)
+	}
+	route, ok := s.GetRoute(store.ResourceID("route-", proxyNamespace, "shop", "web"))
+	if !ok || route.Path != "/" || route.TargetPort != 80 {
+		t.Errorf("stored route %+v, %v", route, ok)
+	}
+
+	if resp := api.admit(admissionv1.Update, "Route", &patched, false, nil); resp.Patch != nil {
+		t.Errorf("patched route patched again: %s", resp.Patch)
+	}
+}
+
+func TestGenerateNameIsRejected(t *testing.T) {
+	server, s := newTestServer(t)
+	api := newAPIServer(t, server)
+
+	ing := newIngress("", "web", 8000)
+	ing.GenerateName = "web-"
+	resp := api.admit(admissionv1.Create, "Ingress", ing, false, nil)
+	if resp.Allowed || resp.Result == nil || resp.Result.Code != http.StatusUnprocessableEntity {
+		t.Errorf("generateName admitted: %+v", resp)
+	}
+	if routes := s.GetAllRoutes(); len(routes) != 0 {
+		t.Errorf("routes stored: %+v", routes)
+	}
+}
+
+func TestObjectsNotPatched(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(server *Server, s *store.Store)
+	}{
+		{"namespace not watched", func(server *Server, s *store.Store) {
+			server.K8sClient = &k8s.Client{Namespace: proxyNamespace, Scope: k8s.NamespaceScope{Mode: k8s.ModeList, Namespaces: []string{"other"}}}
+		}},
+		{"invalid route", func(server *Server, s *store.Store) {
+			server.MinIdleTimeout = time.Hour
+		}},
+		{"host and path conflict", func(server *Server, s *store.Store) {
+			s.AddRoute(&store.RouteConfig{ID: "shop", Host: "shop.example.com", Path: "/", Namespace: "shop", Deployment: "shop", TargetService: "shop", TargetPort: 80})
+		}},
+		{"webhook dry run", func(server *Server, s *store.Store) {
+			server.DryRun = true
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, s := newTestServer(t)
+			tt.setup(server, s)
+			api := newAPIServer(t, server)
+
+			var admitted networkingv1.Ingress
+			resp := api.admit(admissionv1.Create, "Ingress", newIngress("web", "web", 8000), false, &admitted)
+			if !resp.Allowed || len(resp.Warnings) == 0 {
+				t.Errorf("want allowed with a warning: %+v", resp)
+			}
+			if name, _ := backendOf(&admitted); name != "web" {
+				t.Errorf("backend patched to %s", name)
+			}
+			if _, ok := s.GetRoute(store.ResourceID("ing-", proxyNamespace, "shop", "web")); ok {
+				t.Errorf("route stored")
+			}
+		})
+	}
+}
+
+// serviceAPI serves the Services of the shop namespace, as the API server would.
+func serviceAPI(t *testing.T, services ...corev1.Service) *k8s.Client {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, svc := range services {
+			if r.URL.Path == "/api/v1/namespaces/shop/services/"+svc.Name {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(svc)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonNotFound, Code: http.StatusNotFound})
+	}))
+	t.Cleanup(ts.Close)
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &k8s.Client{Clientset: clientset, Namespace: proxyNamespace, Scope: k8s.NamespaceScope{Mode: k8s.ModeAll}}
+}
+
+func TestNamedPortsAreResolved(t *testing.T) {
+	web := corev1.Service{
+		TypeMeta:   metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			{Name: "metrics", Port: 9090},
+			{Name: "http", Port: 8000, TargetPort: intstr.FromString("web-http")},
+		}},
+	}
+	namedIngress := func(port string) *networkingv1.Ingress {
+		ing := newIngress("web", "web", 0)
+		ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Port = networkingv1.ServiceBackendPort{Name: port}
+		return ing
+	}
+	namedRoute := func(port string) *routev1.Route {
+		return &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", Labels: map[string]string{OptInKey: "true"}},
+			Spec: routev1.RouteSpec{
+				Host: "shop.example.com",
+				To:   routev1.RouteTargetReference{Kind: "Service", Name: "web"},
+				Port: &routev1.RoutePort{TargetPort: intstr.FromString(port)},
+			},
+		}
+	}
+
+	t.Run("ingress", func(t *testing.T) {
+		server, s := newTestServer(t)
+		server.K8sClient = serviceAPI(t, web)
+		var patched networkingv1.Ingress
+		api := newAPIServer(t, server)
+		api.admit(admissionv1.Create, "Ingress", namedIngress("http"), false, &patched)
+		if name, port := backendOf(&patched); name != ProxyServiceName || port != 8080 {
+			t.Errorf("backend %s:%d", name, port)
+		}
+		if route, _ := s.GetRoute(store.ResourceID("ing-", proxyNamespace, "shop", "web")); route.TargetPort != 8000 {
+			t.Errorf("stored port %d, want 8000", route.TargetPort)
+		}
+	})
+	t.Run("route", func(t *testing.T) {
+		server, s := newTestServer(t)
+		server.K8sClient = serviceAPI(t, web)
+		api := newAPIServer(t, server)
+		var patched routev1.Route
+		api.admit(admissionv1.Create, "Route", namedRoute("web-http"), false, &patched)
+		if patched.Spec.To.Name != ProxyServiceName {
+			t.Errorf("route target %s", patched.Spec.To.Name)
+		}
+		if route, _ := s.GetRoute(store.ResourceID("route-", proxyNamespace, "shop", "web")); route.TargetPort != 8000 {
+			t.Errorf("stored port %d, want 8000", route.TargetPort)
+		}
+	})
+
+	unresolved := []struct {
+		name   string
+		client *k8s.Client
+		obj    metav1.Object
+		kind   string
+	}{
+		{"ingress port not in the service", serviceAPI(t, web), namedIngress("https"), "Ingress"},
+		{"ingress service not found", serviceAPI(t), namedIngress("http"), "Ingress"},
+		{"ingress without a cluster", nil, namedIngress("http"), "Ingress"},
+		{"route port not in the service", serviceAPI(t, web), namedRoute("https"), "Route"},
+		{"route without a cluster", nil, namedRoute("web-http"), "Route"},
+	}
+	for _, tt := range unresolved {
+		t.Run(tt.name, func(t *testing.T) {
+			server, s := newTestServer(t)
+			server.K8sClient = tt.client
+			resp := newAPIServer(t, server).admit(admissionv1.Create, tt.kind, tt.obj, false, nil)
+			if !resp.Allowed || resp.Patch != nil || len(resp.Warnings) == 0 {
+				t.Errorf("want allowed unpatched with a warning: %+v", resp)
+			}
+			if routes := s.GetAllRoutes(); len(routes) != 0 {
+				t.Errorf("routes stored: %+v", routes)
+			}
+		})
+	}
+}
+
+func TestServerSideDryRunDoesNotStoreRoute(t *testing.T) {
+	server, s := newTestServer(t)
+	api := newAPIServer(t, server)
+
+	var admitted networkingv1.Ingress
+	api.admit(admissionv1.Create, "Ingress", newIngress("web", "web", 8000), true, &admitted)
+	if name, _ := backendOf(&admitted); name != ProxyServiceName {
+		t.Errorf("dry-run object not patched: %s", name)
+	}
+	if routes := s.GetAllRoutes(); len(routes) != 0 {
+		t.Errorf("routes stored on dry run: %+v", routes)
+	}
+}
@@ -0,0 +1,162 @@
+#!/bin/bash
+
+# Generates the RBAC manifests for a given namespace mode.
+#
+# Usage:
+#   ./scripts/generate-rbac.sh single   <install-namespace>
+#   ./scripts/generate-rbac.sh list     <install-namespace> <ns1,ns2,...>
+#   ./scripts/generate-rbac.sh selector <install-namespace>
+#   ./scripts/generate-rbac.sh all      <install-namespace>
+#
+# "single" and "list" produce a Role/RoleBinding per namespace.
+# "selector" and "all" need to watch namespaces, so they produce a ClusterRole/ClusterRoleBinding.
+#
+# Set AUTH_KUBERNETES=true to also allow TokenReview/SubjectAccessReview (AUTH_MODE=kubernetes).
+#
+# Example:
+#   ./scripts/generate-rbac.sh list smart-proxy team-a,team-b | kubectl apply -f -
+
+MODE=$1
+INSTALL_NS=$2
+NAMESPACES=$3
+SA_NAME="smart-proxy-sa"
+
+if [ -z "$MODE" ] || [ -z "$INSTALL_NS" ]; then
+    sed -n '3,15p' "$0" | sed 's/^# \{0,1\}//'
+    exit 1
+fi
+
+rules() {
+    cat <<RULES
+rules:
+  - apiGroups: ["apps"]
+    resources: ["deployments", "deployments/scale"]
+    verbs: ["get", "list", "watch", "update", "patch"]
+  - apiGroups: [""]
+    resources: ["services", "pods"]
+    verbs: ["get", "list", "watch"]
+  - apiGroups: [""]
+    resources: ["secrets"]
+    verbs: ["get"]
+  - apiGroups: [""]
+    resources: ["events"]
+    verbs: ["create", "patch"]
+  - apiGroups: ["networking.k8s.io"]
+    resources: ["ingresses"]
+    verbs: ["get", "list", "watch", "update", "patch"]
+  - apiGroups: ["route.openshift.io"]
+    resources: ["routes"]
+    verbs: ["get", "list", "watch", "update", "patch"]
+RULES
+}
+
+service_account() {
+    cat <<SA
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: $SA_NAME
+  namespace: $INSTALL_NS
+SA
+}
+
+namespaced() {
+    local ns=$1
+    cat <<ROLE
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: smart-proxy-role
+  namespace: $ns
+$(rules)
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: smart-proxy-binding
+  namespace: $ns
+subjects:
+  - kind: ServiceAccount
+    name: $SA_NAME
+    namespace: $INSTALL_NS
+roleRef:
+  kind: Role
+  name: smart-proxy-role
+  apiGroup: rbac.authorization.k8s.io
+ROLE
+}
+
+cluster() {
+    cat <<ROLE
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: smart-proxy-role
+$(rules)
+  - apiGroups: [""]
+    resources: ["namespaces"]
+    verbs: ["get", "list", "watch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: smart-proxy-binding
+subjects:
+  - kind: ServiceAccount
+    name: $SA_NAME
+    namespace: $INSTALL_NS
+roleRef:
+  kind: ClusterRole
+  name: smart-proxy-role
+  apiGroup: rbac.authorization.k8s.io
+ROLE
+}
+
+auth_delegator() {
+    cat <<ROLE
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: smart-proxy-auth-delegator
+subjects:
+  - kind: ServiceAccount
+    name: $SA_NAME
+    namespace: $INSTALL_NS
+roleRef:
+  kind: ClusterRole
+  name: system:auth-delegator
+  apiGroup: rbac.authorization.k8s.io
+ROLE
+}
+
+case $MODE in
+    single)
+        service_account
+        namespaced "$INSTALL_NS"
+        ;;
+    list)
+        if [ -z "$NAMESPACES" ]; then
+            echo "❌ The list mode requires a comma-separated list of namespaces." >&2
+            exit 1
+        fi
+        service_account
+        for ns in ${NAMESPACES//,/ }; do
+            namespaced "$ns"
+        done
+        ;;
+    selector|all)
+        service_account
+        cluster
+        ;;
+    *)
+        echo "❌ Unknown mode: $MODE (expected single, list, selector or all)" >&2
+        exit 1
+        ;;
+esac
+
+if [ "$AUTH_KUBERNETES" = "true" ]; then
+    auth_delegator
+fi
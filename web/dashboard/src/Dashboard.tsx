@@ -1,6 +1,7 @@
 import { useState, useEffect } from "react";
 import { usePolling } from "@/hooks/usePolling";
-import type { RouteConfig, RouteStatus, StatsData } from "@/types/api";
+import type { Problem, RouteConfig, RouteStatus, StatsData, StreamEvent } from "@/types/api";
+import { RouteSaveError } from "@/types/api";
 import { RouteTable } from "@/components/views/RouteTable";
 import { LogsView } from "@/components/views/LogsView";
 import { PatchingView } from "@/components/views/PatchingView";
@@ -20,8 +21,24 @@ export function Dashboard() {
     const [editingRoute, setEditingRoute] = useState<RouteConfig | null>(null);
     const [selectedRouteId, setSelectedRouteId] = useState<string | null>(null);
 
-    const { data: routes, refetch } = usePolling<RouteStatus[]>("/api/routes", 2000);
-    const { data: stats } = usePolling<StatsData>("/api/stats", 2000);
+    // Routes are reloaded when /api/events reports a change; the slow poll only catches what the stream can't see
+    const { data: routes, refetch } = usePolling<RouteStatus[]>("/api/routes", 30000);
+    const { data: polledStats } = usePolling<StatsData>("/api/stats", 60000);
+    const [streamedStats, setStreamedStats] = useState<StatsData | null>(null);
+    const stats = streamedStats || polledStats;
+
+    useEffect(() => {
+        const es = new EventSource("/api/events");
+        const reload = () => refetch();
+        for (const type of ["route.created", "route.updated", "route.deleted", "route.state", "reset"]) {
+            es.addEventListener(type, reload);
+        }
+        es.addEventListener("metrics", (e) => {
+            const event: StreamEvent<StatsData> = JSON.parse((e as MessageEvent).data);
+            setStreamedStats(event.data);
+        });
+        return () => es.close();
+    }, [refetch]);
     // Mock logs for now or pull from LogsView context if we lift state.
     // For MVP, let's just pass empty array or fetch logs if needed.
     // Actually, LogsView fetches its own logs. We should lift logs state or fetch here.
@@ -38,11 +55,19 @@ export function Dashboard() {
     }, []);
 
     const handleCreateRoute = async (data: Partial<RouteConfig>) => {
-        await fetch("/api/routes", {
+        const res = await fetch("/api/routes", {
             method: "POST",
             headers: { "Content-Type": "application/json" },
             body: JSON.stringify(data),
         });
+        if (!res.ok) {
+            // Validation errors and conflicts come as problem details, naming the fields at fault
+            if (res.headers.get("Content-Type")?.startsWith("application/problem+json")) {
+                const problem: Problem = await res.json();
+                throw new RouteSaveError(problem.errors?.map(e => `${e.path}: ${e.message}`) ?? [problem.title]);
+            }
+            throw new RouteSaveError([(await res.text()).trim() || res.statusText]);
+        }
         refetch();
     };
 
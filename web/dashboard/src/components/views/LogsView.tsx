@@ -48,7 +48,10 @@ export function LogsView() {
                         <span className={`uppercase font-bold shrink-0 w-16 ${log.level === 'ERROR' ? 'text-red-500' :
                             log.level === 'WARN' ? 'text-yellow-500' : 'text-blue-500'
                             }`}>{log.level}</span>
+                        {log.component && <span className="text-gray-500 shrink-0">{log.component}</span>}
                         <span className="text-gray-300 break-all">{log.message}</span>
+                        {log.attrs && <span className="text-gray-500 break-all">{Object.entries(log.attrs).map(([k, v]) => `${k}=${v}`).join(" ")}</span>}
+                        {log.request_id && <span className="text-gray-600 shrink-0">req={log.request_id}</span>}
                     </div>
                 ))}
             </div>
@@ -22,8 +22,8 @@ export function PatchingView() {
         setLoading(true);
         try {
             const [ingRes, routeRes] = await Promise.all([
-                fetch("/api/k8s/ingresses?namespace=smart-proxy-demo"),
-                fetch("/api/k8s/routes?namespace=smart-proxy-demo")
+                fetch("/api/k8s/ingresses"),
+                fetch("/api/k8s/routes")
             ]);
 
             const ingresses: PatchableResource[] = await ingRes.json();
@@ -49,7 +49,7 @@ export function PatchingView() {
     const patchResource = async (res: PatchableResource) => {
         const endpoint = res.type === "Route" ? "/api/patch-route" : "/api/patch-ingress";
         try {
-            await fetch(`${endpoint}?name=${res.name}`, {
+            await fetch(`${endpoint}?name=${res.name}&namespace=${res.namespace}`, {
                 method: "POST"
             });
             toast.success(`Successfully patched ${res.type} ${res.name}`);
@@ -62,7 +62,7 @@ export function PatchingView() {
     const unpatchResource = async (res: PatchableResource) => {
         const endpoint = res.type === "Route" ? "/api/unpatch-route" : "/api/unpatch-ingress";
         try {
-            await fetch(`${endpoint}?name=${res.name}`, {
+            await fetch(`${endpoint}?name=${res.name}&namespace=${res.namespace}`, {
                 method: "POST"
             });
             toast.success(`Restored original backend for ${res.name}`);
@@ -18,7 +18,7 @@ interface RouteDetailViewProps {
 
 export function RouteDetailView({ route, stats, logs, onBack, onEdit, onDelete, onStop }: RouteDetailViewProps) {
     const routeLogs = useMemo(() => {
-        return logs.filter(l => l.message.includes(route.deployment) || l.message.includes(route.path));
+        return logs.filter(l => l.route_id === route.id);
     }, [logs, route]);
 
     const requests = stats?.RouteStats[route.id] || 0;
@@ -129,7 +129,7 @@ export function RouteDetailView({ route, stats, logs, onBack, onEdit, onDelete,
                         routeLogs.map((l, i) => (
                             <div key={i} className="mb-1 border-b border-gray-900 pb-1 last:border-0 hover:bg-white/5 p-1 rounded">
                                 <span className="text-gray-500 mr-3">[{new Date(l.timestamp).toLocaleTimeString()}]</span>
-                                <span className={l.level === 'error' ? 'text-red-400' : 'text-gray-300'}>{l.message}</span>
+                                <span className={l.level === 'ERROR' ? 'text-red-400' : 'text-gray-300'}>{l.message}</span>
                             </div>
                         ))
                     )}
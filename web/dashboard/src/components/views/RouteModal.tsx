@@ -1,5 +1,6 @@
 import { useState, useEffect } from "react";
 import type { RouteConfig } from "@/types/api";
+import { RouteSaveError } from "@/types/api";
 import { Button } from "@/components/ui/Button";
 import { X, Plus, ArrowUp, ArrowDown } from "lucide-react";
 
@@ -28,10 +29,12 @@ export function RouteModal({ isOpen, onClose, onSubmit, initialData }: RouteModa
 
     const [deployments, setDeployments] = useState<string[]>([]);
     const [selectedDepToAdd, setSelectedDepToAdd] = useState("");
+    const [errors, setErrors] = useState<string[]>([]);
 
     // Reset form when opening
     useEffect(() => {
         if (isOpen) {
+            setErrors([]);
             if (initialData) {
                 setFormData(initialData);
                 // Load deployments for the namespace of the existing route
@@ -82,7 +85,13 @@ export function RouteModal({ isOpen, onClose, onSubmit, initialData }: RouteModa
 
     const handleSubmit = async (e: React.FormEvent) => {
         e.preventDefault();
-        await onSubmit(formData);
+        try {
+            await onSubmit(formData);
+        } catch (err) {
+            // The route was not saved: keep the modal open with the server's reasons
+            setErrors(err instanceof RouteSaveError ? err.messages : [String(err)]);
+            return;
+        }
         onClose();
     };
 
@@ -121,6 +130,11 @@ export function RouteModal({ isOpen, onClose, onSubmit, initialData }: RouteModa
                 </div>
 
                 <form onSubmit={handleSubmit} className="p-6 space-y-6">
+                    {errors.length > 0 && (
+                        <ul className="bg-red-900/40 border border-red-700 rounded-lg p-3 text-sm text-red-200 list-disc list-inside">
+                            {errors.map(message => <li key={message}>{message}</li>)}
+                        </ul>
+                    )}
                     <div className="grid grid-cols-2 gap-4">
                         <div>
                             <label className="block text-gray-400 text-sm mb-1">Host</label>
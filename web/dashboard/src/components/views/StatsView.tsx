@@ -1,44 +1,39 @@
-import { useState, useEffect } from "react";
-import { AreaChart, Area, XAxis, YAxis, CartesianGrid, Tooltip, ResponsiveContainer } from "recharts";
+import { useState } from "react";
+import { AreaChart, Area, LineChart, Line, XAxis, YAxis, CartesianGrid, Tooltip, ResponsiveContainer } from "recharts";
 import { Card, CardHeader, CardTitle, CardContent } from "@/components/ui/Card";
 import { Activity, Zap, Server } from "lucide-react";
-import type { StatsData } from "@/types/api";
+import { usePolling } from "@/hooks/usePolling";
+import type { StatsData, TimeseriesPoint } from "@/types/api";
 
+// Time ranges of the charts, served from the persisted time series
+const RANGES = {
+    "1h": { from: "-1h", step: "1m" },
+    "24h": { from: "-24h", step: "15m" },
+    "7d": { from: "-168h", step: "1h" },
+    "30d": { from: "-720h", step: "6h" },
+} as const;
 
-
-interface ChartPoint {
-    time: string;
-    requests: number;
-}
+type Range = keyof typeof RANGES;
 
 interface StatsViewProps {
     stats: StatsData | null;
 }
 
 export function StatsView({ stats }: StatsViewProps) {
-    // const { data: stats } = usePolling<StatsData>("/api/stats", 2000); // Lifted to Dashboard
-    const [history, setHistory] = useState<ChartPoint[]>([]);
-
-    // Accumulate history for the chart
-    useEffect(() => {
-        if (stats) {
-            setHistory(prev => {
-                const now = new Date();
-                const timeStr = now.toLocaleTimeString([], { hour12: false, hour: '2-digit', minute: '2-digit', second: '2-digit' });
-                const newPoint = { time: timeStr, requests: stats.TotalRequests };
+    const [range, setRange] = useState<Range>("1h");
+    const { from, step } = RANGES[range];
+    const { data: points } = usePolling<TimeseriesPoint[]>(`/api/stats/timeseries?from=${from}&step=${step}`, 30000);
 
-                // Keep last 20 points
-                const newHistory = [...prev, newPoint];
-                if (newHistory.length > 20) newHistory.shift();
-                return newHistory;
-            });
-        }
-    }, [stats]);
+    const history = (points || []).map(p => ({
+        ...p,
+        time: new Date(p.time).toLocaleString([], range === "1h" || range === "24h"
+            ? { hour12: false, hour: '2-digit', minute: '2-digit' }
+            : { month: 'short', day: 'numeric', hour12: false, hour: '2-digit' }),
+    }));
 
-    // Calculate RPS (approximate based on polling interval)
-    const rps = history.length > 1
-        ? (history[history.length - 1].requests - history[history.length - 2].requests) / 2
-        : 0;
+    // Requests per second over the last complete minute
+    const lastMinute = range === "1h" && history.length > 1 ? history[history.length - 2] : null;
+    const rps = lastMinute ? lastMinute.requests / 60 : 0;
 
     return (
         <div className="space-y-6">
@@ -62,7 +57,7 @@ export function StatsView({ stats }: StatsViewProps) {
                     <CardContent className="pt-6">
                         <div className="flex items-center justify-between">
                             <div>
-                                <p className="text-sm font-medium text-gray-400">Requests / Sec</p>
+                                <p className="text-sm font-medium text-gray-400">Requests / Sec (last minute)</p>
                                 <div className="text-3xl font-bold text-white mt-2">{rps.toFixed(1)}</div>
                             </div>
                             <div className="p-3 bg-green-500/10 rounded-xl">
@@ -90,8 +85,23 @@ export function StatsView({ stats }: StatsViewProps) {
             {/* Main Chart */}
             <Card className="col-span-1">
                 <CardHeader>
-                    <CardTitle>Traffic Overview</CardTitle>
-                    <p className="text-gray-400 text-sm">Real-time request processing (Growth)</p>
+                    <div className="flex items-center justify-between">
+                        <div>
+                            <CardTitle>Traffic Overview</CardTitle>
+                            <p className="text-gray-400 text-sm">Requests and 5xx errors per {step}</p>
+                        </div>
+                        <div className="flex gap-1">
+                            {(Object.keys(RANGES) as Range[]).map(r => (
+                                <button
+                                    key={r}
+                                    onClick={() => setRange(r)}
+                                    className={`px-3 py-1 rounded-md text-sm ${r === range ? "bg-blue-500/20 text-blue-300" : "text-gray-400 hover:text-white"}`}
+                                >
+                                    {r}
+                                </button>
+                            ))}
+                        </div>
+                    </div>
                 </CardHeader>
                 <CardContent>
                     <div className="h-[300px] w-full">
@@ -111,11 +121,33 @@ export function StatsView({ stats }: StatsViewProps) {
                                     itemStyle={{ color: '#60a5fa' }}
                                 />
                                 <Area type="monotone" dataKey="requests" stroke="#3b82f6" strokeWidth={2} fillOpacity={1} fill="url(#colorReq)" />
+                                <Area type="monotone" dataKey="errors" stroke="#ef4444" strokeWidth={2} fillOpacity={0} />
                             </AreaChart>
                         </ResponsiveContainer>
                     </div>
                 </CardContent>
             </Card>
+
+            <Card className="col-span-1">
+                <CardHeader>
+                    <CardTitle>Latency</CardTitle>
+                    <p className="text-gray-400 text-sm">Median and 95th percentile, in milliseconds</p>
+                </CardHeader>
+                <CardContent>
+                    <div className="h-[200px] w-full">
+                        <ResponsiveContainer width="100%" height="100%">
+                            <LineChart data={history}>
+                                <CartesianGrid strokeDasharray="3 3" stroke="#374151" vertical={false} />
+                                <XAxis dataKey="time" stroke="#9ca3af" fontSize={12} tickLine={false} axisLine={false} />
+                                <YAxis stroke="#9ca3af" fontSize={12} tickLine={false} axisLine={false} />
+                                <Tooltip contentStyle={{ backgroundColor: '#1f2937', borderColor: '#374151', color: '#fff' }} />
+                                <Line type="monotone" dataKey="p50_ms" name="p50" stroke="#22c55e" strokeWidth={2} dot={false} />
+                                <Line type="monotone" dataKey="p95_ms" name="p95" stroke="#f59e0b" strokeWidth={2} dot={false} />
+                            </LineChart>
+                        </ResponsiveContainer>
+                    </div>
+                </CardContent>
+            </Card>
         </div>
     );
 }
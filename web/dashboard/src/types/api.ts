@@ -24,12 +24,53 @@ export interface RouteStatus extends RouteConfig {
 
 export interface LogEntry {
     timestamp: string;
-    level: string;
+    level: string; // DEBUG, INFO, WARN or ERROR
     message: string;
-    component?: string;
+    component?: string; // proxy, watcher, admin, k8s, ...
+    route_id?: string;
+    request_id?: string;
+    attrs?: Record<string, unknown>;
+}
+
+export interface TimeseriesPoint {
+    time: string;
+    requests: number;
+    errors: number; // 5xx responses
+    p50_ms: number;
+    p95_ms: number;
+    state?: "ready" | "waking" | "failed" | "sleeping"; // Only for single-route queries
 }
 
 export interface StatsData {
     TotalRequests: number;
     RouteStats: Record<string, number>;
 }
+
+// An event of the /api/events stream; the SSE event name is its type.
+export interface StreamEvent<T = unknown> {
+    id?: number; // Absent for metrics snapshots
+    type: "route.created" | "route.updated" | "route.deleted" | "route.state" | "wake.progress" | "metrics";
+    time: string;
+    route_id?: string;
+    namespace?: string;
+    data?: T;
+}
+
+// An error answer of the admin API as problem details (application/problem+json).
+export interface Problem {
+    type: string;
+    title: string;
+    status: number;
+    detail?: string;
+    errors?: { path: string; message: string }[]; // The fields at fault, e.g. "dependencies[0].name"
+}
+
+// Thrown when the admin API refuses to save a route.
+export class RouteSaveError extends Error {
+    messages: string[];
+
+    constructor(messages: string[]) {
+        super(messages.join("; "));
+        this.messages = messages;
+    }
+}
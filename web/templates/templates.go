@@ -0,0 +1,8 @@
+// Package templates embeds the default pages served by the proxy: loading, wake failed, maintenance and
+// not found. Files with the same names in PAGE_TEMPLATES_DIR, or in a route's ConfigMap, override them.
+package templates
+
+import "embed"
+
+//go:embed *.html
+var FS embed.FS